@@ -0,0 +1,161 @@
+// Package atomicfile replaces files by writing a temporary file next to
+// them and renaming it into place, so that readers never see a partial
+// write even if the process dies or the disk fills up. Files that are
+// updated read-modify-write use git's <file>.lock protocol instead, which
+// also keeps concurrent writers out.
+package atomicfile
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// StaleLockAge is the age after which a lock is reported as probably
+// left behind by a crashed process.
+const StaleLockAge = 10 * time.Minute
+
+// LockedError is returned by Lock when another process holds the lock.
+type LockedError struct {
+	// Path is the lock file.
+	Path string
+	// Age is how long ago the lock was taken.
+	Age time.Duration
+}
+
+// Stale reports whether the lock is old enough to have been left behind.
+func (e *LockedError) Stale() bool {
+	return e.Age >= StaleLockAge
+}
+
+func (e *LockedError) Error() string {
+	msg := fmt.Sprintf("Unable to create '%s': File exists.\n\n", e.Path)
+	if e.Stale() {
+		return msg + fmt.Sprintf("The lock file is %s old, so the git process that created it\n"+
+			"has probably crashed. If no other git process is running,\n"+
+			"remove the file manually to continue.", e.Age.Round(time.Second))
+	}
+	return msg + "Another git process seems to be running in this repository, e.g.\n" +
+		"an editor opened by 'git commit'. Please make sure all processes\n" +
+		"are terminated then try again. If it still fails, a git process\n" +
+		"may have crashed in this repository earlier:\n" +
+		"remove the file manually to continue."
+}
+
+// File is a temporary file that replaces its destination when committed.
+type File struct {
+	*os.File
+
+	sync bool
+	// done is set once the file is committed or aborted.
+	done bool
+}
+
+// CreateTemp creates a temporary file in dir, named from pattern as by
+// os.CreateTemp. With sync set, Commit flushes the data and the rename
+// to disk before returning.
+func CreateTemp(dir, pattern string, sync bool) (*File, error) {
+	f, err := os.CreateTemp(dir, pattern)
+	if err != nil {
+		return nil, err
+	}
+	return &File{File: f, sync: sync}, nil
+}
+
+// Lock takes the lock on path by creating path.lock exclusively, as
+// git does, retrying for up to timeout while another process holds it;
+// a negative timeout waits indefinitely. Writing the File and
+// committing it to path replaces path; aborting it releases the lock.
+func Lock(path string, timeout time.Duration, sync bool) (*File, error) {
+	lockPath := path + ".lock"
+	deadline := time.Now().Add(timeout)
+	backoff := time.Millisecond
+	for {
+		f, err := os.OpenFile(lockPath, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+		if err == nil {
+			return &File{File: f, sync: sync}, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, fmt.Errorf("Unable to create '%s': %w", lockPath, err)
+		}
+
+		remaining := time.Until(deadline)
+		if timeout < 0 {
+			remaining = time.Second
+		} else if remaining <= 0 {
+			lockErr := &LockedError{Path: lockPath}
+			if abs, err := filepath.Abs(lockPath); err == nil {
+				lockErr.Path = abs
+			}
+			if info, err := os.Stat(lockPath); err == nil {
+				lockErr.Age = time.Since(info.ModTime())
+			}
+			return nil, lockErr
+		}
+		time.Sleep(min(backoff, remaining))
+		backoff = min(2*backoff, time.Second)
+	}
+}
+
+// Commit gives the file mode perm, closes it and renames it to path.
+func (f *File) Commit(path string, perm os.FileMode) error {
+	if f.sync {
+		if err := f.File.Sync(); err != nil {
+			return err
+		}
+	}
+	if err := f.Chmod(perm); err != nil {
+		return err
+	}
+	if err := f.File.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		return err
+	}
+	f.done = true
+	if f.sync {
+		return syncDir(filepath.Dir(path))
+	}
+	return nil
+}
+
+// Abort removes the file, releasing the lock if it is one, unless it
+// was committed or already aborted. It is meant to be deferred right
+// after CreateTemp or Lock.
+func (f *File) Abort() {
+	if f.done {
+		return
+	}
+	f.done = true
+	f.File.Close()
+	os.Remove(f.Name())
+}
+
+// WriteFile atomically replaces path with data, creating it with mode
+// perm. With sync set the new content is on disk when it returns.
+func WriteFile(path string, data []byte, perm os.FileMode, sync bool) error {
+	f, err := CreateTemp(filepath.Dir(path), "tmp_"+filepath.Base(path)+"_", sync)
+	if err != nil {
+		return err
+	}
+	defer f.Abort()
+
+	if _, err := f.Write(data); err != nil {
+		return err
+	}
+	return f.Commit(path, perm)
+}
+
+// syncDir flushes the directory entries of dir, making a rename into it
+// durable.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
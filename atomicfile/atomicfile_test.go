@@ -0,0 +1,111 @@
+package atomicfile
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLock(t *testing.T) {
+	tests := []struct {
+		name string
+		// held creates path.lock before locking.
+		held bool
+		// release removes a held lock after the given delay.
+		release time.Duration
+		timeout time.Duration
+		wantErr bool
+	}{
+		{"free", false, 0, 0, false},
+		{"held", true, 0, 0, true},
+		{"held past timeout", true, 0, 20 * time.Millisecond, true},
+		{"released while waiting", true, 10 * time.Millisecond, time.Second, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config")
+			if err := os.WriteFile(path, []byte("old"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if tt.held {
+				if err := os.WriteFile(path+".lock", nil, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.release > 0 {
+				time.AfterFunc(tt.release, func() { os.Remove(path + ".lock") })
+			}
+
+			lock, err := Lock(path, tt.timeout, false)
+			if tt.wantErr {
+				var lockErr *LockedError
+				if !errors.As(err, &lockErr) {
+					t.Fatalf("Lock error = %v, want a LockedError", err)
+				}
+				if _, err := os.Stat(path + ".lock"); err != nil {
+					t.Errorf("someone else's lock was removed: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := lock.WriteString("new"); err != nil {
+				t.Fatal(err)
+			}
+			if err := lock.Commit(path, 0644); err != nil {
+				t.Fatal(err)
+			}
+			lock.Abort()
+			if data, _ := os.ReadFile(path); string(data) != "new" {
+				t.Errorf("content = %q after commit, want %q", data, "new")
+			}
+			if _, err := os.Stat(path + ".lock"); !os.IsNotExist(err) {
+				t.Errorf("lock survived the commit: %v", err)
+			}
+		})
+	}
+}
+
+func TestAbortKeepsOriginal(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "HEAD")
+	if err := os.WriteFile(path, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	lock, err := Lock(path, 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lock.WriteString("new")
+	lock.Abort()
+	lock.Abort()
+
+	if data, _ := os.ReadFile(path); string(data) != "old" {
+		t.Errorf("content = %q after abort, want %q", data, "old")
+	}
+	if _, err := os.Stat(path + ".lock"); !os.IsNotExist(err) {
+		t.Errorf("lock survived the abort: %v", err)
+	}
+}
+
+func TestWriteFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "file")
+	for _, content := range []string{"first", "second, longer", ""} {
+		if err := WriteFile(path, []byte(content), 0444, true); err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil || string(data) != content {
+			t.Fatalf("content = %q, %v; want %q", data, err, content)
+		}
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0444 {
+		t.Errorf("mode = %v, %v; want 0444", info.Mode(), err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("%d files left in the directory, want 1", len(entries))
+	}
+}
@@ -0,0 +1,386 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/refs"
+
+	"gopkg.in/ini.v1"
+)
+
+// listBranches prints the local branches, marking the current one. With
+// verbose set it also shows each branch's commit, how far it is ahead of
+// or behind its upstream, and the commit subject.
+func listBranches(verbose bool) error {
+	branches, err := listRefs("refs/heads/")
+	if err != nil {
+		return err
+	}
+	head, err := headBranch()
+	if err != nil {
+		return err
+	}
+
+	type branchLine struct {
+		name, ref, hash string
+		current         bool
+	}
+	var lines []branchLine
+	if head == "" {
+		if hash, err := resolveRef("HEAD"); err == nil {
+			lines = append(lines, branchLine{name: fmt.Sprintf("(HEAD detached at %s)", hash[:7]), hash: hash, current: true})
+		}
+	}
+	names := make([]string, 0, len(branches))
+	for ref := range branches {
+		names = append(names, ref)
+	}
+	sort.Strings(names)
+	for _, ref := range names {
+		lines = append(lines, branchLine{
+			name:    strings.TrimPrefix(ref, "refs/heads/"),
+			ref:     ref,
+			hash:    branches[ref],
+			current: ref == head,
+		})
+	}
+
+	width := 0
+	for _, line := range lines {
+		width = max(width, len(line.name))
+	}
+	for _, line := range lines {
+		marker := " "
+		if line.current {
+			marker = "*"
+		}
+		if !verbose {
+			fmt.Printf("%s %s\n", marker, line.name)
+			continue
+		}
+
+		tracking := ""
+		if line.ref != "" {
+			if tracking, err = trackingInfo(strings.TrimPrefix(line.ref, "refs/heads/"), line.hash); err != nil {
+				return err
+			}
+		}
+		fmt.Printf("%s %-*s %s %s%s\n", marker, width, line.name, line.hash[:7], tracking, commitSubject(line.hash))
+	}
+	return nil
+}
+
+// trackingInfo describes how the branch at hash relates to its upstream,
+// e.g. "[ahead 1, behind 2] ", or "" if it has none or is up to date.
+func trackingInfo(branch, hash string) (string, error) {
+	upstream, err := branchUpstream(branch)
+	if err != nil || upstream == "" {
+		return "", err
+	}
+	upstreamHash, err := resolveRef(upstream)
+	if errors.Is(err, refs.ErrNotFound) {
+		return "[gone] ", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	ahead, behind, err := aheadBehind(hash, upstreamHash)
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case ahead > 0 && behind > 0:
+		return fmt.Sprintf("[ahead %d, behind %d] ", ahead, behind), nil
+	case ahead > 0:
+		return fmt.Sprintf("[ahead %d] ", ahead), nil
+	case behind > 0:
+		return fmt.Sprintf("[behind %d] ", behind), nil
+	}
+	return "", nil
+}
+
+// branchUpstream returns the local ref tracking the upstream of branch,
+// as set by branch.<name>.remote and branch.<name>.merge, or "" if it
+// has none.
+func branchUpstream(branch string) (string, error) {
+	cfg, err := loadConfig()
+	if err != nil {
+		return "", err
+	}
+	section, err := cfg.GetSection(configSubsection("branch", branch))
+	if err != nil {
+		return "", nil
+	}
+	remote, merge := section.Key("remote").String(), section.Key("merge").String()
+	if remote == "" || merge == "" {
+		return "", nil
+	}
+	if remote == "." {
+		return merge, nil
+	}
+
+	_, specs, err := remoteURL(remote)
+	if err != nil {
+		return "", err
+	}
+	for _, s := range specs {
+		spec, err := parseRefspec(s)
+		if err != nil {
+			return "", err
+		}
+		if dst, ok := spec.MatchSrc(merge); ok && dst != "" {
+			return dst, nil
+		}
+	}
+	return "", nil
+}
+
+// createBranch creates the branch name at the commit start names, or at
+// HEAD if start is empty. Branches started from a remote-tracking branch
+// track it, as with git's default branch.autoSetupMerge.
+func createBranch(name, start string) error {
+	ref := "refs/heads/" + name
+	if !refs.ValidName(ref) {
+		return fmt.Errorf("'%s' is not a valid branch name", name)
+	}
+	if _, err := resolveRef(ref); err == nil {
+		return fmt.Errorf("a branch named '%s' already exists", name)
+	}
+
+	if start == "" {
+		start = "HEAD"
+	}
+	hash, err := resolveCommit(start)
+	if err != nil {
+		return err
+	}
+	f, err := objectFormat()
+	if err != nil {
+		return err
+	}
+	if err := updateRef(ref, f.ZeroID(), hash, "branch: Created from "+start); err != nil {
+		return err
+	}
+
+	if startRef, _, err := dwimRef(start); err == nil && strings.HasPrefix(startRef, "refs/remotes/") {
+		return setUpstream(name, startRef)
+	}
+	return nil
+}
+
+// deleteBranch deletes the branch name. Unless force is set the branch
+// must be merged into its upstream, or into HEAD if it has none.
+func deleteBranch(name string, force bool) error {
+	ref := "refs/heads/" + name
+	hash, err := resolveRef(ref)
+	if errors.Is(err, refs.ErrNotFound) {
+		return fmt.Errorf("branch '%s' not found", name)
+	}
+	if err != nil {
+		return err
+	}
+	if head, err := headBranch(); err == nil && head == ref {
+		return fmt.Errorf("cannot delete branch '%s' checked out", name)
+	}
+
+	if !force {
+		into := "HEAD"
+		upstream, err := branchUpstream(name)
+		if err != nil {
+			return err
+		}
+		if upstream != "" {
+			into = upstream
+		}
+		merged := false
+		if tip, err := resolveRef(into); err == nil {
+			if merged, err = isAncestor(hash, tip); err != nil {
+				return err
+			}
+		}
+		if !merged {
+			return fmt.Errorf("the branch '%s' is not fully merged; use -D to delete it anyway", name)
+		}
+	}
+
+	if err := removeBranch(name, hash); err != nil {
+		return err
+	}
+
+	fmt.Printf("Deleted branch %s (was %s).\n", name, hash[:7])
+	return nil
+}
+
+// removeBranch deletes the branch name, which must be at hash, together
+// with its config.
+func removeBranch(name, hash string) error {
+	store, err := refStore()
+	if err != nil {
+		return err
+	}
+	tx := store.Transaction()
+	tx.Delete("refs/heads/"+name, hash)
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	return renameBranchConfig(name, "")
+}
+
+// renameBranch renames the branch oldName, or the current branch if it
+// is empty, to newName, together with its reflog and config. HEAD
+// follows the branch if it is checked out.
+func renameBranch(oldName, newName string) error {
+	head, err := headBranch()
+	if err != nil {
+		return err
+	}
+	if oldName == "" {
+		if head == "" {
+			return fmt.Errorf("cannot rename the current branch while not on any")
+		}
+		oldName = strings.TrimPrefix(head, "refs/heads/")
+	}
+	oldRef, newRef := "refs/heads/"+oldName, "refs/heads/"+newName
+	if !refs.ValidName(newRef) {
+		return fmt.Errorf("'%s' is not a valid branch name", newName)
+	}
+	if _, err := resolveRef(newRef); err == nil {
+		return fmt.Errorf("a branch named '%s' already exists", newName)
+	}
+
+	store, err := refStore()
+	if err != nil {
+		return err
+	}
+	tx := store.Transaction()
+	if head == oldRef {
+		tx.SetSymbolic("HEAD", newRef)
+	}
+
+	var oldLog, newLog string
+	movedLog := false
+	hash, err := resolveRef(oldRef)
+	switch {
+	case errors.Is(err, refs.ErrNotFound) && oldRef == head:
+		// An unborn branch only lives in HEAD.
+	case errors.Is(err, refs.ErrNotFound):
+		return fmt.Errorf("no branch named '%s'", oldName)
+	case err != nil:
+		return err
+	default:
+		// The reflog moves first so that the rename is logged after the
+		// branch's history, and moves back if the refs cannot be updated.
+		oldLog = filepath.Join(".git", "logs", filepath.FromSlash(oldRef))
+		newLog = filepath.Join(".git", "logs", filepath.FromSlash(newRef))
+		if _, err := os.Stat(oldLog); err == nil {
+			if err := os.MkdirAll(filepath.Dir(newLog), 0755); err != nil {
+				return fmt.Errorf("error moving reflog: %w", err)
+			}
+			if err := os.Rename(oldLog, newLog); err != nil {
+				return fmt.Errorf("error moving reflog: %w", err)
+			}
+			movedLog = true
+		}
+
+		tx.SetReflog(reflogIdentity(), fmt.Sprintf("Branch: renamed %s to %s", oldRef, newRef))
+		tx.Update(newRef, store.Format().ZeroID(), hash)
+		tx.Delete(oldRef, hash)
+	}
+
+	if err := tx.Commit(); err != nil {
+		if movedLog {
+			os.Rename(newLog, oldLog)
+		}
+		return err
+	}
+	if movedLog {
+		removeEmptyLogDirs(oldRef)
+	}
+	return renameBranchConfig(oldName, newName)
+}
+
+// removeEmptyLogDirs removes the now empty directories the reflog of
+// the branch ref lived in.
+func removeEmptyLogDirs(ref string) {
+	dir := filepath.Dir(filepath.Join(".git", "logs", filepath.FromSlash(ref)))
+	for dir != filepath.Join(".git", "logs", "refs", "heads") && os.Remove(dir) == nil {
+		dir = filepath.Dir(dir)
+	}
+}
+
+// renameBranchConfig moves the branch.<oldName> config section to
+// branch.<newName>, or drops it if newName is empty.
+func renameBranchConfig(oldName, newName string) error {
+	return updateConfig(func(cfg *ini.File) error {
+		section, err := cfg.GetSection(configSubsection("branch", oldName))
+		if err != nil {
+			return nil
+		}
+		if newName != "" {
+			renamed := cfg.Section(configSubsection("branch", newName))
+			for _, key := range section.Keys() {
+				renamed.Key(key.Name()).SetValue(key.String())
+			}
+		}
+		cfg.DeleteSection(section.Name())
+		return nil
+	})
+}
+
+// setUpstream makes branch track upstream, a local or remote-tracking
+// branch, by setting branch.<name>.remote and branch.<name>.merge.
+func setUpstream(branch, upstream string) error {
+	ref, _, err := dwimRef(upstream)
+	if errors.Is(err, refs.ErrNotFound) {
+		return fmt.Errorf("the requested upstream branch '%s' does not exist", upstream)
+	}
+	if err != nil {
+		return err
+	}
+	err = updateConfig(func(cfg *ini.File) error {
+		remote, merge := "", ""
+		if strings.HasPrefix(ref, "refs/heads/") {
+			remote, merge = ".", ref
+		} else if strings.HasPrefix(ref, "refs/remotes/") {
+			// Find the remote whose fetch refspecs map a remote ref to it.
+			for _, section := range cfg.Sections() {
+				name, ok := strings.CutPrefix(section.Name(), `remote "`)
+				if !ok || !section.HasKey("fetch") {
+					continue
+				}
+				for _, s := range section.Key("fetch").ValueWithShadows() {
+					spec, err := parseRefspec(s)
+					if err != nil {
+						return err
+					}
+					if src, ok := spec.MatchDst(ref); ok {
+						remote, merge = strings.TrimSuffix(name, `"`), src
+						break
+					}
+				}
+				if merge != "" {
+					break
+				}
+			}
+		}
+		if merge == "" {
+			return fmt.Errorf("cannot set up tracking information; starting point '%s' is not a branch", upstream)
+		}
+
+		section := cfg.Section(configSubsection("branch", branch))
+		section.Key("remote").SetValue(remote)
+		section.Key("merge").SetValue(merge)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("branch '%s' set up to track '%s'.\n", branch, shortRefName(ref))
+	return nil
+}
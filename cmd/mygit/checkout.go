@@ -0,0 +1,272 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/index"
+	"github.com/codecrafters-io/git-starter-go/refs"
+)
+
+// headState is where HEAD is before a switch: a branch, possibly
+// unborn, or a detached commit.
+type headState struct {
+	Branch string
+	Hash   string
+}
+
+func readHeadState() (headState, error) {
+	branch, err := headBranch()
+	if err != nil {
+		return headState{}, err
+	}
+	hash, err := resolveRef("HEAD")
+	if err != nil && !errors.Is(err, refs.ErrNotFound) {
+		return headState{}, err
+	}
+	return headState{Branch: branch, Hash: hash}, nil
+}
+
+// describe names the position for the HEAD reflog, the way git's
+// @{-N} syntax later reads it back.
+func (h headState) describe() string {
+	if h.Branch != "" {
+		return strings.TrimPrefix(h.Branch, "refs/heads/")
+	}
+	return h.Hash
+}
+
+// checkoutCommit moves the index and working tree from the commit HEAD
+// is at to commit, refusing to overwrite local changes. An empty commit
+// stands for the empty tree.
+func checkoutCommit(head headState, commit string) error {
+	oldTree, err := commitTree(head.Hash)
+	if err != nil {
+		return err
+	}
+	newTree, err := commitTree(commit)
+	if err != nil {
+		return err
+	}
+	return updateIndex(func(idx *index.Index) error {
+		return switchWorktree(idx, oldTree, newTree)
+	})
+}
+
+func commitTree(hash string) (string, error) {
+	if hash == "" {
+		return "", nil
+	}
+	commit, err := readCommit(hash)
+	if err != nil {
+		return "", err
+	}
+	return commit.Tree, nil
+}
+
+// moveHead points HEAD at branch, or detaches it at hash if branch is
+// empty, and records the move in the HEAD reflog.
+func moveHead(from headState, branch, hash, to string) error {
+	store, err := refStore()
+	if err != nil {
+		return err
+	}
+	tx := store.Transaction()
+	tx.SetReflog(reflogIdentity(), fmt.Sprintf("checkout: moving from %s to %s", from.describe(), to))
+	if branch != "" {
+		tx.SetSymbolic("HEAD", branch)
+	} else {
+		tx.Update("HEAD", "", hash)
+	}
+	return tx.Commit()
+}
+
+// printPreviousHead tells where a detached HEAD was before it moved
+// away, as git does.
+func printPreviousHead(from headState, hash string) {
+	if from.Branch == "" && from.Hash != "" && from.Hash != hash {
+		fmt.Printf("Previous HEAD position was %s %s\n", from.Hash[:7], commitSubject(from.Hash))
+	}
+}
+
+func commitSubject(hash string) string {
+	commit, err := readCommit(hash)
+	if err != nil {
+		return ""
+	}
+	subject, _, _ := strings.Cut(strings.TrimSpace(commit.Message), "\n")
+	return subject
+}
+
+// switchBranch checks out the local branch name, which may be "-" for
+// the previous branch. If there is none, a unique remote-tracking branch
+// of that name is used to start one.
+func switchBranch(name string) error {
+	name, err := expandPreviousBranch(name)
+	if err != nil {
+		return err
+	}
+	ref := "refs/heads/" + name
+	hash, err := resolveRef(ref)
+	if errors.Is(err, refs.ErrNotFound) {
+		if remoteRef := guessRemoteBranch(name); remoteRef != "" {
+			return switchNewBranch(name, remoteRef)
+		}
+		if _, err := resolveCommit(name); err == nil {
+			return fmt.Errorf("a branch is expected, got '%s'; use --detach to check out a commit", name)
+		}
+		return fmt.Errorf("invalid reference: %s", name)
+	}
+	if err != nil {
+		return err
+	}
+
+	head, err := readHeadState()
+	if err != nil {
+		return err
+	}
+	if head.Branch == ref {
+		fmt.Printf("Already on '%s'\n", name)
+		return nil
+	}
+	if err := checkoutCommit(head, hash); err != nil {
+		return err
+	}
+	if err := moveHead(head, ref, hash, name); err != nil {
+		return err
+	}
+	printPreviousHead(head, hash)
+	fmt.Printf("Switched to branch '%s'\n", name)
+	return nil
+}
+
+// switchNewBranch creates the branch name at start, or at HEAD if start
+// is empty, and checks it out.
+func switchNewBranch(name, start string) error {
+	ref := "refs/heads/" + name
+	if !refs.ValidName(ref) {
+		return fmt.Errorf("'%s' is not a valid branch name", name)
+	}
+	if _, err := resolveRef(ref); err == nil {
+		return fmt.Errorf("a branch named '%s' already exists", name)
+	}
+	head, err := readHeadState()
+	if err != nil {
+		return err
+	}
+	if start == "" && head.Hash == "" {
+		// Nothing to branch from yet: the new branch is unborn too.
+		return switchOrphan(name)
+	}
+
+	hash := head.Hash
+	if start != "" {
+		if hash, err = resolveCommit(start); err != nil {
+			return err
+		}
+	}
+	// The branch comes first so that a failure to create it leaves the
+	// working tree alone; a failed checkout takes the branch back out.
+	if err := createBranch(name, start); err != nil {
+		return err
+	}
+	if err := checkoutCommit(head, hash); err != nil {
+		if rerr := removeBranch(name, hash); rerr != nil {
+			return fmt.Errorf("%w; error removing branch '%s': %v", err, name, rerr)
+		}
+		return err
+	}
+	if err := moveHead(head, ref, hash, name); err != nil {
+		return err
+	}
+	printPreviousHead(head, hash)
+	fmt.Printf("Switched to a new branch '%s'\n", name)
+	return nil
+}
+
+// switchOrphan points HEAD at the unborn branch name and empties the
+// index and working tree of tracked files.
+func switchOrphan(name string) error {
+	ref := "refs/heads/" + name
+	if !refs.ValidName(ref) {
+		return fmt.Errorf("'%s' is not a valid branch name", name)
+	}
+	if _, err := resolveRef(ref); err == nil {
+		return fmt.Errorf("a branch named '%s' already exists", name)
+	}
+	head, err := readHeadState()
+	if err != nil {
+		return err
+	}
+	if err := checkoutCommit(head, ""); err != nil {
+		return err
+	}
+	if err := moveHead(head, ref, "", name); err != nil {
+		return err
+	}
+	fmt.Printf("Switched to a new branch '%s'\n", name)
+	return nil
+}
+
+// detachHead checks out the commit rev names with HEAD detached.
+func detachHead(rev string) error {
+	hash, err := resolveCommit(rev)
+	if err != nil {
+		return err
+	}
+	head, err := readHeadState()
+	if err != nil {
+		return err
+	}
+	if err := checkoutCommit(head, hash); err != nil {
+		return err
+	}
+	if err := moveHead(head, "", hash, rev); err != nil {
+		return err
+	}
+	printPreviousHead(head, hash)
+	fmt.Printf("HEAD is now at %s %s\n", hash[:7], commitSubject(hash))
+	return nil
+}
+
+// checkoutRevision is checkout's reading of a single argument: a local
+// branch, else any commit with HEAD detached, else a remote branch to
+// start a local one from.
+func checkoutRevision(rev string) error {
+	rev, err := expandPreviousBranch(rev)
+	if err != nil {
+		return err
+	}
+	if _, err := resolveRef("refs/heads/" + rev); err == nil {
+		return switchBranch(rev)
+	}
+	if _, err := resolveCommit(rev); err == nil {
+		return detachHead(rev)
+	}
+	if remoteRef := guessRemoteBranch(rev); remoteRef != "" {
+		return switchNewBranch(rev, remoteRef)
+	}
+	return fmt.Errorf("invalid reference: %s", rev)
+}
+
+// guessRemoteBranch returns refs/remotes/<remote>/<name> if exactly one
+// remote has a branch called name.
+func guessRemoteBranch(name string) string {
+	remoteRefs, err := listRefs("refs/remotes/")
+	if err != nil {
+		return ""
+	}
+	match := ""
+	for ref := range remoteRefs {
+		remote, branch, ok := strings.Cut(strings.TrimPrefix(ref, "refs/remotes/"), "/")
+		if !ok || branch != name || remote == "" {
+			continue
+		}
+		if match != "" {
+			return ""
+		}
+		match = ref
+	}
+	return match
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/atomicfile"
+	"github.com/codecrafters-io/git-starter-go/object"
+	"github.com/codecrafters-io/git-starter-go/transport"
+
+	"gopkg.in/ini.v1"
+)
+
+// cloneDirName derives the checkout directory from a repository URL,
+// e.g. https://host/user/repo.git -> repo.
+func cloneDirName(url string) string {
+	name := path.Base(strings.TrimSuffix(strings.TrimSuffix(url, "/"), "/.git"))
+	return strings.TrimSuffix(name, ".git")
+}
+
+// cloneOptions limits what a clone downloads.
+type cloneOptions struct {
+	Depth int
+}
+
+func cloneRepository(url, dir string, opts cloneOptions) (err error) {
+	entries, statErr := os.ReadDir(dir)
+	if statErr == nil && len(entries) > 0 {
+		return fmt.Errorf("destination path '%s' already exists and is not an empty directory", dir)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("error creating directory: %w", err)
+	}
+
+	// Like git, don't leave a half-cloned repository behind.
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	parent, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err == nil {
+			return
+		}
+		os.Chdir(parent)
+		if os.IsNotExist(statErr) {
+			os.RemoveAll(absDir)
+		} else {
+			os.RemoveAll(filepath.Join(absDir, ".git"))
+		}
+	}()
+
+	if err := os.Chdir(dir); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Cloning into '%s'...\n", dir)
+
+	client := transport.NewClient(url)
+	client.Progress = os.Stderr
+
+	adv, err := client.Discover(transport.UploadPackService)
+	if err != nil {
+		return err
+	}
+	format, err := adv.ObjectFormat()
+	if err != nil {
+		return err
+	}
+	if err := initRepository(format); err != nil {
+		return err
+	}
+
+	const remote = "origin"
+	err = updateConfig(func(cfg *ini.File) error {
+		core := cfg.Section("core")
+		if format == object.SHA1 {
+			core.Key("repositoryformatversion").SetValue("0")
+		}
+		core.Key("filemode").SetValue("true")
+		core.Key("bare").SetValue("false")
+		remoteSection := cfg.Section(configSubsection("remote", remote))
+		remoteSection.Key("url").SetValue(url)
+		remoteSection.Key("fetch").SetValue(fmt.Sprintf("+refs/heads/*:refs/remotes/%s/*", remote))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	refs, err := client.ListRefs(adv, "HEAD", "refs/heads/", "refs/tags/")
+	if err != nil {
+		return err
+	}
+
+	var wants []string
+	seen := make(map[string]bool)
+	for _, ref := range refs {
+		if !strings.HasPrefix(ref.Name, "refs/heads/") && !strings.HasPrefix(ref.Name, "refs/tags/") {
+			continue
+		}
+		if !seen[ref.Hash] {
+			seen[ref.Hash] = true
+			wants = append(wants, ref.Hash)
+		}
+	}
+	if len(wants) == 0 {
+		// Point HEAD at the remote's unborn default branch, if known.
+		if head := transport.DefaultBranch(refs); head != "" {
+			if err := writeSymbolicRef("HEAD", head); err != nil {
+				return err
+			}
+		}
+		fmt.Fprintf(os.Stderr, "warning: You appear to have cloned an empty repository.\n")
+		return nil
+	}
+
+	result, err := client.FetchPack(adv, transport.FetchRequest{Wants: wants, Depth: opts.Depth})
+	if err != nil {
+		return err
+	}
+	defer result.Pack.Close()
+
+	store, err := objectStore()
+	if err != nil {
+		return err
+	}
+	if _, err := store.Packs.WritePack(result.Pack); err != nil {
+		return err
+	}
+	if err := writeShallow(result.Shallow); err != nil {
+		return err
+	}
+
+	refsStore, err := refStore()
+	if err != nil {
+		return err
+	}
+	tx := refsStore.Transaction()
+	tx.SetReflog(reflogIdentity(), "clone: from "+url)
+	for _, ref := range refs {
+		var name string
+		switch {
+		case strings.HasPrefix(ref.Name, "refs/heads/"):
+			name = fmt.Sprintf("refs/remotes/%s/%s", remote, strings.TrimPrefix(ref.Name, "refs/heads/"))
+		case strings.HasPrefix(ref.Name, "refs/tags/"):
+			name = ref.Name
+		default:
+			continue
+		}
+		tx.Update(name, "", ref.Hash)
+	}
+
+	head := transport.DefaultBranch(refs)
+	headRef, ok := transport.FindRef(refs, head)
+	if !ok {
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "warning: remote HEAD refers to nonexistent ref, unable to checkout\n")
+		return nil
+	}
+	branch := strings.TrimPrefix(head, "refs/heads/")
+
+	tx.Update(head, "", headRef.Hash)
+	tx.SetSymbolic("HEAD", head)
+	tx.SetSymbolic(fmt.Sprintf("refs/remotes/%s/HEAD", remote), fmt.Sprintf("refs/remotes/%s/%s", remote, branch))
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	err = updateConfig(func(cfg *ini.File) error {
+		branchSection := cfg.Section(configSubsection("branch", branch))
+		branchSection.Key("remote").SetValue(remote)
+		branchSection.Key("merge").SetValue(head)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	_, content, err := readObject(headRef.Hash)
+	if err != nil {
+		return err
+	}
+	commit, err := object.ParseCommit(content)
+	if err != nil {
+		return fmt.Errorf("error parsing commit %s: %w", headRef.Hash, err)
+	}
+	idx, err := checkoutTree(commit.Tree)
+	if err != nil {
+		return fmt.Errorf("error checking out %s: %w", branch, err)
+	}
+	return writeIndex(idx)
+}
+
+// readShallow returns the shallow boundary commits from .git/shallow.
+func readShallow() ([]string, error) {
+	data, err := os.ReadFile(".git/shallow")
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading shallow file: %w", err)
+	}
+	return strings.Fields(string(data)), nil
+}
+
+// shallowSet returns the shallow boundary commits as a set.
+func shallowSet() (map[string]bool, error) {
+	hashes, err := readShallow()
+	if err != nil {
+		return nil, err
+	}
+	set := make(map[string]bool, len(hashes))
+	for _, hash := range hashes {
+		set[hash] = true
+	}
+	return set, nil
+}
+
+// writeShallow records the shallow boundary commits in .git/shallow,
+// removing the file once the repository is complete.
+func writeShallow(hashes []string) error {
+	if len(hashes) == 0 {
+		if err := os.Remove(".git/shallow"); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("error removing shallow file: %w", err)
+		}
+		return nil
+	}
+	var buf strings.Builder
+	for _, hash := range hashes {
+		buf.WriteString(hash + "\n")
+	}
+	sync, err := shouldFsync(fsyncReference)
+	if err != nil {
+		return err
+	}
+	if err := atomicfile.WriteFile(".git/shallow", []byte(buf.String()), 0644, sync); err != nil {
+		return fmt.Errorf("error writing shallow file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/codecrafters-io/git-starter-go/atomicfile"
+	"github.com/codecrafters-io/git-starter-go/pack"
+
+	"gopkg.in/ini.v1"
+)
+
+func init() {
+	ini.PrettyFormat = false
+	ini.PrettyEqual = true
+}
+
+// loadConfig reads .git/config. Multi-valued keys such as
+// remote.<name>.fetch are kept as shadows.
+func loadConfig() (*ini.File, error) {
+	configPath := filepath.Join(".git", "config")
+	if _, err := os.Stat(configPath); os.IsNotExist(err) {
+		return ini.Empty(ini.LoadOptions{AllowShadows: true}), nil
+	}
+
+	cfg, err := ini.LoadSources(ini.LoadOptions{AllowShadows: true}, configPath)
+	if err != nil {
+		return nil, fmt.Errorf("error reading .git/config: %w", err)
+	}
+	return cfg, nil
+}
+
+// updateConfig applies fn to .git/config while holding config.lock.
+// The config is read only once the lock is held, so concurrent edits
+// are never lost, and fn's changes are written back through the lock.
+func updateConfig(fn func(cfg *ini.File) error) error {
+	configPath := filepath.Join(".git", "config")
+	lock, err := atomicfile.Lock(configPath, 0, false)
+	if err != nil {
+		return fmt.Errorf("error locking .git/config: %w", err)
+	}
+	defer lock.Abort()
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	if err := fn(cfg); err != nil {
+		return err
+	}
+	if _, err := cfg.WriteToIndent(lock, "\t"); err != nil {
+		return fmt.Errorf("error writing .git/config: %w", err)
+	}
+	if err := lock.Commit(configPath, 0644); err != nil {
+		return fmt.Errorf("error writing .git/config: %w", err)
+	}
+	return nil
+}
+
+// configValue looks key up in section ignoring case, as git does for
+// variable names.
+func configValue(section *ini.Section, key string) string {
+	for _, k := range section.Keys() {
+		if strings.EqualFold(k.Name(), key) {
+			return k.String()
+		}
+	}
+	return ""
+}
+
+// configBool is configValue for boolean variables, false if unset.
+func configBool(section *ini.Section, key string) bool {
+	for _, k := range section.Keys() {
+		if strings.EqualFold(k.Name(), key) {
+			return k.MustBool(false)
+		}
+	}
+	return false
+}
+
+// lockTimeout returns how long to retry a lock held by another process,
+// from core.<key> in milliseconds or def if unset. Negative values wait
+// indefinitely.
+func lockTimeout(key string, def time.Duration) (time.Duration, error) {
+	cfg, err := loadConfig()
+	if err != nil {
+		return 0, err
+	}
+	value := configValue(cfg.Section("core"), key)
+	if value == "" {
+		return def, nil
+	}
+	ms, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("bad numeric config value '%s' for 'core.%s'", value, key)
+	}
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
+// configSize parses a git size such as "512m", with an optional k, m or
+// g suffix, from section.key, returning def if it is unset.
+func configSize(section *ini.Section, key string, def int64) (int64, error) {
+	value := configValue(section, key)
+	if value == "" {
+		return def, nil
+	}
+	num, unit := value, int64(1)
+	switch strings.ToLower(value[len(value)-1:]) {
+	case "k":
+		unit = 1 << 10
+	case "m":
+		unit = 1 << 20
+	case "g":
+		unit = 1 << 30
+	}
+	if unit != 1 {
+		num = value[:len(value)-1]
+	}
+	n, err := strconv.ParseInt(num, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("bad numeric config value '%s' for '%s.%s'", value, section.Name(), key)
+	}
+	return n * unit, nil
+}
+
+// bigFileThreshold returns core.bigFileThreshold, the size above which
+// files are stored without delta compression.
+func bigFileThreshold() (int64, error) {
+	cfg, err := loadConfig()
+	if err != nil {
+		return 0, err
+	}
+	return configSize(cfg.Section("core"), "bigFileThreshold", pack.DefaultBigFileThreshold)
+}
+
+// configSubsection returns the ini section name for a git config
+// subsection, e.g. `remote "origin"`.
+func configSubsection(section, name string) string {
+	return fmt.Sprintf("%s %q", section, name)
+}
+
+// fsyncComponent is a kind of file core.fsync can ask to be flushed to
+// disk whenever it is written.
+type fsyncComponent int
+
+const (
+	fsyncLooseObject fsyncComponent = 1 << iota
+	fsyncPack
+	fsyncPackMetadata
+	fsyncIndex
+	fsyncReference
+
+	fsyncObjects   = fsyncLooseObject | fsyncPack | fsyncPackMetadata
+	fsyncCommitted = fsyncObjects | fsyncReference
+	fsyncAll       = fsyncCommitted | fsyncIndex
+
+	// fsyncDefault is git's: everything committed except loose objects.
+	fsyncDefault = fsyncCommitted &^ fsyncLooseObject
+)
+
+var fsyncComponentNames = map[string]fsyncComponent{
+	"loose-object":     fsyncLooseObject,
+	"pack":             fsyncPack,
+	"pack-metadata":    fsyncPackMetadata,
+	"index":            fsyncIndex,
+	"reference":        fsyncReference,
+	"objects":          fsyncObjects,
+	"derived-metadata": fsyncPackMetadata,
+	"committed":        fsyncCommitted,
+	"added":            fsyncAll,
+	"all":              fsyncAll,
+}
+
+// parseFsync parses a core.fsync value: a comma-separated list of
+// components added to the default, "-<component>" to drop one, or
+// "none" to start from nothing.
+func parseFsync(value string) fsyncComponent {
+	current, positive, negative := fsyncDefault, fsyncComponent(0), fsyncComponent(0)
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		remove := strings.HasPrefix(name, "-")
+		name = strings.TrimPrefix(name, "-")
+		switch c, ok := fsyncComponentNames[name]; {
+		case name == "":
+		case name == "none":
+			current, positive = 0, 0
+		case !ok:
+			fmt.Fprintf(os.Stderr, "warning: ignoring unknown core.fsync component '%s'\n", name)
+		case remove:
+			negative |= c
+		default:
+			positive |= c
+		}
+	}
+	return current&^negative | positive
+}
+
+var fsyncConfig *fsyncComponent
+
+// shouldFsync reports whether files of component c are to be flushed
+// to disk, per core.fsync and the older core.fsyncObjectFiles.
+func shouldFsync(c fsyncComponent) (bool, error) {
+	if fsyncConfig == nil {
+		cfg, err := loadConfig()
+		if err != nil {
+			return false, err
+		}
+		core := cfg.Section("core")
+		components := fsyncDefault
+		if value := configValue(core, "fsync"); value != "" {
+			components = parseFsync(value)
+		}
+		if configBool(core, "fsyncObjectFiles") {
+			components |= fsyncLooseObject
+		}
+		fsyncConfig = &components
+	}
+	return *fsyncConfig&c != 0, nil
+}
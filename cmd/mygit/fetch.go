@@ -0,0 +1,512 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/atomicfile"
+	"github.com/codecrafters-io/git-starter-go/refs"
+	"github.com/codecrafters-io/git-starter-go/transport"
+)
+
+type fetchOptions struct {
+	// Force allows non-fast-forward updates for every refspec.
+	Force bool
+	// Prune deletes remote-tracking refs whose remote ref is gone.
+	Prune bool
+}
+
+// refUpdate is a local ref to set from a remote ref.
+type refUpdate struct {
+	Src  string
+	Dst  string
+	Hash string
+	// Force allows the update even if it is not a fast-forward.
+	Force bool
+	// ForMerge marks the ref for merging in FETCH_HEAD.
+	ForMerge bool
+}
+
+// remoteURL returns the URL and configured fetch refspecs of remote,
+// which may also be given as a plain URL.
+func remoteURL(remote string) (string, []string, error) {
+	cfg, err := loadConfig()
+	if err != nil {
+		return "", nil, err
+	}
+	section, err := cfg.GetSection(configSubsection("remote", remote))
+	if err != nil || section.Key("url").String() == "" {
+		if strings.Contains(remote, "://") {
+			return remote, nil, nil
+		}
+		return "", nil, fmt.Errorf("'%s' does not appear to be a git repository", remote)
+	}
+	var specs []string
+	if section.HasKey("fetch") {
+		specs = section.Key("fetch").ValueWithShadows()
+	}
+	return section.Key("url").String(), specs, nil
+}
+
+// defaultRemote returns the remote of the current branch, or origin.
+func defaultRemote() string {
+	cfg, err := loadConfig()
+	if err != nil {
+		return "origin"
+	}
+	head, err := headBranch()
+	if err != nil || head == "" {
+		return "origin"
+	}
+	section, err := cfg.GetSection(configSubsection("branch", strings.TrimPrefix(head, "refs/heads/")))
+	if err != nil || section.Key("remote").String() == "" {
+		return "origin"
+	}
+	return section.Key("remote").String()
+}
+
+// checkRemoteFormat refuses to talk to a repository whose objects are
+// named with a different hash algorithm.
+func checkRemoteFormat(adv *transport.Advertisement) error {
+	local, err := objectFormat()
+	if err != nil {
+		return err
+	}
+	remote, err := adv.ObjectFormat()
+	if err != nil {
+		return err
+	}
+	if remote != local {
+		return fmt.Errorf("mismatched algorithms: client %s; server %s", local, remote)
+	}
+	return nil
+}
+
+func fetchRemote(remote string, args []string, opts fetchOptions) error {
+	url, configured, err := remoteURL(remote)
+	if err != nil {
+		return err
+	}
+
+	var configSpecs []refspec
+	for _, s := range configured {
+		spec, err := parseRefspec(s)
+		if err != nil {
+			return err
+		}
+		configSpecs = append(configSpecs, spec)
+	}
+	specs := configSpecs
+	if len(args) > 0 {
+		specs = nil
+		for _, s := range args {
+			spec, err := parseRefspec(s)
+			if err != nil {
+				return err
+			}
+			if spec.Dst != "" && !strings.HasPrefix(spec.Dst, "refs/") {
+				spec.Dst = "refs/heads/" + spec.Dst
+			}
+			specs = append(specs, spec)
+		}
+	} else if len(specs) == 0 {
+		specs = []refspec{{Src: "HEAD"}}
+	}
+	// Tags pointing into the fetched history come along with the
+	// configured refspecs, as in git.
+	followTags := len(args) == 0
+
+	client := transport.NewClient(url)
+	client.Progress = os.Stderr
+	adv, err := client.Discover(transport.UploadPackService)
+	if err != nil {
+		return err
+	}
+	if err := checkRemoteFormat(adv); err != nil {
+		return err
+	}
+
+	var prefixes []string
+	for _, spec := range specs {
+		if spec.IsGlob() {
+			prefix, _, _ := strings.Cut(spec.Src, "*")
+			prefixes = append(prefixes, prefix)
+		} else {
+			prefixes = append(prefixes, expandRefName(spec.Src)...)
+		}
+	}
+	if followTags {
+		prefixes = append(prefixes, "refs/tags/")
+	}
+	remoteRefs, err := client.ListRefs(adv, prefixes...)
+	if err != nil {
+		return err
+	}
+	remoteByName := make(map[string]transport.Ref)
+	for _, ref := range remoteRefs {
+		remoteByName[ref.Name] = ref
+	}
+
+	updates, err := planFetch(remote, specs, configSpecs, len(args) > 0, remoteRefs, remoteByName)
+	if err != nil {
+		return err
+	}
+
+	store, err := objectStore()
+	if err != nil {
+		return err
+	}
+	if followTags {
+		updates = append(updates, followedTags(updates, remoteRefs, store.Has)...)
+	}
+
+	var wants []string
+	seen := make(map[string]bool)
+	for _, u := range updates {
+		if !seen[u.Hash] && !store.Has(u.Hash) {
+			seen[u.Hash] = true
+			wants = append(wants, u.Hash)
+		}
+	}
+
+	if len(wants) > 0 {
+		localRefs, err := listRefs("refs/")
+		if err != nil {
+			return err
+		}
+		var haves []string
+		haveSeen := make(map[string]bool)
+		for _, hash := range localRefs {
+			if !haveSeen[hash] && store.Has(hash) {
+				haveSeen[hash] = true
+				haves = append(haves, hash)
+			}
+		}
+		sort.Strings(haves)
+
+		shallows, err := readShallow()
+		if err != nil {
+			return err
+		}
+		result, err := client.FetchPack(adv, transport.FetchRequest{Wants: wants, Haves: haves, Shallows: shallows})
+		if err != nil {
+			return err
+		}
+		_, err = store.Packs.WritePack(result.Pack)
+		result.Pack.Close()
+		if err != nil {
+			return err
+		}
+		if err := updateShallow(shallows, result.Shallow, result.Unshallow); err != nil {
+			return err
+		}
+	}
+
+	if err := writeFetchHead(url, updates); err != nil {
+		return err
+	}
+
+	refsStore, err := refStore()
+	if err != nil {
+		return err
+	}
+	tx := refsStore.Transaction()
+	tx.SetReflog(reflogIdentity(), "fetch")
+	printer := &fetchPrinter{url: url}
+	rejected := false
+	for _, u := range updates {
+		if u.Dst == "" {
+			continue
+		}
+		ok, err := queueFetchUpdate(tx, u, opts.Force, printer)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			rejected = true
+		}
+	}
+
+	if opts.Prune {
+		if err := pruneRemoteRefs(tx, specs, remoteByName, printer); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	if rejected {
+		return fmt.Errorf("some local refs could not be updated")
+	}
+	return nil
+}
+
+// planFetch maps the remote refs through specs. When the refspecs come
+// from the command line, matching configured refspecs also update their
+// remote-tracking refs.
+func planFetch(remote string, specs, configSpecs []refspec, explicit bool, remoteRefs []transport.Ref, remoteByName map[string]transport.Ref) ([]refUpdate, error) {
+	var mergeRef string
+	if !explicit {
+		mergeRef = branchMergeRef(remote)
+	}
+
+	var updates []refUpdate
+	byDst := make(map[string]bool)
+	add := func(u refUpdate) {
+		if u.Dst != "" {
+			if byDst[u.Dst] {
+				return
+			}
+			byDst[u.Dst] = true
+		}
+		updates = append(updates, u)
+	}
+
+	for _, spec := range specs {
+		if spec.IsGlob() {
+			for _, ref := range remoteRefs {
+				dst, ok := spec.MatchSrc(ref.Name)
+				if !ok || ref.Hash == "" {
+					continue
+				}
+				add(refUpdate{Src: ref.Name, Dst: dst, Hash: ref.Hash, Force: spec.Force, ForMerge: ref.Name == mergeRef})
+			}
+			continue
+		}
+
+		var ref transport.Ref
+		found := false
+		for _, name := range expandRefName(spec.Src) {
+			if ref, found = remoteByName[name]; found && ref.Hash != "" {
+				break
+			}
+			found = false
+		}
+		if !found {
+			return nil, fmt.Errorf("couldn't find remote ref %s", spec.Src)
+		}
+		add(refUpdate{Src: ref.Name, Dst: spec.Dst, Hash: ref.Hash, Force: spec.Force, ForMerge: explicit || ref.Name == mergeRef})
+
+		if explicit {
+			for _, cs := range configSpecs {
+				if dst, ok := cs.MatchSrc(ref.Name); ok && dst != "" {
+					add(refUpdate{Src: ref.Name, Dst: dst, Hash: ref.Hash, Force: cs.Force})
+				}
+			}
+		}
+	}
+	return updates, nil
+}
+
+// branchMergeRef returns the upstream ref of the current branch if it
+// is tracked from remote.
+func branchMergeRef(remote string) string {
+	head, err := headBranch()
+	if err != nil || head == "" {
+		return ""
+	}
+	cfg, err := loadConfig()
+	if err != nil {
+		return ""
+	}
+	section, err := cfg.GetSection(configSubsection("branch", strings.TrimPrefix(head, "refs/heads/")))
+	if err != nil || section.Key("remote").String() != remote {
+		return ""
+	}
+	return section.Key("merge").String()
+}
+
+// followedTags returns updates for remote tags that are missing locally
+// and point at objects being fetched or already present.
+func followedTags(updates []refUpdate, remoteRefs []transport.Ref, has func(id string) bool) []refUpdate {
+	fetching := make(map[string]bool)
+	taken := make(map[string]bool)
+	for _, u := range updates {
+		fetching[u.Hash] = true
+		taken[u.Dst] = true
+	}
+
+	var tags []refUpdate
+	for _, ref := range remoteRefs {
+		if !strings.HasPrefix(ref.Name, "refs/tags/") || ref.Hash == "" || taken[ref.Name] {
+			continue
+		}
+		if _, err := resolveRef(ref.Name); err == nil {
+			continue
+		}
+		target := ref.Hash
+		if ref.Peeled != "" {
+			target = ref.Peeled
+		}
+		if fetching[target] || has(target) {
+			tags = append(tags, refUpdate{Src: ref.Name, Dst: ref.Name, Hash: ref.Hash})
+		}
+	}
+	return tags
+}
+
+// updateShallow applies the server's shallow-info to .git/shallow.
+func updateShallow(current, shallow, unshallow []string) error {
+	if len(shallow) == 0 && len(unshallow) == 0 {
+		return nil
+	}
+	set := make(map[string]bool)
+	for _, hash := range current {
+		set[hash] = true
+	}
+	for _, hash := range shallow {
+		set[hash] = true
+	}
+	for _, hash := range unshallow {
+		delete(set, hash)
+	}
+	hashes := make([]string, 0, len(set))
+	for hash := range set {
+		hashes = append(hashes, hash)
+	}
+	sort.Strings(hashes)
+	return writeShallow(hashes)
+}
+
+// writeFetchHead records the fetched refs in .git/FETCH_HEAD, refs to
+// be merged first.
+func writeFetchHead(url string, updates []refUpdate) error {
+	var merge, rest strings.Builder
+	for _, u := range updates {
+		var desc string
+		switch {
+		case strings.HasPrefix(u.Src, "refs/heads/"):
+			desc = fmt.Sprintf("branch '%s' of %s", strings.TrimPrefix(u.Src, "refs/heads/"), url)
+		case strings.HasPrefix(u.Src, "refs/tags/"):
+			desc = fmt.Sprintf("tag '%s' of %s", strings.TrimPrefix(u.Src, "refs/tags/"), url)
+		case u.Src == "HEAD":
+			desc = url
+		default:
+			desc = fmt.Sprintf("'%s' of %s", u.Src, url)
+		}
+		if u.ForMerge {
+			fmt.Fprintf(&merge, "%s\t\t%s\n", u.Hash, desc)
+		} else {
+			fmt.Fprintf(&rest, "%s\tnot-for-merge\t%s\n", u.Hash, desc)
+		}
+	}
+	if err := atomicfile.WriteFile(".git/FETCH_HEAD", []byte(merge.String()+rest.String()), 0644, false); err != nil {
+		return fmt.Errorf("error writing FETCH_HEAD: %w", err)
+	}
+	return nil
+}
+
+// fetchPrinter reports ref updates in git's format, printing the
+// "From <url>" header before the first line.
+type fetchPrinter struct {
+	url     string
+	started bool
+}
+
+func (p *fetchPrinter) print(flag byte, summary, src, dst, reason string) {
+	if !p.started {
+		fmt.Fprintf(os.Stderr, "From %s\n", p.url)
+		p.started = true
+	}
+	if reason != "" {
+		reason = " (" + reason + ")"
+	}
+	fmt.Fprintf(os.Stderr, " %c %-17s %-10s -> %s%s\n", flag, summary, src, dst, reason)
+}
+
+// queueFetchUpdate adds the update of one local ref to tx, checked
+// against the value it is decided on, reporting false if the update was
+// rejected.
+func queueFetchUpdate(tx *refs.Transaction, u refUpdate, force bool, p *fetchPrinter) (bool, error) {
+	src, dst := shortRefName(u.Src), shortRefName(u.Dst)
+	isTag := strings.HasPrefix(u.Dst, "refs/tags/")
+
+	if head, err := headBranch(); err == nil && head == u.Dst {
+		return false, fmt.Errorf("refusing to fetch into branch '%s' checked out", u.Dst)
+	}
+
+	old, err := resolveRef(u.Dst)
+	if err != nil && !errors.Is(err, refs.ErrNotFound) {
+		return false, err
+	}
+	if old == u.Hash {
+		return true, nil
+	}
+
+	if old == "" {
+		summary, action := "[new ref]", "storing ref"
+		switch {
+		case isTag:
+			summary, action = "[new tag]", "storing tag"
+		case strings.HasPrefix(u.Src, "refs/heads/"):
+			summary, action = "[new branch]", "storing head"
+		}
+		p.print('*', summary, src, dst, "")
+		tx.UpdateMessage(u.Dst, repoFormat.ZeroID(), u.Hash, "fetch: "+action)
+		return true, nil
+	}
+
+	fastForward := false
+	if !isTag {
+		if fastForward, err = isAncestor(old, u.Hash); err != nil {
+			return false, err
+		}
+	}
+	action := "fast-forward"
+	switch {
+	case fastForward:
+		p.print(' ', old[:7]+".."+u.Hash[:7], src, dst, "")
+	case u.Force || force:
+		p.print('+', old[:7]+"..."+u.Hash[:7], src, dst, "forced update")
+		action = "forced-update"
+	case isTag:
+		p.print('!', "[rejected]", src, dst, "would clobber existing tag")
+		return false, nil
+	default:
+		p.print('!', "[rejected]", src, dst, "non-fast-forward")
+		return false, nil
+	}
+	tx.UpdateMessage(u.Dst, old, u.Hash, "fetch: "+action)
+	return true, nil
+}
+
+// pruneRemoteRefs queues deleting the local refs covered by the glob
+// refspecs whose remote counterpart no longer exists.
+func pruneRemoteRefs(tx *refs.Transaction, specs []refspec, remoteByName map[string]transport.Ref, p *fetchPrinter) error {
+	for _, spec := range specs {
+		if !spec.IsGlob() || spec.Dst == "" {
+			continue
+		}
+		prefix, _, _ := strings.Cut(spec.Dst, "*")
+		local, err := listRefs(prefix)
+		if err != nil {
+			return err
+		}
+		names := make([]string, 0, len(local))
+		for name := range local {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			src, ok := spec.MatchDst(name)
+			if !ok {
+				continue
+			}
+			if _, exists := remoteByName[src]; exists {
+				continue
+			}
+			// Leave symbolic refs such as refs/remotes/origin/HEAD alone.
+			if ref, err := readRef(name); err != nil || ref.IsSymbolic() {
+				continue
+			}
+			tx.Delete(name, local[name])
+			p.print('-', "[deleted]", "(none)", shortRefName(name), "")
+		}
+	}
+	return nil
+}
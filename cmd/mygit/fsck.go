@@ -0,0 +1,226 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/fsck"
+	"github.com/codecrafters-io/git-starter-go/object"
+	"github.com/codecrafters-io/git-starter-go/pack"
+)
+
+type fsckOptions struct {
+	// NoDangling suppresses the listing of unreferenced objects.
+	NoDangling bool
+}
+
+// fsckRepository checks every object, ref, reflog and the index, and
+// reports whether the repository is free of errors. Errors go to
+// stderr; missing and dangling objects are listed on stdout as git does.
+func fsckRepository(opts fsckOptions) (bool, error) {
+	store, err := objectStore()
+	if err != nil {
+		return false, err
+	}
+	shallow, err := shallowSet()
+	if err != nil {
+		return false, err
+	}
+
+	ok := true
+	report := func(format string, args ...any) {
+		fmt.Fprintf(os.Stderr, "error: "+format+"\n", args...)
+		ok = false
+	}
+
+	packs, err := filepath.Glob(filepath.Join(".git", "objects", "pack", "*.pack"))
+	if err != nil {
+		return false, err
+	}
+	for _, path := range packs {
+		if _, err := pack.Verify(path, store.Format()); err != nil {
+			report("%s", err)
+		}
+	}
+
+	types := make(map[string]object.Type)
+	links := make(map[string][]fsck.Link)
+	err = store.Iterate(func(id string) error {
+		t, content, err := store.Get(id)
+		if err != nil {
+			report("%s: object corrupt or missing: %s", id, err)
+			return nil
+		}
+		hash, err := store.Format().Hash(t, content)
+		if err != nil {
+			report("%s: %s", id, err)
+			return nil
+		}
+		if hash != id {
+			report("hash mismatch %s (content hashes to %s)", id, hash)
+			return nil
+		}
+		types[id] = t
+
+		findings, objLinks := fsck.Check(t, content, store.Format())
+		for _, f := range findings {
+			fmt.Fprintf(os.Stderr, "%s in %s %s: %s\n", f.Severity, t, id, f.Message)
+			if f.Severity == fsck.Error {
+				ok = false
+			}
+		}
+		if t == object.TypeCommit && shallow[id] && len(objLinks) > 0 {
+			// Only the tree of a shallow boundary commit is present.
+			objLinks = objLinks[:1]
+		}
+		links[id] = objLinks
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	ids := make([]string, 0, len(types))
+	for id := range types {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	referenced := make(map[string]bool)
+	for _, id := range ids {
+		for _, link := range links[id] {
+			referenced[link.ID] = true
+			t, present := types[link.ID]
+			switch {
+			case !present:
+				fmt.Printf("broken link from %7s %s\n              to %7s %s\n", types[id], id, link.Type, link.ID)
+				ok = false
+			case t != link.Type:
+				report("%s %s refers to %s as a %s, but it is a %s", types[id], id, link.ID, link.Type, t)
+			}
+		}
+	}
+
+	var roots []string
+	addRoot := func(hash string) {
+		if _, present := types[hash]; present {
+			roots = append(roots, hash)
+		}
+	}
+
+	// peel follows tags to the object they ultimately name.
+	peel := func(hash string) string {
+		for types[hash] == object.TypeTag && len(links[hash]) > 0 {
+			hash = links[hash][0].ID
+		}
+		return hash
+	}
+	checkRef := func(name, hash string) {
+		if _, present := types[hash]; !present {
+			report("%s: invalid sha1 pointer %s", name, hash)
+			return
+		}
+		addRoot(hash)
+		if !strings.HasPrefix(name, "refs/tags/") && types[peel(hash)] != object.TypeCommit {
+			report("%s: not a commit", name)
+		}
+	}
+
+	head, err := readRef("HEAD")
+	switch {
+	case err != nil:
+		report("HEAD: %s", err)
+	case head.IsSymbolic():
+		if hash, err := resolveRef(head.Target); err == nil {
+			checkRef("HEAD", hash)
+		} else {
+			fmt.Fprintf(os.Stderr, "notice: HEAD points to an unborn branch (%s)\n", shortRefName(head.Target))
+		}
+	default:
+		checkRef("HEAD", head.Hash)
+	}
+
+	refs, err := listRefs("refs/")
+	if err != nil {
+		return false, err
+	}
+	refNames := make([]string, 0, len(refs))
+	for name := range refs {
+		refNames = append(refNames, name)
+	}
+	sort.Strings(refNames)
+	for _, name := range refNames {
+		checkRef(name, refs[name])
+	}
+
+	reflogs, err := listReflogs()
+	if err != nil {
+		return false, err
+	}
+	for _, name := range reflogs {
+		entries, err := readReflog(name)
+		if err != nil {
+			return false, err
+		}
+		for _, entry := range entries {
+			for _, hash := range []string{entry.Old, entry.New} {
+				if hash == "" || object.IsZeroID(hash) {
+					continue
+				}
+				if _, present := types[hash]; !present {
+					report("%s: invalid reflog entry %s", name, hash)
+				}
+				addRoot(hash)
+			}
+		}
+	}
+
+	idx, err := readIndex()
+	if err != nil {
+		report("index: %s", err)
+	} else {
+		for _, entry := range idx.Entries {
+			if entry.Mode == object.ModeGitlink {
+				continue
+			}
+			if _, present := types[entry.Hash]; !present {
+				report("%s: invalid sha1 pointer in index for '%s'", entry.Hash, entry.Path)
+			}
+			addRoot(entry.Hash)
+		}
+	}
+
+	reachable := make(map[string]bool)
+	queue := roots
+	for _, hash := range roots {
+		reachable[hash] = true
+	}
+	for len(queue) > 0 {
+		hash := queue[0]
+		queue = queue[1:]
+		for _, link := range links[hash] {
+			if reachable[link.ID] {
+				continue
+			}
+			reachable[link.ID] = true
+			if _, present := types[link.ID]; !present {
+				fmt.Printf("missing %s %s\n", link.Type, link.ID)
+				ok = false
+				continue
+			}
+			queue = append(queue, link.ID)
+		}
+	}
+
+	if !opts.NoDangling {
+		for _, id := range ids {
+			if !reachable[id] && !referenced[id] {
+				fmt.Printf("dangling %s %s\n", types[id], id)
+			}
+		}
+	}
+	return ok, nil
+}
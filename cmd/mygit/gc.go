@@ -0,0 +1,327 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/codecrafters-io/git-starter-go/object"
+	"github.com/codecrafters-io/git-starter-go/pack"
+	"github.com/codecrafters-io/git-starter-go/revlist"
+	"github.com/codecrafters-io/git-starter-go/storage"
+)
+
+type repackOptions struct {
+	// All packs every reachable object, not just loose ones.
+	All bool
+	// Delete removes the packs and loose objects made redundant.
+	Delete bool
+	// KeepUnreachable turns unreachable objects of deleted packs into
+	// loose objects instead of dropping them.
+	KeepUnreachable bool
+	Build           pack.BuildOptions
+}
+
+// reachableTips returns the objects a repository must keep: the targets
+// of HEAD, of every ref and reflog entry, and the blobs in the index.
+func reachableTips(store storage.ObjectStore) ([]string, error) {
+	var tips []string
+	seen := make(map[string]bool)
+	add := func(hash string) {
+		if !object.IsZeroID(hash) && !seen[hash] && store.Has(hash) {
+			seen[hash] = true
+			tips = append(tips, hash)
+		}
+	}
+
+	if hash, err := resolveRef("HEAD"); err == nil {
+		add(hash)
+	}
+	refs, err := listRefs("refs/")
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(refs))
+	for name := range refs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		add(refs[name])
+	}
+
+	reflogs, err := listReflogs()
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range reflogs {
+		entries, err := readReflog(name)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			add(entry.Old)
+			add(entry.New)
+		}
+	}
+
+	idx, err := readIndex()
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range idx.Entries {
+		if entry.Mode != object.ModeGitlink {
+			add(entry.Hash)
+		}
+	}
+	return tips, nil
+}
+
+// reachableObjects lists every object reachable from reachableTips.
+func reachableObjects(store storage.ObjectStore) ([]revlist.Entry, error) {
+	tips, err := reachableTips(store)
+	if err != nil {
+		return nil, err
+	}
+	shallow, err := shallowSet()
+	if err != nil {
+		return nil, err
+	}
+	return revlist.Objects(store, tips, nil, shallow)
+}
+
+// repack writes the reachable objects into a new pack. Without All only
+// loose objects are packed.
+func repack(opts repackOptions) error {
+	store, err := objectStore()
+	if err != nil {
+		return err
+	}
+	objects, err := reachableObjects(store)
+	if err != nil {
+		return err
+	}
+	if !opts.All {
+		loose := objects[:0]
+		for _, entry := range objects {
+			if !store.Packs.Has(entry.Hash) {
+				loose = append(loose, entry)
+			}
+		}
+		objects = loose
+	}
+
+	packDir := filepath.Join(".git", "objects", "pack")
+	oldPacks, err := filepath.Glob(filepath.Join(packDir, "pack-*.pack"))
+	if err != nil {
+		return err
+	}
+
+	if len(objects) == 0 {
+		fmt.Fprintf(os.Stderr, "Nothing new to pack.\n")
+	} else {
+		if err := os.MkdirAll(packDir, 0755); err != nil {
+			return err
+		}
+		name, written, err := writePackFiles(filepath.Join(packDir, "pack"), store, objects, opts.Build)
+		if err != nil {
+			return err
+		}
+		printPackStats(written)
+
+		if opts.All && opts.Delete {
+			newPack := filepath.Join(packDir, "pack-"+name+".pack")
+			kept := make(map[string]bool, len(written))
+			for _, obj := range written {
+				kept[obj.ID] = true
+			}
+			if err := removePacks(store, oldPacks, newPack, kept, opts.KeepUnreachable); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := store.Packs.Reload(); err != nil {
+		return err
+	}
+	if opts.Delete {
+		return prunePacked(store)
+	}
+	return nil
+}
+
+// removePacks deletes the packs in paths other than keep. Objects not in
+// reachable are first written out as loose objects if loosen is set,
+// dated like the pack so that prune can expire them later.
+func removePacks(store *storage.DiskStore, paths []string, keep string, reachable map[string]bool, loosen bool) error {
+	for _, path := range paths {
+		if path == keep {
+			continue
+		}
+		if loosen {
+			if err := loosenUnreachable(store, path, reachable); err != nil {
+				return err
+			}
+		}
+		base := strings.TrimSuffix(path, ".pack")
+		for _, ext := range []string{".idx", ".pack"} {
+			if err := os.Remove(base + ext); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("error removing %s: %w", base+ext, err)
+			}
+		}
+	}
+	return nil
+}
+
+func loosenUnreachable(store *storage.DiskStore, path string, reachable map[string]bool) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	p, err := pack.Open(path, store.Format())
+	if err != nil {
+		return fmt.Errorf("error opening pack %s: %w", path, err)
+	}
+	defer p.Close()
+	p.ResolveExternal = func(id string) (pack.ObjectType, []byte, error) {
+		t, content, err := store.Get(id)
+		return pack.ObjectType(t), content, err
+	}
+
+	for i := 0; i < p.Index.Count(); i++ {
+		id := p.Index.HashAt(i)
+		if reachable[id] || store.Loose.Has(id) {
+			continue
+		}
+		t, content, err := p.Get(id)
+		if err != nil {
+			return fmt.Errorf("error reading %s from %s: %w", id, path, err)
+		}
+		if _, err := store.Loose.Put(object.Type(t), content); err != nil {
+			return err
+		}
+		mtime := info.ModTime()
+		if err := os.Chtimes(store.Loose.Path(id), mtime, mtime); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// prunePacked removes loose objects that are also packed.
+func prunePacked(store *storage.DiskStore) error {
+	var packed []string
+	err := store.Loose.Iterate(func(id string) error {
+		if store.Packs.Has(id) {
+			packed = append(packed, id)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, id := range packed {
+		path := store.Loose.Path(id)
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("error removing loose object %s: %w", id, err)
+		}
+		// Fails harmlessly while the fan-out directory has other objects.
+		os.Remove(filepath.Dir(path))
+	}
+	return nil
+}
+
+// packRefs moves every ref into packed-refs, with the peeled target of
+// annotated tags, and deletes the loose ref files. Symbolic refs stay
+// loose.
+func packRefs() error {
+	store, err := objectStore()
+	if err != nil {
+		return err
+	}
+	refs, err := refStore()
+	if err != nil {
+		return err
+	}
+	return refs.Pack(func(hash string) string {
+		return peelTag(store, hash)
+	})
+}
+
+// peelTag returns the object an annotated tag ultimately points to, or ""
+// if hash is not a tag.
+func peelTag(store storage.ObjectStore, hash string) string {
+	peeled := ""
+	for i := 0; i < 10; i++ {
+		objType, content, err := store.Get(hash)
+		if err != nil || objType != object.TypeTag {
+			break
+		}
+		tag, err := object.ParseTag(content)
+		if err != nil {
+			break
+		}
+		hash, peeled = tag.Object, tag.Object
+	}
+	return peeled
+}
+
+// gc packs refs, expires old reflog entries, repacks the repository
+// into a single pack and prunes old unreachable objects.
+func gc(aggressive bool) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	section := cfg.Section("gc")
+	expiry := func(key, def string) (time.Time, error) {
+		value := def
+		if section.HasKey(key) {
+			value = section.Key(key).String()
+		}
+		t, err := parseExpiry(value, now)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("gc.%s: %w", key, err)
+		}
+		return t, nil
+	}
+	expire, err := expiry("reflogExpire", "90.days.ago")
+	if err != nil {
+		return err
+	}
+	expireUnreachable, err := expiry("reflogExpireUnreachable", "30.days.ago")
+	if err != nil {
+		return err
+	}
+
+	pruneExpire, err := expiry("pruneExpire", "2.weeks.ago")
+	if err != nil {
+		return err
+	}
+
+	if err := packRefs(); err != nil {
+		return err
+	}
+	if err := expireReflogs(expire, expireUnreachable); err != nil {
+		return err
+	}
+
+	opts := repackOptions{All: true, Delete: true, KeepUnreachable: true, Build: pack.DefaultBuildOptions}
+	if opts.Build.BigFileThreshold, err = bigFileThreshold(); err != nil {
+		return err
+	}
+	if aggressive {
+		opts.Build.Window = 250
+	}
+	if err := repack(opts); err != nil {
+		return err
+	}
+	if pruneExpire.IsZero() {
+		return nil
+	}
+	return prune(pruneOptions{Expire: pruneExpire})
+}
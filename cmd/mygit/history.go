@@ -0,0 +1,74 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/codecrafters-io/git-starter-go/object"
+	"github.com/codecrafters-io/git-starter-go/refs"
+	"github.com/codecrafters-io/git-starter-go/revlist"
+)
+
+// readCommit reads and parses the commit hash.
+func readCommit(hash string) (*object.Commit, error) {
+	objType, content, err := readObject(hash)
+	if err != nil {
+		return nil, err
+	}
+	if objType != object.TypeCommit {
+		return nil, fmt.Errorf("object %s is a %s, not a commit", hash, objType)
+	}
+	commit, err := object.ParseCommit(content)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing commit %s: %w", hash, err)
+	}
+	return commit, nil
+}
+
+// isAncestor reports whether ancestor is reachable from commit.
+func isAncestor(ancestor, commit string) (bool, error) {
+	store, err := objectStore()
+	if err != nil {
+		return false, err
+	}
+	return revlist.IsAncestor(store, ancestor, commit)
+}
+
+// aheadBehind counts the commits on a that are not on b and the other
+// way round.
+func aheadBehind(a, b string) (int, int, error) {
+	store, err := objectStore()
+	if err != nil {
+		return 0, 0, err
+	}
+	return revlist.AheadBehind(store, a, b)
+}
+
+// dwimRef finds the ref a short name such as "main" or "origin/main"
+// stands for, returning its full name and the hash it resolves to.
+func dwimRef(name string) (string, string, error) {
+	for _, candidate := range expandRefName(name) {
+		hash, err := resolveRef(candidate)
+		if err == nil {
+			return candidate, hash, nil
+		}
+		if !errors.Is(err, refs.ErrNotFound) {
+			return "", "", err
+		}
+	}
+	return "", "", fmt.Errorf("%w: %s", refs.ErrNotFound, name)
+}
+
+// resolveCommit returns the commit the revision expression rev names.
+// Tags are peeled.
+func resolveCommit(rev string) (string, error) {
+	hash, err := revParse(rev)
+	if err != nil {
+		return "", err
+	}
+	commit, err := peelObject(hash, object.TypeCommit)
+	if err != nil {
+		return "", fmt.Errorf("'%s' is not a commit", rev)
+	}
+	return commit, nil
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/atomicfile"
+	"github.com/codecrafters-io/git-starter-go/pack"
+)
+
+// indexPack builds the index of the pack at packPath and writes it to
+// idxPath, by default the pack's name with an .idx extension.
+func indexPack(packPath, idxPath string) error {
+	if idxPath == "" {
+		if !strings.HasSuffix(packPath, ".pack") {
+			return fmt.Errorf("packfile name '%s' does not end with '.pack'", packPath)
+		}
+		idxPath = strings.TrimSuffix(packPath, ".pack") + ".idx"
+	}
+
+	f, err := os.Open(packPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	format, err := objectFormat()
+	if err != nil {
+		return err
+	}
+	objects, checksum, err := pack.IndexPack(f, info.Size(), format, nil)
+	if err != nil {
+		return err
+	}
+
+	sync, err := shouldFsync(fsyncPackMetadata)
+	if err != nil {
+		return err
+	}
+	tmp, err := atomicfile.CreateTemp(filepath.Dir(idxPath), "tmp_idx_", sync)
+	if err != nil {
+		return fmt.Errorf("error creating temporary index: %w", err)
+	}
+	defer tmp.Abort()
+	if err := pack.WriteIndex(tmp, format, objects, checksum); err != nil {
+		return fmt.Errorf("error writing index: %w", err)
+	}
+	if err := tmp.Commit(idxPath, 0444); err != nil {
+		return err
+	}
+
+	fmt.Println(hex.EncodeToString(checksum))
+	return nil
+}
+
+// verifyPack checks the pack named by an .idx or .pack path against its
+// index. With verbose set it lists every object and a histogram of delta
+// chain lengths.
+func verifyPack(path string, verbose bool) error {
+	packPath := strings.TrimSuffix(strings.TrimSuffix(path, ".idx"), ".pack") + ".pack"
+	format, err := objectFormat()
+	if err != nil {
+		return err
+	}
+	objects, err := pack.Verify(packPath, format)
+	if err != nil {
+		return err
+	}
+	if !verbose {
+		return nil
+	}
+
+	nonDelta := 0
+	chains := make(map[int]int)
+	for _, obj := range objects {
+		if obj.DeltaDepth == 0 {
+			nonDelta++
+			fmt.Printf("%s %-6s %d %d %d\n", obj.ID, obj.Type, obj.EntrySize, obj.PackedSize, obj.Offset)
+			continue
+		}
+		chains[obj.DeltaDepth]++
+		fmt.Printf("%s %-6s %d %d %d %d %s\n", obj.ID, obj.Type, obj.EntrySize, obj.PackedSize, obj.Offset, obj.DeltaDepth, obj.BaseID)
+	}
+
+	fmt.Printf("non delta: %d %s\n", nonDelta, plural(nonDelta, "object", "objects"))
+	depths := make([]int, 0, len(chains))
+	for depth := range chains {
+		depths = append(depths, depth)
+	}
+	sort.Ints(depths)
+	for _, depth := range depths {
+		fmt.Printf("chain length = %d: %d %s\n", depth, chains[depth], plural(chains[depth], "object", "objects"))
+	}
+	fmt.Printf("%s: ok\n", packPath)
+	return nil
+}
+
+func plural(n int, one, many string) string {
+	if n == 1 {
+		return one
+	}
+	return many
+}
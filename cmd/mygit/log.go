@@ -0,0 +1,521 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/codecrafters-io/git-starter-go/object"
+	"github.com/codecrafters-io/git-starter-go/refs"
+	"github.com/codecrafters-io/git-starter-go/revlist"
+	"github.com/codecrafters-io/git-starter-go/storage"
+)
+
+// logOptions select and format the commits log shows.
+type logOptions struct {
+	MaxCount int // negative for no limit
+	Oneline  bool
+	Format   string
+	// FormatSeparator puts the newline after a --format=format: entry
+	// between entries rather than after each one.
+	FormatSeparator bool
+	Since           time.Time
+	Until           time.Time
+	Authors         patternList
+	Greps           patternList
+	FirstParent     bool
+	Paths           []string
+}
+
+// patternList collects the regular expressions given to a repeatable
+// flag. A commit matches if any of them does.
+type patternList []*regexp.Regexp
+
+func (l *patternList) String() string { return "" }
+
+func (l *patternList) Set(s string) error {
+	re, err := regexp.Compile(s)
+	if err != nil {
+		return err
+	}
+	*l = append(*l, re)
+	return nil
+}
+
+func (l patternList) matches(s string) bool {
+	if len(l) == 0 {
+		return true
+	}
+	for _, re := range l {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// showLog prints the commits reachable from revs, newest first. revs
+// may hold ^<rev> exclusions and <rev>..<rev> ranges; with none, HEAD
+// is used.
+func showLog(revs []string, opts logOptions) error {
+	store, err := objectStore()
+	if err != nil {
+		return err
+	}
+	walker := revlist.NewWalker(store)
+	walker.FirstParent = opts.FirstParent
+
+	include, exclude, err := logTips(revs)
+	if err != nil {
+		return err
+	}
+	for _, hash := range exclude {
+		if err := walker.Hide(hash); err != nil {
+			return err
+		}
+	}
+	for _, hash := range include {
+		if err := walker.Push(hash); err != nil {
+			return err
+		}
+	}
+
+	// With paths given, a commit is shown only if it changes one of them
+	// against every parent it has. Otherwise the walk follows just a
+	// parent it matches, as git's default history simplification does.
+	changed := make(map[string]bool)
+	if len(opts.Paths) > 0 {
+		walker.ParentFilter = func(hash string, c *object.Commit, parents []string) ([]string, error) {
+			if len(parents) == 0 {
+				differs, err := pathsChanged("", c.Tree, opts.Paths)
+				changed[hash] = differs
+				return parents, err
+			}
+			for _, parent := range parents {
+				parentTree, err := commitTree(parent)
+				if errors.Is(err, storage.ErrNotFound) {
+					// Past a shallow boundary the parent counts as empty.
+					parentTree, err = "", nil
+				}
+				if err != nil {
+					return nil, err
+				}
+				differs, err := pathsChanged(parentTree, c.Tree, opts.Paths)
+				if err != nil {
+					return nil, err
+				}
+				if !differs {
+					return []string{parent}, nil
+				}
+			}
+			changed[hash] = true
+			return parents, nil
+		}
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+	shown := 0
+	for opts.MaxCount < 0 || shown < opts.MaxCount {
+		hash, commit, err := walker.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if len(opts.Paths) > 0 && !changed[hash] {
+			continue
+		}
+		when := commit.Committer.When
+		if !opts.Since.IsZero() && when.Before(opts.Since) {
+			continue
+		}
+		if !opts.Until.IsZero() && when.After(opts.Until) {
+			continue
+		}
+		if !opts.Authors.matches(commit.Author.Name+" <"+commit.Author.Email+">") || !opts.Greps.matches(commit.Message) {
+			continue
+		}
+
+		switch {
+		case opts.Format != "" && opts.FormatSeparator:
+			if shown > 0 {
+				fmt.Fprintln(out)
+			}
+			fmt.Fprint(out, formatCommit(opts.Format, hash, commit))
+		case opts.Format != "":
+			fmt.Fprintln(out, formatCommit(opts.Format, hash, commit))
+		case opts.Oneline:
+			fmt.Fprintf(out, "%s %s\n", shortID(hash), commitSubjectLine(commit.Message))
+		default:
+			if shown > 0 {
+				fmt.Fprintln(out)
+			}
+			writeMediumCommit(out, hash, commit)
+		}
+		shown++
+	}
+	return nil
+}
+
+// logTips resolves log's revision arguments to the commits to start
+// from and the commits whose history to leave out.
+func logTips(revs []string) ([]string, []string, error) {
+	var include, exclude []string
+	add := func(rev string, negated bool) error {
+		hash, err := resolveCommit(rev)
+		if err != nil {
+			return err
+		}
+		if negated {
+			exclude = append(exclude, hash)
+		} else {
+			include = append(include, hash)
+		}
+		return nil
+	}
+
+	for _, rev := range revs {
+		if from, to, ok := strings.Cut(rev, ".."); ok && indexOutsideBraces(rev, ":") < 0 {
+			if from == "" {
+				from = "HEAD"
+			}
+			if to == "" {
+				to = "HEAD"
+			}
+			if err := add(from, true); err != nil {
+				return nil, nil, err
+			}
+			if err := add(to, false); err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+		rev, negated := strings.CutPrefix(rev, "^")
+		if err := add(rev, negated); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if len(revs) == 0 {
+		hash, err := resolveRef("HEAD")
+		if errors.Is(err, refs.ErrNotFound) {
+			head, _ := headBranch()
+			return nil, nil, fmt.Errorf("your current branch '%s' does not have any commits yet", strings.TrimPrefix(head, "refs/heads/"))
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		include = append(include, hash)
+	}
+	return include, exclude, nil
+}
+
+// cleanPathspec turns a log path argument into a slash-separated path
+// relative to the top of the worktree, or "" for the whole tree.
+func cleanPathspec(p string) string {
+	p = path.Clean(strings.ReplaceAll(p, string(os.PathSeparator), "/"))
+	if p == "." || p == "/" {
+		return ""
+	}
+	return strings.TrimPrefix(p, "/")
+}
+
+// pathsChanged diffs the trees a and b, either of which may be "" for
+// the empty tree, at paths only: it descends just into the subtrees on
+// the way to each path and stops wherever both sides are identical.
+func pathsChanged(a, b string, paths []string) (bool, error) {
+	for _, p := range paths {
+		changed, err := pathChanged(
+			object.TreeEntry{Mode: object.ModeDir, Hash: a},
+			object.TreeEntry{Mode: object.ModeDir, Hash: b},
+			strings.Split(p, "/"))
+		if err != nil || changed {
+			return changed, err
+		}
+	}
+	return false, nil
+}
+
+func pathChanged(a, b object.TreeEntry, names []string) (bool, error) {
+	if a.Hash == b.Hash && a.Mode == b.Mode {
+		return false, nil
+	}
+	if len(names) == 0 {
+		return true, nil
+	}
+	childA, err := childEntry(a, names[0])
+	if err != nil {
+		return false, err
+	}
+	childB, err := childEntry(b, names[0])
+	if err != nil {
+		return false, err
+	}
+	return pathChanged(childA, childB, names[1:])
+}
+
+// childEntry returns the entry name in the tree entry refers to, or a
+// zero entry if it is not a tree or has no such entry.
+func childEntry(entry object.TreeEntry, name string) (object.TreeEntry, error) {
+	if entry.Hash == "" || !entry.Mode.IsDir() {
+		return object.TreeEntry{}, nil
+	}
+	tree, err := readTree(entry.Hash)
+	if err != nil {
+		return object.TreeEntry{}, err
+	}
+	child, _ := tree.Find(name)
+	return child, nil
+}
+
+// writeMediumCommit prints a commit the way git log does by default.
+func writeMediumCommit(w io.Writer, hash string, c *object.Commit) {
+	fmt.Fprintf(w, "commit %s\n", hash)
+	if len(c.Parents) > 1 {
+		short := make([]string, len(c.Parents))
+		for i, parent := range c.Parents {
+			short[i] = shortID(parent)
+		}
+		fmt.Fprintf(w, "Merge: %s\n", strings.Join(short, " "))
+	}
+	fmt.Fprintf(w, "Author: %s <%s>\n", c.Author.Name, c.Author.Email)
+	fmt.Fprintf(w, "Date:   %s\n\n", c.Author.When.Format(gitDateLayout))
+	for _, line := range strings.Split(strings.TrimRight(c.Message, "\n"), "\n") {
+		fmt.Fprintf(w, "    %s\n", line)
+	}
+}
+
+// gitDateLayout is git's default date format.
+const gitDateLayout = "Mon Jan 2 15:04:05 2006 -0700"
+
+// formatCommit expands the --format placeholders in format for commit.
+// Unknown placeholders are copied through, as git does.
+func formatCommit(format, hash string, c *object.Commit) string {
+	var b strings.Builder
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' || i+1 == len(format) {
+			b.WriteByte(format[i])
+			continue
+		}
+		spec := format[i+1:]
+		n := 1
+		switch {
+		case spec[0] == '%':
+			b.WriteByte('%')
+		case spec[0] == 'n':
+			b.WriteByte('\n')
+		case spec[0] == 'H':
+			b.WriteString(hash)
+		case spec[0] == 'h':
+			b.WriteString(shortID(hash))
+		case spec[0] == 'T':
+			b.WriteString(c.Tree)
+		case spec[0] == 't':
+			b.WriteString(shortID(c.Tree))
+		case spec[0] == 'P':
+			b.WriteString(strings.Join(c.Parents, " "))
+		case spec[0] == 'p':
+			short := make([]string, len(c.Parents))
+			for i, parent := range c.Parents {
+				short[i] = shortID(parent)
+			}
+			b.WriteString(strings.Join(short, " "))
+		case spec[0] == 's':
+			b.WriteString(commitSubjectLine(c.Message))
+		case spec[0] == 'b':
+			b.WriteString(commitBody(c.Message))
+		case spec[0] == 'B':
+			b.WriteString(c.Message)
+		case spec[0] == 'x' && len(spec) >= 3:
+			if v, err := strconv.ParseUint(spec[1:3], 16, 8); err == nil {
+				b.WriteByte(byte(v))
+				n = 3
+			} else {
+				b.WriteString("%x")
+			}
+		case (spec[0] == 'a' || spec[0] == 'c') && len(spec) >= 2:
+			sig := c.Author
+			if spec[0] == 'c' {
+				sig = c.Committer
+			}
+			s, ok := formatSignature(sig, spec[1])
+			if !ok {
+				b.WriteString("%" + spec[:2])
+			}
+			b.WriteString(s)
+			n = 2
+		default:
+			b.WriteByte('%')
+			n = 0
+		}
+		i += n
+	}
+	return b.String()
+}
+
+// formatSignature expands the second letter of an %a or %c placeholder.
+func formatSignature(sig object.Signature, field byte) (string, bool) {
+	switch field {
+	case 'n':
+		return sig.Name, true
+	case 'e':
+		return sig.Email, true
+	case 'd':
+		return sig.When.Format(gitDateLayout), true
+	case 't':
+		return strconv.FormatInt(sig.When.Unix(), 10), true
+	case 'i':
+		return sig.When.Format("2006-01-02 15:04:05 -0700"), true
+	case 'I':
+		return sig.When.Format("2006-01-02T15:04:05-07:00"), true
+	case 'r':
+		return relativeDate(sig.When, time.Now()), true
+	}
+	return "", false
+}
+
+// relativeDate describes t the way git's --date=relative does.
+func relativeDate(t, now time.Time) string {
+	seconds := int64(now.Sub(t) / time.Second)
+	if seconds < 0 {
+		return "in the future"
+	}
+	plural := func(n int64, unit string) string {
+		if n == 1 {
+			return fmt.Sprintf("%d %s ago", n, unit)
+		}
+		return fmt.Sprintf("%d %ss ago", n, unit)
+	}
+	minutes := (seconds + 30) / 60
+	hours := (minutes + 30) / 60
+	days := (hours + 12) / 24
+	switch {
+	case seconds < 90:
+		return plural(seconds, "second")
+	case minutes < 90:
+		return plural(minutes, "minute")
+	case hours < 36:
+		return plural(hours, "hour")
+	case days < 14:
+		return plural(days, "day")
+	case days < 70:
+		return plural((days+3)/7, "week")
+	case days < 365:
+		return plural((days+15)/30, "month")
+	}
+	return plural((days+183)/365, "year")
+}
+
+// commitSubjectLine returns the first paragraph of message joined into
+// one line, as git's %s does.
+func commitSubjectLine(message string) string {
+	paragraph, _, _ := strings.Cut(strings.TrimLeft(message, "\n"), "\n\n")
+	lines := strings.Split(strings.TrimRight(paragraph, "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(line)
+	}
+	return strings.Join(lines, " ")
+}
+
+// commitBody returns message without its subject paragraph.
+func commitBody(message string) string {
+	_, body, _ := strings.Cut(strings.TrimLeft(message, "\n"), "\n\n")
+	return strings.TrimLeft(body, "\n")
+}
+
+// shortID abbreviates hash for display, falling back to seven
+// characters if the object store cannot be searched.
+func shortID(hash string) string {
+	short, err := abbreviateID(hash)
+	if err != nil {
+		return hash[:7]
+	}
+	return short
+}
+
+// expandCountFlags rewrites git's -<n> and -n<n> spellings of the
+// commit limit into the -n <n> the flag package understands.
+func expandCountFlags(args []string) []string {
+	var expanded []string
+	for _, arg := range args {
+		count, ok := strings.CutPrefix(arg, "-n")
+		if !ok {
+			count, ok = strings.CutPrefix(arg, "-")
+		}
+		if _, err := strconv.Atoi(count); ok && err == nil && !strings.HasPrefix(count, "-") {
+			expanded = append(expanded, "-n", count)
+			continue
+		}
+		expanded = append(expanded, arg)
+	}
+	return expanded
+}
+
+// parseLogDate parses a --since or --until date: an absolute date, a
+// Unix timestamp written @<seconds>, "<n> <unit>s ago", or yesterday.
+func parseLogDate(s string, now time.Time) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if seconds, ok := strings.CutPrefix(s, "@"); ok {
+		n, err := strconv.ParseInt(seconds, 10, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid date '%s'", s)
+		}
+		return time.Unix(n, 0), nil
+	}
+	for _, layout := range []string{
+		time.RFC3339,
+		"2006-01-02 15:04:05 -0700",
+		"2006-01-02T15:04:05",
+		"2006-01-02 15:04:05",
+		"2006-01-02 15:04",
+		gitDateLayout,
+	} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		// Like git, a bare date means that day at the current time.
+		now := now.In(time.Local)
+		return time.Date(t.Year(), t.Month(), t.Day(), now.Hour(), now.Minute(), now.Second(), 0, time.Local), nil
+	}
+
+	switch s {
+	case "now":
+		return now, nil
+	case "yesterday":
+		return now.AddDate(0, 0, -1), nil
+	}
+	fields := strings.Fields(strings.ReplaceAll(s, ".", " "))
+	if len(fields) == 3 && fields[2] == "ago" {
+		n, err := strconv.Atoi(fields[0])
+		if err == nil {
+			switch strings.TrimSuffix(fields[1], "s") {
+			case "second":
+				return now.Add(-time.Duration(n) * time.Second), nil
+			case "minute":
+				return now.Add(-time.Duration(n) * time.Minute), nil
+			case "hour":
+				return now.Add(-time.Duration(n) * time.Hour), nil
+			case "day":
+				return now.AddDate(0, 0, -n), nil
+			case "week":
+				return now.AddDate(0, 0, -7*n), nil
+			case "month":
+				return now.AddDate(0, -n, 0), nil
+			case "year":
+				return now.AddDate(-n, 0, 0), nil
+			}
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date '%s'", s)
+}
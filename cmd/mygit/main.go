@@ -1,165 +1,291 @@
 package main
 
 import (
-	"bytes"
-	"compress/zlib"
-	"crypto/sha1"
-	"encoding/hex"
+	"bufio"
+	"errors"
 	"flag"
 	"fmt"
-	"io"
+	"net/http"
 	"os"
 	"path/filepath"
-	"sort"
 	"strings"
 	"time"
 
+	"github.com/codecrafters-io/git-starter-go/atomicfile"
+	"github.com/codecrafters-io/git-starter-go/index"
+	"github.com/codecrafters-io/git-starter-go/object"
+	"github.com/codecrafters-io/git-starter-go/pack"
+	"github.com/codecrafters-io/git-starter-go/refs"
+	"github.com/codecrafters-io/git-starter-go/server"
+	"github.com/codecrafters-io/git-starter-go/storage"
+
 	"gopkg.in/ini.v1"
 )
 
-func hashFile(fileContents []byte) (string, error) {
-	header := fmt.Sprintf("blob %d\x00", len(fileContents))
-	data := append([]byte(header), fileContents...)
+var (
+	repoFormat *object.Format
+	objects    *storage.DiskStore
+)
 
-	hash := fmt.Sprintf("%x", sha1.Sum(data))
-	objectDir := fmt.Sprintf(".git/objects/%s", hash[:2])
-	objectPath := fmt.Sprintf("%s/%s", objectDir, hash[2:])
+// objectFormat returns the hash algorithm of the repository, set by
+// extensions.objectFormat and SHA-1 by default.
+func objectFormat() (*object.Format, error) {
+	if repoFormat != nil {
+		return repoFormat, nil
+	}
 
-	if _, err := os.Stat(objectPath); err == nil {
-		return hash, nil
+	cfg, err := loadConfig()
+	if err != nil {
+		return nil, err
 	}
+	f := object.SHA1
+	if name := configValue(cfg.Section("extensions"), "objectFormat"); name != "" {
+		if f, err = object.FormatByName(name); err != nil {
+			return nil, fmt.Errorf("error reading extensions.objectFormat: %w", err)
+		}
+	}
+	repoFormat = f
+	return repoFormat, nil
+}
 
-	err := os.MkdirAll(objectDir, os.ModePerm)
+func objectStore() (*storage.DiskStore, error) {
+	if objects != nil {
+		return objects, nil
+	}
+
+	f, err := objectFormat()
+	if err != nil {
+		return nil, err
+	}
+	store, err := storage.Open(filepath.Join(".git", "objects"), f)
 	if err != nil {
-		return "", fmt.Errorf("error creating directory: %w", err)
+		return nil, fmt.Errorf("error opening object store: %w", err)
+	}
+	if store.Loose.Sync, err = shouldFsync(fsyncLooseObject); err != nil {
+		return nil, err
+	}
+	if store.Packs.Sync, err = shouldFsync(fsyncPack | fsyncPackMetadata); err != nil {
+		return nil, err
+	}
+	if store.BigFileThreshold, err = bigFileThreshold(); err != nil {
+		return nil, err
 	}
+	objects = store
+	return objects, nil
+}
 
-	objectFile, err := os.Create(objectPath)
+func writeObject(objType object.Type, content []byte) (string, error) {
+	store, err := objectStore()
 	if err != nil {
-		return "", fmt.Errorf("error creating file: %w", err)
+		return "", err
 	}
-	defer objectFile.Close()
+	return store.Put(objType, content)
+}
 
-	zw := zlib.NewWriter(objectFile)
-	_, err = zw.Write(data)
+func readObject(hash string) (object.Type, []byte, error) {
+	store, err := objectStore()
 	if err != nil {
-		return "", fmt.Errorf("error compressing file: %w", err)
+		return 0, nil, err
+	}
+	objType, content, err := store.Get(hash)
+	if err == storage.ErrNotFound {
+		return 0, nil, fmt.Errorf("%w: %s", storage.ErrNotFound, hash)
 	}
-	zw.Close()
+	return objType, content, err
+}
 
-	return hash, nil
+func hashFile(fileContents []byte) (string, error) {
+	return writeObject(object.TypeBlob, fileContents)
 }
 
+// getFullHashFromAbbreviated expands an abbreviated object ID, which
+// must name exactly one object.
 func getFullHashFromAbbreviated(abbrev string) (string, error) {
-	if len(abbrev) < 7 {
-		return "", fmt.Errorf("abbreviated hash too short, must be at least 7 characters")
+	if len(abbrev) < minAbbrev {
+		return "", fmt.Errorf("abbreviated hash too short, must be at least %d characters", minAbbrev)
 	}
 
-	dir := fmt.Sprintf(".git/objects/%s", abbrev[:2])
-	files, err := os.ReadDir(dir)
+	store, err := objectStore()
 	if err != nil {
-		return "", fmt.Errorf("error reading object directory: %s", err)
+		return "", err
+	}
+	matches, err := store.FindPrefix(strings.ToLower(abbrev))
+	if err != nil {
+		return "", err
+	}
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("could not resolve full hash from abbreviated: %s", abbrev)
+	case 1:
+		return matches[0], nil
 	}
 
-	for _, file := range files {
-		if strings.HasPrefix(file.Name(), abbrev[2:]) {
-			return file.Name(), nil
+	var candidates strings.Builder
+	for _, id := range matches {
+		objType, _, err := readObject(id)
+		if err != nil {
+			return "", err
 		}
+		fmt.Fprintf(&candidates, "\n  %s %s", id, objType)
 	}
-
-	return "", fmt.Errorf("could not resolve full hash from abbreviated: %s", abbrev)
+	return "", fmt.Errorf("short object ID %s is ambiguous; the candidates are:%s", abbrev, candidates.String())
 }
 
-func hexToBytes(s string) ([]byte, error) {
-	if len(s)%2 != 0 {
-		return nil, fmt.Errorf("odd length hex string")
-	}
-	b := make([]byte, len(s)/2)
-	_, err := hex.Decode(b, []byte(s))
+// lockIndex takes .git/index.lock. Like git, it does not wait for
+// another process to release it.
+func lockIndex() (*atomicfile.File, error) {
+	sync, err := shouldFsync(fsyncIndex)
 	if err != nil {
 		return nil, err
 	}
-	return b, nil
+	return atomicfile.Lock(filepath.Join(".git", "index"), 0, sync)
 }
 
-func writeIndex(entries map[string]string) error {
-	indexPath := filepath.Join(".git", "index")
-	var buffer bytes.Buffer
+func writeIndex(idx *index.Index) error {
+	lock, err := lockIndex()
+	if err != nil {
+		return err
+	}
+	defer lock.Abort()
+	return commitIndex(lock, idx)
+}
 
-	for path, hash := range entries {
-		mode := "100644"
-		buffer.WriteString(fmt.Sprintf("%s %s\x00", mode, path))
-		hashBytes, err := hexToBytes(hash)
-		if err != nil {
-			return fmt.Errorf("error converting hash to bytes: %w", err)
-		}
-		buffer.Write(hashBytes)
+func commitIndex(lock *atomicfile.File, idx *index.Index) error {
+	w := bufio.NewWriter(lock)
+	if err := idx.Write(w); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return lock.Commit(filepath.Join(".git", "index"), 0644)
+}
+
+// updateIndex reads the index, lets fn modify it and writes it back,
+// holding index.lock throughout so that concurrent updates are not lost.
+func updateIndex(fn func(idx *index.Index) error) error {
+	lock, err := lockIndex()
+	if err != nil {
+		return err
+	}
+	defer lock.Abort()
+
+	idx, err := readIndex()
+	if err != nil {
+		return fmt.Errorf("error reading index: %w", err)
 	}
+	if err := fn(idx); err != nil {
+		return err
+	}
+	return commitIndex(lock, idx)
+}
 
-	return os.WriteFile(indexPath, buffer.Bytes(), 0644)
+// newIndex returns an empty index for the repository.
+func newIndex() (*index.Index, error) {
+	f, err := objectFormat()
+	if err != nil {
+		return nil, err
+	}
+	return index.New(f), nil
 }
 
-func readIndex() (map[string]string, error) {
+func readIndex() (*index.Index, error) {
 	indexPath := filepath.Join(".git", "index")
-	content, err := os.ReadFile(indexPath)
+	f, err := os.Open(indexPath)
 	if err != nil {
 		if os.IsNotExist(err) {
-			return make(map[string]string), nil
+			return newIndex()
 		}
 		return nil, err
 	}
+	defer f.Close()
 
-	entries := make(map[string]string)
-	for i := 0; i < len(content); {
-		if i+6 > len(content) {
-			break
-		}
-		i += 7
+	objFormat, err := objectFormat()
+	if err != nil {
+		return nil, err
+	}
+	return index.Read(f, objFormat)
+}
 
-		pathStart := i
-		nullIndex := bytes.IndexByte(content[i:], 0)
-		if nullIndex == -1 {
-			break
+func hashWorktreeFile(filePath string, info os.FileInfo) (string, error) {
+	if info.Mode()&os.ModeSymlink != 0 {
+		target, err := os.Readlink(filePath)
+		if err != nil {
+			return "", fmt.Errorf("error reading link '%s': %w", filePath, err)
 		}
-		path := string(content[pathStart : i+nullIndex])
-		i += nullIndex + 1
-
-		if i+20 > len(content) {
-			break
+		hash, err := hashFile([]byte(target))
+		if err != nil {
+			return "", fmt.Errorf("error hashing file '%s': %w", filePath, err)
 		}
-		hashBytes := content[i : i+20]
-		hash := hex.EncodeToString(hashBytes)
-		i += 20
+		return hash, nil
+	}
+
+	hash, err := hashFileStream(filePath, info.Size())
+	if err != nil {
+		return "", fmt.Errorf("error hashing file '%s': %w", filePath, err)
+	}
+	return hash, nil
+}
 
-		entries[path] = hash
+// hashFileStream stores the file at path, whose size is known from
+// Stat, as a blob without reading it into memory.
+func hashFileStream(path string, size int64) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	store, err := objectStore()
+	if err != nil {
+		return "", err
 	}
-	return entries, nil
+	return store.PutStream(object.TypeBlob, size, f)
 }
 
-func addFileToIndex(indexEntries map[string]string, filePath string) error {
-	fileContents, err := os.ReadFile(filePath)
+func addFileToIndex(idx *index.Index, filePath string) error {
+	filePath = filepath.ToSlash(filepath.Clean(filePath))
+	info, err := os.Lstat(filePath)
 	if err != nil {
 		return fmt.Errorf("error reading file '%s': %w", filePath, err)
 	}
-	hash, err := hashFile(fileContents)
+
+	hash, err := hashWorktreeFile(filePath, info)
 	if err != nil {
-		return fmt.Errorf("error hashing file '%s': %w", filePath, err)
+		return err
 	}
-	indexEntries[filePath] = hash
+	idx.Add(index.NewEntry(filePath, hash, info))
+	idx.RemoveExtension("TREE")
 	fmt.Printf("Added %s\n", filePath)
 	return nil
 }
 
-func compress(data []byte) []byte {
-	var b bytes.Buffer
-	w := zlib.NewWriter(&b)
-	w.Write(data)
-	w.Close()
-	return b.Bytes()
+// initRepository creates an empty repository using object format f.
+// Formats other than SHA-1 are recorded in extensions.objectFormat.
+func initRepository(f *object.Format) error {
+	for _, dir := range []string{".git", ".git/objects", ".git/refs"} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("error creating directory: %w", err)
+		}
+	}
+
+	repoFormat, objects, refDB = f, nil, nil
+	if err := writeSymbolicRef("HEAD", "refs/heads/main"); err != nil {
+		return fmt.Errorf("error writing HEAD: %w", err)
+	}
+
+	if f == object.SHA1 {
+		return nil
+	}
+	return updateConfig(func(cfg *ini.File) error {
+		cfg.Section("core").Key("repositoryformatversion").SetValue("1")
+		cfg.Section("extensions").Key("objectformat").SetValue(f.Name)
+		return nil
+	})
 }
 
 func getGitConfig() (name, email string, err error) {
-	cfg, err := ini.Load(filepath.Join(".git", "config"))
+	cfg, err := loadConfig()
 	if err != nil {
 		return "", "", fmt.Errorf("error reading .git/config: %w", err)
 	}
@@ -182,93 +308,65 @@ func getGitConfig() (name, email string, err error) {
 	return nameKey.String(), emailKey.String(), nil
 }
 
-func writeTreeFromIndex(indexEntries map[string]string) (string, error) {
-	var buffer bytes.Buffer
-	var entries []string
-
-	for path, hash := range indexEntries {
-		entries = append(entries, fmt.Sprintf("100644 %s\x00%s", path, hash))
-	}
-	sort.Strings(entries)
-
-	for _, entry := range entries {
-		parts := strings.SplitN(entry, "\x00", 2)
-		if len(parts) != 2 {
-			return "", fmt.Errorf("invalid index entry format: %s", entry)
-		}
-		header := parts[0]
-		hashStr := parts[1]
-		hashBytes, err := hexToBytes(hashStr)
-		if err != nil {
-			return "", fmt.Errorf("error converting hex hash to bytes: %w", err)
+func writeTreeFromIndex(idx *index.Index) (string, error) {
+	var files []object.TreeEntry
+	for _, entry := range idx.Entries {
+		if entry.Stage != 0 {
+			return "", fmt.Errorf("%s: unmerged entry", entry.Path)
 		}
-		buffer.WriteString(header)
-		buffer.Write(hashBytes)
+		files = append(files, object.TreeEntry{Mode: entry.Mode, Name: entry.Path, Hash: entry.Hash})
 	}
 
-	data := append([]byte(fmt.Sprintf("tree %d\x00", buffer.Len())), buffer.Bytes()...)
-	treeHash := fmt.Sprintf("%x", sha1.Sum(data))
-
-	objectDir := filepath.Join(".git", "objects", treeHash[:2])
-	objectPath := filepath.Join(objectDir, treeHash[2:])
-	os.MkdirAll(objectDir, 0755)
-
-	err := os.WriteFile(objectPath, compress(data), 0644)
-	if err != nil {
-		return "", err
-	}
-
-	return treeHash, nil
+	return writeTreeFromFiles(files)
 }
 
-func readCompressedObject(objectPath string) ([]byte, error) {
-	objectFile, err := os.Open(objectPath)
-	if err != nil {
-		return nil, err
-	}
-	defer objectFile.Close()
+// writeTreeFromFiles writes the nested trees for a list of entries whose
+// names are slash-separated paths, returning the root tree hash.
+// Subtrees are written before the trees that contain them.
+func writeTreeFromFiles(files []object.TreeEntry) (string, error) {
+	tree := &object.Tree{}
+	var dirNames []string
+	dirs := make(map[string][]object.TreeEntry)
 
-	zr, err := zlib.NewReader(objectFile)
-	if err != nil {
-		return nil, err
+	for _, file := range files {
+		name, rest, isNested := strings.Cut(file.Name, "/")
+		if name == "" || name == "." || name == ".." || name == ".git" {
+			return "", fmt.Errorf("invalid path '%s'", file.Name)
+		}
+		if !isNested {
+			tree.Entries = append(tree.Entries, object.TreeEntry{Mode: file.Mode, Name: name, Hash: file.Hash})
+			continue
+		}
+		if _, exists := dirs[name]; !exists {
+			dirNames = append(dirNames, name)
+		}
+		dirs[name] = append(dirs[name], object.TreeEntry{Mode: file.Mode, Name: rest, Hash: file.Hash})
 	}
-	defer zr.Close()
-
-	return io.ReadAll(zr)
-}
 
-func extractTreeHashFromCommit(commitData string) string {
-	lines := strings.SplitN(commitData, "\n", 2)
-	if len(lines) > 0 && strings.HasPrefix(lines[0], "tree ") {
-		return strings.TrimPrefix(lines[0], "tree ")
+	for _, name := range dirNames {
+		if _, exists := tree.Find(name); exists {
+			return "", fmt.Errorf("'%s' is both a file and a directory", name)
+		}
+		subtreeHash, err := writeTreeFromFiles(dirs[name])
+		if err != nil {
+			return "", err
+		}
+		tree.Entries = append(tree.Entries, object.TreeEntry{Mode: object.ModeDir, Name: name, Hash: subtreeHash})
 	}
-	return ""
+	tree.Sort()
+
+	return writeObject(object.TypeTree, tree.Encode())
 }
 
 func compareTrees(oldTreeHash, newTreeHash string) (int, int) {
-	oldEntries := readTreeEntries(oldTreeHash)
-	newEntries := readTreeEntries(newTreeHash)
-
-	insertions := 0
-	deletions := 0
-
 	oldPaths := make(map[string]string)
-	for _, entry := range oldEntries {
-		parts := strings.SplitN(entry, "\x00", 2)
-		headerParts := strings.SplitN(parts[0], " ", 2)
-		if len(headerParts) == 2 {
-			oldPaths[headerParts[1]] = parts[1]
-		}
-	}
+	readTreeFiles(oldTreeHash, "", oldPaths)
 
 	newPaths := make(map[string]string)
-	for _, entry := range newEntries {
-		parts := strings.SplitN(entry, "\x00", 2)
-		headerParts := strings.SplitN(parts[0], " ", 2)
-		if len(headerParts) == 2 {
-			newPaths[headerParts[1]] = parts[1]
-		}
-	}
+	readTreeFiles(newTreeHash, "", newPaths)
+
+	insertions := 0
+	deletions := 0
 
 	for path, newHash := range newPaths {
 		if _, exists := oldPaths[path]; !exists {
@@ -288,34 +386,36 @@ func compareTrees(oldTreeHash, newTreeHash string) (int, int) {
 	return insertions, deletions
 }
 
-func readTreeEntries(treeHash string) []string {
+// readTreeFiles records the hash of every non-tree entry reachable from
+// treeHash, keyed by its full path.
+func readTreeFiles(treeHash, prefix string, files map[string]string) {
+	for _, entry := range readTreeEntries(treeHash) {
+		if entry.Mode.IsDir() {
+			readTreeFiles(entry.Hash, prefix+entry.Name+"/", files)
+			continue
+		}
+		files[prefix+entry.Name] = entry.Hash
+	}
+}
+
+func readTreeEntries(treeHash string) []object.TreeEntry {
 	if treeHash == "" {
 		return nil
 	}
-	objectPath := filepath.Join(".git", "objects", treeHash[:2], treeHash[2:])
-	compressedData, err := readCompressedObject(objectPath)
+	_, content, err := readObject(treeHash)
 	if err != nil {
 		return nil
 	}
 
-	nullIndex := bytes.IndexByte(compressedData, 0)
-	if nullIndex == -1 {
+	f, err := objectFormat()
+	if err != nil {
 		return nil
 	}
-	content := compressedData[nullIndex+1:]
-
-	entries := []string{}
-	i := 0
-	for i < len(content) {
-		nullIndex := bytes.IndexByte(content[i:], 0)
-		if nullIndex == -1 {
-			break
-		}
-		entry := string(content[i : i+nullIndex+21])
-		entries = append(entries, entry)
-		i += nullIndex + 21
+	tree, err := object.ParseTree(content, f)
+	if err != nil {
+		return nil
 	}
-	return entries
+	return tree.Entries
 }
 
 // Usage: your_program.sh <command> <arg1> <arg2> ...
@@ -330,16 +430,20 @@ func main() {
 
 	switch command := os.Args[1]; command {
 	case "init":
-		for _, dir := range []string{".git", ".git/objects", ".git/refs"} {
-			if err := os.MkdirAll(dir, 0755); err != nil {
-				fmt.Fprintf(os.Stderr, "Error creating directory: %s\n", err)
-				os.Exit(1)
-			}
+		initCmd := flag.NewFlagSet("init", flag.ExitOnError)
+		formatFlag := initCmd.String("object-format", "sha1", "hash algorithm for object names (sha1 or sha256)")
+		if err := initCmd.Parse(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "Error parsing arguments: %s\n", err)
+			os.Exit(1)
+		}
+		f, err := object.FormatByName(*formatFlag)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error initializing repository: %s\n", err)
+			os.Exit(1)
 		}
 
-		headFileContents := []byte("ref: refs/heads/main\n")
-		if err := os.WriteFile(".git/HEAD", headFileContents, 0644); err != nil {
-			fmt.Fprintf(os.Stderr, "Error writing file: %s\n", err)
+		if err := initRepository(f); err != nil {
+			fmt.Fprintf(os.Stderr, "Error initializing repository: %s\n", err)
 			os.Exit(1)
 		}
 
@@ -356,38 +460,18 @@ func main() {
 			os.Exit(1)
 		}
 
-		object := os.Args[3]
-		objectPath := fmt.Sprintf(".git/objects/%s/%s", object[:2], object[2:])
-		objectFile, err := os.Open(objectPath)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error opening file: %s\n", err)
-			os.Exit(1)
-		}
-		defer objectFile.Close()
-
-		zr, err := zlib.NewReader(objectFile)
+		hash, err := revParse(os.Args[3])
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error creating zlib reader: %s\n", err)
+			fmt.Fprintf(os.Stderr, "Error resolving object hash: %s\n", err)
 			os.Exit(1)
 		}
-		defer zr.Close()
-
-		var out bytes.Buffer
-		_, err = io.Copy(&out, zr)
+		_, content, err := readObject(hash)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error decompressing file: %s\n", err)
-			os.Exit(1)
-		}
-
-		data := out.String()
-		nullIndex := strings.IndexByte(data, 0)
-		if nullIndex == -1 {
-			fmt.Fprintf(os.Stderr, "Invalid object format\n")
+			fmt.Fprintf(os.Stderr, "Error reading object: %s\n", err)
 			os.Exit(1)
 		}
 
-		content := data[nullIndex+1:]
-		fmt.Print(content)
+		fmt.Print(string(content))
 	case "hash-object":
 		if len(os.Args) < 4 {
 			fmt.Fprintf(os.Stderr, "usage: mygit hash-object -w <file>\n")
@@ -401,17 +485,13 @@ func main() {
 		}
 
 		file := os.Args[3]
-		fileContents := []byte{}
-		if file != "" {
-			var err error
-			fileContents, err = os.ReadFile(file)
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "Error reading file: %s\n", err)
-				os.Exit(1)
-			}
+		info, err := os.Stat(file)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading file: %s\n", err)
+			os.Exit(1)
 		}
 
-		hash, err := hashFile(fileContents)
+		hash, err := hashFileStream(file, info.Size())
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error hashing file: %s\n", err)
 			os.Exit(1)
@@ -424,136 +504,63 @@ func main() {
 			os.Exit(1)
 		}
 
-		object := os.Args[2]
-		objectDir := object[:2]
-		objectFileName := object[2:]
-
-		objectPath := fmt.Sprintf(".git/objects/%s/%s", objectDir, objectFileName)
-
-		objectFile, err := os.Open(objectPath)
-		if err != nil {
-			fullHash, err := getFullHashFromAbbreviated(object)
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "Error resolving object hash: %s\n", err)
-				os.Exit(1)
-			}
-
-			objectPath = fmt.Sprintf(".git/objects/%s/%s", objectDir, fullHash)
-			objectFile, err = os.Open(objectPath)
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "Error opening object file: %s\n", err)
-				os.Exit(1)
-			}
-		}
-		defer objectFile.Close()
-
-		zr, err := zlib.NewReader(objectFile)
+		hash, err := revParse(os.Args[2])
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error creating zlib reader: %s\n", err)
+			fmt.Fprintf(os.Stderr, "Error resolving object hash: %s\n", err)
 			os.Exit(1)
 		}
-		defer zr.Close()
-
-		var out bytes.Buffer
-		_, err = io.Copy(&out, zr)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error decompressing file: %s\n", err)
+		if hash, err = peelObject(hash, object.TypeTree); err != nil {
+			fmt.Fprintf(os.Stderr, "Error resolving object hash: %s\n", err)
 			os.Exit(1)
 		}
 
-		data := out.String()
-		nullIndex := strings.IndexByte(data, 0)
-		if nullIndex == -1 {
-			fmt.Fprintf(os.Stderr, "Invalid object format\n")
+		_, content, err := readObject(hash)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading object: %s\n", err)
 			os.Exit(1)
 		}
 
-		content := data[nullIndex+1:]
-		fmt.Print(content)
+		fmt.Print(string(content))
 	case "read-tree":
 		if len(os.Args) < 3 {
 			fmt.Fprintf(os.Stderr, "usage: mygit read-tree <object>\n")
 			os.Exit(1)
 		}
 
-		object := os.Args[2]
-		objectDir := object[:2]
-		objectFileName := object[2:]
-
-		objectPath := fmt.Sprintf(".git/objects/%s/%s", objectDir, objectFileName)
-
-		objectFile, err := os.Open(objectPath)
+		hash, err := revParse(os.Args[2])
 		if err != nil {
-			fullHash, err := getFullHashFromAbbreviated(object)
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "Error resolving object hash: %s\n", err)
-				os.Exit(1)
-			}
-
-			objectPath = fmt.Sprintf(".git/objects/%s/%s", objectDir, fullHash)
-			objectFile, err = os.Open(objectPath)
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "Error opening object file: %s\n", err)
-				os.Exit(1)
-			}
+			fmt.Fprintf(os.Stderr, "Error resolving object hash: %s\n", err)
+			os.Exit(1)
+		}
+		if hash, err = peelObject(hash, object.TypeTree); err != nil {
+			fmt.Fprintf(os.Stderr, "Error resolving object hash: %s\n", err)
+			os.Exit(1)
 		}
-		defer objectFile.Close()
 
-		zr, err := zlib.NewReader(objectFile)
+		_, content, err := readObject(hash)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error creating zlib reader: %s\n", err)
+			fmt.Fprintf(os.Stderr, "Error reading object: %s\n", err)
 			os.Exit(1)
 		}
-		defer zr.Close()
 
-		var out bytes.Buffer
-		_, err = io.Copy(&out, zr)
+		f, err := objectFormat()
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error decompressing file: %s\n", err)
+			fmt.Fprintf(os.Stderr, "Error reading object format: %s\n", err)
 			os.Exit(1)
 		}
-
-		data := out.Bytes()
-
-		nullIndex := bytes.IndexByte(data, 0)
-		if nullIndex == -1 {
-			fmt.Fprintf(os.Stderr, "Invalid object format\n")
+		tree, err := object.ParseTree(content, f)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid object format: %s\n", err)
 			os.Exit(1)
 		}
 
-		content := data[nullIndex+1:]
-
 		fmt.Println("Tree Object Contents:")
 
-		i := 0
-		for i < len(content) {
-			spaceIndex := bytes.IndexByte(content[i:], ' ')
-			if spaceIndex == -1 {
-				break
-			}
-			mode := string(content[i : i+spaceIndex])
-			startOfPath := i + spaceIndex + 1
-
-			nullIndex := bytes.IndexByte(content[startOfPath:], 0)
-			if nullIndex == -1 {
-				break
-			}
-			path := string(content[startOfPath : startOfPath+nullIndex])
-			startOfHash := startOfPath + nullIndex + 1
-
-			if startOfHash+20 > len(content) {
-				break
-			}
-			hashBytes := content[startOfHash : startOfHash+20]
-			hash := hex.EncodeToString(hashBytes)
-
-			fmt.Printf("Mode: %s | Path: %s | Hash: %s\n", mode, path, hash)
-
-			i = startOfHash + 20
+		for _, entry := range tree.Entries {
+			fmt.Printf("Mode: %s | Path: %s | Hash: %s\n", entry.Mode, entry.Name, entry.Hash)
 		}
 	case "write-tree":
-		var buffer bytes.Buffer
-		directories := make(map[string]bool)
+		var files []object.TreeEntry
 
 		err := filepath.Walk(".", func(path string, info os.FileInfo, err error) error {
 			if err != nil {
@@ -564,43 +571,16 @@ func main() {
 				return filepath.SkipDir
 			}
 
-			if strings.HasPrefix(path, ".git/") {
-				return nil
-			}
-
-			if path == "." {
-				return nil
-			}
-
-			mode := "100644"
-
 			if info.IsDir() {
-				if _, exists := directories[path]; !exists {
-					directories[path] = true
-					mode = "40000"
-					buffer.WriteString(fmt.Sprintf("%s %s\x00", mode, path))
-					buffer.Write(make([]byte, 20))
-				}
 				return nil
 			}
 
-			fileContents, err := os.ReadFile(path)
-			if err != nil {
-				return fmt.Errorf("error reading file %s: %w", path, err)
-			}
-
-			fileHash, err := hashFile(fileContents)
-			if err != nil {
-				return fmt.Errorf("error hashing file %s: %w", path, err)
-			}
-
-			hashBytes, err := hexToBytes(fileHash)
+			fileHash, err := hashWorktreeFile(path, info)
 			if err != nil {
-				return fmt.Errorf("error converting hex to bytes: %w", err)
+				return err
 			}
 
-			buffer.WriteString(fmt.Sprintf("%s %s\x00", mode, path))
-			buffer.Write(hashBytes)
+			files = append(files, object.TreeEntry{Mode: index.FileModeOf(info), Name: filepath.ToSlash(path), Hash: fileHash})
 			return nil
 		})
 
@@ -609,28 +589,11 @@ func main() {
 			os.Exit(1)
 		}
 
-		data := append([]byte(fmt.Sprintf("tree %d\x00", buffer.Len())), buffer.Bytes()...)
-		treeHash := fmt.Sprintf("%x", sha1.Sum(data))
-
-		objectDir := fmt.Sprintf(".git/objects/%s", treeHash[:2])
-		objectPath := fmt.Sprintf("%s/%s", objectDir, treeHash[2:])
-
-		os.MkdirAll(objectDir, os.ModePerm)
-
-		objectFile, err := os.Create(objectPath)
+		treeHash, err := writeTreeFromFiles(files)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error creating tree object: %s\n", err)
+			fmt.Fprintf(os.Stderr, "Error writing tree object: %s\n", err)
 			os.Exit(1)
 		}
-		defer objectFile.Close()
-
-		zw := zlib.NewWriter(objectFile)
-		_, err = zw.Write(data)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error compressing tree object: %s\n", err)
-			os.Exit(1)
-		}
-		zw.Close()
 
 		fmt.Println(treeHash)
 	case "add":
@@ -639,47 +602,40 @@ func main() {
 			os.Exit(1)
 		}
 
-		indexEntries, err := readIndex()
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error reading index: %s\n", err)
-			os.Exit(1)
-		}
-
 		filesToAdd := os.Args[2:]
 		if len(filesToAdd) == 0 {
 			fmt.Fprintf(os.Stderr, "usage: mygit add [<file>...]\n")
 			os.Exit(1)
 		}
 
-		for _, pattern := range filesToAdd {
-			if pattern == "." {
-				err := filepath.Walk(".", func(path string, info os.FileInfo, err error) error {
+		err := updateIndex(func(idx *index.Index) error {
+			for _, pattern := range filesToAdd {
+				if pattern == "." {
+					err := filepath.Walk(".", func(path string, info os.FileInfo, err error) error {
+						if err != nil {
+							return err
+						}
+						if info.IsDir() {
+							return nil
+						}
+						if strings.HasPrefix(path, ".git/") || path == ".git" {
+							return nil
+						}
+						return addFileToIndex(idx, path)
+					})
 					if err != nil {
-						return err
-					}
-					if info.IsDir() {
-						return nil
+						return fmt.Errorf("error walking directory: %w", err)
 					}
-					if strings.HasPrefix(path, ".git/") || path == ".git" {
-						return nil
+				} else {
+					if err := addFileToIndex(idx, pattern); err != nil {
+						return fmt.Errorf("error adding file '%s': %w", pattern, err)
 					}
-					return addFileToIndex(indexEntries, path)
-				})
-				if err != nil {
-					fmt.Fprintf(os.Stderr, "Error walking directory: %s\n", err)
-					os.Exit(1)
-				}
-			} else {
-				err := addFileToIndex(indexEntries, pattern)
-				if err != nil {
-					fmt.Fprintf(os.Stderr, "Error adding file '%s': %s\n", pattern, err)
 				}
 			}
-		}
-
-		err = writeIndex(indexEntries)
+			return nil
+		})
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error writing index: %s\n", err)
+			fmt.Fprintf(os.Stderr, "Error updating index: %s\n", err)
 			os.Exit(1)
 		}
 	case "commit":
@@ -701,85 +657,91 @@ func main() {
 			fmt.Fprintf(os.Stderr, "Error getting Git config: %s\n", err)
 			os.Exit(1)
 		}
-		committerName := authorName
-		committerEmail := authorEmail
-		timestamp := time.Now().Unix()
-		timezone := time.Now().Format("-0700")
+		now := time.Now()
+		author := object.Signature{Name: authorName, Email: authorEmail, When: now}
 
-		indexEntries, err := readIndex()
+		idx, err := readIndex()
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error reading index: %s\n", err)
 			os.Exit(1)
 		}
 
-		if len(indexEntries) == 0 {
+		if len(idx.Entries) == 0 {
 			fmt.Fprintf(os.Stderr, "No changes staged to commit\n")
 			os.Exit(1)
 		}
 
-		treeHash, err := writeTreeFromIndex(indexEntries)
+		treeHash, err := writeTreeFromIndex(idx)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error writing tree from index: %s\n", err)
 			os.Exit(1)
 		}
 
-		parentHash := ""
-		headContent, err := os.ReadFile(".git/HEAD")
-		if err == nil {
-			headStr := strings.TrimSpace(string(headContent))
-			if strings.HasPrefix(headStr, "ref: ") {
-				refPath := strings.TrimSpace(strings.TrimPrefix(headStr, "ref:"))
-				refContent, err := os.ReadFile(filepath.Join(".git", refPath))
-				if err == nil {
-					parentHash = strings.TrimSpace(string(refContent))
-				}
-			}
+		store, err := refStore()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading HEAD: %s\n", err)
+			os.Exit(1)
+		}
+		headRef, parentHash, err := store.Resolve("HEAD")
+		if err != nil && !errors.Is(err, refs.ErrNotFound) {
+			fmt.Fprintf(os.Stderr, "Error reading HEAD: %s\n", err)
+			os.Exit(1)
+		}
+		if parentTree, err := commitTree(parentHash); err == nil && parentTree == treeHash {
+			fmt.Fprintf(os.Stderr, "No changes staged to commit\n")
+			os.Exit(1)
 		}
 
-		var commitContent strings.Builder
-		commitContent.WriteString(fmt.Sprintf("tree %s\n", treeHash))
+		commit := &object.Commit{
+			Tree:      treeHash,
+			Author:    author,
+			Committer: author,
+			Message:   *messageFlag,
+		}
 		if parentHash != "" {
-			commitContent.WriteString(fmt.Sprintf("parent %s\n", parentHash))
+			commit.Parents = []string{parentHash}
 		}
-		commitContent.WriteString(fmt.Sprintf("author %s <%s> %d %s\n", authorName, authorEmail, timestamp, timezone))
-		commitContent.WriteString(fmt.Sprintf("committer %s <%s> %d %s\n", committerName, committerEmail, timestamp, timezone))
-		commitContent.WriteString("\n")
-		commitContent.WriteString(*messageFlag)
-
-		commitData := []byte(commitContent.String())
-		header := fmt.Sprintf("commit %d\x00", len(commitData))
-		fullCommitData := append([]byte(header), commitData...)
 
-		commitHash := fmt.Sprintf("%x", sha1.Sum(fullCommitData))
-		objectDir := filepath.Join(".git", "objects", commitHash[:2])
-		objectPath := filepath.Join(objectDir, commitHash[2:])
-		os.MkdirAll(objectDir, 0755)
-		err = os.WriteFile(objectPath, compress(fullCommitData), 0644)
+		commitHash, err := writeObject(object.TypeCommit, commit.Encode())
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error writing commit object: %s\n", err)
 			os.Exit(1)
 		}
 
-		currentBranch := ""
-		headContent, err = os.ReadFile(".git/HEAD")
-		if err == nil {
-			headStr := strings.TrimSpace(string(headContent))
-			if strings.HasPrefix(headStr, "ref: refs/heads/") {
-				currentBranch = strings.TrimPrefix(headStr, "ref: refs/heads/")
-			}
+		// An unborn branch must still not exist when it is created.
+		old := parentHash
+		if old == "" {
+			old = repoFormat.ZeroID()
+		}
+		reflogMessage := "commit: "
+		if parentHash == "" {
+			reflogMessage = "commit (initial): "
+		}
+		tx := store.Transaction()
+		subject, _, _ := strings.Cut(commit.Message, "\n")
+		tx.SetReflog(author, reflogMessage+subject)
+		tx.Update(headRef, old, commitHash)
+		if err := tx.Commit(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error updating ref: %s\n", err)
+			os.Exit(1)
 		}
 
+		currentBranch := "detached HEAD"
+		if headRef != "HEAD" {
+			currentBranch = strings.TrimPrefix(headRef, "refs/heads/")
+		}
 		shortCommitHash := commitHash[:7]
 
 		var changesSummary string
 		if parentHash == "" {
-			changesSummary = fmt.Sprintf("%d insertions(+)", len(indexEntries))
+			changesSummary = fmt.Sprintf("%d insertions(+)", len(idx.Entries))
 		} else {
 			parentTreeHash := ""
-			parentCommitPath := filepath.Join(".git", "objects", parentHash[:2], parentHash[2:])
-			parentCommitData, err := readCompressedObject(parentCommitPath)
+			_, parentCommitData, err := readObject(parentHash)
 			if err == nil {
-				parentTreeHash = extractTreeHashFromCommit(string(parentCommitData))
+				if parentCommit, err := object.ParseCommit(parentCommitData); err == nil {
+					parentTreeHash = parentCommit.Tree
+				}
 			}
 			insertions, deletions := compareTrees(parentTreeHash, treeHash)
 			changesSummary = fmt.Sprintf("%d insertions(+), %d deletions(-)", insertions, deletions)
@@ -790,39 +752,509 @@ func main() {
 			fmt.Println(changesSummary)
 		}
 
-		headContent, err = os.ReadFile(".git/HEAD")
-		if err == nil {
-			headStr := strings.TrimSpace(string(headContent))
-			if strings.HasPrefix(headStr, "ref: ") {
-				refPath := strings.TrimSpace(strings.TrimPrefix(headStr, "ref:"))
-				refFilePath := filepath.Join(".git", refPath)
-				err = os.WriteFile(refFilePath, []byte(commitHash+"\n"), 0644)
-				if err != nil {
-					if os.IsNotExist(err) {
-						err = os.MkdirAll(filepath.Dir(refFilePath), 0755)
-						if err != nil {
-							fmt.Fprintf(os.Stderr, "Error creating ref directory: %s\n", err)
-							os.Exit(1)
-						}
-						err = os.WriteFile(refFilePath, []byte(commitHash+"\n"), 0644)
-						if err != nil {
-							fmt.Fprintf(os.Stderr, "Error creating and updating ref: %s\n", err)
-							os.Exit(1)
-						}
-						fmt.Println(commitHash)
-					} else {
-						fmt.Fprintf(os.Stderr, "Error updating ref: %s\n", err)
-						os.Exit(1)
-					}
-				} else {
-					fmt.Println(commitHash)
+		fmt.Println(commitHash)
+	case "branch":
+		branchCmd := flag.NewFlagSet("branch", flag.ExitOnError)
+		verboseFlag := branchCmd.Bool("v", false, "show commit, upstream status and subject")
+		deleteFlag := branchCmd.Bool("d", false, "delete fully merged branches")
+		forceDeleteFlag := branchCmd.Bool("D", false, "delete branches even if not merged")
+		moveFlag := branchCmd.Bool("m", false, "rename a branch and its reflog")
+		upstreamFlag := branchCmd.String("set-upstream-to", "", "set the upstream of a branch")
+		branchCmd.StringVar(upstreamFlag, "u", "", "shorthand for --set-upstream-to")
+		if err := branchCmd.Parse(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "Error parsing arguments: %s\n", err)
+			os.Exit(1)
+		}
+
+		args := branchCmd.Args()
+		switch {
+		case *deleteFlag || *forceDeleteFlag:
+			if len(args) == 0 {
+				fmt.Fprintf(os.Stderr, "usage: mygit branch (-d | -D) <branch>...\n")
+				os.Exit(1)
+			}
+			failed := false
+			for _, name := range args {
+				if err := deleteBranch(name, *forceDeleteFlag); err != nil {
+					fmt.Fprintf(os.Stderr, "Error deleting branch: %s\n", err)
+					failed = true
 				}
 			}
+			if failed {
+				os.Exit(1)
+			}
+		case *moveFlag:
+			if len(args) == 0 || len(args) > 2 {
+				fmt.Fprintf(os.Stderr, "usage: mygit branch -m [<old-branch>] <new-branch>\n")
+				os.Exit(1)
+			}
+			oldName, newName := "", args[0]
+			if len(args) == 2 {
+				oldName, newName = args[0], args[1]
+			}
+			if err := renameBranch(oldName, newName); err != nil {
+				fmt.Fprintf(os.Stderr, "Error renaming branch: %s\n", err)
+				os.Exit(1)
+			}
+		case *upstreamFlag != "":
+			if len(args) > 1 {
+				fmt.Fprintf(os.Stderr, "usage: mygit branch --set-upstream-to=<upstream> [<branch>]\n")
+				os.Exit(1)
+			}
+			branch := ""
+			if len(args) == 1 {
+				branch = args[0]
+			} else if head, err := headBranch(); err == nil && head != "" {
+				branch = strings.TrimPrefix(head, "refs/heads/")
+			} else {
+				fmt.Fprintf(os.Stderr, "Error setting upstream: HEAD is not on any branch\n")
+				os.Exit(1)
+			}
+			if err := setUpstream(branch, *upstreamFlag); err != nil {
+				fmt.Fprintf(os.Stderr, "Error setting upstream: %s\n", err)
+				os.Exit(1)
+			}
+		case len(args) == 0:
+			if err := listBranches(*verboseFlag); err != nil {
+				fmt.Fprintf(os.Stderr, "Error listing branches: %s\n", err)
+				os.Exit(1)
+			}
+		default:
+			if len(args) > 2 {
+				fmt.Fprintf(os.Stderr, "usage: mygit branch <branch> [<start-point>]\n")
+				os.Exit(1)
+			}
+			start := ""
+			if len(args) == 2 {
+				start = args[1]
+			}
+			if err := createBranch(args[0], start); err != nil {
+				fmt.Fprintf(os.Stderr, "Error creating branch: %s\n", err)
+				os.Exit(1)
+			}
+		}
+	case "switch":
+		switchCmd := flag.NewFlagSet("switch", flag.ExitOnError)
+		createFlag := switchCmd.String("c", "", "create a new branch and switch to it")
+		orphanFlag := switchCmd.String("orphan", "", "switch to a new unborn branch with an empty tree")
+		detachFlag := switchCmd.Bool("detach", false, "check out a commit with HEAD detached")
+		if err := switchCmd.Parse(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "Error parsing arguments: %s\n", err)
+			os.Exit(1)
+		}
+
+		var err error
+		args := switchCmd.Args()
+		switch {
+		case *createFlag != "" && len(args) <= 1:
+			start := ""
+			if len(args) == 1 {
+				start = args[0]
+			}
+			err = switchNewBranch(*createFlag, start)
+		case *orphanFlag != "" && len(args) == 0:
+			err = switchOrphan(*orphanFlag)
+		case *detachFlag && len(args) <= 1:
+			rev := "HEAD"
+			if len(args) == 1 {
+				rev = args[0]
+			}
+			err = detachHead(rev)
+		case *createFlag == "" && *orphanFlag == "" && !*detachFlag && len(args) == 1:
+			err = switchBranch(args[0])
+		default:
+			fmt.Fprintf(os.Stderr, "usage: mygit switch [-c <new-branch> [<start-point>] | --orphan <new-branch> | --detach [<commit>] | <branch>]\n")
+			os.Exit(1)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error switching: %s\n", err)
+			os.Exit(1)
+		}
+	case "checkout":
+		checkoutCmd := flag.NewFlagSet("checkout", flag.ExitOnError)
+		newBranchFlag := checkoutCmd.String("b", "", "create a new branch and check it out")
+		detachFlag := checkoutCmd.Bool("detach", false, "check out a commit with HEAD detached")
+		if err := checkoutCmd.Parse(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "Error parsing arguments: %s\n", err)
+			os.Exit(1)
 		}
 
-		err = writeIndex(make(map[string]string))
+		var err error
+		args := checkoutCmd.Args()
+		switch {
+		case *newBranchFlag != "" && len(args) <= 1:
+			start := ""
+			if len(args) == 1 {
+				start = args[0]
+			}
+			err = switchNewBranch(*newBranchFlag, start)
+		case *detachFlag && len(args) <= 1:
+			rev := "HEAD"
+			if len(args) == 1 {
+				rev = args[0]
+			}
+			err = detachHead(rev)
+		case *newBranchFlag == "" && !*detachFlag && len(args) == 1:
+			err = checkoutRevision(args[0])
+		default:
+			fmt.Fprintf(os.Stderr, "usage: mygit checkout [-b <new-branch>] [--detach] <branch-or-commit>\n")
+			os.Exit(1)
+		}
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error clearing index: %s\n", err)
+			fmt.Fprintf(os.Stderr, "Error checking out: %s\n", err)
+			os.Exit(1)
+		}
+	case "log":
+		// Everything after "--" is a path, which the flag package would
+		// otherwise swallow along with the marker.
+		args, paths := os.Args[2:], []string(nil)
+		for i, arg := range args {
+			if arg == "--" {
+				args, paths = args[:i], args[i+1:]
+				break
+			}
+		}
+
+		logCmd := flag.NewFlagSet("log", flag.ExitOnError)
+		opts := logOptions{}
+		logCmd.IntVar(&opts.MaxCount, "n", -1, "show at most this many commits")
+		logCmd.IntVar(&opts.MaxCount, "max-count", -1, "show at most this many commits")
+		logCmd.BoolVar(&opts.Oneline, "oneline", false, "show each commit as its abbreviated ID and subject")
+		formatFlag := logCmd.String("format", "", "format commits with placeholders such as %H, %an and %s")
+		sinceFlag := logCmd.String("since", "", "show commits more recent than a date")
+		logCmd.StringVar(sinceFlag, "after", "", "same as --since")
+		untilFlag := logCmd.String("until", "", "show commits older than a date")
+		logCmd.StringVar(untilFlag, "before", "", "same as --until")
+		logCmd.Var(&opts.Authors, "author", "show commits whose author matches a regex")
+		logCmd.Var(&opts.Greps, "grep", "show commits whose message matches a regex")
+		logCmd.BoolVar(&opts.FirstParent, "first-parent", false, "follow only the first parent of merges")
+		if err := logCmd.Parse(expandCountFlags(args)); err != nil {
+			fmt.Fprintf(os.Stderr, "Error parsing arguments: %s\n", err)
+			os.Exit(1)
+		}
+
+		switch format := *formatFlag; {
+		case format == "oneline":
+			opts.Format = "%H %s"
+		case format == "" || format == "medium":
+		case strings.HasPrefix(format, "format:"):
+			opts.Format, opts.FormatSeparator = strings.TrimPrefix(format, "format:"), true
+		default:
+			opts.Format = strings.TrimPrefix(format, "tformat:")
+		}
+		now := time.Now()
+		var err error
+		if *sinceFlag != "" {
+			if opts.Since, err = parseLogDate(*sinceFlag, now); err != nil {
+				fmt.Fprintf(os.Stderr, "Error parsing arguments: %s\n", err)
+				os.Exit(1)
+			}
+		}
+		if *untilFlag != "" {
+			if opts.Until, err = parseLogDate(*untilFlag, now); err != nil {
+				fmt.Fprintf(os.Stderr, "Error parsing arguments: %s\n", err)
+				os.Exit(1)
+			}
+		}
+		for _, p := range paths {
+			p = cleanPathspec(p)
+			if p == "" {
+				opts.Paths = nil
+				break
+			}
+			opts.Paths = append(opts.Paths, p)
+		}
+
+		if err := showLog(logCmd.Args(), opts); err != nil {
+			fmt.Fprintf(os.Stderr, "Error showing log: %s\n", err)
+			os.Exit(1)
+		}
+	case "rev-parse":
+		revParseCmd := flag.NewFlagSet("rev-parse", flag.ExitOnError)
+		var opts revParseOptions
+		revParseCmd.BoolVar(&opts.Verify, "verify", false, "require exactly one revision naming an existing object")
+		revParseCmd.BoolVar(&opts.Short, "short", false, "abbreviate object IDs")
+		revParseCmd.BoolVar(&opts.AbbrevRef, "abbrev-ref", false, "print short ref names")
+		revParseCmd.BoolVar(&opts.SymbolicFullName, "symbolic-full-name", false, "print full ref names")
+		if err := revParseCmd.Parse(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "Error parsing arguments: %s\n", err)
+			os.Exit(1)
+		}
+
+		args := revParseCmd.Args()
+		if opts.Verify && len(args) != 1 {
+			fmt.Fprintf(os.Stderr, "Error parsing revision: needed a single revision\n")
+			os.Exit(1)
+		}
+		for _, arg := range args {
+			lines, err := revParseArg(arg, opts)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error parsing revision: %s\n", err)
+				os.Exit(1)
+			}
+			for _, line := range lines {
+				fmt.Println(line)
+			}
+		}
+	case "clone":
+		cloneCmd := flag.NewFlagSet("clone", flag.ExitOnError)
+		depthFlag := cloneCmd.Int("depth", 0, "create a shallow clone with that many commits")
+		if err := cloneCmd.Parse(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "Error parsing arguments: %s\n", err)
+			os.Exit(1)
+		}
+		args := cloneCmd.Args()
+		if len(args) < 1 || len(args) > 2 {
+			fmt.Fprintf(os.Stderr, "usage: mygit clone [--depth <n>] <url> [<dir>]\n")
+			os.Exit(1)
+		}
+
+		url := args[0]
+		dir := cloneDirName(url)
+		if len(args) == 2 {
+			dir = args[1]
+		}
+
+		opts := cloneOptions{Depth: *depthFlag}
+		if err := cloneRepository(url, dir, opts); err != nil {
+			fmt.Fprintf(os.Stderr, "Error cloning repository: %s\n", err)
+			os.Exit(1)
+		}
+	case "fetch":
+		fetchCmd := flag.NewFlagSet("fetch", flag.ExitOnError)
+		pruneFlag := fetchCmd.Bool("prune", false, "remove remote-tracking refs that no longer exist on the remote")
+		forceFlag := fetchCmd.Bool("force", false, "allow non-fast-forward updates")
+		fetchCmd.BoolVar(pruneFlag, "p", false, "shorthand for --prune")
+		fetchCmd.BoolVar(forceFlag, "f", false, "shorthand for --force")
+		if err := fetchCmd.Parse(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "Error parsing arguments: %s\n", err)
+			os.Exit(1)
+		}
+
+		remote := defaultRemote()
+		args := fetchCmd.Args()
+		if len(args) > 0 {
+			remote, args = args[0], args[1:]
+		}
+
+		opts := fetchOptions{Force: *forceFlag, Prune: *pruneFlag}
+		if err := fetchRemote(remote, args, opts); err != nil {
+			fmt.Fprintf(os.Stderr, "Error fetching from %s: %s\n", remote, err)
+			os.Exit(1)
+		}
+	case "push":
+		pushCmd := flag.NewFlagSet("push", flag.ExitOnError)
+		forceFlag := pushCmd.Bool("force", false, "allow non-fast-forward updates")
+		deleteFlag := pushCmd.Bool("delete", false, "delete the named remote refs")
+		atomicFlag := pushCmd.Bool("atomic", false, "update all refs or none")
+		pushCmd.BoolVar(forceFlag, "f", false, "shorthand for --force")
+		pushCmd.BoolVar(deleteFlag, "d", false, "shorthand for --delete")
+		if err := pushCmd.Parse(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "Error parsing arguments: %s\n", err)
+			os.Exit(1)
+		}
+
+		remote := defaultRemote()
+		args := pushCmd.Args()
+		if len(args) > 0 {
+			remote, args = args[0], args[1:]
+		}
+
+		opts := pushOptions{Force: *forceFlag, Delete: *deleteFlag, Atomic: *atomicFlag}
+		if err := pushRemote(remote, args, opts); err != nil {
+			fmt.Fprintf(os.Stderr, "Error pushing to %s: %s\n", remote, err)
+			os.Exit(1)
+		}
+	case "upload-pack", "receive-pack":
+		serviceCmd := flag.NewFlagSet(command, flag.ExitOnError)
+		statelessFlag := serviceCmd.Bool("stateless-rpc", false, "handle a single smart HTTP request")
+		advertiseFlag := serviceCmd.Bool("advertise-refs", false, "only advertise refs")
+		if err := serviceCmd.Parse(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "Error parsing arguments: %s\n", err)
+			os.Exit(1)
+		}
+		if serviceCmd.NArg() != 1 {
+			fmt.Fprintf(os.Stderr, "usage: mygit %s [--stateless-rpc] [--advertise-refs] <directory>\n", command)
+			os.Exit(1)
+		}
+
+		repo, err := server.Open(serviceCmd.Arg(0))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error opening repository: %s\n", err)
+			os.Exit(1)
+		}
+		defer repo.Close()
+
+		opts := server.Options{StatelessRPC: *statelessFlag, AdvertiseRefs: *advertiseFlag}
+		if command == "upload-pack" {
+			err = server.UploadPack(repo, os.Stdin, os.Stdout, opts)
+		} else {
+			err = server.ReceivePack(repo, os.Stdin, os.Stdout, opts)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error in %s: %s\n", command, err)
+			os.Exit(1)
+		}
+	case "serve":
+		serveCmd := flag.NewFlagSet("serve", flag.ExitOnError)
+		listenFlag := serveCmd.String("listen", "localhost:8080", "address to listen on")
+		receivePackFlag := serveCmd.Bool("enable-receive-pack", false, "allow pushes")
+		if err := serveCmd.Parse(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "Error parsing arguments: %s\n", err)
+			os.Exit(1)
+		}
+		if serveCmd.NArg() != 1 {
+			fmt.Fprintf(os.Stderr, "usage: mygit serve [--listen <addr>] [--enable-receive-pack] <directory>\n")
+			os.Exit(1)
+		}
+
+		handler := &server.Handler{Root: serveCmd.Arg(0), ReceivePack: *receivePackFlag}
+		fmt.Fprintf(os.Stderr, "Serving %s on http://%s/\n", handler.Root, *listenFlag)
+		if err := http.ListenAndServe(*listenFlag, handler); err != nil {
+			fmt.Fprintf(os.Stderr, "Error serving repositories: %s\n", err)
+			os.Exit(1)
+		}
+	case "pack-objects":
+		packCmd := flag.NewFlagSet("pack-objects", flag.ExitOnError)
+		stdoutFlag := packCmd.Bool("stdout", false, "write the pack to stdout")
+		revsFlag := packCmd.Bool("revs", false, "read revisions from stdin instead of object IDs")
+		windowFlag := packCmd.Int("window", pack.DefaultBuildOptions.Window, "number of objects tried as delta bases")
+		depthFlag := packCmd.Int("depth", pack.DefaultBuildOptions.Depth, "maximum delta chain length")
+		if err := packCmd.Parse(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "Error parsing arguments: %s\n", err)
+			os.Exit(1)
+		}
+		if *stdoutFlag == (packCmd.NArg() == 1) || packCmd.NArg() > 1 {
+			fmt.Fprintf(os.Stderr, "usage: mygit pack-objects [--revs] [--window=<n>] [--depth=<n>] (--stdout | <base-name>)\n")
+			os.Exit(1)
+		}
+
+		threshold, err := bigFileThreshold()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading config: %s\n", err)
+			os.Exit(1)
+		}
+		opts := packObjectsOptions{
+			Stdout: *stdoutFlag,
+			Revs:   *revsFlag,
+			Build:  pack.BuildOptions{Window: *windowFlag, Depth: *depthFlag, BigFileThreshold: threshold},
+		}
+		if err := packObjects(packCmd.Arg(0), os.Stdin, opts); err != nil {
+			fmt.Fprintf(os.Stderr, "Error packing objects: %s\n", err)
+			os.Exit(1)
+		}
+	case "index-pack":
+		indexCmd := flag.NewFlagSet("index-pack", flag.ExitOnError)
+		outputFlag := indexCmd.String("o", "", "write the index to this file")
+		if err := indexCmd.Parse(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "Error parsing arguments: %s\n", err)
+			os.Exit(1)
+		}
+		if indexCmd.NArg() != 1 {
+			fmt.Fprintf(os.Stderr, "usage: mygit index-pack [-o <index-file>] <pack-file>\n")
+			os.Exit(1)
+		}
+
+		if err := indexPack(indexCmd.Arg(0), *outputFlag); err != nil {
+			fmt.Fprintf(os.Stderr, "Error indexing pack: %s\n", err)
+			os.Exit(1)
+		}
+	case "verify-pack":
+		verifyCmd := flag.NewFlagSet("verify-pack", flag.ExitOnError)
+		verboseFlag := verifyCmd.Bool("v", false, "list objects and delta chain lengths")
+		if err := verifyCmd.Parse(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "Error parsing arguments: %s\n", err)
+			os.Exit(1)
+		}
+		if verifyCmd.NArg() == 0 {
+			fmt.Fprintf(os.Stderr, "usage: mygit verify-pack [-v] <pack>...\n")
+			os.Exit(1)
+		}
+
+		failed := false
+		for _, path := range verifyCmd.Args() {
+			if err := verifyPack(path, *verboseFlag); err != nil {
+				fmt.Fprintf(os.Stderr, "Error verifying pack: %s\n", err)
+				failed = true
+			}
+		}
+		if failed {
+			os.Exit(1)
+		}
+	case "repack":
+		repackCmd := flag.NewFlagSet("repack", flag.ExitOnError)
+		allFlag := repackCmd.Bool("a", false, "pack everything reachable into a single pack")
+		keepFlag := repackCmd.Bool("A", false, "like -a, but loosen unreachable objects")
+		deleteFlag := repackCmd.Bool("d", false, "remove redundant packs and loose objects")
+		windowFlag := repackCmd.Int("window", pack.DefaultBuildOptions.Window, "number of objects considered for deltas")
+		depthFlag := repackCmd.Int("depth", pack.DefaultBuildOptions.Depth, "maximum delta chain length")
+		if err := repackCmd.Parse(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "Error parsing arguments: %s\n", err)
+			os.Exit(1)
+		}
+
+		threshold, err := bigFileThreshold()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading config: %s\n", err)
+			os.Exit(1)
+		}
+		opts := repackOptions{
+			All:             *allFlag || *keepFlag,
+			Delete:          *deleteFlag,
+			KeepUnreachable: *keepFlag,
+			Build:           pack.BuildOptions{Window: *windowFlag, Depth: *depthFlag, BigFileThreshold: threshold},
+		}
+		if err := repack(opts); err != nil {
+			fmt.Fprintf(os.Stderr, "Error repacking: %s\n", err)
+			os.Exit(1)
+		}
+	case "prune":
+		pruneCmd := flag.NewFlagSet("prune", flag.ExitOnError)
+		expireFlag := pruneCmd.String("expire", "now", "only prune loose objects older than this date")
+		dryRunFlag := pruneCmd.Bool("dry-run", false, "list the objects that would be removed")
+		pruneCmd.BoolVar(dryRunFlag, "n", false, "list the objects that would be removed")
+		verboseFlag := pruneCmd.Bool("verbose", false, "report removed objects")
+		pruneCmd.BoolVar(verboseFlag, "v", false, "report removed objects")
+		if err := pruneCmd.Parse(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "Error parsing arguments: %s\n", err)
+			os.Exit(1)
+		}
+
+		expire, err := parseExpiry(*expireFlag, time.Now())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error parsing --expire: %s\n", err)
+			os.Exit(1)
+		}
+		if err := prune(pruneOptions{Expire: expire, DryRun: *dryRunFlag, Verbose: *verboseFlag}); err != nil {
+			fmt.Fprintf(os.Stderr, "Error pruning: %s\n", err)
+			os.Exit(1)
+		}
+	case "fsck":
+		fsckCmd := flag.NewFlagSet("fsck", flag.ExitOnError)
+		noDanglingFlag := fsckCmd.Bool("no-dangling", false, "do not list dangling objects")
+		if err := fsckCmd.Parse(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "Error parsing arguments: %s\n", err)
+			os.Exit(1)
+		}
+
+		ok, err := fsckRepository(fsckOptions{NoDangling: *noDanglingFlag})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error checking repository: %s\n", err)
+			os.Exit(1)
+		}
+		if !ok {
+			os.Exit(1)
+		}
+	case "gc":
+		gcCmd := flag.NewFlagSet("gc", flag.ExitOnError)
+		aggressiveFlag := gcCmd.Bool("aggressive", false, "spend more time searching for deltas")
+		if err := gcCmd.Parse(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "Error parsing arguments: %s\n", err)
+			os.Exit(1)
+		}
+
+		if err := gc(*aggressiveFlag); err != nil {
+			fmt.Fprintf(os.Stderr, "Error running gc: %s\n", err)
 			os.Exit(1)
 		}
 	default:
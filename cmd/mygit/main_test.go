@@ -0,0 +1,413 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"errors"
+	"hash"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/codecrafters-io/git-starter-go/index"
+	"github.com/codecrafters-io/git-starter-go/object"
+	"github.com/codecrafters-io/git-starter-go/refs"
+	"github.com/codecrafters-io/git-starter-go/server"
+
+	"gopkg.in/ini.v1"
+)
+
+// TestMain lets the test binary stand in for mygit: run with
+// MYGIT_TEST_MAIN set, it executes main on its arguments.
+func TestMain(m *testing.M) {
+	if os.Getenv("MYGIT_TEST_MAIN") != "" {
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// runMygit runs mygit with args in dir.
+func runMygit(dir string, args ...string) (stdout, stderr string, err error) {
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "MYGIT_TEST_MAIN=1")
+	var out, errOut bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &out, &errOut
+	err = cmd.Run()
+	return out.String(), errOut.String(), err
+}
+
+// mygit runs mygit with args in dir, failing the test if it fails, and
+// returns its standard output.
+func mygit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	out, errOut, err := runMygit(dir, args...)
+	if err != nil {
+		t.Fatalf("mygit %s: %v\n%s", strings.Join(args, " "), err, errOut)
+	}
+	return out
+}
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// newRepo initializes a repository at dir with a committer identity.
+func newRepo(t *testing.T, dir string) {
+	t.Helper()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	mygit(t, dir, "init")
+	setIdentity(t, dir)
+}
+
+// setIdentity adds a committer identity to the config of the
+// repository at dir.
+func setIdentity(t *testing.T, dir string) {
+	t.Helper()
+	f, err := os.OpenFile(filepath.Join(dir, ".git", "config"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString("[user]\n\tname = A U Thor\n\temail = author@example.com\n"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// commitFiles writes files into the repository at dir and commits them.
+func commitFiles(t *testing.T, dir, message string, files map[string]string) string {
+	t.Helper()
+	writeFiles(t, dir, files)
+	mygit(t, dir, "add", ".")
+	mygit(t, dir, "commit", "-m", message)
+	return resolveRev(t, dir, "HEAD")
+}
+
+func resolveRev(t *testing.T, dir, rev string) string {
+	t.Helper()
+	return strings.TrimSpace(mygit(t, dir, "rev-parse", "--verify", rev))
+}
+
+// enterRepo makes the repository at dir current for tests calling
+// into mygit in process, until the test ends.
+func enterRepo(t *testing.T, dir string) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	repoFormat, objects, refDB = nil, nil, nil
+	t.Cleanup(func() {
+		os.Chdir(wd)
+		repoFormat, objects, refDB = nil, nil, nil
+	})
+}
+
+// serve serves the repositories under root over smart HTTP.
+func serve(t *testing.T, root string) string {
+	t.Helper()
+	srv := httptest.NewServer(&server.Handler{Root: root, ReceivePack: true})
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+func TestClone(t *testing.T) {
+	root := t.TempDir()
+	src := filepath.Join(root, "src")
+	newRepo(t, src)
+	files := map[string]string{
+		"README":         "hello\n",
+		"dir/file.txt":   "nested\n",
+		"dir/sub/deeper": "deeper\n",
+	}
+	feature := commitFiles(t, src, "initial", files)
+	mygit(t, src, "branch", "feature")
+	files["README"] = "hello again\n"
+	head := commitFiles(t, src, "second", files)
+
+	url := serve(t, root)
+	mygit(t, root, "clone", url+"/src", "dst")
+	dst := filepath.Join(root, "dst")
+
+	for name, want := range files {
+		got, err := os.ReadFile(filepath.Join(dst, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+
+	store := refs.New(filepath.Join(dst, ".git"), object.SHA1)
+	for name, want := range map[string]string{
+		"HEAD":                     "refs/heads/main",
+		"refs/remotes/origin/HEAD": "refs/remotes/origin/main",
+	} {
+		if ref, err := store.Read(name); err != nil || ref.Target != want {
+			t.Errorf("%s = %+v, %v; want a symref to %s", name, ref, err, want)
+		}
+	}
+	for rev, want := range map[string]string{
+		"HEAD":                        head,
+		"refs/heads/main":             head,
+		"refs/remotes/origin/main":    head,
+		"refs/remotes/origin/feature": feature,
+		"refs/remotes/origin/HEAD":    head,
+	} {
+		if got := resolveRev(t, dst, rev); got != want {
+			t.Errorf("%s = %s, want %s", rev, got, want)
+		}
+	}
+
+	cfg, err := ini.Load(filepath.Join(dst, ".git", "config"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, kv := range [][3]string{
+		{`remote "origin"`, "url", url + "/src"},
+		{`remote "origin"`, "fetch", "+refs/heads/*:refs/remotes/origin/*"},
+		{`branch "main"`, "remote", "origin"},
+		{`branch "main"`, "merge", "refs/heads/main"},
+	} {
+		if got := cfg.Section(kv[0]).Key(kv[1]).String(); got != kv[2] {
+			t.Errorf("%s.%s = %q, want %q", kv[0], kv[1], got, kv[2])
+		}
+	}
+}
+
+func TestPush(t *testing.T) {
+	root := t.TempDir()
+	src := filepath.Join(root, "src")
+	newRepo(t, src)
+	commitFiles(t, src, "initial", map[string]string{"README": "hello\n"})
+	url := serve(t, root)
+	mygit(t, root, "clone", url+"/src", "dst")
+	dst := filepath.Join(root, "dst")
+	setIdentity(t, dst)
+
+	head := commitFiles(t, dst, "second", map[string]string{"dir/new": "new\n"})
+	mygit(t, dst, "push", "origin", "main:refs/heads/topic")
+	if got := resolveRev(t, src, "refs/heads/topic"); got != head {
+		t.Errorf("remote topic = %s, want %s", got, head)
+	}
+	if got := resolveRev(t, src, head+"^{tree}"); got != resolveRev(t, dst, "HEAD^{tree}") {
+		t.Errorf("remote has tree %s, want the pushed one", got)
+	}
+
+	// A remote that fails the push without reading the pack must not
+	// leave the push waiting on the pack writer.
+	h := &server.Handler{Root: root, ReceivePack: true}
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			http.Error(w, "refused", http.StatusForbidden)
+			return
+		}
+		h.ServeHTTP(w, r)
+	}))
+	defer failing.Close()
+	commitFiles(t, dst, "third", map[string]string{"dir/new": "newer\n"})
+	if _, _, err := runMygit(dst, "push", failing.URL+"/src", "main:refs/heads/topic"); err == nil {
+		t.Error("push to a failing remote succeeded")
+	}
+}
+
+func TestFetch(t *testing.T) {
+	root := t.TempDir()
+	src := filepath.Join(root, "src")
+	newRepo(t, src)
+	commitFiles(t, src, "initial", map[string]string{"README": "hello\n"})
+	mygit(t, src, "branch", "feature")
+	mygit(t, src, "branch", "gone")
+	url := serve(t, root)
+	mygit(t, root, "clone", url+"/src", "dst")
+	dst := filepath.Join(root, "dst")
+
+	head := commitFiles(t, src, "second", map[string]string{"README": "hello again\n"})
+	mygit(t, src, "branch", "-D", "gone")
+	mygit(t, src, "branch", "new")
+	mygit(t, dst, "fetch", "--prune")
+
+	for rev, want := range map[string]string{
+		"refs/remotes/origin/main": head,
+		"refs/remotes/origin/new":  head,
+	} {
+		if got := resolveRev(t, dst, rev); got != want {
+			t.Errorf("%s = %s, want %s", rev, got, want)
+		}
+	}
+	if _, _, err := runMygit(dst, "rev-parse", "--verify", "refs/remotes/origin/gone"); err == nil {
+		t.Error("refs/remotes/origin/gone survived --prune")
+	}
+	log, err := os.ReadFile(filepath.Join(dst, ".git", "logs", "refs", "remotes", "origin", "main"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSpace(string(log)), "\n"); !strings.HasSuffix(lines[len(lines)-1], "\tfetch: fast-forward") {
+		t.Errorf("last reflog entry of origin/main = %q, want a fetch: fast-forward", lines[len(lines)-1])
+	}
+}
+
+func TestSwitchUntrackedConflict(t *testing.T) {
+	dir := t.TempDir()
+	newRepo(t, dir)
+	commitFiles(t, dir, "initial", map[string]string{"README": "hello\n"})
+	mygit(t, dir, "switch", "-c", "other")
+	commitFiles(t, dir, "nested", map[string]string{"a/b": "tracked\n"})
+	mygit(t, dir, "switch", "main")
+	// An untracked file stands where other needs a directory.
+	writeFiles(t, dir, map[string]string{"a": "untracked\n"})
+
+	for _, args := range [][]string{{"switch", "other"}, {"switch", "-c", "new", "other"}} {
+		_, errOut, err := runMygit(dir, args...)
+		if err == nil || !strings.Contains(errOut, "untracked working tree files would be overwritten by checkout:\n\ta\n") {
+			t.Errorf("mygit %s: %v, %q; want an untracked file conflict on a", strings.Join(args, " "), err, errOut)
+		}
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "a")); err != nil || string(data) != "untracked\n" {
+		t.Errorf("untracked file a = %q, %v", data, err)
+	}
+	if ref, err := refs.New(filepath.Join(dir, ".git"), object.SHA1).Read("HEAD"); err != nil || ref.Target != "refs/heads/main" {
+		t.Errorf("HEAD = %+v, %v; want it still on main", ref, err)
+	}
+	if _, _, err := runMygit(dir, "rev-parse", "--verify", "refs/heads/new"); err == nil {
+		t.Error("branch new was left behind by the failed switch -c")
+	}
+}
+
+// collidingHash is SHA-1 that reports everything it hashes as part of
+// a collision attack.
+type collidingHash struct{ hash.Hash }
+
+func (h collidingHash) CollisionResistantSum(b []byte) ([]byte, bool) { return h.Sum(b), true }
+
+// TestCollisionRefused runs hash-object, add and index-pack in process
+// with a format that takes all content for a SHA-1 collision.
+func TestCollisionRefused(t *testing.T) {
+	dir := t.TempDir()
+	newRepo(t, dir)
+	commitFiles(t, dir, "initial", map[string]string{"README": "hello\n"})
+	mygit(t, dir, "repack", "-a", "-d")
+	packs, err := filepath.Glob(filepath.Join(dir, ".git", "objects", "pack", "*.pack"))
+	if err != nil || len(packs) != 1 {
+		t.Fatalf("packs = %v, %v; want one", packs, err)
+	}
+	writeFiles(t, dir, map[string]string{"new": "colliding\n"})
+
+	enterRepo(t, dir)
+	repoFormat = object.NewFormat("sha1", sha1.Size, func() hash.Hash { return collidingHash{sha1.New()} })
+
+	if _, err := hashFileStream("new", int64(len("colliding\n"))); !errors.Is(err, object.ErrCollision) {
+		t.Errorf("hash-object error = %v, want ErrCollision", err)
+	}
+	if err := addFileToIndex(index.New(repoFormat), "new"); !errors.Is(err, object.ErrCollision) {
+		t.Errorf("add error = %v, want ErrCollision", err)
+	}
+	if err := indexPack(packs[0], filepath.Join(dir, "out.idx")); !errors.Is(err, object.ErrCollision) {
+		t.Errorf("index-pack error = %v, want ErrCollision", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "out.idx")); !os.IsNotExist(err) {
+		t.Errorf("index-pack wrote an index: %v", err)
+	}
+}
+
+func TestAddFailure(t *testing.T) {
+	dir := t.TempDir()
+	newRepo(t, dir)
+	writeFiles(t, dir, map[string]string{"present": "here\n"})
+	if _, _, err := runMygit(dir, "add", "present", "missing"); err == nil {
+		t.Error("add of a missing file succeeded")
+	}
+	if _, err := os.Stat(filepath.Join(dir, ".git", "index")); !os.IsNotExist(err) {
+		t.Errorf("failed add wrote the index: %v", err)
+	}
+}
+
+func TestExpireReflogsLocksRef(t *testing.T) {
+	dir := t.TempDir()
+	newRepo(t, dir)
+	commitFiles(t, dir, "initial", map[string]string{"README": "hello\n"})
+	commitFiles(t, dir, "second", map[string]string{"README": "hello again\n"})
+	logPath := filepath.Join(dir, ".git", "logs", "refs", "heads", "main")
+	before, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	enterRepo(t, dir)
+	refDB, err = refStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	refDB.LockTimeout = 0
+	writeFiles(t, dir, map[string]string{".git/refs/heads/main.lock": ""})
+	if err := expireReflogs(time.Now().Add(time.Hour), time.Time{}); err == nil || !strings.Contains(err.Error(), "refs/heads/main") {
+		t.Errorf("expireReflogs with refs/heads/main locked = %v, want a lock error", err)
+	}
+	if after, err := os.ReadFile(logPath); err != nil || !bytes.Equal(after, before) {
+		t.Errorf("reflog changed while its ref was locked: %q, %v", after, err)
+	}
+
+	if err := os.Remove(filepath.Join(dir, ".git", "refs", "heads", "main.lock")); err != nil {
+		t.Fatal(err)
+	}
+	if err := expireReflogs(time.Now().Add(time.Hour), time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	if after, err := os.ReadFile(logPath); err != nil || len(after) != 0 {
+		t.Errorf("reflog after expiring everything = %q, %v", after, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, ".git", "refs", "heads", "main.lock")); !os.IsNotExist(err) {
+		t.Errorf("lock left behind: %v", err)
+	}
+}
+
+func TestBranchRename(t *testing.T) {
+	dir := t.TempDir()
+	newRepo(t, dir)
+	store := refs.New(filepath.Join(dir, ".git"), object.SHA1)
+
+	mygit(t, dir, "branch", "-m", "unborn")
+	if ref, err := store.Read("HEAD"); err != nil || ref.Target != "refs/heads/unborn" {
+		t.Fatalf("HEAD after renaming the unborn branch = %+v, %v", ref, err)
+	}
+
+	head := commitFiles(t, dir, "initial", map[string]string{"README": "hello\n"})
+	mygit(t, dir, "branch", "-m", "unborn", "trunk")
+	if ref, err := store.Read("HEAD"); err != nil || ref.Target != "refs/heads/trunk" {
+		t.Errorf("HEAD = %+v, %v; want a symref to refs/heads/trunk", ref, err)
+	}
+	if got := resolveRev(t, dir, "HEAD"); got != head {
+		t.Errorf("HEAD resolves to %s, want %s", got, head)
+	}
+	if _, _, err := runMygit(dir, "rev-parse", "--verify", "refs/heads/unborn"); err == nil {
+		t.Error("refs/heads/unborn survived the rename")
+	}
+	log, err := os.ReadFile(filepath.Join(dir, ".git", "logs", "HEAD"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(string(log), "\tBranch: renamed refs/heads/unborn to refs/heads/trunk\n") {
+		t.Errorf("HEAD reflog does not end with the rename:\n%s", log)
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/atomicfile"
+	"github.com/codecrafters-io/git-starter-go/object"
+	"github.com/codecrafters-io/git-starter-go/pack"
+	"github.com/codecrafters-io/git-starter-go/revlist"
+	"github.com/codecrafters-io/git-starter-go/storage"
+)
+
+type packObjectsOptions struct {
+	// Stdout writes the pack to stdout instead of <base-name>-<sha>.pack.
+	Stdout bool
+	// Revs reads revisions instead of object IDs and packs everything
+	// reachable from them.
+	Revs  bool
+	Build pack.BuildOptions
+}
+
+// readPackList reads the objects to pack from r: either "<id> [<path>]"
+// lines, or with revs set, revisions to include and ^revisions to
+// exclude.
+func readPackList(r io.Reader, revs bool) ([]revlist.Entry, error) {
+	var entries, include, exclude []string
+	var paths []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if !revs {
+			id, path, _ := strings.Cut(line, " ")
+			if !object.ValidHash(id) {
+				return nil, fmt.Errorf("expected object ID, got garbage:\n %s", line)
+			}
+			entries = append(entries, id)
+			paths = append(paths, path)
+			continue
+		}
+
+		rev, negated := strings.CutPrefix(line, "^")
+		hash, err := revParse(rev)
+		if err != nil {
+			return nil, fmt.Errorf("bad revision '%s'", rev)
+		}
+		if negated {
+			exclude = append(exclude, hash)
+		} else {
+			include = append(include, hash)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if revs {
+		store, err := objectStore()
+		if err != nil {
+			return nil, err
+		}
+		shallow, err := shallowSet()
+		if err != nil {
+			return nil, err
+		}
+		return revlist.Objects(store, include, exclude, shallow)
+	}
+
+	list := make([]revlist.Entry, 0, len(entries))
+	seen := make(map[string]bool)
+	for i, id := range entries {
+		if !seen[id] {
+			seen[id] = true
+			list = append(list, revlist.Entry{Hash: id, Path: paths[i]})
+		}
+	}
+	return list, nil
+}
+
+func packObjects(baseName string, in io.Reader, opts packObjectsOptions) error {
+	objects, err := readPackList(in, opts.Revs)
+	if err != nil {
+		return err
+	}
+	store, err := objectStore()
+	if err != nil {
+		return err
+	}
+
+	if opts.Stdout {
+		w := bufio.NewWriter(os.Stdout)
+		written, _, err := revlist.WritePack(w, store, objects, opts.Build)
+		if err != nil {
+			return err
+		}
+		printPackStats(written)
+		return w.Flush()
+	}
+
+	name, written, err := writePackFiles(baseName, store, objects, opts.Build)
+	if err != nil {
+		return err
+	}
+	printPackStats(written)
+	fmt.Println(name)
+	return nil
+}
+
+// writePackFiles packs objects into <baseName>-<sha>.pack with its index
+// and returns the hex checksum naming the pair.
+func writePackFiles(baseName string, store storage.ObjectStore, objects []revlist.Entry, opts pack.BuildOptions) (string, []*pack.ObjectInfo, error) {
+	dir := filepath.Dir(baseName)
+	syncPack, err := shouldFsync(fsyncPack)
+	if err != nil {
+		return "", nil, err
+	}
+	syncIdx, err := shouldFsync(fsyncPackMetadata)
+	if err != nil {
+		return "", nil, err
+	}
+	tmp, err := atomicfile.CreateTemp(dir, "tmp_pack_", syncPack)
+	if err != nil {
+		return "", nil, fmt.Errorf("error creating temporary pack: %w", err)
+	}
+	defer tmp.Abort()
+
+	bw := bufio.NewWriter(tmp)
+	written, checksum, err := revlist.WritePack(bw, store, objects, opts)
+	if err != nil {
+		return "", nil, err
+	}
+	if err := bw.Flush(); err != nil {
+		return "", nil, err
+	}
+
+	sorted := append([]*pack.ObjectInfo(nil), written...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].ID < sorted[j].ID })
+
+	tmpIdx, err := atomicfile.CreateTemp(dir, "tmp_idx_", syncIdx)
+	if err != nil {
+		return "", nil, fmt.Errorf("error creating temporary index: %w", err)
+	}
+	defer tmpIdx.Abort()
+	if err := pack.WriteIndex(tmpIdx, store.Format(), sorted, checksum); err != nil {
+		return "", nil, fmt.Errorf("error writing pack index: %w", err)
+	}
+
+	// The pack goes into place first so that a visible index always has
+	// its pack.
+	name := hex.EncodeToString(checksum)
+	if err := tmp.Commit(baseName+"-"+name+".pack", 0444); err != nil {
+		return "", nil, err
+	}
+	if err := tmpIdx.Commit(baseName+"-"+name+".idx", 0444); err != nil {
+		return "", nil, err
+	}
+
+	return name, written, nil
+}
+
+func printPackStats(objects []*pack.ObjectInfo) {
+	deltas := 0
+	for _, obj := range objects {
+		if obj.EntryType == pack.ObjOfsDelta || obj.EntryType == pack.ObjRefDelta {
+			deltas++
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Total %d (delta %d), reused 0 (delta 0), pack-reused 0\n", len(objects), deltas)
+}
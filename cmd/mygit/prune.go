@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/codecrafters-io/git-starter-go/revlist"
+)
+
+type pruneOptions struct {
+	// Expire protects loose objects modified after it. The zero time
+	// protects everything.
+	Expire  time.Time
+	DryRun  bool
+	Verbose bool
+}
+
+// prune deletes unreachable loose objects older than opts.Expire.
+// Objects reachable from recent unreachable objects are kept as well, so
+// that nothing a grace-period object refers to disappears under it.
+func prune(opts pruneOptions) error {
+	store, err := objectStore()
+	if err != nil {
+		return err
+	}
+
+	tips, err := reachableTips(store)
+	if err != nil {
+		return err
+	}
+	var candidates []string
+	err = store.Loose.Iterate(func(id string) error {
+		info, err := os.Stat(store.Loose.Path(id))
+		if err != nil {
+			return err
+		}
+		if opts.Expire.IsZero() || info.ModTime().After(opts.Expire) {
+			tips = append(tips, id)
+		} else {
+			candidates = append(candidates, id)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("error listing loose objects: %w", err)
+	}
+
+	shallow, err := shallowSet()
+	if err != nil {
+		return err
+	}
+	objects, err := revlist.Objects(store, tips, nil, shallow)
+	if err != nil {
+		return err
+	}
+	reachable := make(map[string]bool, len(objects))
+	for _, entry := range objects {
+		reachable[entry.Hash] = true
+	}
+
+	for _, id := range candidates {
+		if reachable[id] {
+			continue
+		}
+		if opts.DryRun || opts.Verbose {
+			objType, _, err := store.Loose.Get(id)
+			if err != nil {
+				fmt.Printf("%s unknown\n", id)
+			} else {
+				fmt.Printf("%s %s\n", id, objType)
+			}
+		}
+		if opts.DryRun {
+			continue
+		}
+		path := store.Loose.Path(id)
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("error removing %s: %w", id, err)
+		}
+		os.Remove(filepath.Dir(path))
+	}
+
+	if opts.DryRun {
+		return nil
+	}
+	return prunePacked(store)
+}
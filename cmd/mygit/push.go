@@ -0,0 +1,371 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/object"
+	"github.com/codecrafters-io/git-starter-go/pack"
+	"github.com/codecrafters-io/git-starter-go/refs"
+	"github.com/codecrafters-io/git-starter-go/revlist"
+	"github.com/codecrafters-io/git-starter-go/transport"
+)
+
+type pushOptions struct {
+	Force  bool
+	Delete bool
+	Atomic bool
+}
+
+// pushUpdate is one ref update the push will attempt.
+type pushUpdate struct {
+	Src   string
+	Dst   string
+	Old   string
+	New   string
+	Force bool
+	// Forced is set for non-fast-forward updates allowed by Force.
+	Forced bool
+
+	// Rejected is set when the update is refused locally.
+	Rejected string
+}
+
+func pushRemote(remote string, args []string, opts pushOptions) error {
+	url, fetchSpecs, err := remoteURL(remote)
+	if err != nil {
+		return err
+	}
+
+	if len(args) == 0 {
+		if opts.Delete {
+			return fmt.Errorf("--delete doesn't make sense without any refs")
+		}
+		spec, err := defaultPushRefspec(remote)
+		if err != nil {
+			return err
+		}
+		args = []string{spec}
+	}
+
+	client := transport.NewClient(url)
+	client.Progress = os.Stderr
+	adv, err := client.Discover(transport.ReceivePackService)
+	if err != nil {
+		return err
+	}
+	if err := checkRemoteFormat(adv); err != nil {
+		return err
+	}
+	remoteRefs := make(map[string]string)
+	for _, ref := range adv.Refs {
+		remoteRefs[ref.Name] = ref.Hash
+	}
+
+	var updates []*pushUpdate
+	for _, arg := range args {
+		u, err := planPush(arg, opts, remoteRefs)
+		if err != nil {
+			return err
+		}
+		if u.Old == u.New {
+			continue
+		}
+		updates = append(updates, u)
+	}
+	if len(updates) == 0 {
+		fmt.Fprintf(os.Stderr, "Everything up-to-date\n")
+		return nil
+	}
+
+	rejected := false
+	for _, u := range updates {
+		if err := checkPushUpdate(u, opts.Force); err != nil {
+			return err
+		}
+		if u.Rejected != "" {
+			rejected = true
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "To %s\n", url)
+	var commands []transport.RefCommand
+	var wants []string
+	for _, u := range updates {
+		if u.Rejected != "" {
+			continue
+		}
+		if opts.Atomic && rejected {
+			u.Rejected = "atomic push failed"
+			continue
+		}
+		commands = append(commands, transport.RefCommand{Name: u.Dst, Old: u.Old, New: u.New})
+		if !object.IsZeroID(u.New) {
+			wants = append(wants, u.New)
+		}
+	}
+
+	statuses := make(map[string]transport.RefStatus)
+	if len(commands) > 0 {
+		req := transport.PushRequest{Commands: commands, Atomic: opts.Atomic}
+		var pr *io.PipeReader
+		var packErr chan error
+		if len(wants) > 0 {
+			var haves []string
+			for _, hash := range remoteRefs {
+				haves = append(haves, hash)
+			}
+			store, err := objectStore()
+			if err != nil {
+				return err
+			}
+			shallow, err := shallowSet()
+			if err != nil {
+				return err
+			}
+			objects, err := revlist.Objects(store, wants, haves, shallow)
+			if err != nil {
+				return err
+			}
+
+			var pw *io.PipeWriter
+			pr, pw = io.Pipe()
+			packErr = make(chan error, 1)
+			go func() {
+				opts := pack.DefaultBuildOptions
+				if !adv.Capabilities.Has("ofs-delta") {
+					opts.Window = 0
+				}
+				_, _, err := revlist.WritePack(pw, store, objects, opts)
+				pw.CloseWithError(err)
+				packErr <- err
+			}()
+			req.Pack = pr
+		}
+
+		result, err := client.Push(adv, req)
+		if packErr != nil {
+			// Push may return without reading the whole pack; closing
+			// the reader unblocks the writer.
+			pr.CloseWithError(err)
+			if perr := <-packErr; perr != nil && err == nil {
+				return fmt.Errorf("error generating pack: %w", perr)
+			}
+		}
+		if err != nil {
+			return err
+		}
+		if result.UnpackError != "" {
+			return fmt.Errorf("remote unpack failed: %s", result.UnpackError)
+		}
+		for _, status := range result.Refs {
+			statuses[status.Name] = status
+		}
+	}
+
+	failed := rejected
+	for _, u := range updates {
+		status, reported := statuses[u.Dst]
+		switch {
+		case u.Rejected != "":
+			printPushStatus('!', "[rejected]", u, u.Rejected)
+		case !reported:
+			printPushStatus('!', "[remote failure]", u, "remote failed to report status")
+			failed = true
+		case status.Error != "":
+			printPushStatus('!', "[remote rejected]", u, status.Error)
+			failed = true
+		default:
+			if err := updateTrackingRef(fetchSpecs, u); err != nil {
+				return err
+			}
+			switch {
+			case object.IsZeroID(u.New):
+				printPushStatus('-', "[deleted]", u, "")
+			case object.IsZeroID(u.Old):
+				summary := "[new branch]"
+				if strings.HasPrefix(u.Dst, "refs/tags/") {
+					summary = "[new tag]"
+				} else if !strings.HasPrefix(u.Dst, "refs/heads/") {
+					summary = "[new reference]"
+				}
+				printPushStatus('*', summary, u, "")
+			case u.Forced:
+				printPushStatus('+', u.Old[:7]+"..."+u.New[:7], u, "forced update")
+			default:
+				printPushStatus(' ', u.Old[:7]+".."+u.New[:7], u, "")
+			}
+		}
+	}
+
+	if failed {
+		return fmt.Errorf("failed to push some refs to '%s'", url)
+	}
+	return nil
+}
+
+// defaultPushRefspec pushes the current branch to its upstream if it
+// tracks remote, and to a branch of the same name otherwise.
+func defaultPushRefspec(remote string) (string, error) {
+	head, err := headBranch()
+	if err != nil {
+		return "", err
+	}
+	if head == "" {
+		return "", fmt.Errorf("you are not currently on a branch")
+	}
+	if merge := branchMergeRef(remote); merge != "" {
+		return head + ":" + merge, nil
+	}
+	return head + ":" + head, nil
+}
+
+// planPush turns a push refspec into an update of the remote ref.
+func planPush(arg string, opts pushOptions, remoteRefs map[string]string) (*pushUpdate, error) {
+	spec, err := parseRefspec(arg)
+	if err != nil {
+		return nil, err
+	}
+	if spec.IsGlob() {
+		return nil, fmt.Errorf("wildcard refspecs are not supported for push: %s", arg)
+	}
+	f, err := objectFormat()
+	if err != nil {
+		return nil, err
+	}
+	if opts.Delete {
+		if spec.Dst != "" {
+			return nil, fmt.Errorf("--delete only accepts plain target ref names")
+		}
+		spec.Src, spec.Dst = "", spec.Src
+	} else if spec.Dst == "" && !strings.Contains(arg, ":") {
+		spec.Dst = spec.Src
+	}
+
+	u := &pushUpdate{Force: spec.Force, New: f.ZeroID()}
+	if spec.Src != "" {
+		u.Src, u.New, err = resolveLocalRef(spec.Src)
+		if err != nil {
+			return nil, err
+		}
+		if spec.Dst == "HEAD" {
+			spec.Dst = u.Src
+		}
+	}
+
+	u.Dst = spec.Dst
+	if !strings.HasPrefix(u.Dst, "refs/") {
+		u.Dst = ""
+		for _, name := range expandRefName(spec.Dst) {
+			if _, ok := remoteRefs[name]; ok {
+				u.Dst = name
+				break
+			}
+		}
+	}
+	if u.Dst == "" {
+		switch {
+		case spec.Src == "":
+			return nil, fmt.Errorf("unable to delete '%s': remote ref does not exist", spec.Dst)
+		case strings.HasPrefix(u.Src, "refs/tags/"):
+			u.Dst = "refs/tags/" + spec.Dst
+		default:
+			u.Dst = "refs/heads/" + spec.Dst
+		}
+	}
+
+	u.Old = f.ZeroID()
+	if hash, ok := remoteRefs[u.Dst]; ok {
+		u.Old = hash
+	}
+	if spec.Src == "" && object.IsZeroID(u.Old) {
+		return nil, fmt.Errorf("unable to delete '%s': remote ref does not exist", spec.Dst)
+	}
+	return u, nil
+}
+
+// resolveLocalRef finds the local ref a short name refers to.
+func resolveLocalRef(name string) (string, string, error) {
+	ref, hash, err := dwimRef(name)
+	if err == nil {
+		if ref == "HEAD" {
+			if head, err := headBranch(); err == nil && head != "" {
+				ref = head
+			}
+		}
+		return ref, hash, nil
+	}
+	if !errors.Is(err, refs.ErrNotFound) {
+		return "", "", err
+	}
+	if hash, err := revParse(name); err == nil {
+		return hash, hash, nil
+	}
+	return "", "", fmt.Errorf("src refspec %s does not match any", name)
+}
+
+// checkPushUpdate rejects non-fast-forward updates unless they are
+// forced.
+func checkPushUpdate(u *pushUpdate, force bool) error {
+	if object.IsZeroID(u.Old) || object.IsZeroID(u.New) {
+		return nil
+	}
+
+	reason := "non-fast-forward"
+	if strings.HasPrefix(u.Dst, "refs/tags/") {
+		reason = "already exists"
+	} else {
+		store, err := objectStore()
+		if err != nil {
+			return err
+		}
+		if !store.Has(u.Old) {
+			reason = "fetch first"
+		} else if ok, err := isAncestor(u.Old, u.New); err != nil {
+			return err
+		} else if ok {
+			return nil
+		}
+	}
+
+	if u.Force || force {
+		u.Forced = true
+	} else {
+		u.Rejected = reason
+	}
+	return nil
+}
+
+// updateTrackingRef mirrors a successful push in the remote-tracking
+// ref the fetch refspecs map the remote ref to.
+func updateTrackingRef(fetchSpecs []string, u *pushUpdate) error {
+	for _, s := range fetchSpecs {
+		spec, err := parseRefspec(s)
+		if err != nil {
+			return err
+		}
+		dst, ok := spec.MatchSrc(u.Dst)
+		if !ok || dst == "" {
+			continue
+		}
+		if object.IsZeroID(u.New) {
+			return deleteRef(dst)
+		}
+		return writeRef(dst, u.New, "update by push")
+	}
+	return nil
+}
+
+func printPushStatus(flag byte, summary string, u *pushUpdate, reason string) {
+	if reason != "" {
+		reason = " (" + reason + ")"
+	}
+	if object.IsZeroID(u.New) {
+		fmt.Fprintf(os.Stderr, " %c %-17s %s%s\n", flag, summary, shortRefName(u.Dst), reason)
+		return
+	}
+	fmt.Fprintf(os.Stderr, " %c %-17s %s -> %s%s\n", flag, summary, shortRefName(u.Src), shortRefName(u.Dst), reason)
+}
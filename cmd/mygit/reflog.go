@@ -0,0 +1,231 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/codecrafters-io/git-starter-go/atomicfile"
+	"github.com/codecrafters-io/git-starter-go/object"
+)
+
+// reflogEntry is one line of a reflog in .git/logs.
+type reflogEntry struct {
+	Old  string
+	New  string
+	When time.Time
+
+	line string
+}
+
+// readReflog returns the entries of the reflog of name, oldest first.
+// Lines that cannot be parsed are kept but never expire.
+func readReflog(name string) ([]reflogEntry, error) {
+	data, err := os.ReadFile(filepath.Join(".git", "logs", filepath.FromSlash(name)))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading reflog %s: %w", name, err)
+	}
+
+	var entries []reflogEntry
+	for _, line := range strings.Split(strings.TrimSuffix(string(data), "\n"), "\n") {
+		if line == "" {
+			continue
+		}
+		entry := reflogEntry{line: line}
+		header, _, _ := strings.Cut(line, "\t")
+		if fields := strings.SplitN(header, " ", 3); len(fields) == 3 {
+			if sig, err := object.ParseSignature(fields[2]); err == nil {
+				entry.Old, entry.New, entry.When = fields[0], fields[1], sig.When
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func writeReflog(name string, entries []reflogEntry) error {
+	var buf strings.Builder
+	for _, entry := range entries {
+		buf.WriteString(entry.line + "\n")
+	}
+	path := filepath.Join(".git", "logs", filepath.FromSlash(name))
+	sync, err := shouldFsync(fsyncReference)
+	if err != nil {
+		return err
+	}
+	if err := atomicfile.WriteFile(path, []byte(buf.String()), 0644, sync); err != nil {
+		return fmt.Errorf("error writing reflog %s: %w", name, err)
+	}
+	return nil
+}
+
+// reflogIdentity returns who to record in reflog entries: the
+// configured user, or like git a name and email made up from the login
+// and host names when there is none.
+func reflogIdentity() object.Signature {
+	name, email, err := getGitConfig()
+	if err != nil {
+		login := "unknown"
+		if u, err := user.Current(); err == nil {
+			login, name = u.Username, u.Name
+		}
+		if name == "" {
+			name = login
+		}
+		host, err := os.Hostname()
+		if err != nil || host == "" {
+			host = "localhost"
+		}
+		email = login + "@" + host
+	}
+	return object.Signature{Name: name, Email: email, When: time.Now()}
+}
+
+// listReflogs returns the names of the refs that have a reflog.
+func listReflogs() ([]string, error) {
+	var names []string
+	root := filepath.Join(".git", "logs")
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() || strings.HasSuffix(path, ".lock") {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		names = append(names, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing reflogs: %w", err)
+	}
+	return names, nil
+}
+
+// expireReflogs drops reflog entries older than expire, and entries
+// older than expireUnreachable whose commit is no longer reachable from
+// the ref. A zero time never expires anything.
+func expireReflogs(expire, expireUnreachable time.Time) error {
+	names, err := listReflogs()
+	if err != nil {
+		return err
+	}
+	store, err := refStore()
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if err := expireReflog(name, expire, expireUnreachable, store.LockTimeout); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// expireReflog expires the reflog of name while holding the ref's lock,
+// which ref updates take to append to the reflog.
+func expireReflog(name string, expire, expireUnreachable time.Time, timeout time.Duration) error {
+	path := filepath.Join(".git", filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("error creating ref directory: %w", err)
+	}
+	lock, err := atomicfile.Lock(path, timeout, false)
+	if err != nil {
+		return fmt.Errorf("cannot lock ref '%s': %w", name, err)
+	}
+	defer lock.Abort()
+
+	entries, err := readReflog(name)
+	if err != nil {
+		return err
+	}
+	tip, err := resolveRef(name)
+	if err != nil {
+		tip = ""
+	}
+
+	kept := entries[:0]
+	for _, entry := range entries {
+		if entry.When.IsZero() {
+			kept = append(kept, entry)
+			continue
+		}
+		if entry.When.Before(expire) {
+			continue
+		}
+		if entry.When.Before(expireUnreachable) && entry.New != tip {
+			reachable := false
+			if tip != "" {
+				if reachable, err = isAncestor(entry.New, tip); err != nil {
+					reachable = false
+				}
+			}
+			if !reachable {
+				continue
+			}
+		}
+		kept = append(kept, entry)
+	}
+	if len(kept) == len(entries) {
+		return nil
+	}
+	return writeReflog(name, kept)
+}
+
+// parseExpiry interprets an expiry date such as "90.days.ago",
+// "2 weeks ago", "now" or "never" relative to now. "never" yields the
+// zero time.
+func parseExpiry(value string, now time.Time) (time.Time, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	switch value {
+	case "never", "false":
+		return time.Time{}, nil
+	case "now", "all":
+		return now, nil
+	}
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(seconds, 0), nil
+	}
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, nil
+	}
+
+	fields := strings.FieldsFunc(value, func(r rune) bool { return r == '.' || r == ' ' })
+	if len(fields) == 3 && fields[2] == "ago" {
+		n, err := strconv.Atoi(fields[0])
+		if err == nil && n >= 0 {
+			unit := strings.TrimSuffix(fields[1], "s")
+			switch unit {
+			case "second":
+				return now.Add(-time.Duration(n) * time.Second), nil
+			case "minute":
+				return now.Add(-time.Duration(n) * time.Minute), nil
+			case "hour":
+				return now.Add(-time.Duration(n) * time.Hour), nil
+			case "day":
+				return now.AddDate(0, 0, -n), nil
+			case "week":
+				return now.AddDate(0, 0, -7*n), nil
+			case "month":
+				return now.AddDate(0, -n, 0), nil
+			case "year":
+				return now.AddDate(-n, 0, 0), nil
+			}
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid expiry date '%s'", value)
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/refs"
+)
+
+var refDB *refs.Store
+
+// refStore returns the ref database of the repository, with the lock
+// timeouts and fsync behaviour from its config.
+func refStore() (*refs.Store, error) {
+	if refDB != nil {
+		return refDB, nil
+	}
+
+	f, err := objectFormat()
+	if err != nil {
+		return nil, err
+	}
+	store := refs.New(".git", f)
+	if store.Sync, err = shouldFsync(fsyncReference); err != nil {
+		return nil, err
+	}
+	if store.LockTimeout, err = lockTimeout("filesRefLockTimeout", refs.DefaultLockTimeout); err != nil {
+		return nil, err
+	}
+	if store.PackedRefsTimeout, err = lockTimeout("packedRefsTimeout", refs.DefaultPackedRefsTimeout); err != nil {
+		return nil, err
+	}
+	cfg, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+	core := cfg.Section("core")
+	switch value := strings.ToLower(configValue(core, "logAllRefUpdates")); value {
+	case "":
+		store.LogAllRefUpdates = !configBool(core, "bare")
+	case "always":
+		store.LogAllRefUpdates = true
+	default:
+		store.LogAllRefUpdates = configBool(core, "logAllRefUpdates")
+	}
+	refDB = store
+	return refDB, nil
+}
+
+// writeRef points the ref name (e.g. refs/heads/main) at hash, with
+// message in its reflog.
+func writeRef(name, hash, message string) error {
+	return updateRef(name, "", hash, message)
+}
+
+// updateRef points the ref name at hash while holding its lock. Unless
+// old is empty the ref must still be at old, or not exist if old is the
+// zero ID, so that a concurrent update is not silently overwritten.
+func updateRef(name, old, hash, message string) error {
+	store, err := refStore()
+	if err != nil {
+		return err
+	}
+	tx := store.Transaction()
+	tx.SetReflog(reflogIdentity(), message)
+	tx.Update(name, old, hash)
+	return tx.Commit()
+}
+
+// deleteRef removes the ref name, whether loose or packed.
+func deleteRef(name string) error {
+	store, err := refStore()
+	if err != nil {
+		return err
+	}
+	tx := store.Transaction()
+	tx.Delete(name, "")
+	return tx.Commit()
+}
+
+// writeSymbolicRef makes name (e.g. HEAD) refer to the ref target.
+func writeSymbolicRef(name, target string) error {
+	store, err := refStore()
+	if err != nil {
+		return err
+	}
+	return store.SetSymbolic(name, target)
+}
+
+// readRef returns the value of the ref name without following symbolic
+// refs.
+func readRef(name string) (refs.Ref, error) {
+	store, err := refStore()
+	if err != nil {
+		return refs.Ref{}, err
+	}
+	return store.Read(name)
+}
+
+// resolveRef follows symbolic refs and returns the hash name points to.
+func resolveRef(name string) (string, error) {
+	store, err := refStore()
+	if err != nil {
+		return "", err
+	}
+	_, hash, err := store.Resolve(name)
+	return hash, err
+}
+
+// headBranch returns the ref HEAD points to, or "" if HEAD is detached.
+func headBranch() (string, error) {
+	store, err := refStore()
+	if err != nil {
+		return "", err
+	}
+	return store.Head()
+}
+
+// listRefs returns the refs under prefix (e.g. "refs/remotes/"), loose
+// or packed, mapped to the hashes they resolve to.
+func listRefs(prefix string) (map[string]string, error) {
+	store, err := refStore()
+	if err != nil {
+		return nil, err
+	}
+	return store.List(prefix)
+}
+
+// shortRefName strips the well-known prefixes from a ref name for
+// display, e.g. refs/remotes/origin/main -> origin/main.
+func shortRefName(name string) string {
+	for _, prefix := range []string{"refs/heads/", "refs/tags/", "refs/remotes/"} {
+		if short, ok := strings.CutPrefix(name, prefix); ok {
+			return short
+		}
+	}
+	return name
+}
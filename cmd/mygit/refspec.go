@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// refspec maps remote refs to local refs, e.g.
+// +refs/heads/*:refs/remotes/origin/*.
+type refspec struct {
+	Force bool
+	Src   string
+	Dst   string
+}
+
+func parseRefspec(s string) (refspec, error) {
+	var spec refspec
+	if rest, ok := strings.CutPrefix(s, "+"); ok {
+		spec.Force = true
+		s = rest
+	}
+	spec.Src, spec.Dst, _ = strings.Cut(s, ":")
+
+	srcGlob := strings.Count(spec.Src, "*")
+	dstGlob := strings.Count(spec.Dst, "*")
+	if srcGlob > 1 || dstGlob > 1 || (spec.Dst != "" && srcGlob != dstGlob) {
+		return refspec{}, fmt.Errorf("invalid refspec '%s'", s)
+	}
+	return spec, nil
+}
+
+// IsGlob reports whether the refspec contains a wildcard.
+func (r refspec) IsGlob() bool {
+	return strings.Contains(r.Src, "*")
+}
+
+// matchPattern matches name against a pattern with at most one "*",
+// returning the part matched by the wildcard.
+func matchPattern(pattern, name string) (string, bool) {
+	prefix, suffix, ok := strings.Cut(pattern, "*")
+	if !ok {
+		return "", pattern == name
+	}
+	if len(name) < len(prefix)+len(suffix) || !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, suffix) {
+		return "", false
+	}
+	return name[len(prefix) : len(name)-len(suffix)], true
+}
+
+// MatchSrc reports whether the remote ref name matches the source side
+// and returns the corresponding destination, which may be empty.
+func (r refspec) MatchSrc(name string) (string, bool) {
+	star, ok := matchPattern(r.Src, name)
+	if !ok {
+		return "", false
+	}
+	return strings.Replace(r.Dst, "*", star, 1), true
+}
+
+// MatchDst is the reverse of MatchSrc.
+func (r refspec) MatchDst(name string) (string, bool) {
+	if r.Dst == "" {
+		return "", false
+	}
+	star, ok := matchPattern(r.Dst, name)
+	if !ok {
+		return "", false
+	}
+	return strings.Replace(r.Src, "*", star, 1), true
+}
+
+// expandRefName turns a short ref name into the candidates it may stand
+// for, in the order git checks them.
+func expandRefName(name string) []string {
+	if name == "HEAD" || strings.HasPrefix(name, "refs/") {
+		return []string{name}
+	}
+	return []string{"refs/" + name, "refs/tags/" + name, "refs/heads/" + name, "refs/remotes/" + name, "refs/remotes/" + name + "/HEAD"}
+}
@@ -0,0 +1,552 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/object"
+	"github.com/codecrafters-io/git-starter-go/refs"
+	"github.com/codecrafters-io/git-starter-go/revlist"
+)
+
+// revParse resolves a revision expression to an object ID. It accepts
+// the forms of gitrevisions(7) that mygit has use for:
+//
+//	<id>, <abbreviated id>, <refname>, @
+//	<rev>~<n>, <rev>^<n>, <rev>^{<type>}, <rev>^{}, <rev>^{/<regex>}
+//	@{-<n>}, [<branch>]@{upstream}, [<ref>]@{<n>}
+//	<rev>:<path>, :[<stage>:]<path>, :/<regex>
+func revParse(rev string) (string, error) {
+	if pattern, ok := strings.CutPrefix(rev, ":/"); ok {
+		tips, err := allCommitTips()
+		if err != nil {
+			return "", err
+		}
+		return searchCommitMessage(tips, pattern)
+	}
+	if path, ok := strings.CutPrefix(rev, ":"); ok {
+		return indexPath(path)
+	}
+	if i := indexOutsideBraces(rev, ":"); i >= 0 {
+		hash, err := revParse(rev[:i])
+		if err != nil {
+			return "", err
+		}
+		tree, err := peelObject(hash, object.TypeTree)
+		if err != nil {
+			return "", err
+		}
+		return treePath(tree, rev[i+1:], rev[:i])
+	}
+
+	end := indexOutsideBraces(rev, "^~")
+	if end < 0 {
+		end = len(rev)
+	}
+	hash, err := resolveBaseRev(rev[:end])
+	if err != nil {
+		return "", err
+	}
+	return applyRevOperators(hash, rev[end:], rev)
+}
+
+// indexOutsideBraces returns the index of the first of chars in rev
+// that is not inside a @{...} or ^{...} suffix, or -1.
+func indexOutsideBraces(rev, chars string) int {
+	depth := 0
+	for i := 0; i < len(rev); i++ {
+		switch {
+		case rev[i] == '{':
+			depth++
+		case rev[i] == '}' && depth > 0:
+			depth--
+		case depth == 0 && strings.IndexByte(chars, rev[i]) >= 0:
+			return i
+		}
+	}
+	return -1
+}
+
+// resolveBaseRev resolves a revision without ~ and ^ operators.
+func resolveBaseRev(base string) (string, error) {
+	if base == "" {
+		return "", fmt.Errorf("invalid revision: missing name")
+	}
+	if base == "@" {
+		base = "HEAD"
+	}
+	if i := strings.Index(base, "@{"); i >= 0 && strings.HasSuffix(base, "}") {
+		return resolveAtSuffix(base[:i], base[i+2:len(base)-1])
+	}
+
+	f, err := objectFormat()
+	if err != nil {
+		return "", err
+	}
+	if f.ValidID(strings.ToLower(base)) {
+		return strings.ToLower(base), nil
+	}
+	_, hash, err := dwimRef(base)
+	if err == nil {
+		return hash, nil
+	}
+	if !errors.Is(err, refs.ErrNotFound) {
+		return "", err
+	}
+	if len(base) >= minAbbrev && isHex(base) {
+		return getFullHashFromAbbreviated(base)
+	}
+	return "", fmt.Errorf("unknown revision '%s'", base)
+}
+
+// resolveAtSuffix resolves name@{spec}.
+func resolveAtSuffix(name, spec string) (string, error) {
+	switch {
+	case strings.HasPrefix(spec, "-"):
+		n, err := strconv.Atoi(spec[1:])
+		if err != nil || n < 1 || name != "" {
+			return "", fmt.Errorf("invalid revision '%s@{%s}'", name, spec)
+		}
+		branch, err := previousBranch(n)
+		if err != nil {
+			return "", err
+		}
+		return resolveBaseRev(branch)
+	case strings.EqualFold(spec, "u") || strings.EqualFold(spec, "upstream"):
+		upstream, err := upstreamOf(name)
+		if err != nil {
+			return "", err
+		}
+		return resolveRef(upstream)
+	}
+
+	n, err := strconv.Atoi(spec)
+	if err != nil || n < 0 {
+		return "", fmt.Errorf("unsupported revision '%s@{%s}'", name, spec)
+	}
+	ref := "HEAD"
+	if name == "" {
+		if head, err := headBranch(); err == nil && head != "" {
+			ref = head
+		}
+	} else if ref, _, err = dwimRef(name); err != nil {
+		return "", fmt.Errorf("unknown revision '%s'", name)
+	}
+	entries, err := readReflog(ref)
+	if err != nil {
+		return "", err
+	}
+	if n >= len(entries) {
+		return "", fmt.Errorf("log for '%s' only has %d entries", shortRefName(ref), len(entries))
+	}
+	return entries[len(entries)-1-n].New, nil
+}
+
+// previousBranch returns the branch, or commit, that was checked out
+// before the n-th most recent checkout, from the HEAD reflog.
+func previousBranch(n int) (string, error) {
+	entries, err := readReflog("HEAD")
+	if err != nil {
+		return "", err
+	}
+	found := 0
+	for i := len(entries) - 1; i >= 0; i-- {
+		_, message, _ := strings.Cut(entries[i].line, "\t")
+		rest, ok := strings.CutPrefix(message, "checkout: moving from ")
+		if !ok {
+			continue
+		}
+		found++
+		if found == n {
+			from, _, _ := strings.Cut(rest, " to ")
+			return from, nil
+		}
+	}
+	return "", fmt.Errorf("'@{-%d}': only %d checkout(s) in reflog", n, found)
+}
+
+// expandPreviousBranch turns "-" and @{-<n>} into the branch they stand
+// for, so that switching back lands on the branch rather than
+// detaching HEAD at its commit.
+func expandPreviousBranch(name string) (string, error) {
+	if name == "-" {
+		name = "@{-1}"
+	}
+	spec, ok := strings.CutPrefix(name, "@{-")
+	if !ok || !strings.HasSuffix(spec, "}") {
+		return name, nil
+	}
+	n, err := strconv.Atoi(strings.TrimSuffix(spec, "}"))
+	if err != nil || n < 1 {
+		return "", fmt.Errorf("invalid revision '%s'", name)
+	}
+	return previousBranch(n)
+}
+
+// upstreamOf returns the ref tracking the upstream of branch, or of the
+// current branch if branch is empty or HEAD.
+func upstreamOf(branch string) (string, error) {
+	if branch == "" || branch == "HEAD" {
+		head, err := headBranch()
+		if err != nil {
+			return "", err
+		}
+		if head == "" {
+			return "", fmt.Errorf("HEAD does not point to a branch")
+		}
+		branch = head
+	}
+	branch = strings.TrimPrefix(branch, "refs/heads/")
+	upstream, err := branchUpstream(branch)
+	if err != nil {
+		return "", err
+	}
+	if upstream == "" {
+		return "", fmt.Errorf("no upstream configured for branch '%s'", branch)
+	}
+	return upstream, nil
+}
+
+// applyRevOperators applies a chain of ~<n>, ^<n> and ^{...} operators
+// to hash.
+func applyRevOperators(hash, ops, rev string) (string, error) {
+	for ops != "" {
+		if spec, ok := strings.CutPrefix(ops, "^{"); ok {
+			end := strings.IndexByte(spec, '}')
+			if end < 0 {
+				return "", fmt.Errorf("invalid revision '%s'", rev)
+			}
+			var err error
+			if hash, err = peelSpec(hash, spec[:end]); err != nil {
+				return "", err
+			}
+			ops = spec[end+1:]
+			continue
+		}
+
+		op := ops[0]
+		if op != '^' && op != '~' {
+			return "", fmt.Errorf("invalid revision '%s'", rev)
+		}
+		digits := 1
+		for digits < len(ops) && ops[digits] >= '0' && ops[digits] <= '9' {
+			digits++
+		}
+		n := 1
+		if digits > 1 {
+			var err error
+			if n, err = strconv.Atoi(ops[1:digits]); err != nil {
+				return "", fmt.Errorf("invalid revision '%s'", rev)
+			}
+		}
+		ops = ops[digits:]
+
+		commitHash, err := peelObject(hash, object.TypeCommit)
+		if err != nil {
+			return "", err
+		}
+		hash = commitHash
+		if op == '^' && n == 0 {
+			continue
+		}
+		steps, parent := n, 1
+		if op == '^' {
+			steps, parent = 1, n
+		}
+		for i := 0; i < steps; i++ {
+			commit, err := readCommit(hash)
+			if err != nil {
+				return "", err
+			}
+			if parent > len(commit.Parents) {
+				return "", fmt.Errorf("unknown revision '%s': %s has no parent %d", rev, hash[:7], parent)
+			}
+			hash = commit.Parents[parent-1]
+		}
+	}
+	return hash, nil
+}
+
+// peelSpec applies the ^{<spec>} operator.
+func peelSpec(hash, spec string) (string, error) {
+	switch spec {
+	case "":
+		return peelObject(hash, 0)
+	case "object":
+		return hash, nil
+	}
+	if pattern, ok := strings.CutPrefix(spec, "/"); ok {
+		commit, err := peelObject(hash, object.TypeCommit)
+		if err != nil {
+			return "", err
+		}
+		return searchCommitMessage([]string{commit}, pattern)
+	}
+	t, err := object.ParseType(spec)
+	if err != nil {
+		return "", fmt.Errorf("invalid object type '%s'", spec)
+	}
+	return peelObject(hash, t)
+}
+
+// peelObject follows tags, and commits to their trees, until it reaches
+// an object of type want. A zero want only peels tags.
+func peelObject(hash string, want object.Type) (string, error) {
+	for {
+		t, content, err := readObject(hash)
+		if err != nil {
+			return "", err
+		}
+		if t == want || (want == 0 && t != object.TypeTag) {
+			return hash, nil
+		}
+		switch {
+		case t == object.TypeTag:
+			tag, err := object.ParseTag(content)
+			if err != nil {
+				return "", fmt.Errorf("error parsing tag %s: %w", hash, err)
+			}
+			hash = tag.Object
+		case t == object.TypeCommit && want == object.TypeTree:
+			commit, err := object.ParseCommit(content)
+			if err != nil {
+				return "", fmt.Errorf("error parsing commit %s: %w", hash, err)
+			}
+			return commit.Tree, nil
+		default:
+			return "", fmt.Errorf("object %s is a %s, not a %s", hash, t, want)
+		}
+	}
+}
+
+// treePath looks path up in the tree treeHash. An empty path names the
+// tree itself.
+func treePath(treeHash, path, rev string) (string, error) {
+	hash := treeHash
+	for _, name := range strings.Split(path, "/") {
+		if name == "" {
+			continue
+		}
+		tree, err := readTree(hash)
+		if err != nil {
+			return "", fmt.Errorf("path '%s' does not exist in '%s'", path, rev)
+		}
+		found := false
+		for _, entry := range tree.Entries {
+			if entry.Name == name {
+				hash, found = entry.Hash, true
+				break
+			}
+		}
+		if !found {
+			return "", fmt.Errorf("path '%s' does not exist in '%s'", path, rev)
+		}
+	}
+	return hash, nil
+}
+
+// indexPath looks up [<stage>:]<path> in the index.
+func indexPath(spec string) (string, error) {
+	stage, path := 0, spec
+	if len(spec) >= 2 && spec[0] >= '0' && spec[0] <= '3' && spec[1] == ':' {
+		stage, path = int(spec[0]-'0'), spec[2:]
+	}
+	idx, err := readIndex()
+	if err != nil {
+		return "", fmt.Errorf("error reading index: %w", err)
+	}
+	for _, e := range idx.Entries {
+		if e.Path == path && e.Stage == stage {
+			return e.Hash, nil
+		}
+	}
+	return "", fmt.Errorf("path '%s' is not in the index at stage %d", path, stage)
+}
+
+// allCommitTips returns the commits HEAD and every ref point to.
+func allCommitTips() ([]string, error) {
+	tips, err := listRefs("refs/")
+	if err != nil {
+		return nil, err
+	}
+	if hash, err := resolveRef("HEAD"); err == nil {
+		tips["HEAD"] = hash
+	}
+	var commits []string
+	for _, hash := range tips {
+		if commit, err := peelObject(hash, object.TypeCommit); err == nil {
+			commits = append(commits, commit)
+		}
+	}
+	return commits, nil
+}
+
+// searchCommitMessage returns the youngest commit reachable from tips
+// whose message matches pattern.
+func searchCommitMessage(tips []string, pattern string) (string, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return "", fmt.Errorf("invalid regex '%s': %w", pattern, err)
+	}
+	store, err := objectStore()
+	if err != nil {
+		return "", err
+	}
+	walker := revlist.NewWalker(store)
+	for _, tip := range tips {
+		if err := walker.Push(tip); err != nil {
+			return "", err
+		}
+	}
+	for {
+		hash, commit, err := walker.Next()
+		if err == io.EOF {
+			return "", fmt.Errorf("no commit message matches '%s'", pattern)
+		}
+		if err != nil {
+			return "", err
+		}
+		if re.MatchString(commit.Message) {
+			return hash, nil
+		}
+	}
+}
+
+// revParseOptions select what the rev-parse command prints.
+type revParseOptions struct {
+	Verify           bool
+	Short            bool
+	AbbrevRef        bool
+	SymbolicFullName bool
+}
+
+// revParseArg returns the lines rev-parse prints for arg, which may be
+// a revision, ^<rev> or a <rev>..<rev> range.
+func revParseArg(arg string, opts revParseOptions) ([]string, error) {
+	if !opts.Verify && indexOutsideBraces(arg, ":") < 0 {
+		if from, to, ok := strings.Cut(arg, ".."); ok {
+			if from == "" {
+				from = "HEAD"
+			}
+			if to == "" {
+				to = "HEAD"
+			}
+			toLines, err := revParseArg(to, opts)
+			if err != nil {
+				return nil, err
+			}
+			fromLines, err := revParseArg("^"+from, opts)
+			if err != nil {
+				return nil, err
+			}
+			return append(toLines, fromLines...), nil
+		}
+	}
+	prefix := ""
+	if rest, ok := strings.CutPrefix(arg, "^"); ok && !opts.Verify {
+		prefix, arg = "^", rest
+	}
+
+	if opts.AbbrevRef || opts.SymbolicFullName {
+		name, err := revSymbolicName(arg)
+		if err != nil {
+			return nil, err
+		}
+		if name == "" {
+			if _, err := revParse(arg); err != nil {
+				return nil, err
+			}
+			return nil, nil
+		}
+		if opts.AbbrevRef {
+			name = shortRefName(name)
+		}
+		return []string{prefix + name}, nil
+	}
+
+	hash, err := revParse(arg)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Verify {
+		if _, _, err := readObject(hash); err != nil {
+			return nil, err
+		}
+	}
+	if opts.Short {
+		if hash, err = abbreviateID(hash); err != nil {
+			return nil, err
+		}
+	}
+	return []string{prefix + hash}, nil
+}
+
+// revSymbolicName returns the full name of the ref rev stands for, or
+// "" if it names no ref.
+func revSymbolicName(rev string) (string, error) {
+	switch {
+	case rev == "HEAD" || rev == "@":
+		head, err := headBranch()
+		if err != nil || head == "" {
+			return "HEAD", err
+		}
+		return head, nil
+	case strings.HasPrefix(rev, "@{-"):
+		branch, err := expandPreviousBranch(rev)
+		if err != nil {
+			return "", err
+		}
+		if _, err := resolveRef("refs/heads/" + branch); err != nil {
+			return "", nil
+		}
+		return "refs/heads/" + branch, nil
+	}
+	if i := strings.Index(rev, "@{"); i >= 0 {
+		spec := strings.TrimSuffix(rev[i+2:], "}")
+		if strings.EqualFold(spec, "u") || strings.EqualFold(spec, "upstream") {
+			return upstreamOf(rev[:i])
+		}
+		return "", nil
+	}
+	ref, _, err := dwimRef(rev)
+	if errors.Is(err, refs.ErrNotFound) {
+		return "", nil
+	}
+	return ref, err
+}
+
+// minAbbrev is the shortest abbreviated object ID git accepts.
+const minAbbrev = 4
+
+// abbreviateID returns the shortest prefix of id, at least 7 characters
+// long, that names no other object.
+func abbreviateID(id string) (string, error) {
+	store, err := objectStore()
+	if err != nil {
+		return "", err
+	}
+	for n := 7; n < len(id); n++ {
+		matches, err := store.FindPrefix(id[:n])
+		if err != nil {
+			return "", err
+		}
+		if len(matches) <= 1 {
+			return id[:n], nil
+		}
+	}
+	return id, nil
+}
+
+func isHex(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,378 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+
+	"github.com/codecrafters-io/git-starter-go/index"
+	"github.com/codecrafters-io/git-starter-go/object"
+)
+
+// checkoutTree writes every file of treeHash into the working directory
+// and returns an index describing them.
+func checkoutTree(treeHash string) (*index.Index, error) {
+	idx, err := newIndex()
+	if err != nil {
+		return nil, err
+	}
+	if err := checkoutTreeInto(idx, treeHash, ""); err != nil {
+		return nil, err
+	}
+	return idx, nil
+}
+
+func checkoutTreeInto(idx *index.Index, treeHash, prefix string) error {
+	tree, err := readTree(treeHash)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range tree.Entries {
+		path := prefix + entry.Name
+		if entry.Mode.IsDir() {
+			if err := os.MkdirAll(filepath.FromSlash(path), 0755); err != nil {
+				return err
+			}
+			if err := checkoutTreeInto(idx, entry.Hash, path+"/"); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := checkoutFile(idx, path, entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkoutFile writes a single tree entry to path and stages it.
+func checkoutFile(idx *index.Index, path string, entry object.TreeEntry) error {
+	filePath := filepath.FromSlash(path)
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return err
+	}
+	os.Remove(filePath)
+
+	switch entry.Mode {
+	case object.ModeGitlink:
+		// Submodules are not checked out; git leaves an empty directory.
+		if err := os.MkdirAll(filePath, 0755); err != nil {
+			return err
+		}
+		idx.Add(&index.Entry{Path: path, Hash: entry.Hash, Mode: object.ModeGitlink})
+		return nil
+	case object.ModeSymlink:
+		_, target, err := readObject(entry.Hash)
+		if err != nil {
+			return err
+		}
+		if err := os.Symlink(string(target), filePath); err != nil {
+			return fmt.Errorf("error creating symlink %s: %w", path, err)
+		}
+	default:
+		_, content, err := readObject(entry.Hash)
+		if err != nil {
+			return err
+		}
+		perm := os.FileMode(0644)
+		if entry.Mode == object.ModeExecutable {
+			perm = 0755
+		}
+		if err := os.WriteFile(filePath, content, perm); err != nil {
+			return fmt.Errorf("error writing %s: %w", path, err)
+		}
+	}
+
+	info, err := os.Lstat(filePath)
+	if err != nil {
+		return err
+	}
+	e := index.NewEntry(path, entry.Hash, info)
+	e.Mode = entry.Mode
+	idx.Add(e)
+	return nil
+}
+
+// readTree reads and parses the tree treeHash.
+func readTree(treeHash string) (*object.Tree, error) {
+	objType, content, err := readObject(treeHash)
+	if err != nil {
+		return nil, err
+	}
+	if objType != object.TypeTree {
+		return nil, fmt.Errorf("object %s is a %s, not a tree", treeHash, objType)
+	}
+	f, err := objectFormat()
+	if err != nil {
+		return nil, err
+	}
+	tree, err := object.ParseTree(content, f)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing tree %s: %w", treeHash, err)
+	}
+	return tree, nil
+}
+
+// treeFiles returns every non-tree entry reachable from treeHash keyed
+// by its full path. An empty treeHash stands for the empty tree.
+func treeFiles(treeHash string) (map[string]object.TreeEntry, error) {
+	files := make(map[string]object.TreeEntry)
+	if treeHash == "" {
+		return files, nil
+	}
+	return files, collectTreeFiles(treeHash, "", files)
+}
+
+func collectTreeFiles(treeHash, prefix string, files map[string]object.TreeEntry) error {
+	tree, err := readTree(treeHash)
+	if err != nil {
+		return err
+	}
+	for _, entry := range tree.Entries {
+		if entry.Mode.IsDir() {
+			if err := collectTreeFiles(entry.Hash, prefix+entry.Name+"/", files); err != nil {
+				return err
+			}
+			continue
+		}
+		files[prefix+entry.Name] = entry
+	}
+	return nil
+}
+
+// switchWorktree moves the index and working tree from oldTree to
+// newTree, either of which may be empty. Only paths that differ between
+// the two trees are touched, so local changes to other paths carry
+// over. If the switch would overwrite local changes or untracked files
+// it fails before anything is written.
+func switchWorktree(idx *index.Index, oldTree, newTree string) error {
+	oldFiles, err := treeFiles(oldTree)
+	if err != nil {
+		return err
+	}
+	newFiles, err := treeFiles(newTree)
+	if err != nil {
+		return err
+	}
+
+	var changed []string
+	for path, entry := range oldFiles {
+		if newEntry, ok := newFiles[path]; !ok || newEntry.Hash != entry.Hash || newEntry.Mode != entry.Mode {
+			changed = append(changed, path)
+		}
+	}
+	for path := range newFiles {
+		if _, ok := oldFiles[path]; !ok {
+			changed = append(changed, path)
+		}
+	}
+	sort.Strings(changed)
+
+	var modified, untracked []string
+	blocked := make(map[string]bool)
+	for _, path := range changed {
+		oldEntry, inOld := oldFiles[path]
+		newEntry, inNew := newFiles[path]
+		if inNew {
+			blocker, err := blockingFile(path, oldFiles)
+			if err != nil {
+				return err
+			}
+			if blocker != "" {
+				if !blocked[blocker] {
+					blocked[blocker] = true
+					untracked = append(untracked, blocker)
+				}
+				continue
+			}
+		}
+		e := idx.Entry(path)
+		switch {
+		case e == nil && inOld:
+			// Staged for deletion.
+			modified = append(modified, path)
+		case e == nil:
+			clean, err := worktreeMatches(path, newEntry, oldFiles)
+			if err != nil {
+				return err
+			}
+			if !clean {
+				untracked = append(untracked, path)
+			}
+		case !(inOld && e.Hash == oldEntry.Hash && e.Mode == oldEntry.Mode) &&
+			!(inNew && e.Hash == newEntry.Hash && e.Mode == newEntry.Mode):
+			// Staged changes.
+			modified = append(modified, path)
+		default:
+			dirty, err := worktreeDirty(e)
+			if err != nil {
+				return err
+			}
+			if dirty {
+				modified = append(modified, path)
+			}
+		}
+	}
+	if len(modified) > 0 {
+		return fmt.Errorf("your local changes to the following files would be overwritten by checkout:\n\t%s\nPlease commit your changes or stash them before you switch branches",
+			strings.Join(modified, "\n\t"))
+	}
+	if len(untracked) > 0 {
+		return fmt.Errorf("the following untracked working tree files would be overwritten by checkout:\n\t%s\nPlease move or remove them before you switch branches",
+			strings.Join(untracked, "\n\t"))
+	}
+
+	// Removals come first so that a file can take the place of a
+	// directory.
+	for _, path := range changed {
+		if _, ok := newFiles[path]; ok {
+			continue
+		}
+		filePath := filepath.FromSlash(path)
+		if err := os.RemoveAll(filePath); err != nil {
+			return fmt.Errorf("error removing %s: %w", path, err)
+		}
+		dir := filepath.Dir(filePath)
+		for dir != "." && os.Remove(dir) == nil {
+			dir = filepath.Dir(dir)
+		}
+		idx.Remove(path)
+	}
+	for _, path := range changed {
+		if entry, ok := newFiles[path]; ok {
+			if err := checkoutFile(idx, path, entry); err != nil {
+				return err
+			}
+		}
+	}
+	idx.RemoveExtension("TREE")
+	return nil
+}
+
+// worktreeDirty reports whether the working tree file of e differs from
+// what is staged. A missing file counts as clean, as it is about to be
+// replaced anyway, and submodules are never checked.
+func worktreeDirty(e *index.Entry) (bool, error) {
+	if e.Mode == object.ModeGitlink {
+		return false, nil
+	}
+	info, err := os.Lstat(filepath.FromSlash(e.Path))
+	if os.IsNotExist(err) || errors.Is(err, syscall.ENOTDIR) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if !e.Changed(info) {
+		return false, nil
+	}
+	if index.FileModeOf(info) != e.Mode {
+		return true, nil
+	}
+	hash, err := worktreeHash(e.Path, info)
+	if err != nil {
+		return false, err
+	}
+	return hash != e.Hash, nil
+}
+
+// blockingFile returns the untracked file or symlink, if any, standing
+// where path needs one of its parent directories. Files tracked in
+// oldFiles do not count, as the switch removes them first.
+func blockingFile(path string, oldFiles map[string]object.TreeEntry) (string, error) {
+	for i := range path {
+		if path[i] != '/' {
+			continue
+		}
+		dir := path[:i]
+		info, err := os.Lstat(filepath.FromSlash(dir))
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		if err != nil {
+			return "", err
+		}
+		if info.IsDir() {
+			continue
+		}
+		if _, ok := oldFiles[dir]; ok {
+			return "", nil
+		}
+		return dir, nil
+	}
+	return "", nil
+}
+
+// worktreeMatches reports whether an untracked path can be replaced by
+// entry without losing data: it is absent, already holds the same
+// content, or is a directory of nothing but the tracked files
+// that are about to be removed.
+func worktreeMatches(path string, entry object.TreeEntry, tracked map[string]object.TreeEntry) (bool, error) {
+	info, err := os.Lstat(filepath.FromSlash(path))
+	if os.IsNotExist(err) || errors.Is(err, syscall.ENOTDIR) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if info.IsDir() {
+		clean := true
+		err := filepath.WalkDir(filepath.FromSlash(path), func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if _, ok := tracked[filepath.ToSlash(p)]; !d.IsDir() && !ok {
+				clean = false
+				return filepath.SkipAll
+			}
+			return nil
+		})
+		return clean, err
+	}
+	hash, err := worktreeHash(path, info)
+	if err != nil {
+		return false, err
+	}
+	return hash == entry.Hash, nil
+}
+
+// worktreeHash computes the blob ID of a working tree file without
+// storing it.
+func worktreeHash(path string, info os.FileInfo) (string, error) {
+	f, err := objectFormat()
+	if err != nil {
+		return "", err
+	}
+	filePath := filepath.FromSlash(path)
+	if info.Mode()&os.ModeSymlink != 0 {
+		target, err := os.Readlink(filePath)
+		if err != nil {
+			return "", fmt.Errorf("error reading link '%s': %w", path, err)
+		}
+		return f.Hash(object.TypeBlob, []byte(target))
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	h := f.New()
+	h.Write(object.Header(object.TypeBlob, int(info.Size())))
+	if _, err := io.Copy(h, file); err != nil {
+		return "", fmt.Errorf("error reading '%s': %w", path, err)
+	}
+	sum, err := f.Sum(h)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(sum), nil
+}
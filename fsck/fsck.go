@@ -0,0 +1,171 @@
+// Package fsck validates the syntax of git objects.
+package fsck
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/object"
+)
+
+// Severity tells how serious a finding is.
+type Severity int
+
+const (
+	Warning Severity = iota
+	Error
+)
+
+func (s Severity) String() string {
+	if s == Error {
+		return "error"
+	}
+	return "warning"
+}
+
+// Finding is a problem found in an object.
+type Finding struct {
+	Severity Severity
+	Message  string
+}
+
+// Link is a reference from one object to another.
+type Link struct {
+	Type object.Type
+	ID   string
+}
+
+// Check validates the content of an object of type t and returns the
+// problems found along with the objects it refers to. Links are returned
+// even for objects with errors, as far as they could be parsed. Object
+// IDs are in format f.
+func Check(t object.Type, content []byte, f *object.Format) ([]Finding, []Link) {
+	switch t {
+	case object.TypeTree:
+		return checkTree(content, f.Size)
+	case object.TypeCommit:
+		return checkCommit(content)
+	case object.TypeTag:
+		return checkTag(content)
+	}
+	return nil, nil
+}
+
+func errorf(format string, args ...any) Finding {
+	return Finding{Severity: Error, Message: fmt.Sprintf(format, args...)}
+}
+
+func warnf(format string, args ...any) Finding {
+	return Finding{Severity: Warning, Message: fmt.Sprintf(format, args...)}
+}
+
+// checkTree walks the raw entries rather than using object.ParseTree so
+// that the mode strings can be checked as written.
+func checkTree(data []byte, hashSize int) ([]Finding, []Link) {
+	var findings []Finding
+	var links []Link
+	var prev *object.TreeEntry
+	names := make(map[string]bool)
+	badMode, zeroPadded, unsorted, duplicate := false, false, false, false
+
+	for i := 0; i < len(data); {
+		space := bytes.IndexByte(data[i:], ' ')
+		if space == -1 {
+			return append(findings, errorf("malformed entry at offset %d: missing mode", i)), links
+		}
+		modeStr := string(data[i : i+space])
+		mode, err := object.ParseFileMode(modeStr)
+		if err != nil {
+			return append(findings, errorf("malformed entry at offset %d: %s", i, err)), links
+		}
+		i += space + 1
+
+		null := bytes.IndexByte(data[i:], 0)
+		if null == -1 {
+			return append(findings, errorf("malformed entry at offset %d: missing name terminator", i)), links
+		}
+		name := string(data[i : i+null])
+		i += null + 1
+		if i+hashSize > len(data) {
+			return append(findings, errorf("malformed entry %q: truncated hash", name)), links
+		}
+		entry := object.TreeEntry{Mode: mode, Name: name, Hash: hex.EncodeToString(data[i : i+hashSize])}
+		i += hashSize
+
+		switch {
+		case name == "":
+			findings = append(findings, errorf("contains empty pathname"))
+		case name == ".":
+			findings = append(findings, errorf("contains '.'"))
+		case name == "..":
+			findings = append(findings, errorf("contains '..'"))
+		case strings.EqualFold(name, ".git"):
+			findings = append(findings, errorf("contains '.git'"))
+		case strings.Contains(name, "/"):
+			findings = append(findings, errorf("contains full pathnames"))
+		}
+		if modeStr[0] == '0' {
+			zeroPadded = true
+		}
+		if !mode.Valid() {
+			badMode = true
+		}
+		if names[name] {
+			duplicate = true
+		}
+		names[name] = true
+		if prev != nil && object.CompareEntries(*prev, entry) > 0 {
+			unsorted = true
+		}
+		prev = &entry
+
+		switch {
+		case mode == object.ModeGitlink:
+			// Submodule commits live in another repository.
+		case mode.IsDir():
+			links = append(links, Link{Type: object.TypeTree, ID: entry.Hash})
+		default:
+			links = append(links, Link{Type: object.TypeBlob, ID: entry.Hash})
+		}
+	}
+
+	if duplicate {
+		findings = append(findings, errorf("contains duplicate file entries"))
+	}
+	if unsorted {
+		findings = append(findings, errorf("not properly sorted"))
+	}
+	if badMode {
+		findings = append(findings, warnf("contains bad file modes"))
+	}
+	if zeroPadded {
+		findings = append(findings, warnf("contains zero-padded file modes"))
+	}
+	return findings, links
+}
+
+func checkCommit(data []byte) ([]Finding, []Link) {
+	commit, err := object.ParseCommit(data)
+	if err != nil {
+		return []Finding{errorf("%s", err)}, nil
+	}
+	links := []Link{{Type: object.TypeTree, ID: commit.Tree}}
+	for _, parent := range commit.Parents {
+		links = append(links, Link{Type: object.TypeCommit, ID: parent})
+	}
+	return nil, links
+}
+
+func checkTag(data []byte) ([]Finding, []Link) {
+	tag, err := object.ParseTag(data)
+	if err != nil {
+		return []Finding{errorf("%s", err)}, nil
+	}
+	var findings []Finding
+	if tag.Tagger == nil {
+		findings = append(findings, warnf("invalid format - expected 'tagger' line"))
+	}
+	return findings, []Link{{Type: tag.ObjectType, ID: tag.Object}}
+}
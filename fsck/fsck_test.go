@@ -0,0 +1,103 @@
+package fsck
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/codecrafters-io/git-starter-go/object"
+)
+
+const (
+	hashA = "1111111111111111111111111111111111111111"
+	hashB = "2222222222222222222222222222222222222222"
+)
+
+// tree encodes entries given as alternating mode/name strings, all
+// pointing at hashA.
+func tree(entries ...string) []byte {
+	raw := strings.Repeat("\x11", 20)
+	var b strings.Builder
+	for i := 0; i < len(entries); i += 2 {
+		b.WriteString(entries[i] + " " + entries[i+1] + "\x00" + raw)
+	}
+	return []byte(b.String())
+}
+
+func TestCheck(t *testing.T) {
+	author := "A U Thor <author@example.com> 1700000000 +0000"
+	tests := []struct {
+		name     string
+		t        object.Type
+		content  []byte
+		findings []string
+		links    []Link
+	}{
+		{
+			name:    "clean tree",
+			t:       object.TypeTree,
+			content: tree("100644", "a", "40000", "b", "160000", "sub"),
+			links:   []Link{{object.TypeBlob, hashA}, {object.TypeTree, hashA}},
+		},
+		{
+			name:     "bad names",
+			t:        object.TypeTree,
+			content:  tree("100644", ".git", "40000", "..", "100644", "a/b"),
+			findings: []string{"error: contains '.git'", "error: contains '..'", "error: contains full pathnames", "error: not properly sorted"},
+			links:    []Link{{object.TypeBlob, hashA}, {object.TypeTree, hashA}, {object.TypeBlob, hashA}},
+		},
+		{
+			name:     "duplicates and modes",
+			t:        object.TypeTree,
+			content:  tree("100664", "a", "040000", "a"),
+			findings: []string{"error: contains duplicate file entries", "warning: contains bad file modes", "warning: contains zero-padded file modes"},
+			links:    []Link{{object.TypeBlob, hashA}, {object.TypeTree, hashA}},
+		},
+		{
+			name:     "truncated tree",
+			t:        object.TypeTree,
+			content:  []byte("100644 a\x00\x11\x11"),
+			findings: []string{`error: malformed entry "a": truncated hash`},
+		},
+		{
+			name:    "commit",
+			t:       object.TypeCommit,
+			content: []byte("tree " + hashA + "\nparent " + hashB + "\nauthor " + author + "\ncommitter " + author + "\n\nmsg\n"),
+			links:   []Link{{object.TypeTree, hashA}, {object.TypeCommit, hashB}},
+		},
+		{
+			name:     "broken commit",
+			t:        object.TypeCommit,
+			content:  []byte("author " + author + "\n\nmsg\n"),
+			findings: []string{"error"},
+		},
+		{
+			name:     "tag without tagger",
+			t:        object.TypeTag,
+			content:  []byte("object " + hashB + "\ntype commit\ntag v1\n\nmsg\n"),
+			findings: []string{"warning: invalid format - expected 'tagger' line"},
+			links:    []Link{{object.TypeCommit, hashB}},
+		},
+		{
+			name:    "blob",
+			t:       object.TypeBlob,
+			content: []byte("anything"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			findings, links := Check(tt.t, tt.content, object.SHA1)
+			if len(findings) != len(tt.findings) {
+				t.Fatalf("findings = %v, want %v", findings, tt.findings)
+			}
+			for i, f := range findings {
+				if got := f.Severity.String() + ": " + f.Message; !strings.HasPrefix(got, tt.findings[i]) {
+					t.Errorf("finding %d = %q, want %q", i, got, tt.findings[i])
+				}
+			}
+			if !reflect.DeepEqual(links, tt.links) {
+				t.Errorf("links = %v, want %v", links, tt.links)
+			}
+		})
+	}
+}
@@ -8,4 +8,7 @@ module github.com/codecrafters-io/git-starter-go
 
 go 1.22
 
-require gopkg.in/ini.v1 v1.67.0 // indirect
+require (
+	github.com/pjbgf/sha1cd v0.3.2
+	gopkg.in/ini.v1 v1.67.0
+)
@@ -0,0 +1,433 @@
+// Package index reads and writes git's DIRC index file (versions 2, 3
+// and 4).
+package index
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/codecrafters-io/git-starter-go/object"
+)
+
+const (
+	flagAssumeValid = 0x8000
+	flagExtended    = 0x4000
+	flagStageMask   = 0x3000
+	flagStageShift  = 12
+	flagNameMask    = 0x0fff
+
+	extFlagSkipWorktree = 0x4000
+	extFlagIntentToAdd  = 0x2000
+)
+
+var signature = []byte("DIRC")
+
+// Entry is a single staged path.
+type Entry struct {
+	CTime time.Time
+	MTime time.Time
+	Dev   uint32
+	Ino   uint32
+	Mode  object.FileMode
+	UID   uint32
+	GID   uint32
+	Size  uint32
+	Hash  string
+	Path  string
+
+	// Stage is 0 for normal entries and 1-3 for unmerged entries.
+	Stage        int
+	AssumeValid  bool
+	SkipWorktree bool
+	IntentToAdd  bool
+}
+
+// Extension is an index extension, kept verbatim.
+type Extension struct {
+	Signature string
+	Data      []byte
+}
+
+// Index is the in-memory form of .git/index. Entries are kept sorted by
+// path and stage.
+type Index struct {
+	Version    uint32
+	Entries    []*Entry
+	Extensions []Extension
+
+	// format names the objects and computes the trailing checksum.
+	format *object.Format
+}
+
+// New returns an empty version 2 index of a repository using object
+// format f.
+func New(f *object.Format) *Index {
+	return &Index{Version: 2, format: f}
+}
+
+// Read parses an index of a repository using object format f and
+// verifies its trailing checksum.
+func Read(r io.Reader, f *object.Format) (*Index, error) {
+	hashSize := f.Size
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 12+hashSize {
+		return nil, fmt.Errorf("index file too short")
+	}
+
+	body, checksum := data[:len(data)-hashSize], data[len(data)-hashSize:]
+	h := f.New()
+	h.Write(body)
+	if !bytes.Equal(h.Sum(nil), checksum) {
+		return nil, fmt.Errorf("index checksum mismatch")
+	}
+	if !bytes.Equal(body[:4], signature) {
+		return nil, fmt.Errorf("bad index signature")
+	}
+
+	idx := &Index{Version: binary.BigEndian.Uint32(body[4:8]), format: f}
+	if idx.Version < 2 || idx.Version > 4 {
+		return nil, fmt.Errorf("unsupported index version %d", idx.Version)
+	}
+	count := binary.BigEndian.Uint32(body[8:12])
+
+	pos := 12
+	prevPath := ""
+	for i := uint32(0); i < count; i++ {
+		e, n, err := idx.readEntry(body[pos:], prevPath)
+		if err != nil {
+			return nil, fmt.Errorf("index entry %d: %w", i, err)
+		}
+		idx.Entries = append(idx.Entries, e)
+		prevPath = e.Path
+		pos += n
+	}
+
+	for pos < len(body) {
+		if pos+8 > len(body) {
+			return nil, fmt.Errorf("truncated index extension header")
+		}
+		sig := string(body[pos : pos+4])
+		size := int(binary.BigEndian.Uint32(body[pos+4 : pos+8]))
+		pos += 8
+		if pos+size > len(body) {
+			return nil, fmt.Errorf("truncated index extension %q", sig)
+		}
+		switch {
+		case sig == "link":
+			return nil, fmt.Errorf("split index is not supported")
+		case sig == "sdir":
+			return nil, fmt.Errorf("sparse index is not supported")
+		case sig[0] < 'A' || sig[0] > 'Z':
+			return nil, fmt.Errorf("unsupported mandatory index extension %q", sig)
+		}
+		idx.Extensions = append(idx.Extensions, Extension{
+			Signature: sig,
+			Data:      append([]byte(nil), body[pos:pos+size]...),
+		})
+		pos += size
+	}
+
+	return idx, nil
+}
+
+func (idx *Index) readEntry(data []byte, prevPath string) (*Entry, int, error) {
+	hashSize := idx.format.Size
+	fixedSize := 40 + hashSize + 2
+	if len(data) < fixedSize {
+		return nil, 0, fmt.Errorf("truncated entry")
+	}
+
+	u32 := func(i int) uint32 { return binary.BigEndian.Uint32(data[i*4:]) }
+	e := &Entry{
+		CTime: time.Unix(int64(u32(0)), int64(u32(1))),
+		MTime: time.Unix(int64(u32(2)), int64(u32(3))),
+		Dev:   u32(4),
+		Ino:   u32(5),
+		Mode:  object.FileMode(u32(6)),
+		UID:   u32(7),
+		GID:   u32(8),
+		Size:  u32(9),
+		Hash:  hex.EncodeToString(data[40 : 40+hashSize]),
+	}
+
+	flags := binary.BigEndian.Uint16(data[40+hashSize:])
+	e.AssumeValid = flags&flagAssumeValid != 0
+	e.Stage = int(flags&flagStageMask) >> flagStageShift
+	nameLen := int(flags & flagNameMask)
+
+	pos := fixedSize
+	if flags&flagExtended != 0 {
+		if idx.Version < 3 {
+			return nil, 0, fmt.Errorf("extended flags in version %d index", idx.Version)
+		}
+		if len(data) < pos+2 {
+			return nil, 0, fmt.Errorf("truncated entry")
+		}
+		extFlags := binary.BigEndian.Uint16(data[pos:])
+		e.SkipWorktree = extFlags&extFlagSkipWorktree != 0
+		e.IntentToAdd = extFlags&extFlagIntentToAdd != 0
+		pos += 2
+	}
+
+	if idx.Version == 4 {
+		strip, n, err := readOffsetVarint(data[pos:])
+		if err != nil {
+			return nil, 0, err
+		}
+		if strip > len(prevPath) {
+			return nil, 0, fmt.Errorf("invalid path prefix length %d", strip)
+		}
+		pos += n
+		end := bytes.IndexByte(data[pos:], 0)
+		if end == -1 {
+			return nil, 0, fmt.Errorf("unterminated path")
+		}
+		e.Path = prevPath[:len(prevPath)-strip] + string(data[pos:pos+end])
+		return e, pos + end + 1, nil
+	}
+
+	end := bytes.IndexByte(data[pos:], 0)
+	if end == -1 {
+		return nil, 0, fmt.Errorf("unterminated path")
+	}
+	if nameLen != flagNameMask && nameLen != end {
+		return nil, 0, fmt.Errorf("path length mismatch for %q", data[pos:pos+end])
+	}
+	e.Path = string(data[pos : pos+end])
+
+	// Entries are NUL-padded to a multiple of eight bytes, with at
+	// least one NUL terminating the path.
+	entryLen := (pos + end + 8) &^ 7
+	if entryLen > len(data) {
+		return nil, 0, fmt.Errorf("truncated entry padding")
+	}
+	return e, entryLen, nil
+}
+
+// readOffsetVarint decodes the variable-length integer used for v4 path
+// prefixes (the same encoding as pack OFS_DELTA offsets).
+func readOffsetVarint(data []byte) (int, int, error) {
+	if len(data) == 0 {
+		return 0, 0, errors.New("truncated varint")
+	}
+	c := data[0]
+	val := int(c & 0x7f)
+	n := 1
+	for c&0x80 != 0 {
+		if n >= len(data) {
+			return 0, 0, errors.New("truncated varint")
+		}
+		c = data[n]
+		n++
+		val = ((val + 1) << 7) | int(c&0x7f)
+	}
+	return val, n, nil
+}
+
+func appendOffsetVarint(buf []byte, val int) []byte {
+	var tmp [16]byte
+	pos := len(tmp) - 1
+	tmp[pos] = byte(val & 0x7f)
+	for val >>= 7; val > 0; val >>= 7 {
+		val--
+		pos--
+		tmp[pos] = 0x80 | byte(val&0x7f)
+	}
+	return append(buf, tmp[pos:]...)
+}
+
+// Write serializes the index followed by its SHA-1 checksum.
+func (idx *Index) Write(w io.Writer) error {
+	idx.Sort()
+
+	version := idx.Version
+	if version == 0 {
+		version = 2
+	}
+	if version == 2 {
+		for _, e := range idx.Entries {
+			if e.SkipWorktree || e.IntentToAdd {
+				version = 3
+				break
+			}
+		}
+	}
+	idx.Version = version
+
+	h := idx.format.New()
+	bw := bufio.NewWriter(io.MultiWriter(w, h))
+
+	var header [12]byte
+	copy(header[:4], signature)
+	binary.BigEndian.PutUint32(header[4:], version)
+	binary.BigEndian.PutUint32(header[8:], uint32(len(idx.Entries)))
+	bw.Write(header[:])
+
+	prevPath := ""
+	for _, e := range idx.Entries {
+		data, err := idx.encodeEntry(e, prevPath)
+		if err != nil {
+			return err
+		}
+		bw.Write(data)
+		prevPath = e.Path
+	}
+
+	for _, ext := range idx.Extensions {
+		var extHeader [8]byte
+		copy(extHeader[:4], ext.Signature)
+		binary.BigEndian.PutUint32(extHeader[4:], uint32(len(ext.Data)))
+		bw.Write(extHeader[:])
+		bw.Write(ext.Data)
+	}
+
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	_, err := w.Write(h.Sum(nil))
+	return err
+}
+
+func (idx *Index) encodeEntry(e *Entry, prevPath string) ([]byte, error) {
+	hash, err := hex.DecodeString(e.Hash)
+	if err != nil || len(hash) != idx.format.Size {
+		return nil, fmt.Errorf("invalid object id %q for %s", e.Hash, e.Path)
+	}
+	if e.Stage < 0 || e.Stage > 3 {
+		return nil, fmt.Errorf("invalid stage %d for %s", e.Stage, e.Path)
+	}
+
+	buf := make([]byte, 40, 64+len(e.Path))
+	put := func(i int, v uint32) { binary.BigEndian.PutUint32(buf[i*4:], v) }
+	put(0, uint32(e.CTime.Unix()))
+	put(1, uint32(e.CTime.Nanosecond()))
+	put(2, uint32(e.MTime.Unix()))
+	put(3, uint32(e.MTime.Nanosecond()))
+	put(4, e.Dev)
+	put(5, e.Ino)
+	put(6, uint32(e.Mode))
+	put(7, e.UID)
+	put(8, e.GID)
+	put(9, e.Size)
+	buf = append(buf, hash...)
+
+	flags := uint16(e.Stage) << flagStageShift
+	if len(e.Path) < flagNameMask {
+		flags |= uint16(len(e.Path))
+	} else {
+		flags |= flagNameMask
+	}
+	if e.AssumeValid {
+		flags |= flagAssumeValid
+	}
+	extended := e.SkipWorktree || e.IntentToAdd
+	if extended {
+		flags |= flagExtended
+	}
+	buf = binary.BigEndian.AppendUint16(buf, flags)
+	if extended {
+		var extFlags uint16
+		if e.SkipWorktree {
+			extFlags |= extFlagSkipWorktree
+		}
+		if e.IntentToAdd {
+			extFlags |= extFlagIntentToAdd
+		}
+		buf = binary.BigEndian.AppendUint16(buf, extFlags)
+	}
+
+	if idx.Version == 4 {
+		common := 0
+		for common < len(prevPath) && common < len(e.Path) && prevPath[common] == e.Path[common] {
+			common++
+		}
+		buf = appendOffsetVarint(buf, len(prevPath)-common)
+		buf = append(buf, e.Path[common:]...)
+		return append(buf, 0), nil
+	}
+
+	buf = append(buf, e.Path...)
+	padded := (len(buf) + 8) &^ 7
+	return append(buf, make([]byte, padded-len(buf))...), nil
+}
+
+// Sort orders entries by path and then stage, as git requires.
+func (idx *Index) Sort() {
+	sort.SliceStable(idx.Entries, func(i, j int) bool {
+		return less(idx.Entries[i].Path, idx.Entries[i].Stage, idx.Entries[j].Path, idx.Entries[j].Stage)
+	})
+}
+
+func less(pathA string, stageA int, pathB string, stageB int) bool {
+	if pathA != pathB {
+		return pathA < pathB
+	}
+	return stageA < stageB
+}
+
+func (idx *Index) search(path string, stage int) int {
+	return sort.Search(len(idx.Entries), func(i int) bool {
+		return !less(idx.Entries[i].Path, idx.Entries[i].Stage, path, stage)
+	})
+}
+
+// Entry returns the stage 0 entry for path, or nil.
+func (idx *Index) Entry(path string) *Entry {
+	i := idx.search(path, 0)
+	if i < len(idx.Entries) && idx.Entries[i].Path == path && idx.Entries[i].Stage == 0 {
+		return idx.Entries[i]
+	}
+	return nil
+}
+
+// Add inserts e. A stage 0 entry replaces every entry for its path,
+// resolving any conflict; a higher stage replaces only the same stage.
+func (idx *Index) Add(e *Entry) {
+	entries := idx.Entries[:0]
+	for _, existing := range idx.Entries {
+		if existing.Path == e.Path && (e.Stage == 0 || existing.Stage == 0 || existing.Stage == e.Stage) {
+			continue
+		}
+		entries = append(entries, existing)
+	}
+	idx.Entries = entries
+
+	i := idx.search(e.Path, e.Stage)
+	idx.Entries = append(idx.Entries, nil)
+	copy(idx.Entries[i+1:], idx.Entries[i:])
+	idx.Entries[i] = e
+}
+
+// Remove deletes all entries for path and reports whether any existed.
+func (idx *Index) Remove(path string) bool {
+	i := idx.search(path, 0)
+	j := i
+	for j < len(idx.Entries) && idx.Entries[j].Path == path {
+		j++
+	}
+	idx.Entries = append(idx.Entries[:i], idx.Entries[j:]...)
+	return j > i
+}
+
+// RemoveExtension drops the extension with the given signature. Callers
+// changing entries should drop "TREE", the cached tree, since it would
+// otherwise describe stale contents.
+func (idx *Index) RemoveExtension(sig string) {
+	exts := idx.Extensions[:0]
+	for _, ext := range idx.Extensions {
+		if ext.Signature != sig {
+			exts = append(exts, ext)
+		}
+	}
+	idx.Extensions = exts
+}
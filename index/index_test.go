@@ -0,0 +1,168 @@
+package index
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/codecrafters-io/git-starter-go/object"
+)
+
+func testEntry(f *object.Format, path string, stage int) *Entry {
+	id, _ := f.Hash(object.TypeBlob, []byte(path))
+	return &Entry{
+		CTime: time.Unix(1700000000, 123),
+		MTime: time.Unix(1700000001, 456789),
+		Dev:   2049,
+		Ino:   uint32(len(path)),
+		Mode:  0100644,
+		UID:   1000,
+		GID:   1000,
+		Size:  uint32(len(path)),
+		Hash:  id,
+		Path:  path,
+		Stage: stage,
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	longPath := strings.Repeat("d/", 2100) + "file"
+	flagged := func(e *Entry, fn func(e *Entry)) *Entry { fn(e); return e }
+
+	tests := []struct {
+		name        string
+		format      *object.Format
+		version     uint32
+		entries     []*Entry
+		wantVersion uint32
+	}{
+		{"v2 empty", object.SHA1, 2, nil, 2},
+		{"v2", object.SHA1, 2, []*Entry{
+			testEntry(object.SHA1, "README", 0),
+			testEntry(object.SHA1, "dir/a.go", 0),
+			flagged(testEntry(object.SHA1, "dir/b.go", 0), func(e *Entry) { e.AssumeValid = true }),
+		}, 2},
+		{"v2 long path", object.SHA1, 2, []*Entry{testEntry(object.SHA1, longPath, 0)}, 2},
+		{"v2 conflict stages", object.SHA1, 2, []*Entry{
+			testEntry(object.SHA1, "conflict", 1),
+			testEntry(object.SHA1, "conflict", 2),
+			testEntry(object.SHA1, "conflict", 3),
+		}, 2},
+		{"v2 upgraded for extended flags", object.SHA1, 2, []*Entry{
+			flagged(testEntry(object.SHA1, "sparse", 0), func(e *Entry) { e.SkipWorktree = true }),
+		}, 3},
+		{"v3", object.SHA1, 3, []*Entry{
+			testEntry(object.SHA1, "a", 0),
+			flagged(testEntry(object.SHA1, "intent", 0), func(e *Entry) { e.IntentToAdd = true }),
+			flagged(testEntry(object.SHA1, "sparse", 0), func(e *Entry) { e.SkipWorktree = true }),
+		}, 3},
+		{"v4", object.SHA1, 4, []*Entry{
+			testEntry(object.SHA1, "src/main.go", 0),
+			testEntry(object.SHA1, "src/main_test.go", 0),
+			testEntry(object.SHA1, "src/pkg/util.go", 0),
+			flagged(testEntry(object.SHA1, "zz", 0), func(e *Entry) { e.SkipWorktree = true }),
+		}, 4},
+		{"v4 long path", object.SHA1, 4, []*Entry{testEntry(object.SHA1, "a", 0), testEntry(object.SHA1, longPath, 0)}, 4},
+		{"sha256", object.SHA256, 4, []*Entry{testEntry(object.SHA256, "a", 0), testEntry(object.SHA256, "b", 0)}, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idx := New(tt.format)
+			idx.Version = tt.version
+			for _, e := range tt.entries {
+				idx.Add(e)
+			}
+			idx.Extensions = []Extension{{Signature: "TREE", Data: []byte("cached tree")}}
+
+			var buf bytes.Buffer
+			if err := idx.Write(&buf); err != nil {
+				t.Fatal(err)
+			}
+			got, err := Read(&buf, tt.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Version != tt.wantVersion {
+				t.Errorf("version = %d, want %d", got.Version, tt.wantVersion)
+			}
+			if len(got.Entries) != len(tt.entries) {
+				t.Fatalf("read %d entries, want %d", len(got.Entries), len(tt.entries))
+			}
+			for i, e := range got.Entries {
+				if !reflect.DeepEqual(e, tt.entries[i]) {
+					t.Errorf("entry %d = %+v, want %+v", i, e, tt.entries[i])
+				}
+			}
+			if !reflect.DeepEqual(got.Extensions, idx.Extensions) {
+				t.Errorf("extensions = %v, want %v", got.Extensions, idx.Extensions)
+			}
+		})
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	idx := New(object.SHA1)
+	idx.Add(testEntry(object.SHA1, "file", 0))
+	var buf bytes.Buffer
+	if err := idx.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	valid := buf.Bytes()
+	// rehash recomputes the trailing checksum after body is modified.
+	rehash := func(fn func(body []byte) []byte) []byte {
+		body := fn(append([]byte(nil), valid[:len(valid)-object.SHA1.Size]...))
+		h := object.SHA1.New()
+		h.Write(body)
+		return h.Sum(body)
+	}
+	extension := func(sig string) []byte {
+		return rehash(func(b []byte) []byte { return append(b, sig[0], sig[1], sig[2], sig[3], 0, 0, 0, 0) })
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"bad checksum", append(append([]byte(nil), valid[:len(valid)-1]...), valid[len(valid)-1]^1)},
+		{"bad signature", rehash(func(b []byte) []byte { b[0] = 'X'; return b })},
+		{"version 1", rehash(func(b []byte) []byte { b[7] = 1; return b })},
+		{"version 5", rehash(func(b []byte) []byte { b[7] = 5; return b })},
+		{"too many entries", rehash(func(b []byte) []byte { b[11] = 2; return b })},
+		{"split index", extension("link")},
+		{"sparse index", extension("sdir")},
+		{"unknown mandatory extension", extension("abcd")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Read(bytes.NewReader(tt.data), object.SHA1); err == nil {
+				t.Fatal("no error")
+			}
+		})
+	}
+
+	if _, err := Read(bytes.NewReader(extension("ZZZZ")), object.SHA1); err != nil {
+		t.Fatalf("optional extension: %v", err)
+	}
+}
+
+func TestAddReplacesStages(t *testing.T) {
+	idx := New(object.SHA1)
+	for stage := 1; stage <= 3; stage++ {
+		idx.Add(testEntry(object.SHA1, "file", stage))
+	}
+	idx.Add(testEntry(object.SHA1, "other", 0))
+	if len(idx.Entries) != 4 {
+		t.Fatalf("%d entries after adding conflict stages", len(idx.Entries))
+	}
+
+	idx.Add(testEntry(object.SHA1, "file", 0))
+	if len(idx.Entries) != 2 || idx.Entry("file") == nil || idx.Entry("file").Stage != 0 {
+		t.Fatalf("resolving the conflict left %d entries", len(idx.Entries))
+	}
+	if !idx.Remove("file") || idx.Remove("file") || len(idx.Entries) != 1 {
+		t.Fatalf("Remove left %d entries", len(idx.Entries))
+	}
+}
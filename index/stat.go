@@ -0,0 +1,46 @@
+package index
+
+import (
+	"os"
+
+	"github.com/codecrafters-io/git-starter-go/object"
+)
+
+// NewEntry builds an entry for path from its lstat information.
+func NewEntry(path, hash string, info os.FileInfo) *Entry {
+	e := &Entry{
+		Path:  path,
+		Hash:  hash,
+		Mode:  FileModeOf(info),
+		MTime: info.ModTime(),
+		CTime: info.ModTime(),
+		Size:  uint32(info.Size()),
+	}
+	fillStat(e, info)
+	return e
+}
+
+// FileModeOf returns the mode git records for a file with the given
+// lstat information.
+func FileModeOf(info os.FileInfo) object.FileMode {
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		return object.ModeSymlink
+	case info.IsDir():
+		return object.ModeGitlink
+	case info.Mode().Perm()&0111 != 0:
+		return object.ModeExecutable
+	}
+	return object.ModeRegular
+}
+
+// Changed reports whether the stat data recorded in e no longer matches
+// info, meaning the file may have been modified since it was staged.
+func (e *Entry) Changed(info os.FileInfo) bool {
+	fresh := NewEntry(e.Path, e.Hash, info)
+	return fresh.Mode != e.Mode ||
+		fresh.Size != e.Size ||
+		!fresh.MTime.Equal(e.MTime) ||
+		!fresh.CTime.Equal(e.CTime) ||
+		fresh.Ino != e.Ino
+}
@@ -0,0 +1,21 @@
+//go:build darwin
+
+package index
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+func fillStat(e *Entry, info os.FileInfo) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return
+	}
+	e.CTime = time.Unix(int64(st.Ctimespec.Sec), int64(st.Ctimespec.Nsec))
+	e.Dev = uint32(st.Dev)
+	e.Ino = uint32(st.Ino)
+	e.UID = st.Uid
+	e.GID = st.Gid
+}
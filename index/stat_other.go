@@ -0,0 +1,7 @@
+//go:build !linux && !darwin
+
+package index
+
+import "os"
+
+func fillStat(e *Entry, info os.FileInfo) {}
@@ -0,0 +1,10 @@
+package object
+
+// Blob is the content of a file.
+type Blob struct {
+	Data []byte
+}
+
+func (b *Blob) Type() Type { return TypeBlob }
+
+func (b *Blob) Encode() []byte { return b.Data }
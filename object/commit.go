@@ -0,0 +1,143 @@
+package object
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// ExtraHeader is an additional commit or tag header such as gpgsig or
+// encoding. Multi-line values are stored with their newlines intact.
+type ExtraHeader struct {
+	Key   string
+	Value string
+}
+
+// Commit is a snapshot of a tree together with its history.
+type Commit struct {
+	Tree         string
+	Parents      []string
+	Author       Signature
+	Committer    Signature
+	ExtraHeaders []ExtraHeader
+	Message      string
+}
+
+func (c *Commit) Type() Type { return TypeCommit }
+
+// ParseCommit decodes the content of a commit object.
+func ParseCommit(data []byte) (*Commit, error) {
+	headers, message, err := parseHeaders(data)
+	if err != nil {
+		return nil, fmt.Errorf("malformed commit: %w", err)
+	}
+
+	c := &Commit{Message: message}
+	var haveAuthor, haveCommitter bool
+	for i, h := range headers {
+		switch {
+		case h.Key == "tree" && i == 0:
+			if !ValidHash(h.Value) {
+				return nil, fmt.Errorf("malformed commit: invalid tree %q", h.Value)
+			}
+			c.Tree = h.Value
+		case h.Key == "parent" && !haveAuthor:
+			if !ValidHash(h.Value) {
+				return nil, fmt.Errorf("malformed commit: invalid parent %q", h.Value)
+			}
+			c.Parents = append(c.Parents, h.Value)
+		case h.Key == "author" && !haveAuthor:
+			if c.Author, err = ParseSignature(h.Value); err != nil {
+				return nil, fmt.Errorf("malformed commit: %w", err)
+			}
+			haveAuthor = true
+		case h.Key == "committer" && haveAuthor && !haveCommitter:
+			if c.Committer, err = ParseSignature(h.Value); err != nil {
+				return nil, fmt.Errorf("malformed commit: %w", err)
+			}
+			haveCommitter = true
+		case h.Key == "tree" || h.Key == "parent" || h.Key == "author" || h.Key == "committer":
+			return nil, fmt.Errorf("malformed commit: unexpected %s header", h.Key)
+		default:
+			if !haveCommitter {
+				return nil, fmt.Errorf("malformed commit: unexpected %s header", h.Key)
+			}
+			c.ExtraHeaders = append(c.ExtraHeaders, h)
+		}
+	}
+
+	switch {
+	case c.Tree == "":
+		return nil, fmt.Errorf("malformed commit: missing tree")
+	case !haveAuthor:
+		return nil, fmt.Errorf("malformed commit: missing author")
+	case !haveCommitter:
+		return nil, fmt.Errorf("malformed commit: missing committer")
+	}
+	return c, nil
+}
+
+// Encode serializes the commit.
+func (c *Commit) Encode() []byte {
+	var buf bytes.Buffer
+	writeHeader(&buf, "tree", c.Tree)
+	for _, p := range c.Parents {
+		writeHeader(&buf, "parent", p)
+	}
+	writeHeader(&buf, "author", c.Author.String())
+	writeHeader(&buf, "committer", c.Committer.String())
+	for _, h := range c.ExtraHeaders {
+		writeHeader(&buf, h.Key, h.Value)
+	}
+	buf.WriteByte('\n')
+	buf.WriteString(c.Message)
+	return buf.Bytes()
+}
+
+// Subject returns the first line of the commit message.
+func (c *Commit) Subject() string {
+	subject, _, _ := strings.Cut(c.Message, "\n")
+	return subject
+}
+
+// parseHeaders splits an object into its header lines and message.
+// Continuation lines, which start with a space, are folded into the
+// previous header's value.
+func parseHeaders(data []byte) ([]ExtraHeader, string, error) {
+	var headers []ExtraHeader
+	for i := 0; ; {
+		if i >= len(data) {
+			return headers, "", nil
+		}
+		end := bytes.IndexByte(data[i:], '\n')
+		if end == -1 {
+			return nil, "", fmt.Errorf("unterminated header line")
+		}
+		line := string(data[i : i+end])
+		i += end + 1
+
+		if line == "" {
+			return headers, string(data[i:]), nil
+		}
+		if line[0] == ' ' {
+			if len(headers) == 0 {
+				return nil, "", fmt.Errorf("continuation line without header")
+			}
+			headers[len(headers)-1].Value += "\n" + line[1:]
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, " ")
+		if !ok || key == "" {
+			return nil, "", fmt.Errorf("malformed header line %q", line)
+		}
+		headers = append(headers, ExtraHeader{Key: key, Value: value})
+	}
+}
+
+func writeHeader(buf *bytes.Buffer, key, value string) {
+	buf.WriteString(key)
+	buf.WriteByte(' ')
+	buf.WriteString(strings.ReplaceAll(value, "\n", "\n "))
+	buf.WriteByte('\n')
+}
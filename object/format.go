@@ -0,0 +1,129 @@
+package object
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"strings"
+
+	"github.com/pjbgf/sha1cd"
+)
+
+// ErrCollision is returned when hashing content that exhibits a known
+// SHA-1 collision attack, which git refuses to store.
+var ErrCollision = errors.New("SHA-1 appears to be part of a collision attack")
+
+// Format is a hash algorithm naming objects, the object format of a
+// repository.
+type Format struct {
+	// Name is the value of extensions.objectFormat, e.g. "sha256".
+	Name string
+	// Size is the length of a raw object ID in bytes.
+	Size int
+
+	newHash func() hash.Hash
+}
+
+var (
+	// SHA1 uses the collision-detecting SHA-1DC variant, as git does.
+	SHA1   = &Format{Name: "sha1", Size: sha1cd.Size, newHash: sha1cd.New}
+	SHA256 = &Format{Name: "sha256", Size: sha256.Size, newHash: sha256.New}
+)
+
+// NewFormat returns a format called name whose size-byte IDs are
+// computed by hashes from newHash. Sum reports collisions for hashes
+// that detect them, as SHA1's do.
+func NewFormat(name string, size int, newHash func() hash.Hash) *Format {
+	return &Format{Name: name, Size: size, newHash: newHash}
+}
+
+// FormatByName returns the format called name.
+func FormatByName(name string) (*Format, error) {
+	switch strings.ToLower(name) {
+	case "sha1":
+		return SHA1, nil
+	case "sha256":
+		return SHA256, nil
+	}
+	return nil, fmt.Errorf("unknown object format '%s'", name)
+}
+
+func (f *Format) String() string { return f.Name }
+
+// New returns a hash computing IDs and checksums in this format.
+func (f *Format) New() hash.Hash {
+	return f.newHash()
+}
+
+// HexSize is the length of a hex object ID.
+func (f *Format) HexSize() int {
+	return 2 * f.Size
+}
+
+// ZeroID returns the all-zero ID used for missing objects.
+func (f *Format) ZeroID() string {
+	return strings.Repeat("0", f.HexSize())
+}
+
+// Sum returns the digest of h, a hash from New, failing with
+// ErrCollision if the data written to it is part of a collision attack.
+func (f *Format) Sum(h hash.Hash) ([]byte, error) {
+	if cr, ok := h.(sha1cd.CollisionResistantHash); ok {
+		sum, collision := cr.CollisionResistantSum(nil)
+		if collision {
+			return nil, fmt.Errorf("%w: %x", ErrCollision, sum)
+		}
+		return sum, nil
+	}
+	return h.Sum(nil), nil
+}
+
+// Hash returns the hex object ID of content stored as type t.
+func (f *Format) Hash(t Type, content []byte) (string, error) {
+	h := f.New()
+	h.Write(Header(t, len(content)))
+	h.Write(content)
+	sum, err := f.Sum(h)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(sum), nil
+}
+
+// HashOf returns the hex object ID of obj.
+func (f *Format) HashOf(obj Object) (string, error) {
+	return f.Hash(obj.Type(), obj.Encode())
+}
+
+// ValidID reports whether s is a full lowercase hex ID in this format.
+func (f *Format) ValidID(s string) bool {
+	return len(s) == f.HexSize() && isLowerHex(s)
+}
+
+// FormatOf returns the format whose IDs are as long as id, or nil.
+func FormatOf(id string) *Format {
+	switch len(id) {
+	case SHA1.HexSize():
+		return SHA1
+	case SHA256.HexSize():
+		return SHA256
+	}
+	return nil
+}
+
+// IsZeroID reports whether id is the zero ID of any format.
+func IsZeroID(id string) bool {
+	return FormatOf(id) != nil && strings.Trim(id, "0") == ""
+}
+
+func isLowerHex(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,81 @@
+// Package object parses and serializes the canonical encodings of git
+// blobs, trees, commits and tags.
+package object
+
+import (
+	"fmt"
+)
+
+// Type is a git object type. Its values match the type codes used in
+// pack entry headers.
+type Type int8
+
+const (
+	TypeCommit Type = 1
+	TypeTree   Type = 2
+	TypeBlob   Type = 3
+	TypeTag    Type = 4
+)
+
+func (t Type) String() string {
+	switch t {
+	case TypeCommit:
+		return "commit"
+	case TypeTree:
+		return "tree"
+	case TypeBlob:
+		return "blob"
+	case TypeTag:
+		return "tag"
+	}
+	return fmt.Sprintf("unknown(%d)", int8(t))
+}
+
+// ParseType returns the Type named by s.
+func ParseType(s string) (Type, error) {
+	switch s {
+	case "commit":
+		return TypeCommit, nil
+	case "tree":
+		return TypeTree, nil
+	case "blob":
+		return TypeBlob, nil
+	case "tag":
+		return TypeTag, nil
+	}
+	return 0, fmt.Errorf("invalid object type %q", s)
+}
+
+// Object is implemented by every typed object.
+type Object interface {
+	Type() Type
+	Encode() []byte
+}
+
+// Header returns the "<type> <size>\x00" prefix that is hashed and
+// stored in front of an object's content.
+func Header(t Type, size int) []byte {
+	return []byte(fmt.Sprintf("%s %d\x00", t, size))
+}
+
+// ValidHash reports whether s is a full lowercase hex object ID in any
+// supported format.
+func ValidHash(s string) bool {
+	return FormatOf(s) != nil && isLowerHex(s)
+}
+
+// Parse decodes content of the given type into a typed object. f is
+// the format of the object IDs in trees.
+func Parse(t Type, content []byte, f *Format) (Object, error) {
+	switch t {
+	case TypeBlob:
+		return &Blob{Data: content}, nil
+	case TypeTree:
+		return ParseTree(content, f)
+	case TypeCommit:
+		return ParseCommit(content)
+	case TypeTag:
+		return ParseTag(content)
+	}
+	return nil, fmt.Errorf("invalid object type %d", t)
+}
@@ -0,0 +1,163 @@
+package object
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	treeID   = "4b825dc642cb6eb9a060e54bf8d69288fbee4904"
+	parentID = "e69de29bb2d1d6434b8b29ae775ad8c2e48c5391"
+)
+
+func TestHash(t *testing.T) {
+	tests := []struct {
+		format  *Format
+		t       Type
+		content string
+		want    string
+	}{
+		{SHA1, TypeBlob, "", "e69de29bb2d1d6434b8b29ae775ad8c2e48c5391"},
+		{SHA1, TypeBlob, "hello world\n", "3b18e512dba79e4c8300dd08aeb37f8e728b8dad"},
+		{SHA1, TypeTree, "", "4b825dc642cb6eb9a060e54bf8d69288fbee4904"},
+		{SHA256, TypeBlob, "", "473a0f4c3be8a93681a267e3b1e9a7dcda1185436fe141f7749120a303721813"},
+		{SHA256, TypeTree, "", "6ef19b41225c5369f1c104d45d8d85efa9b057b53b14b4b9b939dd74decc5321"},
+	}
+	for _, tt := range tests {
+		got, err := tt.format.Hash(tt.t, []byte(tt.content))
+		if err != nil || got != tt.want {
+			t.Errorf("%s %s %q = %s, %v; want %s", tt.format, tt.t, tt.content, got, err, tt.want)
+		}
+		if FormatOf(got) != tt.format || !ValidHash(got) {
+			t.Errorf("%s is not recognized as a %s ID", got, tt.format)
+		}
+	}
+}
+
+// The testdata files hold the first 320 bytes of the SHAttered PDFs,
+// which include the colliding blocks.
+func TestSumCollision(t *testing.T) {
+	tests := []struct {
+		file      string
+		n         int
+		collision bool
+	}{
+		{"shattered-1.prefix", 320, true},
+		{"shattered-2.prefix", 320, true},
+		{"shattered-1.prefix", 192, false},
+	}
+	for _, tt := range tests {
+		data, err := os.ReadFile("testdata/" + tt.file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		h := SHA1.New()
+		h.Write(data[:tt.n])
+		sum, err := SHA1.Sum(h)
+		if errors.Is(err, ErrCollision) != tt.collision || (!tt.collision && err != nil) {
+			t.Errorf("Sum of %d bytes of %s = %x, %v; want collision %v", tt.n, tt.file, sum, err, tt.collision)
+		}
+	}
+}
+
+func TestParseEncodeRoundTrip(t *testing.T) {
+	author := "A U Thor <author@example.com> 1700000000 +0100"
+	tests := []struct {
+		name string
+		t    Type
+		raw  string
+	}{
+		{"blob", TypeBlob, "any content\x00at all"},
+		{"empty tree", TypeTree, ""},
+		{"tree", TypeTree, "100644 file\x00" + strings.Repeat("\x11", 20) + "40000 dir\x00" + strings.Repeat("\x22", 20)},
+		{"root commit", TypeCommit, "tree " + treeID + "\nauthor " + author + "\ncommitter " + author + "\n\nsubject\n\nbody\n"},
+		{"merge commit", TypeCommit, "tree " + treeID + "\nparent " + parentID + "\nparent " + treeID + "\nauthor " + author + "\ncommitter " + author + "\n\nmerge\n"},
+		{"signed commit", TypeCommit, "tree " + treeID + "\nauthor " + author + "\ncommitter " + author + "\ngpgsig -----BEGIN PGP SIGNATURE-----\n \n abc\n -----END PGP SIGNATURE-----\n\nsigned\n"},
+		{"commit without message", TypeCommit, "tree " + treeID + "\nauthor " + author + "\ncommitter " + author + "\n\n"},
+		{"tag", TypeTag, "object " + parentID + "\ntype commit\ntag v1.0\ntagger " + author + "\n\nrelease\n"},
+		{"tag without tagger", TypeTag, "object " + parentID + "\ntype blob\ntag old\n\nold tag\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			obj, err := Parse(tt.t, []byte(tt.raw), SHA1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if obj.Type() != tt.t {
+				t.Errorf("type = %s, want %s", obj.Type(), tt.t)
+			}
+			if got := string(obj.Encode()); got != tt.raw {
+				t.Errorf("Encode = %q, want %q", got, tt.raw)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	author := "A U Thor <author@example.com> 1700000000 +0000"
+	tests := []struct {
+		name string
+		t    Type
+		raw  string
+	}{
+		{"commit without tree", TypeCommit, "author " + author + "\ncommitter " + author + "\n\nmsg\n"},
+		{"commit with bad tree", TypeCommit, "tree xyz\nauthor " + author + "\ncommitter " + author + "\n\nmsg\n"},
+		{"commit without committer", TypeCommit, "tree " + treeID + "\nauthor " + author + "\n\nmsg\n"},
+		{"commit with parent after author", TypeCommit, "tree " + treeID + "\nauthor " + author + "\nparent " + parentID + "\ncommitter " + author + "\n\nmsg\n"},
+		{"commit with bad author", TypeCommit, "tree " + treeID + "\nauthor nobody\ncommitter " + author + "\n\nmsg\n"},
+		{"tag without name", TypeTag, "object " + parentID + "\ntype commit\n\nmsg\n"},
+		{"tag with bad type", TypeTag, "object " + parentID + "\ntype widget\ntag v1\n\nmsg\n"},
+		{"truncated tree", TypeTree, "100644 file\x00" + strings.Repeat("\x11", 10)},
+		{"tree with bad mode", TypeTree, "12345x file\x00" + strings.Repeat("\x11", 20)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse(tt.t, []byte(tt.raw), SHA1); err == nil {
+				t.Fatal("no error")
+			}
+		})
+	}
+}
+
+func TestParseSignature(t *testing.T) {
+	tests := []struct {
+		in      string
+		name    string
+		email   string
+		unix    int64
+		offset  int
+		wantErr bool
+	}{
+		{in: "A U Thor <a@example.com> 1700000000 +0000", name: "A U Thor", email: "a@example.com", unix: 1700000000},
+		{in: "Jo <jo@x> 1 -0730", name: "Jo", email: "jo@x", unix: 1, offset: -(7*3600 + 30*60)},
+		{in: "No Email <> 5 +0200", name: "No Email", email: "", unix: 5, offset: 7200},
+		{in: "Missing <a@b>", wantErr: true},
+		{in: "NoSpace<a@b> 1 +0000", wantErr: true},
+		{in: "Bad Date <a@b> x +0000", wantErr: true},
+		{in: "Bad Zone <a@b> 1 0000", wantErr: true},
+		{in: "no email 1 +0000", wantErr: true},
+	}
+	for _, tt := range tests {
+		sig, err := ParseSignature(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseSignature(%q) error = %v, want error %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if tt.wantErr {
+			continue
+		}
+		_, offset := sig.When.Zone()
+		if sig.Name != tt.name || sig.Email != tt.email || sig.When.Unix() != tt.unix || offset != tt.offset {
+			t.Errorf("ParseSignature(%q) = %+v", tt.in, sig)
+		}
+		if sig.String() != tt.in {
+			t.Errorf("String() = %q, want %q", sig.String(), tt.in)
+		}
+	}
+	if s := (Signature{Name: "x", Email: "y", When: time.Unix(0, 0).UTC()}).String(); s != "x <y> 0 +0000" {
+		t.Errorf("String() = %q", s)
+	}
+}
@@ -0,0 +1,72 @@
+package object
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Signature identifies the author, committer or tagger of an object.
+type Signature struct {
+	Name  string
+	Email string
+	When  time.Time
+}
+
+// ParseSignature parses "Name <email> <unix-seconds> <+hhmm>".
+func ParseSignature(s string) (Signature, error) {
+	lt := strings.IndexByte(s, '<')
+	gt := strings.IndexByte(s, '>')
+	if lt == -1 || gt == -1 || gt < lt {
+		return Signature{}, fmt.Errorf("malformed identity %q: missing email", s)
+	}
+	if lt == 0 || s[lt-1] != ' ' {
+		return Signature{}, fmt.Errorf("malformed identity %q: missing space before email", s)
+	}
+
+	sig := Signature{
+		Name:  s[:lt-1],
+		Email: s[lt+1 : gt],
+	}
+	if strings.ContainsAny(sig.Name, "<>\n") || strings.ContainsAny(sig.Email, "<>\n") {
+		return Signature{}, fmt.Errorf("malformed identity %q", s)
+	}
+
+	fields := strings.Fields(s[gt+1:])
+	if len(fields) != 2 {
+		return Signature{}, fmt.Errorf("malformed identity %q: missing date", s)
+	}
+	seconds, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return Signature{}, fmt.Errorf("malformed identity %q: invalid timestamp", s)
+	}
+	loc, err := parseTimezone(fields[1])
+	if err != nil {
+		return Signature{}, fmt.Errorf("malformed identity %q: %w", s, err)
+	}
+	sig.When = time.Unix(seconds, 0).In(loc)
+
+	return sig, nil
+}
+
+func parseTimezone(tz string) (*time.Location, error) {
+	if len(tz) != 5 || (tz[0] != '+' && tz[0] != '-') {
+		return nil, fmt.Errorf("invalid timezone %q", tz)
+	}
+	hours, err1 := strconv.Atoi(tz[1:3])
+	minutes, err2 := strconv.Atoi(tz[3:5])
+	if err1 != nil || err2 != nil {
+		return nil, fmt.Errorf("invalid timezone %q", tz)
+	}
+	offset := hours*3600 + minutes*60
+	if tz[0] == '-' {
+		offset = -offset
+	}
+	return time.FixedZone(tz, offset), nil
+}
+
+// String formats the signature as stored in commit and tag headers.
+func (s Signature) String() string {
+	return fmt.Sprintf("%s <%s> %d %s", s.Name, s.Email, s.When.Unix(), s.When.Format("-0700"))
+}
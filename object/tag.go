@@ -0,0 +1,83 @@
+package object
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// Tag is an annotated tag pointing at another object.
+type Tag struct {
+	Object       string
+	ObjectType   Type
+	Name         string
+	Tagger       *Signature
+	ExtraHeaders []ExtraHeader
+	Message      string
+}
+
+func (t *Tag) Type() Type { return TypeTag }
+
+// ParseTag decodes the content of a tag object.
+func ParseTag(data []byte) (*Tag, error) {
+	headers, message, err := parseHeaders(data)
+	if err != nil {
+		return nil, fmt.Errorf("malformed tag: %w", err)
+	}
+
+	order := []string{"object", "type", "tag"}
+	if len(headers) < len(order) {
+		return nil, fmt.Errorf("malformed tag: missing headers")
+	}
+	for i, key := range order {
+		if headers[i].Key != key {
+			return nil, fmt.Errorf("malformed tag: expected %s header, got %s", key, headers[i].Key)
+		}
+	}
+
+	t := &Tag{Object: headers[0].Value, Name: headers[2].Value, Message: message}
+	if !ValidHash(t.Object) {
+		return nil, fmt.Errorf("malformed tag: invalid object %q", t.Object)
+	}
+	if t.ObjectType, err = ParseType(headers[1].Value); err != nil {
+		return nil, fmt.Errorf("malformed tag: %w", err)
+	}
+	if t.Name == "" {
+		return nil, fmt.Errorf("malformed tag: empty tag name")
+	}
+
+	rest := headers[len(order):]
+	if len(rest) > 0 && rest[0].Key == "tagger" {
+		sig, err := ParseSignature(rest[0].Value)
+		if err != nil {
+			return nil, fmt.Errorf("malformed tag: %w", err)
+		}
+		t.Tagger = &sig
+		rest = rest[1:]
+	}
+	for _, h := range rest {
+		switch h.Key {
+		case "object", "type", "tag", "tagger":
+			return nil, fmt.Errorf("malformed tag: unexpected %s header", h.Key)
+		}
+	}
+	t.ExtraHeaders = rest
+
+	return t, nil
+}
+
+// Encode serializes the tag.
+func (t *Tag) Encode() []byte {
+	var buf bytes.Buffer
+	writeHeader(&buf, "object", t.Object)
+	writeHeader(&buf, "type", t.ObjectType.String())
+	writeHeader(&buf, "tag", t.Name)
+	if t.Tagger != nil {
+		writeHeader(&buf, "tagger", t.Tagger.String())
+	}
+	for _, h := range t.ExtraHeaders {
+		writeHeader(&buf, h.Key, h.Value)
+	}
+	buf.WriteByte('\n')
+	buf.WriteString(t.Message)
+	return buf.Bytes()
+}
@@ -0,0 +1,145 @@
+package object
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// FileMode is the mode of a tree entry.
+type FileMode uint32
+
+const (
+	ModeDir        FileMode = 0040000
+	ModeRegular    FileMode = 0100644
+	ModeExecutable FileMode = 0100755
+	ModeSymlink    FileMode = 0120000
+	ModeGitlink    FileMode = 0160000
+)
+
+// String returns the mode as written in a tree object.
+func (m FileMode) String() string {
+	return strconv.FormatUint(uint64(m), 8)
+}
+
+// IsDir reports whether the entry refers to a subtree.
+func (m FileMode) IsDir() bool {
+	return m == ModeDir
+}
+
+// Valid reports whether m is one of the modes git writes.
+func (m FileMode) Valid() bool {
+	switch m {
+	case ModeDir, ModeRegular, ModeExecutable, ModeSymlink, ModeGitlink:
+		return true
+	}
+	return false
+}
+
+// ParseFileMode parses an octal tree entry mode.
+func ParseFileMode(s string) (FileMode, error) {
+	if s == "" {
+		return 0, fmt.Errorf("empty mode")
+	}
+	m, err := strconv.ParseUint(s, 8, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid mode %q", s)
+	}
+	return FileMode(m), nil
+}
+
+// TreeEntry is a single named entry of a tree.
+type TreeEntry struct {
+	Mode FileMode
+	Name string
+	Hash string
+}
+
+// Tree is a directory listing.
+type Tree struct {
+	Entries []TreeEntry
+}
+
+func (t *Tree) Type() Type { return TypeTree }
+
+// ParseTree decodes the content of a tree object whose entries hold IDs
+// in format f.
+func ParseTree(data []byte, f *Format) (*Tree, error) {
+	t := &Tree{}
+	for i := 0; i < len(data); {
+		spaceIndex := bytes.IndexByte(data[i:], ' ')
+		if spaceIndex == -1 {
+			return nil, fmt.Errorf("malformed tree entry at offset %d: missing mode", i)
+		}
+		mode, err := ParseFileMode(string(data[i : i+spaceIndex]))
+		if err != nil {
+			return nil, fmt.Errorf("malformed tree entry at offset %d: %w", i, err)
+		}
+		i += spaceIndex + 1
+
+		nullIndex := bytes.IndexByte(data[i:], 0)
+		if nullIndex == -1 {
+			return nil, fmt.Errorf("malformed tree entry at offset %d: missing name terminator", i)
+		}
+		name := string(data[i : i+nullIndex])
+		if name == "" {
+			return nil, fmt.Errorf("malformed tree entry at offset %d: empty name", i)
+		}
+		i += nullIndex + 1
+
+		if i+f.Size > len(data) {
+			return nil, fmt.Errorf("malformed tree entry %q: truncated hash", name)
+		}
+		hash := hex.EncodeToString(data[i : i+f.Size])
+		i += f.Size
+
+		t.Entries = append(t.Entries, TreeEntry{Mode: mode, Name: name, Hash: hash})
+	}
+	return t, nil
+}
+
+// Encode serializes the entries in their current order.
+func (t *Tree) Encode() []byte {
+	var buf bytes.Buffer
+	for _, e := range t.Entries {
+		buf.WriteString(e.Mode.String())
+		buf.WriteByte(' ')
+		buf.WriteString(e.Name)
+		buf.WriteByte(0)
+		hash, _ := hex.DecodeString(e.Hash)
+		buf.Write(hash)
+	}
+	return buf.Bytes()
+}
+
+// Find returns the entry with the given name.
+func (t *Tree) Find(name string) (TreeEntry, bool) {
+	for _, e := range t.Entries {
+		if e.Name == name {
+			return e, true
+		}
+	}
+	return TreeEntry{}, false
+}
+
+// Sort orders the entries canonically, comparing directory names as if
+// they had a trailing slash.
+func (t *Tree) Sort() {
+	sort.SliceStable(t.Entries, func(i, j int) bool {
+		return CompareEntries(t.Entries[i], t.Entries[j]) < 0
+	})
+}
+
+// CompareEntries compares two tree entries in git's canonical order.
+func CompareEntries(a, b TreeEntry) int {
+	return bytes.Compare(sortKey(a), sortKey(b))
+}
+
+func sortKey(e TreeEntry) []byte {
+	if e.Mode.IsDir() {
+		return []byte(e.Name + "/")
+	}
+	return []byte(e.Name)
+}
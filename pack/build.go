@@ -0,0 +1,200 @@
+package pack
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"unicode"
+
+	"github.com/codecrafters-io/git-starter-go/object"
+)
+
+// BuildOptions tune the delta search of Build.
+type BuildOptions struct {
+	// Window is the number of preceding objects tried as delta bases.
+	Window int
+	// Depth limits the length of delta chains.
+	Depth int
+	// BigFileThreshold is the size above which objects are stored
+	// without attempting delta compression; 0 means no limit.
+	BigFileThreshold int64
+}
+
+// DefaultBigFileThreshold is git's core.bigFileThreshold default.
+const DefaultBigFileThreshold = 512 << 20
+
+// DefaultBuildOptions match git's pack.window, pack.depth and
+// core.bigFileThreshold defaults.
+var DefaultBuildOptions = BuildOptions{Window: 10, Depth: 50, BigFileThreshold: DefaultBigFileThreshold}
+
+// minDeltaSize is the smallest object worth deltifying.
+const minDeltaSize = 50
+
+// BuildObject is an object to be packed.
+type BuildObject struct {
+	ID string
+	// NameHash groups objects reached by similar paths; see NameHash.
+	NameHash uint32
+}
+
+// NameHash hashes a path so that files with the same name, and to a
+// lesser degree the same suffix, sort next to each other. It is git's
+// pack_name_hash.
+func NameHash(path string) uint32 {
+	var hash uint32
+	for _, c := range []byte(path) {
+		if c < 0x80 && unicode.IsSpace(rune(c)) {
+			continue
+		}
+		hash = (hash >> 2) + uint32(c)<<24
+	}
+	return hash
+}
+
+// Source provides the objects packed by Build.
+type Source interface {
+	// Stat returns the type and size of an object without reading its
+	// content.
+	Stat(id string) (ObjectType, int64, error)
+	// Load returns the type and content of an object.
+	Load(id string) (ObjectType, []byte, error)
+	// Open returns the type and size of an object and a reader over its
+	// content, which the caller closes.
+	Open(id string) (ObjectType, int64, io.ReadCloser, error)
+}
+
+type buildEntry struct {
+	BuildObject
+	t    ObjectType
+	size int64
+
+	base  *buildEntry
+	delta []byte
+	depth int
+
+	info *ObjectInfo
+}
+
+type windowEntry struct {
+	e    *buildEntry
+	data []byte
+}
+
+// Build writes a pack of objects to w, reading them from src. Objects
+// are deltified against similar ones found in a sliding window over the
+// objects sorted by type, name hash and size; only objects in the
+// window are held in memory, and the rest are streamed into the pack.
+// Objects are named in format f. It returns the objects in pack order
+// and the pack checksum.
+func Build(w io.Writer, f *object.Format, objects []BuildObject, src Source, opts BuildOptions) ([]*ObjectInfo, []byte, error) {
+	entries := make([]*buildEntry, len(objects))
+	for i, obj := range objects {
+		t, size, err := src.Stat(obj.ID)
+		if err != nil {
+			return nil, nil, err
+		}
+		entries[i] = &buildEntry{BuildObject: obj, t: t, size: size}
+	}
+
+	if opts.Window > 0 && opts.Depth > 0 {
+		if err := findDeltas(entries, src, opts, f.Size); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	pw, err := NewWriter(w, f, uint32(len(entries)))
+	if err != nil {
+		return nil, nil, err
+	}
+	var write func(e *buildEntry) error
+	write = func(e *buildEntry) error {
+		if e.info != nil {
+			return nil
+		}
+		if e.base != nil {
+			if err := write(e.base); err != nil {
+				return err
+			}
+			e.info, err = pw.WriteDelta(e.ID, e.t, e.size, e.base.info, e.delta)
+			e.delta = nil
+			return err
+		}
+
+		t, size, r, err := src.Open(e.ID)
+		if err != nil {
+			return err
+		}
+		e.info, err = pw.WriteObjectFrom(t, size, r)
+		r.Close()
+		if err != nil {
+			return err
+		}
+		if e.info.ID != e.ID {
+			return fmt.Errorf("object %s hashes to %s", e.ID, e.info.ID)
+		}
+		return nil
+	}
+	for _, e := range entries {
+		if err := write(e); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	checksum, err := pw.Close()
+	if err != nil {
+		return nil, nil, err
+	}
+	return pw.Objects(), checksum, nil
+}
+
+// findDeltas picks a delta base for each entry among the preceding
+// Window entries of the same type, keeping the smallest delta that
+// saves at least half of the object.
+func findDeltas(entries []*buildEntry, src Source, opts BuildOptions, hashSize int) error {
+	sorted := append([]*buildEntry(nil), entries...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if a.t != b.t {
+			return a.t < b.t
+		}
+		if a.NameHash != b.NameHash {
+			return a.NameHash < b.NameHash
+		}
+		return a.size > b.size
+	})
+
+	var window []windowEntry
+	for _, e := range sorted {
+		if e.size < minDeltaSize || (opts.BigFileThreshold > 0 && e.size > opts.BigFileThreshold) {
+			continue
+		}
+		_, data, err := src.Load(e.ID)
+		if err != nil {
+			return err
+		}
+
+		for i := len(window) - 1; i >= 0; i-- {
+			base := window[i]
+			if base.e.t != e.t || base.e.depth >= opts.Depth || base.e.size < e.size/32 {
+				continue
+			}
+			maxSize := e.size/2 - int64(hashSize)
+			if e.delta != nil {
+				maxSize = int64(len(e.delta))
+			}
+			if maxSize <= 0 {
+				break
+			}
+			delta := CreateDelta(base.data, data)
+			if int64(len(delta)) < maxSize {
+				e.base, e.delta, e.depth = base.e, delta, base.e.depth+1
+			}
+		}
+
+		window = append(window, windowEntry{e: e, data: data})
+		if len(window) > opts.Window {
+			window = window[1:]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,268 @@
+package pack
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/codecrafters-io/git-starter-go/object"
+)
+
+type memObject struct {
+	t    ObjectType
+	data []byte
+}
+
+// memSource is a Source over objects held in memory. It counts Load
+// calls so tests can check which objects were read whole.
+type memSource struct {
+	objects map[string]memObject
+	loaded  map[string]int
+}
+
+func newMemSource() *memSource {
+	return &memSource{objects: make(map[string]memObject), loaded: make(map[string]int)}
+}
+
+func (s *memSource) add(t *testing.T, typ ObjectType, data []byte) string {
+	t.Helper()
+	id, err := object.SHA1.Hash(object.Type(typ), data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.objects[id] = memObject{typ, data}
+	return id
+}
+
+func (s *memSource) Stat(id string) (ObjectType, int64, error) {
+	obj, ok := s.objects[id]
+	if !ok {
+		return 0, 0, ErrNotFound
+	}
+	return obj.t, int64(len(obj.data)), nil
+}
+
+func (s *memSource) Load(id string) (ObjectType, []byte, error) {
+	obj, ok := s.objects[id]
+	if !ok {
+		return 0, nil, ErrNotFound
+	}
+	s.loaded[id]++
+	return obj.t, obj.data, nil
+}
+
+func (s *memSource) Open(id string) (ObjectType, int64, io.ReadCloser, error) {
+	obj, ok := s.objects[id]
+	if !ok {
+		return 0, 0, nil, ErrNotFound
+	}
+	return obj.t, int64(len(obj.data)), io.NopCloser(bytes.NewReader(obj.data)), nil
+}
+
+// writePack stores a pack and its index in dir and opens it.
+func writePack(t *testing.T, dir string, data []byte) (*Packfile, []*ObjectInfo) {
+	t.Helper()
+	objects, checksum, err := IndexPack(bytes.NewReader(data), int64(len(data)), object.SHA1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := filepath.Join(dir, "pack-"+hex.EncodeToString(checksum))
+	var idx bytes.Buffer
+	if err := WriteIndex(&idx, object.SHA1, objects, checksum); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(base+".pack", data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(base+".idx", idx.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	p, err := Open(base+".pack", object.SHA1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { p.Close() })
+	return p, objects
+}
+
+func TestBuild(t *testing.T) {
+	src := newMemSource()
+	var objects []BuildObject
+	text := bytes.Repeat([]byte("line of text that repeats\n"), 200)
+	for i := 0; i < 5; i++ {
+		data := append(append([]byte(nil), text...), fmt.Sprintf("version %d\n", i)...)
+		objects = append(objects, BuildObject{ID: src.add(t, ObjBlob, data), NameHash: NameHash("file.txt")})
+	}
+	big := bytes.Repeat([]byte("big file content\n"), 1000)
+	bigID := src.add(t, ObjBlob, big)
+	bigID2 := src.add(t, ObjBlob, append(append([]byte(nil), big...), '!'))
+	objects = append(objects,
+		BuildObject{ID: bigID, NameHash: NameHash("big.bin")},
+		BuildObject{ID: bigID2, NameHash: NameHash("big.bin")},
+		BuildObject{ID: src.add(t, ObjCommit, []byte("tree 4b825dc642cb6eb9a060e54bf8d69288fbee4904\n\nmsg\n"))},
+		BuildObject{ID: src.add(t, ObjBlob, []byte("tiny"))},
+	)
+
+	tests := []struct {
+		name   string
+		opts   BuildOptions
+		deltas int
+	}{
+		{"no deltas", BuildOptions{}, 0},
+		{"defaults", DefaultBuildOptions, 5},
+		{"depth 1", BuildOptions{Window: 10, Depth: 1, BigFileThreshold: DefaultBigFileThreshold}, 5},
+		{"big file threshold", BuildOptions{Window: 10, Depth: 50, BigFileThreshold: 10000}, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clear(src.loaded)
+			var buf bytes.Buffer
+			written, _, err := Build(&buf, object.SHA1, objects, src, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(written) != len(objects) {
+				t.Fatalf("wrote %d objects, want %d", len(written), len(objects))
+			}
+			if tt.opts.BigFileThreshold > 0 && tt.opts.BigFileThreshold < int64(len(big)) && src.loaded[bigID]+src.loaded[bigID2] > 0 {
+				t.Errorf("objects above the big file threshold were loaded")
+			}
+
+			p, indexed := writePack(t, t.TempDir(), buf.Bytes())
+			deltas := 0
+			for _, info := range indexed {
+				if isDelta(info.EntryType) {
+					deltas++
+				}
+				if info.DeltaDepth > tt.opts.Depth {
+					t.Errorf("%s has delta depth %d, limit %d", info.ID, info.DeltaDepth, tt.opts.Depth)
+				}
+			}
+			if deltas != tt.deltas {
+				t.Errorf("%d deltas, want %d", deltas, tt.deltas)
+			}
+			for id, obj := range src.objects {
+				typ, data, err := p.Get(id)
+				if err != nil {
+					t.Fatalf("Get(%s): %v", id, err)
+				}
+				if typ != obj.t || !bytes.Equal(data, obj.data) {
+					t.Errorf("Get(%s) returned different content", id)
+				}
+				typ, size, err := p.Stat(id)
+				if err != nil || typ != obj.t || size != int64(len(obj.data)) {
+					t.Errorf("Stat(%s) = %s, %d, %v; want %s, %d", id, typ, size, err, obj.t, len(obj.data))
+				}
+				typ, size, r, err := p.Open(id)
+				if err != nil {
+					t.Fatalf("Open(%s): %v", id, err)
+				}
+				data, err = io.ReadAll(r)
+				r.Close()
+				if err != nil || typ != obj.t || size != int64(len(data)) || !bytes.Equal(data, obj.data) {
+					t.Errorf("Open(%s) returned different content", id)
+				}
+			}
+		})
+	}
+}
+
+// refDeltaPack returns a pack holding target as a REF_DELTA against
+// base, which the pack does not contain.
+func refDeltaPack(t *testing.T, baseID string, base, target []byte) []byte {
+	t.Helper()
+	delta := CreateDelta(base, target)
+	var entry bytes.Buffer
+	entry.Write(appendEntryHeader(nil, ObjRefDelta, int64(len(delta))))
+	hash, _ := hex.DecodeString(baseID)
+	entry.Write(hash)
+	zw := zlib.NewWriter(&entry)
+	zw.Write(delta)
+	zw.Close()
+
+	var buf bytes.Buffer
+	pw, err := NewWriter(&buf, object.SHA1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pw.write(entry.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	pw.objects = append(pw.objects, &ObjectInfo{})
+	if _, err := pw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// bufferAt is an in-memory file for AppendObjects.
+type bufferAt struct {
+	data []byte
+}
+
+func (b *bufferAt) ReadAt(p []byte, off int64) (int, error) {
+	if off >= int64(len(b.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, b.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (b *bufferAt) WriteAt(p []byte, off int64) (int, error) {
+	if end := off + int64(len(p)); end > int64(len(b.data)) {
+		b.data = append(b.data, make([]byte, end-int64(len(b.data)))...)
+	}
+	return copy(b.data[off:], p), nil
+}
+
+func TestCompleteThinPack(t *testing.T) {
+	src := newMemSource()
+	base := bytes.Repeat([]byte("shared content\n"), 100)
+	target := append(append([]byte(nil), base...), "new line\n"...)
+	baseID := src.add(t, ObjBlob, base)
+	targetID := src.add(t, ObjBlob, target)
+
+	thin := refDeltaPack(t, baseID, base, target)
+	if _, _, err := IndexPack(bytes.NewReader(thin), int64(len(thin)), object.SHA1, nil); err == nil {
+		t.Fatal("indexed a thin pack without its base")
+	}
+	objects, _, err := IndexPack(bytes.NewReader(thin), int64(len(thin)), object.SHA1, src.Load)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objects) != 1 || objects[0].ID != targetID {
+		t.Fatalf("indexed %v, want %s", objects, targetID)
+	}
+	missing := MissingBases(objects)
+	if len(missing) != 1 || missing[0] != baseID {
+		t.Fatalf("MissingBases = %v, want [%s]", missing, baseID)
+	}
+
+	f := &bufferAt{data: thin}
+	added, checksum, err := AppendObjects(f, int64(len(thin)), object.SHA1, missing, src.Load)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(added) != 1 || added[0].ID != baseID {
+		t.Fatalf("AppendObjects added %v, want %s", added, baseID)
+	}
+
+	objects, sum, err := IndexPack(bytes.NewReader(f.data), int64(len(f.data)), object.SHA1, nil)
+	if err != nil {
+		t.Fatalf("completed pack: %v", err)
+	}
+	if !bytes.Equal(sum, checksum) {
+		t.Errorf("pack checksum = %x, AppendObjects returned %x", sum, checksum)
+	}
+	if len(objects) != 2 || len(MissingBases(objects)) != 0 {
+		t.Errorf("completed pack holds %d objects, missing %v", len(objects), MissingBases(objects))
+	}
+}
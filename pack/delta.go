@@ -0,0 +1,207 @@
+package pack
+
+import (
+	"errors"
+	"fmt"
+)
+
+var errDeltaCorrupt = errors.New("corrupt delta")
+
+func readDeltaSize(delta []byte, pos int) (uint64, int, error) {
+	var size uint64
+	var shift uint
+	for {
+		if pos >= len(delta) || shift > 63 {
+			return 0, 0, errDeltaCorrupt
+		}
+		b := delta[pos]
+		pos++
+		size |= uint64(b&0x7f) << shift
+		shift += 7
+		if b&0x80 == 0 {
+			return size, pos, nil
+		}
+	}
+}
+
+// ApplyDelta reconstructs an object from its base and a git delta.
+func ApplyDelta(base, delta []byte) ([]byte, error) {
+	srcSize, pos, err := readDeltaSize(delta, 0)
+	if err != nil {
+		return nil, err
+	}
+	if srcSize != uint64(len(base)) {
+		return nil, fmt.Errorf("delta base size mismatch: expected %d, got %d", srcSize, len(base))
+	}
+	dstSize, pos, err := readDeltaSize(delta, pos)
+	if err != nil {
+		return nil, err
+	}
+
+	// dstSize comes from the delta and is not trusted: the output is
+	// preallocated no larger than the data it can be built from and
+	// grows as instructions are applied.
+	out := make([]byte, 0, min(dstSize, uint64(len(base)+len(delta))))
+	for pos < len(delta) {
+		op := delta[pos]
+		pos++
+
+		switch {
+		case op&0x80 != 0:
+			var offset, size uint64
+			for i := uint(0); i < 4; i++ {
+				if op&(1<<i) != 0 {
+					if pos >= len(delta) {
+						return nil, errDeltaCorrupt
+					}
+					offset |= uint64(delta[pos]) << (8 * i)
+					pos++
+				}
+			}
+			for i := uint(0); i < 3; i++ {
+				if op&(1<<(4+i)) != 0 {
+					if pos >= len(delta) {
+						return nil, errDeltaCorrupt
+					}
+					size |= uint64(delta[pos]) << (8 * i)
+					pos++
+				}
+			}
+			if size == 0 {
+				size = 0x10000
+			}
+			if offset+size > uint64(len(base)) {
+				return nil, errDeltaCorrupt
+			}
+			out = append(out, base[offset:offset+size]...)
+		case op != 0:
+			if pos+int(op) > len(delta) {
+				return nil, errDeltaCorrupt
+			}
+			out = append(out, delta[pos:pos+int(op)]...)
+			pos += int(op)
+		default:
+			return nil, fmt.Errorf("unexpected delta opcode 0")
+		}
+		if uint64(len(out)) > dstSize {
+			return nil, fmt.Errorf("delta result size mismatch: expected %d, got more", dstSize)
+		}
+	}
+
+	if uint64(len(out)) != dstSize {
+		return nil, fmt.Errorf("delta result size mismatch: expected %d, got %d", dstSize, len(out))
+	}
+	return out, nil
+}
+
+// deltaBlock is the granularity at which bases are indexed for
+// CreateDelta.
+const deltaBlock = 16
+
+// maxCopySize is the largest copy a single instruction encodes. Larger
+// sizes are valid in the format but git never emits them.
+const maxCopySize = 0x10000
+
+// CreateDelta returns a delta that turns base into target. It indexes
+// the base in fixed-size blocks and greedily extends matches found at
+// each position of the target.
+func CreateDelta(base, target []byte) []byte {
+	delta := appendDeltaSize(nil, uint64(len(base)))
+	delta = appendDeltaSize(delta, uint64(len(target)))
+
+	index := make(map[uint64][]int)
+	for i := 0; i+deltaBlock <= len(base); i += deltaBlock {
+		h := blockHash(base[i : i+deltaBlock])
+		if len(index[h]) < 64 {
+			index[h] = append(index[h], i)
+		}
+	}
+
+	var insert []byte
+	flushInsert := func() {
+		for len(insert) > 0 {
+			n := min(len(insert), 0x7f)
+			delta = append(delta, byte(n))
+			delta = append(delta, insert[:n]...)
+			insert = insert[n:]
+		}
+		insert = insert[:0]
+	}
+
+	pos := 0
+	for pos < len(target) {
+		bestOff, bestLen := 0, 0
+		if pos+deltaBlock <= len(target) {
+			for _, off := range index[blockHash(target[pos:pos+deltaBlock])] {
+				n := 0
+				for off+n < len(base) && pos+n < len(target) && base[off+n] == target[pos+n] {
+					n++
+				}
+				if n > bestLen {
+					bestOff, bestLen = off, n
+				}
+			}
+		}
+		if bestLen < deltaBlock {
+			insert = append(insert, target[pos])
+			pos++
+			continue
+		}
+
+		pos += bestLen
+		// Grow the match backwards over bytes queued for insertion.
+		for bestOff > 0 && len(insert) > 0 && base[bestOff-1] == insert[len(insert)-1] {
+			bestOff--
+			bestLen++
+			insert = insert[:len(insert)-1]
+		}
+		flushInsert()
+		for bestLen > 0 {
+			n := min(bestLen, maxCopySize)
+			delta = appendCopy(delta, bestOff, n)
+			bestOff += n
+			bestLen -= n
+		}
+	}
+	flushInsert()
+	return delta
+}
+
+func blockHash(b []byte) uint64 {
+	var h uint64 = 14695981039346656037
+	for _, c := range b {
+		h ^= uint64(c)
+		h *= 1099511628211
+	}
+	return h
+}
+
+func appendDeltaSize(buf []byte, size uint64) []byte {
+	for size >= 0x80 {
+		buf = append(buf, byte(size)|0x80)
+		size >>= 7
+	}
+	return append(buf, byte(size))
+}
+
+// appendCopy encodes a copy instruction, omitting zero bytes of the
+// offset and size.
+func appendCopy(buf []byte, offset, size int) []byte {
+	op := byte(0x80)
+	var args []byte
+	for i := uint(0); i < 4; i++ {
+		if b := byte(offset >> (8 * i)); b != 0 {
+			op |= 1 << i
+			args = append(args, b)
+		}
+	}
+	if size != maxCopySize {
+		for i := uint(0); i < 3; i++ {
+			if b := byte(size >> (8 * i)); b != 0 {
+				op |= 1 << (4 + i)
+				args = append(args, b)
+			}
+		}
+	}
+	return append(append(buf, op), args...)
+}
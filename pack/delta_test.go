@@ -0,0 +1,80 @@
+package pack
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+func randomBytes(seed int64, n int) []byte {
+	b := make([]byte, n)
+	rand.New(rand.NewSource(seed)).Read(b)
+	return b
+}
+
+func TestDeltaRoundTrip(t *testing.T) {
+	big := randomBytes(1, 200000)
+	text := bytes.Repeat([]byte("the quick brown fox jumps over the lazy dog\n"), 100)
+	tests := []struct {
+		name         string
+		base, target []byte
+	}{
+		{"empty", nil, nil},
+		{"empty base", nil, []byte("hello, world")},
+		{"empty target", text, nil},
+		{"identical", text, text},
+		{"appended", text, append(append([]byte(nil), text...), "one more line\n"...)},
+		{"prepended", text, append([]byte("first line\n"), text...)},
+		{"edited middle", text, bytes.Replace(text, []byte("lazy"), []byte("sleepy"), 1)},
+		{"unrelated", randomBytes(2, 1000), randomBytes(3, 1000)},
+		{"long insert", nil, randomBytes(4, 1000)},
+		{"copy over 64k", big, append(append([]byte(nil), big...), 'x')},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			delta := CreateDelta(tt.base, tt.target)
+			got, err := ApplyDelta(tt.base, delta)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, tt.target) {
+				t.Fatalf("ApplyDelta returned %d bytes, want %d", len(got), len(tt.target))
+			}
+		})
+	}
+}
+
+func TestDeltaIsSmallForSimilarInput(t *testing.T) {
+	base := randomBytes(5, 10000)
+	target := append(append([]byte(nil), base[:5000]...), base[5001:]...)
+	if delta := CreateDelta(base, target); len(delta) > 64 {
+		t.Fatalf("delta for a one-byte deletion is %d bytes", len(delta))
+	}
+}
+
+func TestApplyDeltaErrors(t *testing.T) {
+	base := []byte("0123456789")
+	tests := []struct {
+		name  string
+		delta []byte
+	}{
+		{"empty", nil},
+		{"base size mismatch", []byte{5, 1, 1, 'x'}},
+		{"missing result size", []byte{10}},
+		{"copy past base", []byte{10, 5, 0x91, 8, 5}},
+		{"truncated copy", []byte{10, 5, 0x91}},
+		{"truncated insert", []byte{10, 5, 5, 'a', 'b'}},
+		{"opcode zero", []byte{10, 1, 0}},
+		{"result size mismatch", []byte{10, 3, 1, 'x'}},
+		{"result past size", []byte{10, 1, 0x90, 10, 0x90, 10}},
+		{"huge result size", []byte{10, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x3f, 1, 'x'}},
+		{"size overflow", append([]byte{10}, append(bytes.Repeat([]byte{0xff}, 10), 1)...)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ApplyDelta(base, tt.delta); err == nil {
+				t.Fatalf("ApplyDelta(%v): no error", tt.delta)
+			}
+		})
+	}
+}
@@ -0,0 +1,166 @@
+package pack
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/codecrafters-io/git-starter-go/object"
+)
+
+var idxMagic = []byte{0xff, 't', 'O', 'c'}
+
+// Index is a parsed version 2 pack index (.idx) file.
+type Index struct {
+	format       *object.Format
+	data         []byte
+	fanout       [256]uint32
+	names        []byte
+	crcs         []byte
+	offsets      []byte
+	largeOffsets []byte
+
+	PackChecksum []byte
+	Checksum     []byte
+}
+
+// ReadIndex parses a version 2 pack index of objects named in format f.
+func ReadIndex(r io.Reader, f *object.Format) (*Index, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < 8+256*4 || !bytes.Equal(data[:4], idxMagic) {
+		return nil, fmt.Errorf("unsupported pack index format")
+	}
+	if version := binary.BigEndian.Uint32(data[4:8]); version != 2 {
+		return nil, fmt.Errorf("unsupported pack index version %d", version)
+	}
+
+	idx := &Index{format: f, data: data}
+	hashSize := f.Size
+	pos := 8
+	for i := range idx.fanout {
+		idx.fanout[i] = binary.BigEndian.Uint32(data[pos:])
+		if i > 0 && idx.fanout[i] < idx.fanout[i-1] {
+			return nil, fmt.Errorf("corrupt pack index: fan-out table is not monotonic")
+		}
+		pos += 4
+	}
+
+	n := int(idx.fanout[255])
+	if len(data) < pos+n*(hashSize+8)+2*hashSize {
+		return nil, fmt.Errorf("corrupt pack index: truncated")
+	}
+	idx.names = data[pos : pos+n*hashSize]
+	pos += n * hashSize
+	idx.crcs = data[pos : pos+n*4]
+	pos += n * 4
+	idx.offsets = data[pos : pos+n*4]
+	pos += n * 4
+
+	large := 0
+	for i := 0; i < n; i++ {
+		if binary.BigEndian.Uint32(idx.offsets[i*4:])&0x80000000 != 0 {
+			large++
+		}
+	}
+	if len(data) != pos+large*8+2*hashSize {
+		return nil, fmt.Errorf("corrupt pack index: unexpected size")
+	}
+	idx.largeOffsets = data[pos : pos+large*8]
+	pos += large * 8
+
+	idx.PackChecksum = data[pos : pos+hashSize]
+	idx.Checksum = data[pos+hashSize:]
+
+	return idx, nil
+}
+
+// VerifyChecksum checks the trailing checksum of the index file, which
+// ReadIndex skips for speed.
+func (idx *Index) VerifyChecksum() error {
+	h := idx.format.New()
+	h.Write(idx.data[:len(idx.data)-idx.format.Size])
+	if !bytes.Equal(h.Sum(nil), idx.Checksum) {
+		return fmt.Errorf("pack index checksum mismatch")
+	}
+	return nil
+}
+
+// Count returns the number of objects in the index.
+func (idx *Index) Count() int {
+	return int(idx.fanout[255])
+}
+
+// HashAt returns the hex object ID of the i-th (sorted) entry.
+func (idx *Index) HashAt(i int) string {
+	hashSize := idx.format.Size
+	return hex.EncodeToString(idx.names[i*hashSize : (i+1)*hashSize])
+}
+
+// CRC32At returns the CRC32 of the packed data of the i-th entry.
+func (idx *Index) CRC32At(i int) uint32 {
+	return binary.BigEndian.Uint32(idx.crcs[i*4:])
+}
+
+// OffsetAt returns the pack offset of the i-th entry.
+func (idx *Index) OffsetAt(i int) int64 {
+	off := binary.BigEndian.Uint32(idx.offsets[i*4:])
+	if off&0x80000000 == 0 {
+		return int64(off)
+	}
+	j := int(off & 0x7fffffff)
+	return int64(binary.BigEndian.Uint64(idx.largeOffsets[j*8:]))
+}
+
+// Find returns the position of hash in the index.
+func (idx *Index) Find(hash []byte) (int, bool) {
+	hashSize := idx.format.Size
+	if len(hash) != hashSize {
+		return 0, false
+	}
+
+	lo := 0
+	if hash[0] > 0 {
+		lo = int(idx.fanout[hash[0]-1])
+	}
+	hi := int(idx.fanout[hash[0]])
+
+	i := lo + sort.Search(hi-lo, func(i int) bool {
+		return bytes.Compare(idx.names[(lo+i)*hashSize:(lo+i+1)*hashSize], hash) >= 0
+	})
+	if i < hi && bytes.Equal(idx.names[i*hashSize:(i+1)*hashSize], hash) {
+		return i, true
+	}
+	return 0, false
+}
+
+// FindPrefix returns the hex IDs of every entry starting with the given hex prefix.
+func (idx *Index) FindPrefix(prefix string) []string {
+	if len(prefix) < 2 {
+		return nil
+	}
+	first, err := hex.DecodeString(prefix[:2])
+	if err != nil {
+		return nil
+	}
+
+	lo := 0
+	if first[0] > 0 {
+		lo = int(idx.fanout[first[0]-1])
+	}
+	hi := int(idx.fanout[first[0]])
+
+	var matches []string
+	for i := lo; i < hi; i++ {
+		if id := idx.HashAt(i); len(id) >= len(prefix) && id[:len(prefix)] == prefix {
+			matches = append(matches, id)
+		}
+	}
+	return matches
+}
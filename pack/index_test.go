@@ -0,0 +1,121 @@
+package pack
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/codecrafters-io/git-starter-go/object"
+)
+
+func testObjects(t *testing.T, f *object.Format, offsets []int64) []*ObjectInfo {
+	t.Helper()
+	objects := make([]*ObjectInfo, len(offsets))
+	for i, off := range offsets {
+		id, err := f.Hash(object.TypeBlob, []byte(fmt.Sprint(i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		objects[i] = &ObjectInfo{ID: id, Offset: off, CRC32: uint32(i) * 0x01010101}
+	}
+	sort.Slice(objects, func(i, j int) bool { return objects[i].ID < objects[j].ID })
+	return objects
+}
+
+func TestIndexRoundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  *object.Format
+		offsets []int64
+	}{
+		{"empty", object.SHA1, nil},
+		{"small offsets", object.SHA1, []int64{12, 100, 2000, 1 << 20}},
+		{"large offsets", object.SHA1, []int64{12, 1 << 31, 1<<31 - 1, 5 << 32}},
+		{"sha256", object.SHA256, []int64{12, 345, 6 << 32}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			objects := testObjects(t, tt.format, tt.offsets)
+			packChecksum := bytes.Repeat([]byte{0xab}, tt.format.Size)
+
+			var buf bytes.Buffer
+			if err := WriteIndex(&buf, tt.format, objects, packChecksum); err != nil {
+				t.Fatal(err)
+			}
+			idx, err := ReadIndex(&buf, tt.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := idx.VerifyChecksum(); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(idx.PackChecksum, packChecksum) {
+				t.Errorf("pack checksum = %x, want %x", idx.PackChecksum, packChecksum)
+			}
+			if idx.Count() != len(objects) {
+				t.Fatalf("Count = %d, want %d", idx.Count(), len(objects))
+			}
+			for i, obj := range objects {
+				if id := idx.HashAt(i); id != obj.ID {
+					t.Errorf("HashAt(%d) = %s, want %s", i, id, obj.ID)
+				}
+				if off := idx.OffsetAt(i); off != obj.Offset {
+					t.Errorf("OffsetAt(%d) = %d, want %d", i, off, obj.Offset)
+				}
+				if crc := idx.CRC32At(i); crc != obj.CRC32 {
+					t.Errorf("CRC32At(%d) = %x, want %x", i, crc, obj.CRC32)
+				}
+				hash, _ := hex.DecodeString(obj.ID)
+				if j, ok := idx.Find(hash); !ok || j != i {
+					t.Errorf("Find(%s) = %d, %v; want %d", obj.ID, j, ok, i)
+				}
+				if ids := idx.FindPrefix(obj.ID[:6]); len(ids) != 1 || ids[0] != obj.ID {
+					t.Errorf("FindPrefix(%s) = %v", obj.ID[:6], ids)
+				}
+			}
+			if _, ok := idx.Find(make([]byte, tt.format.Size)); ok {
+				t.Error("Find found the zero ID")
+			}
+		})
+	}
+}
+
+func TestReadIndexErrors(t *testing.T) {
+	var valid bytes.Buffer
+	objects := testObjects(t, object.SHA1, []int64{12, 40})
+	if err := WriteIndex(&valid, object.SHA1, objects, make([]byte, 20)); err != nil {
+		t.Fatal(err)
+	}
+	corrupt := func(fn func(b []byte) []byte) []byte {
+		return fn(append([]byte(nil), valid.Bytes()...))
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"bad magic", corrupt(func(b []byte) []byte { b[0] = 0; return b })},
+		{"version 1", corrupt(func(b []byte) []byte { b[7] = 1; return b })},
+		{"non-monotonic fan-out", corrupt(func(b []byte) []byte { b[8+3] = 9; return b })},
+		{"truncated", corrupt(func(b []byte) []byte { return b[:len(b)-30] })},
+		{"trailing garbage", corrupt(func(b []byte) []byte { return append(b, 0) })},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ReadIndex(bytes.NewReader(tt.data), object.SHA1); err == nil {
+				t.Fatal("no error")
+			}
+		})
+	}
+
+	idx, err := ReadIndex(bytes.NewReader(corrupt(func(b []byte) []byte { b[len(b)-1] ^= 1; return b })), object.SHA1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := idx.VerifyChecksum(); err == nil {
+		t.Fatal("VerifyChecksum accepted a corrupt index")
+	}
+}
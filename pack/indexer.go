@@ -0,0 +1,410 @@
+package pack
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"sort"
+
+	"github.com/codecrafters-io/git-starter-go/object"
+)
+
+// ObjectInfo describes an object found while indexing a pack.
+type ObjectInfo struct {
+	ID string
+	// Type and Size describe the object after delta resolution.
+	Type ObjectType
+	Size int64
+
+	// EntrySize is the size of the entry's data: the delta for
+	// deltified objects, otherwise the same as Size.
+	EntrySize int64
+
+	Offset int64
+	// PackedSize is the number of pack bytes the entry occupies,
+	// including its header.
+	PackedSize int64
+	CRC32      uint32
+
+	// EntryType is the type recorded in the entry header, which is a
+	// delta type for deltified objects.
+	EntryType ObjectType
+	// DeltaDepth is the length of the delta chain, zero for undeltified
+	// objects.
+	DeltaDepth int
+	// BaseID is the ID of the delta base of deltified objects.
+	BaseID string
+
+	baseOffset int64
+	resolved   bool
+}
+
+// countingReader tracks the number of bytes consumed along with their
+// CRC32 and a running checksum of the whole pack.
+type countingReader struct {
+	r   *bufio.Reader
+	n   int64
+	crc hash.Hash32
+	sum hash.Hash
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	c.crc.Write(p[:n])
+	c.sum.Write(p[:n])
+	return n, err
+}
+
+func (c *countingReader) ReadByte() (byte, error) {
+	b, err := c.r.ReadByte()
+	if err == nil {
+		c.n++
+		c.crc.Write([]byte{b})
+		c.sum.Write([]byte{b})
+	}
+	return b, err
+}
+
+// maxCacheBytes bounds the delta base cache used while indexing.
+const maxCacheBytes = 64 << 20
+
+type cachedObject struct {
+	t     ObjectType
+	data  []byte
+	depth int
+}
+
+type indexer struct {
+	r        io.ReaderAt
+	size     int64
+	format   *object.Format
+	external func(id string) (ObjectType, []byte, error)
+
+	objects  []*ObjectInfo
+	byOffset map[int64]*ObjectInfo
+	byID     map[string]*ObjectInfo
+
+	cache      map[int64]cachedObject
+	cacheBytes int
+}
+
+// IndexPack reads every entry of the size-byte pack in r, verifies the
+// trailing checksum and resolves deltas, naming objects in format f. It
+// returns the objects sorted by ID and the pack checksum. REF_DELTA
+// bases missing from the pack (as in thin packs) are requested from
+// external, which may be nil.
+func IndexPack(r io.ReaderAt, size int64, f *object.Format, external func(id string) (ObjectType, []byte, error)) ([]*ObjectInfo, []byte, error) {
+	ix := &indexer{
+		r:        r,
+		size:     size,
+		format:   f,
+		external: external,
+		byOffset: make(map[int64]*ObjectInfo),
+		byID:     make(map[string]*ObjectInfo),
+		cache:    make(map[int64]cachedObject),
+	}
+
+	checksum, err := ix.scan()
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := ix.resolveDeltas(); err != nil {
+		return nil, nil, err
+	}
+
+	sort.Slice(ix.objects, func(i, j int) bool { return ix.objects[i].ID < ix.objects[j].ID })
+	for i := 1; i < len(ix.objects); i++ {
+		if ix.objects[i].ID == ix.objects[i-1].ID {
+			return nil, nil, fmt.Errorf("duplicate object %s in pack", ix.objects[i].ID)
+		}
+	}
+	return ix.objects, checksum, nil
+}
+
+// MissingBases returns the sorted IDs of the REF_DELTA bases that
+// objects refer to but do not include, which is what makes a pack thin.
+func MissingBases(objects []*ObjectInfo) []string {
+	have := make(map[string]bool, len(objects))
+	for _, info := range objects {
+		have[info.ID] = true
+	}
+	var missing []string
+	for _, info := range objects {
+		if info.EntryType == ObjRefDelta && !have[info.BaseID] {
+			have[info.BaseID] = true
+			missing = append(missing, info.BaseID)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+// scan reads the pack sequentially, recording every entry and hashing
+// the undeltified ones.
+func (ix *indexer) scan() ([]byte, error) {
+	size, hashSize := ix.size, int64(ix.format.Size)
+	if size < 12+hashSize {
+		return nil, fmt.Errorf("pack too short")
+	}
+	cr := &countingReader{
+		r:   bufio.NewReaderSize(io.NewSectionReader(ix.r, 0, size-hashSize), 64<<10),
+		crc: crc32.NewIEEE(),
+		sum: ix.format.New(),
+	}
+
+	var header [12]byte
+	if _, err := io.ReadFull(cr, header[:]); err != nil {
+		return nil, fmt.Errorf("error reading pack header: %w", err)
+	}
+	if string(header[:4]) != "PACK" {
+		return nil, fmt.Errorf("not a pack file")
+	}
+	if version := binary.BigEndian.Uint32(header[4:8]); version != 2 && version != 3 {
+		return nil, fmt.Errorf("unsupported pack version %d", version)
+	}
+	count := binary.BigEndian.Uint32(header[8:12])
+
+	for i := uint32(0); i < count; i++ {
+		offset := cr.n
+		cr.crc.Reset()
+		entry, err := readEntry(cr, offset, ix.format.Size, maxEntrySize(size-hashSize-offset))
+		if err != nil {
+			return nil, fmt.Errorf("error reading entry %d at offset %d: %w", i, offset, err)
+		}
+
+		info := &ObjectInfo{
+			Offset:     offset,
+			PackedSize: cr.n - offset,
+			CRC32:      cr.crc.Sum32(),
+			EntryType:  entry.Type,
+			Size:       entry.Size,
+			EntrySize:  entry.Size,
+		}
+		switch entry.Type {
+		case ObjCommit, ObjTree, ObjBlob, ObjTag:
+			info.Type = entry.Type
+			if info.ID, err = ix.format.Hash(object.Type(entry.Type), entry.Data); err != nil {
+				return nil, fmt.Errorf("object at offset %d: %w", offset, err)
+			}
+			info.resolved = true
+			ix.byID[info.ID] = info
+		case ObjOfsDelta:
+			info.baseOffset = entry.BaseOffset
+			if _, ok := ix.byOffset[entry.BaseOffset]; !ok {
+				return nil, fmt.Errorf("delta at offset %d has invalid base offset %d", offset, entry.BaseOffset)
+			}
+		case ObjRefDelta:
+			info.BaseID = entry.BaseID
+		default:
+			return nil, fmt.Errorf("invalid object type %d at offset %d", entry.Type, offset)
+		}
+		ix.objects = append(ix.objects, info)
+		ix.byOffset[offset] = info
+	}
+
+	if cr.n != size-hashSize {
+		return nil, fmt.Errorf("pack has %d bytes of trailing garbage", size-hashSize-cr.n)
+	}
+	checksum := make([]byte, hashSize)
+	if _, err := ix.r.ReadAt(checksum, size-hashSize); err != nil {
+		return nil, fmt.Errorf("error reading pack checksum: %w", err)
+	}
+	sum, err := ix.format.Sum(cr.sum)
+	if err != nil {
+		return nil, fmt.Errorf("pack checksum: %w", err)
+	}
+	if !bytes.Equal(sum, checksum) {
+		return nil, fmt.Errorf("pack checksum mismatch")
+	}
+	return checksum, nil
+}
+
+// resolveDeltas repeatedly resolves deltas whose base is known until
+// every object has an ID. REF_DELTA bases can appear anywhere in the
+// pack, so a single pass is not always enough.
+func (ix *indexer) resolveDeltas() error {
+	for {
+		progress, pending := false, 0
+		for _, info := range ix.objects {
+			if info.resolved {
+				continue
+			}
+			ok, err := ix.tryResolve(info)
+			if err != nil {
+				return err
+			}
+			if ok {
+				progress = true
+			} else {
+				pending++
+			}
+		}
+		if pending == 0 {
+			return nil
+		}
+		if !progress {
+			break
+		}
+	}
+
+	// Whatever is left depends on bases outside the pack.
+	for _, info := range ix.objects {
+		if info.resolved {
+			continue
+		}
+		if info.EntryType != ObjRefDelta || ix.external == nil {
+			return fmt.Errorf("missing delta base %s for object at offset %d", info.BaseID, info.Offset)
+		}
+		if _, _, _, err := ix.resolve(info); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tryResolve resolves info if its whole base chain is available.
+func (ix *indexer) tryResolve(info *ObjectInfo) (bool, error) {
+	for cur := info; !cur.resolved; {
+		var base *ObjectInfo
+		if cur.EntryType == ObjOfsDelta {
+			base = ix.byOffset[cur.baseOffset]
+		} else {
+			base = ix.byID[cur.BaseID]
+		}
+		if base == nil {
+			return false, nil
+		}
+		cur = base
+	}
+	_, _, _, err := ix.resolve(info)
+	return err == nil, err
+}
+
+// resolve returns the type, content and delta depth of info, recording
+// its ID along the way.
+func (ix *indexer) resolve(info *ObjectInfo) (ObjectType, []byte, int, error) {
+	if cached, ok := ix.cache[info.Offset]; ok {
+		return cached.t, cached.data, cached.depth, nil
+	}
+
+	r := bufio.NewReader(io.NewSectionReader(ix.r, info.Offset, 1<<62))
+	entry, err := readEntry(r, info.Offset, ix.format.Size, maxEntrySize(ix.size-int64(ix.format.Size)-info.Offset))
+	if err != nil {
+		return 0, nil, 0, err
+	}
+	if !isDelta(entry.Type) {
+		ix.cacheObject(info.Offset, cachedObject{t: entry.Type, data: entry.Data})
+		return entry.Type, entry.Data, 0, nil
+	}
+
+	var baseType ObjectType
+	var base []byte
+	var baseDepth int
+	switch {
+	case entry.Type == ObjOfsDelta:
+		baseInfo := ix.byOffset[entry.BaseOffset]
+		baseType, base, baseDepth, err = ix.resolve(baseInfo)
+		info.BaseID = baseInfo.ID
+	case ix.byID[entry.BaseID] != nil:
+		baseType, base, baseDepth, err = ix.resolve(ix.byID[entry.BaseID])
+	case ix.external != nil:
+		baseType, base, err = ix.external(entry.BaseID)
+	default:
+		err = fmt.Errorf("missing delta base %s", entry.BaseID)
+	}
+	if err != nil {
+		return 0, nil, 0, fmt.Errorf("error resolving delta at offset %d: %w", info.Offset, err)
+	}
+
+	data, err := ApplyDelta(base, entry.Data)
+	if err != nil {
+		return 0, nil, 0, fmt.Errorf("error applying delta at offset %d: %w", info.Offset, err)
+	}
+
+	if !info.resolved {
+		info.Type = baseType
+		info.Size = int64(len(data))
+		info.DeltaDepth = baseDepth + 1
+		if info.ID, err = ix.format.Hash(object.Type(baseType), data); err != nil {
+			return 0, nil, 0, fmt.Errorf("object at offset %d: %w", info.Offset, err)
+		}
+		info.resolved = true
+		ix.byID[info.ID] = info
+	}
+
+	ix.cacheObject(info.Offset, cachedObject{t: baseType, data: data, depth: baseDepth + 1})
+	return baseType, data, baseDepth + 1, nil
+}
+
+func (ix *indexer) cacheObject(offset int64, obj cachedObject) {
+	if ix.cacheBytes+len(obj.data) > maxCacheBytes {
+		ix.cache = make(map[int64]cachedObject)
+		ix.cacheBytes = 0
+	}
+	ix.cache[offset] = obj
+	ix.cacheBytes += len(obj.data)
+}
+
+func isDelta(t ObjectType) bool {
+	return t == ObjOfsDelta || t == ObjRefDelta
+}
+
+// WriteIndex writes a version 2 index for objects named in format f,
+// which must be sorted by ID, followed by the pack and index checksums.
+func WriteIndex(w io.Writer, f *object.Format, objects []*ObjectInfo, packChecksum []byte) error {
+	h := f.New()
+	bw := bufio.NewWriter(io.MultiWriter(w, h))
+
+	bw.Write(idxMagic)
+	binary.Write(bw, binary.BigEndian, uint32(2))
+
+	var fanout [256]uint32
+	for _, obj := range objects {
+		first, err := hex.DecodeString(obj.ID[:2])
+		if err != nil {
+			return fmt.Errorf("invalid object id %q", obj.ID)
+		}
+		fanout[first[0]]++
+	}
+	for i := 1; i < len(fanout); i++ {
+		fanout[i] += fanout[i-1]
+	}
+	binary.Write(bw, binary.BigEndian, fanout)
+
+	for _, obj := range objects {
+		id, err := hex.DecodeString(obj.ID)
+		if err != nil || len(id) != f.Size {
+			return fmt.Errorf("invalid object id %q", obj.ID)
+		}
+		bw.Write(id)
+	}
+	for _, obj := range objects {
+		binary.Write(bw, binary.BigEndian, obj.CRC32)
+	}
+
+	var large []uint64
+	for _, obj := range objects {
+		if obj.Offset < 0x80000000 {
+			binary.Write(bw, binary.BigEndian, uint32(obj.Offset))
+			continue
+		}
+		binary.Write(bw, binary.BigEndian, uint32(0x80000000|len(large)))
+		large = append(large, uint64(obj.Offset))
+	}
+	for _, off := range large {
+		binary.Write(bw, binary.BigEndian, off)
+	}
+
+	bw.Write(packChecksum)
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	_, err := w.Write(h.Sum(nil))
+	return err
+}
@@ -0,0 +1,106 @@
+package pack
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"errors"
+	"hash"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/codecrafters-io/git-starter-go/object"
+)
+
+func TestIndexPack(t *testing.T) {
+	base := []byte(strings.Repeat("base content\n", 10))
+	v1 := append(append([]byte(nil), base[:100]...), "one\n"...)
+	v2 := append(append([]byte(nil), v1[:90]...), "two\n"...)
+	external := []byte(strings.Repeat("stored elsewhere\n", 5))
+	v3 := append(append([]byte(nil), external[:40]...), "three\n"...)
+	entries := []testEntry{
+		{t: ObjBlob, content: base},
+		{t: ObjOfsDelta, content: suffixDelta(base, 100, "one\n"), ofs: 0, id: blobID(v1)},
+		{t: ObjRefDelta, content: suffixDelta(v1, 90, "two\n"), ref: blobID(v1), id: blobID(v2)},
+	}
+	thin := append(entries, testEntry{t: ObjRefDelta, content: suffixDelta(external, 40, "three\n"), ref: blobID(external), id: blobID(v3)})
+	resolve := func(id string) (ObjectType, []byte, error) {
+		if id != blobID(external) {
+			t.Errorf("asked for external base %s", id)
+		}
+		return ObjBlob, external, nil
+	}
+
+	tests := []struct {
+		name     string
+		entries  []testEntry
+		external func(id string) (ObjectType, []byte, error)
+		corrupt  func(data []byte)
+		depths   map[string]int
+		wantErr  bool
+	}{
+		{name: "ofs and ref deltas", entries: entries, depths: map[string]int{blobID(base): 0, blobID(v1): 1, blobID(v2): 2}},
+		{name: "thin", entries: thin, external: resolve, depths: map[string]int{blobID(v3): 1}},
+		{name: "thin without external", entries: thin, wantErr: true},
+		{name: "bad checksum", entries: entries, corrupt: func(data []byte) { data[len(data)-1] ^= 1 }, wantErr: true},
+		{name: "corrupt entry", entries: entries, corrupt: func(data []byte) { data[14] ^= 0xff }, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeTestPack(t, t.TempDir(), tt.entries)
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.corrupt != nil {
+				tt.corrupt(data)
+			}
+			objects, checksum, err := IndexPack(bytes.NewReader(data), int64(len(data)), object.SHA1, tt.external)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("no error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, obj := range objects {
+				if depth, ok := tt.depths[obj.ID]; ok && obj.DeltaDepth != depth {
+					t.Errorf("%s has delta depth %d, want %d", obj.ID, obj.DeltaDepth, depth)
+				}
+			}
+
+			// The index written from the result must match the one
+			// written alongside the pack.
+			var idx bytes.Buffer
+			if err := WriteIndex(&idx, object.SHA1, objects, checksum); err != nil {
+				t.Fatal(err)
+			}
+			want, err := os.ReadFile(strings.TrimSuffix(path, ".pack") + ".idx")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(idx.Bytes(), want) {
+				t.Fatal("written index differs from the expected one")
+			}
+		})
+	}
+}
+
+// collidingHash is SHA-1 that reports everything it hashes as part of
+// a collision attack.
+type collidingHash struct{ hash.Hash }
+
+func (h collidingHash) CollisionResistantSum(b []byte) ([]byte, bool) { return h.Sum(b), true }
+
+func TestIndexPackCollision(t *testing.T) {
+	colliding := object.NewFormat("sha1", sha1.Size, func() hash.Hash { return collidingHash{sha1.New()} })
+	data, err := os.ReadFile(writeTestPack(t, t.TempDir(), []testEntry{{t: ObjBlob, content: []byte("x")}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := IndexPack(bytes.NewReader(data), int64(len(data)), colliding, nil); !errors.Is(err, object.ErrCollision) {
+		t.Fatalf("IndexPack error = %v, want ErrCollision", err)
+	}
+}
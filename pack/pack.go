@@ -0,0 +1,430 @@
+// Package pack reads git packfiles and their version 2 indexes.
+package pack
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/object"
+)
+
+// ObjectType is the type code stored in a pack entry header.
+type ObjectType int8
+
+const (
+	ObjCommit   ObjectType = 1
+	ObjTree     ObjectType = 2
+	ObjBlob     ObjectType = 3
+	ObjTag      ObjectType = 4
+	ObjOfsDelta ObjectType = 6
+	ObjRefDelta ObjectType = 7
+)
+
+func (t ObjectType) String() string {
+	switch t {
+	case ObjCommit:
+		return "commit"
+	case ObjTree:
+		return "tree"
+	case ObjBlob:
+		return "blob"
+	case ObjTag:
+		return "tag"
+	case ObjOfsDelta:
+		return "ofs-delta"
+	case ObjRefDelta:
+		return "ref-delta"
+	}
+	return fmt.Sprintf("unknown(%d)", int8(t))
+}
+
+// ErrNotFound is returned when an object is not present in a pack.
+var ErrNotFound = errors.New("object not found in pack")
+
+const maxDeltaDepth = 4096
+
+// maxDeflateRatio is the best compression ratio deflate can achieve.
+const maxDeflateRatio = 1032
+
+// maxEntrySize returns the largest size an entry can declare when at
+// most n bytes of compressed data follow its header.
+func maxEntrySize(n int64) int64 {
+	return min(max(n, 0), math.MaxInt64/maxDeflateRatio) * maxDeflateRatio
+}
+
+// Packfile is an open .pack file together with its index.
+type Packfile struct {
+	Index *Index
+
+	f     *os.File
+	size  int64
+	count uint32
+
+	// ResolveExternal, if set, is consulted for REF_DELTA bases that
+	// are not stored in this pack.
+	ResolveExternal func(id string) (ObjectType, []byte, error)
+}
+
+// Open opens a .pack file and the .idx file next to it. Objects are
+// named in the given format.
+func Open(packPath string, format *object.Format) (*Packfile, error) {
+	idxPath := strings.TrimSuffix(packPath, ".pack") + ".idx"
+	idxFile, err := os.Open(idxPath)
+	if err != nil {
+		return nil, err
+	}
+	idx, err := ReadIndex(idxFile, format)
+	idxFile.Close()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", idxPath, err)
+	}
+
+	f, err := os.Open(packPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var header [12]byte
+	if _, err := io.ReadFull(f, header[:]); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: error reading pack header: %w", packPath, err)
+	}
+	if string(header[:4]) != "PACK" {
+		f.Close()
+		return nil, fmt.Errorf("%s: not a pack file", packPath)
+	}
+	if version := binary.BigEndian.Uint32(header[4:8]); version != 2 && version != 3 {
+		f.Close()
+		return nil, fmt.Errorf("%s: unsupported pack version %d", packPath, version)
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	p := &Packfile{Index: idx, f: f, size: info.Size(), count: binary.BigEndian.Uint32(header[8:12])}
+	if int(p.count) != idx.Count() {
+		f.Close()
+		return nil, fmt.Errorf("%s: pack has %d objects but index has %d", packPath, p.count, idx.Count())
+	}
+	return p, nil
+}
+
+// Close closes the underlying pack file.
+func (p *Packfile) Close() error {
+	return p.f.Close()
+}
+
+// Has reports whether the pack contains the object.
+func (p *Packfile) Has(id string) bool {
+	hash, err := hex.DecodeString(id)
+	if err != nil {
+		return false
+	}
+	_, ok := p.Index.Find(hash)
+	return ok
+}
+
+// Get returns the fully resolved type and content of an object.
+func (p *Packfile) Get(id string) (ObjectType, []byte, error) {
+	i, err := p.find(id)
+	if err != nil {
+		return 0, nil, err
+	}
+	return p.ObjectAt(p.Index.OffsetAt(i))
+}
+
+// ObjectAt returns the fully resolved object stored at offset.
+func (p *Packfile) ObjectAt(offset int64) (ObjectType, []byte, error) {
+	return p.objectAt(offset, 0)
+}
+
+func (p *Packfile) objectAt(offset int64, depth int) (ObjectType, []byte, error) {
+	if depth > maxDeltaDepth {
+		return 0, nil, fmt.Errorf("delta chain too deep at offset %d", offset)
+	}
+
+	entry, err := p.EntryAt(offset)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var baseType ObjectType
+	var base []byte
+	switch entry.Type {
+	case ObjCommit, ObjTree, ObjBlob, ObjTag:
+		return entry.Type, entry.Data, nil
+	case ObjOfsDelta:
+		baseType, base, err = p.objectAt(entry.BaseOffset, depth+1)
+	case ObjRefDelta:
+		baseType, base, err = p.resolveRef(entry.BaseID, depth+1)
+	default:
+		return 0, nil, fmt.Errorf("invalid object type %d at offset %d", entry.Type, offset)
+	}
+	if err != nil {
+		return 0, nil, fmt.Errorf("error resolving delta base at offset %d: %w", offset, err)
+	}
+
+	data, err := ApplyDelta(base, entry.Data)
+	if err != nil {
+		return 0, nil, fmt.Errorf("error applying delta at offset %d: %w", offset, err)
+	}
+	return baseType, data, nil
+}
+
+// Stat returns the type and size of an object from its entry headers,
+// inflating no more than the start of a delta.
+func (p *Packfile) Stat(id string) (ObjectType, int64, error) {
+	i, err := p.find(id)
+	if err != nil {
+		return 0, 0, err
+	}
+	return p.statAt(p.Index.OffsetAt(i), 0)
+}
+
+func (p *Packfile) statAt(offset int64, depth int) (ObjectType, int64, error) {
+	if depth > maxDeltaDepth {
+		return 0, 0, fmt.Errorf("delta chain too deep at offset %d", offset)
+	}
+
+	r := bufio.NewReader(io.NewSectionReader(p.f, offset, 1<<62))
+	entry, err := readEntryHeader(r, offset, p.Index.format.Size, p.maxEntrySize(offset))
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var t ObjectType
+	switch entry.Type {
+	case ObjCommit, ObjTree, ObjBlob, ObjTag:
+		return entry.Type, entry.Size, nil
+	case ObjOfsDelta:
+		t, _, err = p.statAt(entry.BaseOffset, depth+1)
+	case ObjRefDelta:
+		t, err = p.refType(entry.BaseID, depth+1)
+	default:
+		return 0, 0, fmt.Errorf("invalid object type %d at offset %d", entry.Type, offset)
+	}
+	if err != nil {
+		return 0, 0, fmt.Errorf("error resolving delta base at offset %d: %w", offset, err)
+	}
+
+	// The delta starts with the base and result sizes, each at most
+	// ten bytes long.
+	zr, err := zlib.NewReader(r)
+	if err != nil {
+		return 0, 0, fmt.Errorf("error inflating entry at offset %d: %w", offset, err)
+	}
+	defer zr.Close()
+	head := make([]byte, min(entry.Size, 20))
+	if _, err := io.ReadFull(zr, head); err != nil {
+		return 0, 0, fmt.Errorf("error inflating entry at offset %d: %w", offset, err)
+	}
+	_, pos, err := readDeltaSize(head, 0)
+	if err != nil {
+		return 0, 0, fmt.Errorf("error reading delta at offset %d: %w", offset, err)
+	}
+	size, _, err := readDeltaSize(head, pos)
+	if err != nil {
+		return 0, 0, fmt.Errorf("error reading delta at offset %d: %w", offset, err)
+	}
+	return t, int64(size), nil
+}
+
+func (p *Packfile) refType(id string, depth int) (ObjectType, error) {
+	hash, err := hex.DecodeString(id)
+	if err != nil {
+		return 0, err
+	}
+	if i, ok := p.Index.Find(hash); ok {
+		t, _, err := p.statAt(p.Index.OffsetAt(i), depth)
+		return t, err
+	}
+	t, _, err := p.resolveRef(id, depth)
+	return t, err
+}
+
+// Open returns the type and size of an object and a reader over its
+// content. Undeltified objects are inflated as they are read, so they
+// are never held in memory; deltas are resolved up front.
+func (p *Packfile) Open(id string) (ObjectType, int64, io.ReadCloser, error) {
+	i, err := p.find(id)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	offset := p.Index.OffsetAt(i)
+
+	r := bufio.NewReader(io.NewSectionReader(p.f, offset, 1<<62))
+	entry, err := readEntryHeader(r, offset, p.Index.format.Size, p.maxEntrySize(offset))
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	switch entry.Type {
+	case ObjCommit, ObjTree, ObjBlob, ObjTag:
+		zr, err := zlib.NewReader(r)
+		if err != nil {
+			return 0, 0, nil, fmt.Errorf("error inflating entry at offset %d: %w", offset, err)
+		}
+		return entry.Type, entry.Size, zr, nil
+	}
+
+	t, data, err := p.ObjectAt(offset)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	return t, int64(len(data)), io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (p *Packfile) find(id string) (int, error) {
+	hash, err := hex.DecodeString(id)
+	if err != nil {
+		return 0, fmt.Errorf("invalid object id %q", id)
+	}
+	i, ok := p.Index.Find(hash)
+	if !ok {
+		return 0, ErrNotFound
+	}
+	return i, nil
+}
+
+func (p *Packfile) resolveRef(id string, depth int) (ObjectType, []byte, error) {
+	hash, err := hex.DecodeString(id)
+	if err != nil {
+		return 0, nil, err
+	}
+	if i, ok := p.Index.Find(hash); ok {
+		return p.objectAt(p.Index.OffsetAt(i), depth)
+	}
+	if p.ResolveExternal != nil {
+		return p.ResolveExternal(id)
+	}
+	return 0, nil, fmt.Errorf("missing delta base %s", id)
+}
+
+// Entry is a single, possibly deltified, pack entry.
+type Entry struct {
+	Type ObjectType
+	// Size is the inflated size of Data as recorded in the entry header.
+	Size int64
+	// Data is the inflated object content or delta instructions.
+	Data []byte
+
+	// BaseOffset is set for ObjOfsDelta entries.
+	BaseOffset int64
+	// BaseID is set for ObjRefDelta entries.
+	BaseID string
+}
+
+// EntryAt reads the raw entry at offset without resolving deltas.
+func (p *Packfile) EntryAt(offset int64) (*Entry, error) {
+	r := bufio.NewReader(io.NewSectionReader(p.f, offset, 1<<62))
+	return readEntry(r, offset, p.Index.format.Size, p.maxEntrySize(offset))
+}
+
+// maxEntrySize bounds the size of the entry at offset by the data
+// between it and the trailing checksum.
+func (p *Packfile) maxEntrySize(offset int64) int64 {
+	return maxEntrySize(p.size - int64(p.Index.format.Size) - offset)
+}
+
+// byteReader is satisfied by *bufio.Reader. zlib reads exactly the
+// compressed stream from such a reader, which lets callers track where
+// each entry ends.
+type byteReader interface {
+	io.Reader
+	io.ByteReader
+}
+
+// readEntry parses an entry header and inflates its data from r, which
+// must be positioned at offset. Entries declaring more than maxSize
+// bytes are rejected.
+func readEntry(r byteReader, offset int64, hashSize int, maxSize int64) (*Entry, error) {
+	entry, err := readEntryHeader(r, offset, hashSize, maxSize)
+	if err != nil {
+		return nil, err
+	}
+
+	zr, err := zlib.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("error inflating entry at offset %d: %w", offset, err)
+	}
+	defer zr.Close()
+
+	// The declared size is untrusted, so the buffer grows only as data
+	// arrives, and never much past that size.
+	var buf bytes.Buffer
+	if _, err := io.Copy(&buf, io.LimitReader(zr, entry.Size+1)); err != nil {
+		return nil, fmt.Errorf("error inflating entry at offset %d: %w", offset, err)
+	}
+	if int64(buf.Len()) != entry.Size {
+		return nil, fmt.Errorf("entry at offset %d has size %d, expected %d", offset, buf.Len(), entry.Size)
+	}
+	entry.Data = buf.Bytes()
+
+	return entry, nil
+}
+
+// readEntryHeader parses an entry header from r, leaving r at the start
+// of the compressed data. Entries declaring more than maxSize bytes are
+// rejected.
+func readEntryHeader(r byteReader, offset int64, hashSize int, maxSize int64) (*Entry, error) {
+	c, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	entry := &Entry{Type: ObjectType((c >> 4) & 7)}
+	size := int64(c & 0x0f)
+	shift := uint(4)
+	for c&0x80 != 0 {
+		if shift > 63-7 {
+			return nil, fmt.Errorf("entry size overflows at offset %d", offset)
+		}
+		if c, err = r.ReadByte(); err != nil {
+			return nil, err
+		}
+		size |= int64(c&0x7f) << shift
+		shift += 7
+	}
+	if size > maxSize {
+		return nil, fmt.Errorf("entry at offset %d has size %d, more than the pack can hold", offset, size)
+	}
+	entry.Size = size
+
+	switch entry.Type {
+	case ObjOfsDelta:
+		if c, err = r.ReadByte(); err != nil {
+			return nil, err
+		}
+		rel := int64(c & 0x7f)
+		for c&0x80 != 0 {
+			if rel > offset>>7 {
+				return nil, fmt.Errorf("invalid delta base offset at offset %d", offset)
+			}
+			if c, err = r.ReadByte(); err != nil {
+				return nil, err
+			}
+			rel = ((rel + 1) << 7) | int64(c&0x7f)
+		}
+		if rel <= 0 || rel > offset {
+			return nil, fmt.Errorf("invalid delta base offset at offset %d", offset)
+		}
+		entry.BaseOffset = offset - rel
+	case ObjRefDelta:
+		hash := make([]byte, hashSize)
+		if _, err := io.ReadFull(r, hash); err != nil {
+			return nil, err
+		}
+		entry.BaseID = hex.EncodeToString(hash)
+	}
+	return entry, nil
+}
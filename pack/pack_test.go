@@ -0,0 +1,258 @@
+package pack
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/codecrafters-io/git-starter-go/object"
+)
+
+// testEntry is an entry of a hand-built pack. Deltas name their base by
+// its index in the pack (ofs) or by ID (ref).
+type testEntry struct {
+	t       ObjectType
+	content []byte
+	ofs     int
+	ref     string
+	// id is the ID of the resolved object; it must be set for deltas.
+	id string
+}
+
+func blobID(content []byte) string {
+	h := sha1.New()
+	fmt.Fprintf(h, "blob %d\x00", len(content))
+	h.Write(content)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// suffixDelta returns a delta turning base into base[:n] + suffix.
+func suffixDelta(base []byte, n int, suffix string) []byte {
+	delta := binary.AppendUvarint(nil, uint64(len(base)))
+	delta = binary.AppendUvarint(delta, uint64(n+len(suffix)))
+	delta = append(delta, 0x80|0x10, byte(n))
+	return append(append(delta, byte(len(suffix))), suffix...)
+}
+
+// writeTestPack writes a pack holding entries and its version 2 index
+// to dir and returns the path of the pack.
+func writeTestPack(t *testing.T, dir string, entries []testEntry) string {
+	t.Helper()
+	var buf bytes.Buffer
+	buf.WriteString("PACK")
+	binary.Write(&buf, binary.BigEndian, uint32(2))
+	binary.Write(&buf, binary.BigEndian, uint32(len(entries)))
+
+	type indexed struct {
+		hash   []byte
+		crc    uint32
+		offset int
+	}
+	var objects []indexed
+	offsets := make([]int, len(entries))
+	for i, e := range entries {
+		offsets[i] = buf.Len()
+		size := len(e.content)
+		c := byte(e.t)<<4 | byte(size&0x0f)
+		var header []byte
+		for size >>= 4; size > 0; size >>= 7 {
+			header = append(header, c|0x80)
+			c = byte(size & 0x7f)
+		}
+		header = append(header, c)
+		switch e.t {
+		case ObjOfsDelta:
+			rel := offsets[i] - offsets[e.ofs]
+			enc := []byte{byte(rel & 0x7f)}
+			for rel >>= 7; rel > 0; rel >>= 7 {
+				rel--
+				enc = append([]byte{0x80 | byte(rel&0x7f)}, enc...)
+			}
+			header = append(header, enc...)
+		case ObjRefDelta:
+			hash, _ := hex.DecodeString(e.ref)
+			header = append(header, hash...)
+		}
+		var z bytes.Buffer
+		zw := zlib.NewWriter(&z)
+		zw.Write(e.content)
+		zw.Close()
+		raw := append(header, z.Bytes()...)
+		buf.Write(raw)
+
+		id := e.id
+		if id == "" {
+			id = blobID(e.content)
+		}
+		hash, _ := hex.DecodeString(id)
+		objects = append(objects, indexed{hash, crc32.ChecksumIEEE(raw), offsets[i]})
+	}
+	packSum := sha1.Sum(buf.Bytes())
+	buf.Write(packSum[:])
+
+	sort.Slice(objects, func(i, j int) bool { return bytes.Compare(objects[i].hash, objects[j].hash) < 0 })
+	var idx bytes.Buffer
+	idx.Write(idxMagic)
+	binary.Write(&idx, binary.BigEndian, uint32(2))
+	for b := 0; b < 256; b++ {
+		n := sort.Search(len(objects), func(i int) bool { return int(objects[i].hash[0]) > b })
+		binary.Write(&idx, binary.BigEndian, uint32(n))
+	}
+	for _, obj := range objects {
+		idx.Write(obj.hash)
+	}
+	for _, obj := range objects {
+		binary.Write(&idx, binary.BigEndian, obj.crc)
+	}
+	for _, obj := range objects {
+		binary.Write(&idx, binary.BigEndian, uint32(obj.offset))
+	}
+	idx.Write(packSum[:])
+	idxSum := sha1.Sum(idx.Bytes())
+	idx.Write(idxSum[:])
+
+	path := filepath.Join(dir, "pack-test.pack")
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(strings.TrimSuffix(path, ".pack")+".idx", idx.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestPackfileGet(t *testing.T) {
+	base := []byte(strings.Repeat("base content\n", 10))
+	v1 := append(append([]byte(nil), base[:100]...), "one\n"...)
+	v2 := append(append([]byte(nil), v1[:90]...), "two\n"...)
+	v3 := append(append([]byte(nil), base[:50]...), "three\n"...)
+	external := []byte(strings.Repeat("stored elsewhere\n", 5))
+	v4 := append(append([]byte(nil), external[:40]...), "four\n"...)
+
+	p, err := Open(writeTestPack(t, t.TempDir(), []testEntry{
+		{t: ObjBlob, content: base},
+		{t: ObjOfsDelta, content: suffixDelta(base, 100, "one\n"), ofs: 0, id: blobID(v1)},
+		{t: ObjOfsDelta, content: suffixDelta(v1, 90, "two\n"), ofs: 1, id: blobID(v2)},
+		{t: ObjRefDelta, content: suffixDelta(base, 50, "three\n"), ref: blobID(base), id: blobID(v3)},
+		{t: ObjRefDelta, content: suffixDelta(external, 40, "four\n"), ref: blobID(external), id: blobID(v4)},
+	}), object.SHA1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	tests := []struct {
+		name     string
+		id       string
+		external bool
+		want     []byte
+		wantErr  string
+	}{
+		{name: "base", id: blobID(base), want: base},
+		{name: "ofs delta", id: blobID(v1), want: v1},
+		{name: "ofs delta chain", id: blobID(v2), want: v2},
+		{name: "ref delta", id: blobID(v3), want: v3},
+		{name: "external base", id: blobID(v4), external: true, want: v4},
+		{name: "missing external base", id: blobID(v4), wantErr: "missing delta base"},
+		{name: "not in pack", id: blobID(external), wantErr: ErrNotFound.Error()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p.ResolveExternal = nil
+			if tt.external {
+				p.ResolveExternal = func(id string) (ObjectType, []byte, error) {
+					if id != blobID(external) {
+						t.Errorf("asked for external base %s", id)
+					}
+					return ObjBlob, external, nil
+				}
+			}
+			typ, content, err := p.Get(tt.id)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Get error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if typ != ObjBlob || !bytes.Equal(content, tt.want) {
+				t.Fatalf("Get = %s %q, want blob %q", typ, content, tt.want)
+			}
+			if !p.Has(tt.id) {
+				t.Errorf("Has(%s) = false", tt.id)
+			}
+		})
+	}
+}
+
+func TestOpenErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		corrupt func(path string) error
+	}{
+		{"missing index", func(path string) error {
+			return os.Remove(strings.TrimSuffix(path, ".pack") + ".idx")
+		}},
+		{"not a pack", func(path string) error {
+			return os.WriteFile(path, []byte("JUNK\x00\x00\x00\x02\x00\x00\x00\x01"), 0644)
+		}},
+		{"bad version", func(path string) error {
+			return os.WriteFile(path, []byte("PACK\x00\x00\x00\x04\x00\x00\x00\x01"), 0644)
+		}},
+		{"count mismatch", func(path string) error {
+			return os.WriteFile(path, []byte("PACK\x00\x00\x00\x02\x00\x00\x00\x07"), 0644)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeTestPack(t, t.TempDir(), []testEntry{{t: ObjBlob, content: []byte("x")}})
+			if err := tt.corrupt(path); err != nil {
+				t.Fatal(err)
+			}
+			if p, err := Open(path, object.SHA1); err == nil {
+				p.Close()
+				t.Fatal("no error")
+			}
+		})
+	}
+}
+
+func TestReadEntryLimits(t *testing.T) {
+	deflate := func(s string) []byte {
+		var z bytes.Buffer
+		zw := zlib.NewWriter(&z)
+		zw.Write([]byte(s))
+		zw.Close()
+		return z.Bytes()
+	}
+	tests := []struct {
+		name    string
+		raw     []byte
+		wantErr string
+	}{
+		{"size overflow", append(bytes.Repeat([]byte{0xbf}, 10), 0x01), "overflows"},
+		{"size beyond pack", append([]byte{0xbf, 0xff, 0x7f}, deflate("x")...), "more than the pack can hold"},
+		{"data beyond size", append([]byte{0x31}, deflate("hello")...), "expected 1"},
+		{"base offset overflow", append([]byte{0x65}, append(bytes.Repeat([]byte{0xff}, 11), 0x01)...), "invalid delta base offset"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := readEntry(bufio.NewReader(bytes.NewReader(tt.raw)), 1<<20, 20, maxEntrySize(int64(len(tt.raw))))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("readEntry error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package pack
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/object"
+)
+
+// Verify checks a pack against its index: both checksums, every entry
+// of the pack and the ID, offset and CRC32 the index records for it. It
+// returns the objects in pack order. Objects are named in format f.
+func Verify(packPath string, f *object.Format) ([]*ObjectInfo, error) {
+	idxPath := strings.TrimSuffix(packPath, ".pack") + ".idx"
+	idxFile, err := os.Open(idxPath)
+	if err != nil {
+		return nil, err
+	}
+	idx, err := ReadIndex(idxFile, f)
+	idxFile.Close()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", idxPath, err)
+	}
+	if err := idx.VerifyChecksum(); err != nil {
+		return nil, fmt.Errorf("%s: %w", idxPath, err)
+	}
+
+	packFile, err := os.Open(packPath)
+	if err != nil {
+		return nil, err
+	}
+	defer packFile.Close()
+	info, err := packFile.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	objects, checksum, err := IndexPack(packFile, info.Size(), f, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", packPath, err)
+	}
+	if !bytes.Equal(checksum, idx.PackChecksum) {
+		return nil, fmt.Errorf("%s: pack checksum does not match its index", packPath)
+	}
+	if len(objects) != idx.Count() {
+		return nil, fmt.Errorf("%s: pack has %d objects, index has %d", packPath, len(objects), idx.Count())
+	}
+	for i, obj := range objects {
+		if idx.HashAt(i) != obj.ID {
+			return nil, fmt.Errorf("%s: index lists %s, pack has %s", idxPath, idx.HashAt(i), obj.ID)
+		}
+		if idx.OffsetAt(i) != obj.Offset {
+			return nil, fmt.Errorf("%s: wrong offset for %s", idxPath, obj.ID)
+		}
+		if idx.CRC32At(i) != obj.CRC32 {
+			return nil, fmt.Errorf("%s: CRC32 mismatch for %s", idxPath, obj.ID)
+		}
+	}
+
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Offset < objects[j].Offset })
+	return objects, nil
+}
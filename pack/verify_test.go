@@ -0,0 +1,71 @@
+package pack
+
+import (
+	"crypto/sha1"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/codecrafters-io/git-starter-go/object"
+)
+
+func TestVerify(t *testing.T) {
+	base := []byte(strings.Repeat("base content\n", 10))
+	entries := []testEntry{
+		{t: ObjBlob, content: base},
+		{t: ObjOfsDelta, content: suffixDelta(base, 100, "one\n"), ofs: 0, id: blobID(append(base[:100:100], "one\n"...))},
+	}
+	// The CRC32 table follows the header, fan-out and names.
+	const crcOffset = 8 + 256*4 + 2*20
+	rehash := func(idx []byte) {
+		sum := sha1.Sum(idx[:len(idx)-20])
+		copy(idx[len(idx)-20:], sum[:])
+	}
+
+	tests := []struct {
+		name    string
+		corrupt func(pack, idx []byte)
+		wantErr string
+	}{
+		{name: "valid", corrupt: func(pack, idx []byte) {}},
+		{name: "index checksum", corrupt: func(pack, idx []byte) { idx[crcOffset] ^= 1 }, wantErr: "checksum"},
+		{name: "crc32", corrupt: func(pack, idx []byte) { idx[crcOffset] ^= 1; rehash(idx) }, wantErr: "CRC32 mismatch"},
+		{name: "pack checksum", corrupt: func(pack, idx []byte) { pack[len(pack)-1] ^= 1 }, wantErr: "checksum"},
+		{name: "recorded pack checksum", corrupt: func(pack, idx []byte) { idx[len(idx)-21] ^= 1; rehash(idx) }, wantErr: "does not match its index"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeTestPack(t, t.TempDir(), entries)
+			idxPath := strings.TrimSuffix(path, ".pack") + ".idx"
+			pack, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			idx, err := os.ReadFile(idxPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.corrupt(pack, idx)
+			if err := os.WriteFile(path, pack, 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(idxPath, idx, 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			objects, err := Verify(path, object.SHA1)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Verify error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(objects) != 2 || objects[0].Offset > objects[1].Offset {
+				t.Fatalf("Verify returned %d objects out of pack order", len(objects))
+			}
+		})
+	}
+}
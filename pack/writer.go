@@ -0,0 +1,270 @@
+package pack
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+
+	"github.com/codecrafters-io/git-starter-go/object"
+)
+
+// Writer writes a pack stream. The number of objects must be known up
+// front since it is part of the header.
+type Writer struct {
+	w      io.Writer
+	format *object.Format
+	sum    hash.Hash
+	offset int64
+
+	count   uint32
+	objects []*ObjectInfo
+}
+
+// NewWriter writes the header of a pack holding count objects, named in
+// format f, to w.
+func NewWriter(w io.Writer, f *object.Format, count uint32) (*Writer, error) {
+	pw := &Writer{w: w, format: f, sum: f.New(), count: count}
+
+	var header [12]byte
+	copy(header[:4], "PACK")
+	binary.BigEndian.PutUint32(header[4:8], 2)
+	binary.BigEndian.PutUint32(header[8:12], count)
+	if err := pw.write(header[:]); err != nil {
+		return nil, err
+	}
+	return pw, nil
+}
+
+func (pw *Writer) write(p []byte) error {
+	n, err := pw.w.Write(p)
+	pw.sum.Write(p[:n])
+	pw.offset += int64(n)
+	return err
+}
+
+// WriteObject appends an undeltified object to the pack.
+func (pw *Writer) WriteObject(t ObjectType, data []byte) (*ObjectInfo, error) {
+	if t < ObjCommit || t > ObjTag {
+		return nil, fmt.Errorf("invalid object type %s", t)
+	}
+	id, err := pw.format.Hash(object.Type(t), data)
+	if err != nil {
+		return nil, err
+	}
+	info := &ObjectInfo{
+		ID:        id,
+		Type:      t,
+		Size:      int64(len(data)),
+		EntrySize: int64(len(data)),
+		EntryType: t,
+		resolved:  true,
+	}
+	return info, pw.writeEntry(info, nil, data)
+}
+
+// WriteDelta appends the object id of type t and size bytes as an
+// OFS_DELTA against base, which must already be in the pack.
+func (pw *Writer) WriteDelta(id string, t ObjectType, size int64, base *ObjectInfo, delta []byte) (*ObjectInfo, error) {
+	if base.Offset >= pw.offset || base.ID == "" {
+		return nil, fmt.Errorf("delta base %s is not in the pack", base.ID)
+	}
+	info := &ObjectInfo{
+		ID:         id,
+		Type:       t,
+		Size:       size,
+		EntrySize:  int64(len(delta)),
+		EntryType:  ObjOfsDelta,
+		DeltaDepth: base.DeltaDepth + 1,
+		BaseID:     base.ID,
+		baseOffset: base.Offset,
+		resolved:   true,
+	}
+	return info, pw.writeEntry(info, appendOffset(nil, pw.offset-base.Offset), delta)
+}
+
+// WriteObjectFrom appends an undeltified object of type t whose size
+// bytes of content are read from r, compressing and hashing it as it is
+// copied so that it is never held in memory.
+func (pw *Writer) WriteObjectFrom(t ObjectType, size int64, r io.Reader) (*ObjectInfo, error) {
+	if t < ObjCommit || t > ObjTag {
+		return nil, fmt.Errorf("invalid object type %s", t)
+	}
+	if uint32(len(pw.objects)) == pw.count {
+		return nil, fmt.Errorf("pack already holds %d objects", pw.count)
+	}
+
+	info := &ObjectInfo{
+		Type:      t,
+		Size:      size,
+		EntrySize: size,
+		EntryType: t,
+		Offset:    pw.offset,
+		resolved:  true,
+	}
+	crc := crc32.NewIEEE()
+	ew := &entryWriter{pw: pw, crc: crc}
+	if _, err := ew.Write(appendEntryHeader(nil, t, size)); err != nil {
+		return nil, err
+	}
+
+	h := pw.format.New()
+	h.Write(object.Header(object.Type(t), int(size)))
+	zw := zlib.NewWriter(ew)
+	n, err := io.Copy(io.MultiWriter(h, zw), r)
+	if err != nil {
+		return nil, err
+	}
+	if n != size {
+		return nil, fmt.Errorf("object size changed while reading: expected %d bytes, read %d", size, n)
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	sum, err := pw.format.Sum(h)
+	if err != nil {
+		return nil, err
+	}
+	info.ID = hex.EncodeToString(sum)
+	info.PackedSize = pw.offset - info.Offset
+	info.CRC32 = crc.Sum32()
+	pw.objects = append(pw.objects, info)
+	return info, nil
+}
+
+// entryWriter writes an entry to the pack, keeping its CRC32.
+type entryWriter struct {
+	pw  *Writer
+	crc hash.Hash32
+}
+
+func (ew *entryWriter) Write(p []byte) (int, error) {
+	if err := ew.pw.write(p); err != nil {
+		return 0, err
+	}
+	ew.crc.Write(p)
+	return len(p), nil
+}
+
+func (pw *Writer) writeEntry(info *ObjectInfo, extra, data []byte) error {
+	if uint32(len(pw.objects)) == pw.count {
+		return fmt.Errorf("pack already holds %d objects", pw.count)
+	}
+
+	var entry bytes.Buffer
+	entry.Write(appendEntryHeader(nil, info.EntryType, int64(len(data))))
+	entry.Write(extra)
+	zw := zlib.NewWriter(&entry)
+	zw.Write(data)
+	if err := zw.Close(); err != nil {
+		return err
+	}
+
+	info.Offset = pw.offset
+	info.PackedSize = int64(entry.Len())
+	info.CRC32 = crc32.ChecksumIEEE(entry.Bytes())
+	if err := pw.write(entry.Bytes()); err != nil {
+		return err
+	}
+	pw.objects = append(pw.objects, info)
+	return nil
+}
+
+// Objects returns the objects written so far, in pack order.
+func (pw *Writer) Objects() []*ObjectInfo {
+	return pw.objects
+}
+
+// Close writes the trailing checksum and returns it.
+func (pw *Writer) Close() ([]byte, error) {
+	if uint32(len(pw.objects)) != pw.count {
+		return nil, fmt.Errorf("pack has %d objects, header says %d", len(pw.objects), pw.count)
+	}
+	checksum := pw.sum.Sum(nil)
+	if _, err := pw.w.Write(checksum); err != nil {
+		return nil, err
+	}
+	return checksum, nil
+}
+
+// AppendObjects adds the objects ids, read through load, to the end of
+// the size-byte pack in f, updating its object count and trailing
+// checksum. Appending the missing bases of a thin pack makes it
+// self-contained. It returns the appended objects and the new checksum.
+func AppendObjects(f interface {
+	io.ReaderAt
+	io.WriterAt
+}, size int64, format *object.Format, ids []string, load func(id string) (ObjectType, []byte, error)) ([]*ObjectInfo, []byte, error) {
+	end := size - int64(format.Size)
+	if end < 12 {
+		return nil, nil, fmt.Errorf("pack too short")
+	}
+	var header [12]byte
+	if _, err := f.ReadAt(header[:], 0); err != nil {
+		return nil, nil, fmt.Errorf("error reading pack header: %w", err)
+	}
+	if string(header[:4]) != "PACK" {
+		return nil, nil, fmt.Errorf("not a pack file")
+	}
+	count := binary.BigEndian.Uint32(header[8:12])
+	binary.BigEndian.PutUint32(header[8:12], count+uint32(len(ids)))
+	if _, err := f.WriteAt(header[:], 0); err != nil {
+		return nil, nil, err
+	}
+
+	// The new entries overwrite the old checksum, and the new one covers
+	// the whole pack.
+	sum := format.New()
+	if _, err := io.Copy(sum, io.NewSectionReader(f, 0, end)); err != nil {
+		return nil, nil, err
+	}
+	pw := &Writer{w: io.NewOffsetWriter(f, end), format: format, sum: sum, offset: end, count: uint32(len(ids))}
+	for _, id := range ids {
+		t, data, err := load(id)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error reading object %s: %w", id, err)
+		}
+		info, err := pw.WriteObject(t, data)
+		if err != nil {
+			return nil, nil, err
+		}
+		if info.ID != id {
+			return nil, nil, fmt.Errorf("object %s hashes to %s", id, info.ID)
+		}
+	}
+	checksum, err := pw.Close()
+	if err != nil {
+		return nil, nil, err
+	}
+	return pw.Objects(), checksum, nil
+}
+
+// appendEntryHeader encodes the type and size of a pack entry.
+func appendEntryHeader(buf []byte, t ObjectType, size int64) []byte {
+	c := byte(t)<<4 | byte(size&0x0f)
+	size >>= 4
+	for size > 0 {
+		buf = append(buf, c|0x80)
+		c = byte(size & 0x7f)
+		size >>= 7
+	}
+	return append(buf, c)
+}
+
+// appendOffset encodes the distance to an OFS_DELTA base.
+func appendOffset(buf []byte, rel int64) []byte {
+	var tmp [10]byte
+	i := len(tmp) - 1
+	tmp[i] = byte(rel & 0x7f)
+	for rel >>= 7; rel > 0; rel >>= 7 {
+		rel--
+		i--
+		tmp[i] = 0x80 | byte(rel&0x7f)
+	}
+	return append(buf, tmp[i:]...)
+}
@@ -0,0 +1,265 @@
+// Package pktline implements the pkt-line framing used by git's wire
+// protocols, including side-band demultiplexing.
+package pktline
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// MaxPayload is the largest payload a single pkt-line may carry.
+const MaxPayload = 65516
+
+// PacketType distinguishes data packets from the special zero-length
+// control packets.
+type PacketType int
+
+const (
+	Data PacketType = iota
+	Flush
+	Delim
+	ResponseEnd
+)
+
+func (t PacketType) String() string {
+	switch t {
+	case Data:
+		return "data"
+	case Flush:
+		return "flush"
+	case Delim:
+		return "delim"
+	case ResponseEnd:
+		return "response-end"
+	}
+	return fmt.Sprintf("PacketType(%d)", int(t))
+}
+
+// Writer encodes pkt-lines.
+type Writer struct {
+	w io.Writer
+}
+
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w}
+}
+
+// WritePacket writes p as a single data packet.
+func (w *Writer) WritePacket(p []byte) error {
+	if len(p) > MaxPayload {
+		return fmt.Errorf("pkt-line payload too large: %d bytes", len(p))
+	}
+	if _, err := fmt.Fprintf(w.w, "%04x", len(p)+4); err != nil {
+		return err
+	}
+	_, err := w.w.Write(p)
+	return err
+}
+
+// WriteString writes s as a single data packet.
+func (w *Writer) WriteString(s string) error {
+	return w.WritePacket([]byte(s))
+}
+
+// Writef formats a single data packet.
+func (w *Writer) Writef(format string, args ...any) error {
+	return w.WriteString(fmt.Sprintf(format, args...))
+}
+
+// Flush writes a flush packet ("0000").
+func (w *Writer) Flush() error {
+	_, err := io.WriteString(w.w, "0000")
+	return err
+}
+
+// Delim writes a delimiter packet ("0001").
+func (w *Writer) Delim() error {
+	_, err := io.WriteString(w.w, "0001")
+	return err
+}
+
+// ResponseEnd writes a response-end packet ("0002").
+func (w *Writer) ResponseEnd() error {
+	_, err := io.WriteString(w.w, "0002")
+	return err
+}
+
+// Reader decodes pkt-lines.
+type Reader struct {
+	r *bufio.Reader
+}
+
+func NewReader(r io.Reader) *Reader {
+	if br, ok := r.(*bufio.Reader); ok {
+		return &Reader{r: br}
+	}
+	return &Reader{r: bufio.NewReader(r)}
+}
+
+// ReadPacket reads the next packet. For control packets the payload is
+// nil.
+func (r *Reader) ReadPacket() (PacketType, []byte, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(r.r, header[:]); err != nil {
+		return 0, nil, err
+	}
+	n, err := strconv.ParseUint(string(header[:]), 16, 16)
+	if err != nil {
+		return 0, nil, fmt.Errorf("invalid pkt-line length %q", header[:])
+	}
+
+	switch n {
+	case 0:
+		return Flush, nil, nil
+	case 1:
+		return Delim, nil, nil
+	case 2:
+		return ResponseEnd, nil, nil
+	case 3:
+		return 0, nil, fmt.Errorf("invalid pkt-line length %q", header[:])
+	}
+
+	payload := make([]byte, n-4)
+	if _, err := io.ReadFull(r.r, payload); err != nil {
+		return 0, nil, fmt.Errorf("truncated pkt-line: %w", err)
+	}
+	return Data, payload, nil
+}
+
+// ReadLine reads a data packet and strips one trailing newline. It
+// returns io.EOF on a flush packet.
+func (r *Reader) ReadLine() (string, error) {
+	t, payload, err := r.ReadPacket()
+	if err != nil {
+		return "", err
+	}
+	if t != Data {
+		return "", io.EOF
+	}
+	line := string(payload)
+	if len(line) > 0 && line[len(line)-1] == '\n' {
+		line = line[:len(line)-1]
+	}
+	return line, nil
+}
+
+// ErrRemote is wrapped by errors the remote reports on side-band 3 or in
+// an "ERR" packet.
+var ErrRemote = errors.New("remote error")
+
+// SidebandReader demultiplexes a side-band or side-band-64k stream. Band
+// 1 is returned from Read, band 2 is copied to Progress and band 3 ends
+// the stream with an error.
+type SidebandReader struct {
+	r        *Reader
+	Progress io.Writer
+
+	buf []byte
+	err error
+}
+
+func NewSidebandReader(r *Reader, progress io.Writer) *SidebandReader {
+	return &SidebandReader{r: r, Progress: progress}
+}
+
+// Unread queues an already-read packet to be processed before the rest
+// of the stream.
+func (s *SidebandReader) Unread(packet []byte) error {
+	return s.handle(packet)
+}
+
+func (s *SidebandReader) Read(p []byte) (int, error) {
+	for len(s.buf) == 0 {
+		if s.err != nil {
+			return 0, s.err
+		}
+		t, payload, err := s.r.ReadPacket()
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			s.err = err
+			continue
+		}
+		if t == Flush {
+			s.err = io.EOF
+			continue
+		}
+		if t != Data {
+			s.err = fmt.Errorf("unexpected %s packet in side-band stream", t)
+			continue
+		}
+		if err := s.handle(payload); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, s.buf)
+	s.buf = s.buf[n:]
+	return n, nil
+}
+
+func (s *SidebandReader) handle(packet []byte) error {
+	if len(packet) == 0 {
+		return nil
+	}
+	switch packet[0] {
+	case 1:
+		s.buf = append(s.buf, packet[1:]...)
+	case 2:
+		if s.Progress != nil {
+			s.Progress.Write(packet[1:])
+		}
+	case 3:
+		s.err = fmt.Errorf("%w: %s", ErrRemote, trimNewline(packet[1:]))
+		return s.err
+	default:
+		if len(packet) >= 4 && string(packet[:4]) == "ERR " {
+			s.err = fmt.Errorf("%w: %s", ErrRemote, trimNewline(packet[4:]))
+			return s.err
+		}
+		s.err = fmt.Errorf("invalid side-band channel %d", packet[0])
+		return s.err
+	}
+	return nil
+}
+
+func trimNewline(b []byte) string {
+	s := string(b)
+	if len(s) > 0 && s[len(s)-1] == '\n' {
+		s = s[:len(s)-1]
+	}
+	return s
+}
+
+// SidebandWriter multiplexes writes onto one side-band channel, split
+// into packets carrying at most max bytes of data.
+type SidebandWriter struct {
+	w    *Writer
+	band byte
+	max  int
+}
+
+// NewSidebandWriter returns a writer for band. max is MaxPayload-1 for
+// side-band-64k and 995 for side-band.
+func NewSidebandWriter(w *Writer, band byte, max int) *SidebandWriter {
+	return &SidebandWriter{w: w, band: band, max: max}
+}
+
+func (s *SidebandWriter) Write(p []byte) (int, error) {
+	written := 0
+	buf := make([]byte, 0, s.max+1)
+	for len(p) > 0 {
+		n := min(len(p), s.max)
+		buf = append(append(buf[:0], s.band), p[:n]...)
+		if err := s.w.WritePacket(buf); err != nil {
+			return written, err
+		}
+		written += n
+		p = p[n:]
+	}
+	return written, nil
+}
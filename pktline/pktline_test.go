@@ -0,0 +1,164 @@
+package pktline
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestPacketRoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		write func(w *Writer) error
+		wire  string
+		typ   PacketType
+		data  string
+	}{
+		{"data", func(w *Writer) error { return w.WriteString("hello\n") }, "000ahello\n", Data, "hello\n"},
+		{"empty data", func(w *Writer) error { return w.WriteString("") }, "0004", Data, ""},
+		{"formatted", func(w *Writer) error { return w.Writef("want %s\n", "abc") }, "000dwant abc\n", Data, "want abc\n"},
+		{"flush", (*Writer).Flush, "0000", Flush, ""},
+		{"delim", (*Writer).Delim, "0001", Delim, ""},
+		{"response end", (*Writer).ResponseEnd, "0002", ResponseEnd, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := tt.write(NewWriter(&buf)); err != nil {
+				t.Fatal(err)
+			}
+			if buf.String() != tt.wire {
+				t.Fatalf("wrote %q, want %q", buf.String(), tt.wire)
+			}
+			typ, data, err := NewReader(&buf).ReadPacket()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if typ != tt.typ || string(data) != tt.data {
+				t.Fatalf("read %s %q, want %s %q", typ, data, tt.typ, tt.data)
+			}
+		})
+	}
+}
+
+func TestWritePacketTooLarge(t *testing.T) {
+	w := NewWriter(io.Discard)
+	if err := w.WritePacket(make([]byte, MaxPayload)); err != nil {
+		t.Fatalf("MaxPayload bytes: %v", err)
+	}
+	if err := w.WritePacket(make([]byte, MaxPayload+1)); err == nil {
+		t.Fatal("MaxPayload+1 bytes: no error")
+	}
+}
+
+func TestReadPacketErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		wire string
+	}{
+		{"bad hex", "00zz"},
+		{"reserved length", "0003"},
+		{"truncated payload", "0009abc"},
+		{"truncated header", "00"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := NewReader(strings.NewReader(tt.wire)).ReadPacket(); err == nil {
+				t.Fatalf("%q: no error", tt.wire)
+			}
+		})
+	}
+}
+
+func TestReadLine(t *testing.T) {
+	r := NewReader(strings.NewReader("000aline1\n0009line20000"))
+	for _, want := range []string{"line1", "line2"} {
+		line, err := r.ReadLine()
+		if err != nil || line != want {
+			t.Fatalf("ReadLine = %q, %v; want %q", line, err, want)
+		}
+	}
+	if _, err := r.ReadLine(); err != io.EOF {
+		t.Fatalf("ReadLine at flush = %v, want io.EOF", err)
+	}
+}
+
+func sideband(packets ...string) string {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	for _, p := range packets {
+		if p == "" {
+			w.Flush()
+			continue
+		}
+		w.WriteString(p)
+	}
+	return buf.String()
+}
+
+func TestSidebandReader(t *testing.T) {
+	tests := []struct {
+		name     string
+		wire     string
+		data     string
+		progress string
+		wantErr  bool
+		is       error
+	}{
+		{"data and progress", sideband("\x01PACK", "\x02Counting\n", "\x01rest", ""), "PACKrest", "Counting\n", false, nil},
+		{"remote error", sideband("\x01PA", "\x03no such ref\n"), "PA", "", true, ErrRemote},
+		{"ERR packet", sideband("ERR access denied\n"), "", "", true, ErrRemote},
+		{"missing flush", sideband("\x01PACK"), "PACK", "", true, io.ErrUnexpectedEOF},
+		{"bad channel", sideband("\x05x"), "", "", true, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var progress bytes.Buffer
+			r := NewSidebandReader(NewReader(strings.NewReader(tt.wire)), &progress)
+			data, err := io.ReadAll(r)
+			if string(data) != tt.data {
+				t.Errorf("data = %q, want %q", data, tt.data)
+			}
+			if progress.String() != tt.progress {
+				t.Errorf("progress = %q, want %q", progress.String(), tt.progress)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("error = %v, want error %v", err, tt.wantErr)
+			}
+			if tt.is != nil && !errors.Is(err, tt.is) {
+				t.Errorf("error = %v, want %v", err, tt.is)
+			}
+		})
+	}
+}
+
+func TestSidebandWriterSplits(t *testing.T) {
+	tests := []struct {
+		max     int
+		data    string
+		packets []string
+	}{
+		{4, "abcdefghij", []string{"\x02abcd", "\x02efgh", "\x02ij"}},
+		{995, "short", []string{"\x02short"}},
+		{3, "", nil},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		n, err := NewSidebandWriter(NewWriter(&buf), 2, tt.max).Write([]byte(tt.data))
+		if err != nil || n != len(tt.data) {
+			t.Fatalf("Write = %d, %v", n, err)
+		}
+		r := NewReader(&buf)
+		for _, want := range tt.packets {
+			_, p, err := r.ReadPacket()
+			if err != nil || string(p) != want {
+				t.Fatalf("packet = %q, %v; want %q", p, err, want)
+			}
+		}
+		if _, _, err := r.ReadPacket(); err != io.EOF {
+			t.Fatalf("extra packets after %d: %v", len(tt.packets), err)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package refs
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/atomicfile"
+)
+
+// packedRefsHeader is the header git writes: every ref is sorted and
+// every annotated tag carries its fully peeled object.
+const packedRefsHeader = "# pack-refs with: peeled fully-peeled sorted \n"
+
+// packedRef is an entry of packed-refs.
+type packedRef struct {
+	Name string
+	Hash string
+	// Peeled is the object an annotated tag ultimately points to.
+	Peeled string
+}
+
+// packedRefs is the parsed content of a packed-refs file.
+type packedRefs struct {
+	header string
+	refs   []packedRef
+}
+
+func (p *packedRefs) find(name string) *packedRef {
+	i := sort.Search(len(p.refs), func(i int) bool { return p.refs[i].Name >= name })
+	if i < len(p.refs) && p.refs[i].Name == name {
+		return &p.refs[i]
+	}
+	return nil
+}
+
+// remove drops the entries for names and reports whether any existed.
+func (p *packedRefs) remove(names map[string]bool) bool {
+	kept := p.refs[:0]
+	for _, ref := range p.refs {
+		if !names[ref.Name] {
+			kept = append(kept, ref)
+		}
+	}
+	removed := len(kept) != len(p.refs)
+	p.refs = kept
+	return removed
+}
+
+func (p *packedRefs) String() string {
+	var buf strings.Builder
+	buf.WriteString(p.header)
+	for _, ref := range p.refs {
+		fmt.Fprintf(&buf, "%s %s\n", ref.Hash, ref.Name)
+		if ref.Peeled != "" {
+			fmt.Fprintf(&buf, "^%s\n", ref.Peeled)
+		}
+	}
+	return buf.String()
+}
+
+func (s *Store) readPacked() (*packedRefs, error) {
+	packed := &packedRefs{header: packedRefsHeader}
+	data, err := os.ReadFile(filepath.Join(s.GitDir, "packed-refs"))
+	if os.IsNotExist(err) {
+		return packed, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading packed-refs: %w", err)
+	}
+
+	packed.header = ""
+	for _, line := range strings.Split(string(data), "\n") {
+		switch {
+		case line == "":
+		case line[0] == '#':
+			if packed.header == "" {
+				packed.header = line + "\n"
+			}
+		case line[0] == '^':
+			if len(packed.refs) == 0 || !s.format.ValidID(line[1:]) {
+				return nil, fmt.Errorf("malformed packed-refs line %q", line)
+			}
+			packed.refs[len(packed.refs)-1].Peeled = line[1:]
+		default:
+			hash, name, ok := strings.Cut(line, " ")
+			if !ok || !s.format.ValidID(hash) {
+				return nil, fmt.Errorf("malformed packed-refs line %q", line)
+			}
+			packed.refs = append(packed.refs, packedRef{Name: name, Hash: hash})
+		}
+	}
+	// Files written without the sorted trait are sorted on the way in.
+	sort.SliceStable(packed.refs, func(i, j int) bool { return packed.refs[i].Name < packed.refs[j].Name })
+	return packed, nil
+}
+
+// writePacked replaces packed-refs with packed. The caller holds the
+// packed-refs lock.
+func (s *Store) writePacked(lock *atomicfile.File, packed *packedRefs) error {
+	if _, err := lock.WriteString(packed.String()); err != nil {
+		return fmt.Errorf("error writing packed-refs: %w", err)
+	}
+	if err := lock.Commit(filepath.Join(s.GitDir, "packed-refs"), 0644); err != nil {
+		return fmt.Errorf("error writing packed-refs: %w", err)
+	}
+	return nil
+}
+
+// Pack moves every direct ref into packed-refs and deletes the loose
+// ref files; symbolic refs stay loose. peel returns the object an
+// annotated tag ultimately points to, or "" for anything else.
+func (s *Store) Pack(peel func(hash string) string) error {
+	lock, err := atomicfile.Lock(filepath.Join(s.GitDir, "packed-refs"), s.PackedRefsTimeout, s.Sync)
+	if err != nil {
+		return fmt.Errorf("error locking packed-refs: %w", err)
+	}
+	defer lock.Abort()
+
+	packed, err := s.readPacked()
+	if err != nil {
+		return err
+	}
+	merged := make(map[string]packedRef)
+	for _, ref := range packed.refs {
+		merged[ref.Name] = ref
+	}
+	loose := make(map[string]string)
+	err = s.walkLoose("refs/", func(name string) error {
+		ref, err := s.Read(name)
+		if err != nil {
+			return err
+		}
+		if !ref.IsSymbolic() {
+			loose[name] = ref.Hash
+			merged[name] = packedRef{Name: name, Hash: ref.Hash}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	packed = &packedRefs{header: packedRefsHeader}
+	for _, ref := range merged {
+		ref.Peeled = peel(ref.Hash)
+		packed.refs = append(packed.refs, ref)
+	}
+	sort.Slice(packed.refs, func(i, j int) bool { return packed.refs[i].Name < packed.refs[j].Name })
+	if err := s.writePacked(lock, packed); err != nil {
+		return err
+	}
+
+	for name, hash := range loose {
+		if err := s.pruneLoose(name, hash); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pruneLoose removes the loose ref name once it has been packed, unless
+// it has changed from hash or is locked by another process.
+func (s *Store) pruneLoose(name, hash string) error {
+	lock, err := atomicfile.Lock(s.path(name), s.LockTimeout, s.Sync)
+	if err != nil {
+		return nil
+	}
+	defer s.removeEmptyDirs(name)
+	defer lock.Abort()
+
+	data, err := os.ReadFile(s.path(name))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error reading ref %s: %w", name, err)
+	}
+	if strings.TrimSpace(string(data)) != hash {
+		return nil
+	}
+	if err := os.Remove(s.path(name)); err != nil {
+		return fmt.Errorf("error removing ref %s: %w", name, err)
+	}
+	return nil
+}
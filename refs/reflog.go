@@ -0,0 +1,71 @@
+package refs
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/object"
+)
+
+func (s *Store) logPath(name string) string {
+	return filepath.Join(s.GitDir, "logs", filepath.FromSlash(name))
+}
+
+// shouldLog reports whether updates of the ref name go into its reflog:
+// with LogAllRefUpdates for HEAD, branches, remote-tracking refs and
+// notes, and for any ref that already has a reflog.
+func (s *Store) shouldLog(name string) bool {
+	if _, err := os.Stat(s.logPath(name)); err == nil {
+		return true
+	}
+	if !s.LogAllRefUpdates {
+		return false
+	}
+	return name == "HEAD" || strings.HasPrefix(name, "refs/heads/") ||
+		strings.HasPrefix(name, "refs/remotes/") || strings.HasPrefix(name, "refs/notes/")
+}
+
+// appendLog adds an entry for a move of the ref name from old to new to
+// its reflog. The caller holds the ref's lock.
+func (s *Store) appendLog(name, old, new string, committer object.Signature, message string) error {
+	path := s.logPath(name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("error creating reflog directory: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("error opening reflog %s: %w", name, err)
+	}
+	defer f.Close()
+
+	entry := fmt.Sprintf("%s %s %s", old, new, committer)
+	if message != "" {
+		entry += "\t" + strings.ReplaceAll(strings.TrimRight(message, "\n"), "\n", " ")
+	}
+	if _, err := f.WriteString(entry + "\n"); err != nil {
+		return fmt.Errorf("error writing reflog %s: %w", name, err)
+	}
+	if s.Sync {
+		if err := f.Sync(); err != nil {
+			return fmt.Errorf("error writing reflog %s: %w", name, err)
+		}
+	}
+	return f.Close()
+}
+
+// removeLog deletes the reflog of the ref name along with the
+// directories it leaves empty.
+func (s *Store) removeLog(name string) error {
+	if err := os.Remove(s.logPath(name)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error deleting reflog %s: %w", name, err)
+	}
+	keep := map[string]bool{"refs": true, "refs/heads": true}
+	for dir := filepath.ToSlash(filepath.Dir(name)); strings.HasPrefix(dir, "refs/") && !keep[dir]; dir = filepath.ToSlash(filepath.Dir(dir)) {
+		if os.Remove(s.logPath(dir)) != nil {
+			break
+		}
+	}
+	return nil
+}
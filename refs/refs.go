@@ -0,0 +1,254 @@
+// Package refs reads and updates the refs of a repository: loose ref
+// files, packed-refs and symbolic refs such as HEAD. Updates go through
+// git's <ref>.lock protocol, so they are safe against concurrent git
+// processes.
+package refs
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/codecrafters-io/git-starter-go/atomicfile"
+	"github.com/codecrafters-io/git-starter-go/object"
+)
+
+// ErrNotFound is returned for refs that do not exist.
+var ErrNotFound = errors.New("ref not found")
+
+// Git's default lock timeouts, core.filesRefLockTimeout and
+// core.packedRefsTimeout.
+const (
+	DefaultLockTimeout       = 100 * time.Millisecond
+	DefaultPackedRefsTimeout = time.Second
+)
+
+// maxSymrefDepth bounds the length of symbolic ref chains, as in git.
+const maxSymrefDepth = 5
+
+// Ref is the value of a single ref: an object ID, or the name of
+// another ref for symbolic refs.
+type Ref struct {
+	Name string
+	Hash string
+	// Target is set instead of Hash for symbolic refs.
+	Target string
+}
+
+func (r Ref) IsSymbolic() bool {
+	return r.Target != ""
+}
+
+// Store is the ref database of a git directory.
+type Store struct {
+	GitDir string
+	// Sync flushes ref files to disk as they are written.
+	Sync bool
+	// LockTimeout and PackedRefsTimeout are how long to retry the lock
+	// of a loose ref, or of packed-refs, held by another process.
+	LockTimeout       time.Duration
+	PackedRefsTimeout time.Duration
+	// LogAllRefUpdates records updates of HEAD, branches,
+	// remote-tracking refs and notes in reflogs, as
+	// core.logAllRefUpdates does. Refs that already have a reflog are
+	// logged either way.
+	LogAllRefUpdates bool
+
+	format *object.Format
+}
+
+// New returns the ref database of gitDir, whose refs hold object IDs
+// in format f.
+func New(gitDir string, f *object.Format) *Store {
+	return &Store{
+		GitDir:            gitDir,
+		LockTimeout:       DefaultLockTimeout,
+		PackedRefsTimeout: DefaultPackedRefsTimeout,
+		format:            f,
+	}
+}
+
+func (s *Store) Format() *object.Format {
+	return s.format
+}
+
+func (s *Store) path(name string) string {
+	return filepath.Join(s.GitDir, filepath.FromSlash(name))
+}
+
+// Read returns the value of the ref name itself, without following
+// symbolic refs. Loose refs take precedence over packed ones.
+func (s *Store) Read(name string) (Ref, error) {
+	data, err := os.ReadFile(s.path(name))
+	if errors.Is(err, fs.ErrNotExist) || errors.Is(err, syscall.EISDIR) {
+		packed, err := s.readPacked()
+		if err != nil {
+			return Ref{}, err
+		}
+		if p := packed.find(name); p != nil {
+			return Ref{Name: name, Hash: p.Hash}, nil
+		}
+		return Ref{}, fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	if err != nil {
+		return Ref{}, fmt.Errorf("error reading ref %s: %w", name, err)
+	}
+
+	value := strings.TrimSpace(string(data))
+	if target, ok := strings.CutPrefix(value, "ref:"); ok {
+		return Ref{Name: name, Target: strings.TrimSpace(target)}, nil
+	}
+	if !s.format.ValidID(value) {
+		return Ref{}, fmt.Errorf("ref %s is corrupt", name)
+	}
+	return Ref{Name: name, Hash: value}, nil
+}
+
+// Resolve follows symbolic refs from name and returns the direct ref
+// at the end of the chain with the object it points to. If that ref
+// does not exist, as for HEAD on an unborn branch, its name is returned
+// with an ErrNotFound error.
+func (s *Store) Resolve(name string) (string, string, error) {
+	for i := 0; i < maxSymrefDepth; i++ {
+		ref, err := s.Read(name)
+		if err != nil {
+			return name, "", err
+		}
+		if !ref.IsSymbolic() {
+			return name, ref.Hash, nil
+		}
+		name = ref.Target
+	}
+	return "", "", fmt.Errorf("symbolic ref chain too long at %s", name)
+}
+
+// Head returns the ref HEAD points to, or "" if HEAD is detached.
+func (s *Store) Head() (string, error) {
+	ref, err := s.Read("HEAD")
+	if err != nil {
+		return "", err
+	}
+	return ref.Target, nil
+}
+
+// List returns the refs under prefix (e.g. "refs/remotes/") mapped to
+// the objects they resolve to. Symbolic refs that lead nowhere are left
+// out.
+func (s *Store) List(prefix string) (map[string]string, error) {
+	refs := make(map[string]string)
+	err := s.walkLoose(prefix, func(name string) error {
+		_, hash, err := s.Resolve(name)
+		if errors.Is(err, ErrNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		refs[name] = hash
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	packed, err := s.readPacked()
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range packed.refs {
+		if _, ok := refs[p.Name]; !ok && strings.HasPrefix(p.Name, prefix) {
+			refs[p.Name] = p.Hash
+		}
+	}
+	return refs, nil
+}
+
+// walkLoose calls fn with the name of every loose ref under prefix.
+func (s *Store) walkLoose(prefix string, fn func(name string) error) error {
+	err := filepath.WalkDir(s.path(prefix), func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() || strings.HasSuffix(path, ".lock") {
+			return nil
+		}
+		rel, err := filepath.Rel(s.GitDir, path)
+		if err != nil {
+			return err
+		}
+		return fn(filepath.ToSlash(rel))
+	})
+	if err != nil {
+		return fmt.Errorf("error listing refs: %w", err)
+	}
+	return nil
+}
+
+// ValidName reports whether name is a well-formed ref name, following
+// the rules of git check-ref-format.
+func ValidName(name string) bool {
+	if name == "" || name == "@" || strings.HasSuffix(name, "/") || strings.HasSuffix(name, ".") ||
+		strings.Contains(name, "..") || strings.Contains(name, "@{") || strings.Contains(name, "//") {
+		return false
+	}
+	for _, c := range name {
+		if c < 0x20 || c == 0x7f || strings.ContainsRune(" ~^:?*[\\", c) {
+			return false
+		}
+	}
+	for _, component := range strings.Split(name, "/") {
+		if component == "" || component[0] == '.' || strings.HasSuffix(component, ".lock") {
+			return false
+		}
+	}
+	return true
+}
+
+// SetSymbolic makes name (e.g. HEAD) a symbolic ref to target.
+func (s *Store) SetSymbolic(name, target string) error {
+	lock, err := s.lock(name)
+	if err != nil {
+		return err
+	}
+	defer lock.Abort()
+
+	if _, err := lock.WriteString("ref: " + target + "\n"); err != nil {
+		return fmt.Errorf("error updating ref %s: %w", name, err)
+	}
+	if err := lock.Commit(s.path(name), 0644); err != nil {
+		return fmt.Errorf("error updating ref %s: %w", name, err)
+	}
+	return nil
+}
+
+// lock takes the lock of the loose ref name.
+func (s *Store) lock(name string) (*atomicfile.File, error) {
+	path := s.path(name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("error creating ref directory: %w", err)
+	}
+	lock, err := atomicfile.Lock(path, s.LockTimeout, s.Sync)
+	if err != nil {
+		return nil, fmt.Errorf("cannot lock ref '%s': %w", name, err)
+	}
+	return lock, nil
+}
+
+// removeEmptyDirs removes the directory of the loose ref name and its
+// empty parents, keeping the directories every repository has.
+func (s *Store) removeEmptyDirs(name string) {
+	keep := map[string]bool{"refs": true, "refs/heads": true, "refs/tags": true}
+	for dir := filepath.ToSlash(filepath.Dir(name)); strings.HasPrefix(dir, "refs/") && !keep[dir]; dir = filepath.ToSlash(filepath.Dir(dir)) {
+		if os.Remove(s.path(dir)) != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,272 @@
+package refs
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/codecrafters-io/git-starter-go/atomicfile"
+	"github.com/codecrafters-io/git-starter-go/object"
+)
+
+// Transaction is a set of ref updates applied all together or not at
+// all.
+type Transaction struct {
+	store   *Store
+	updates []update
+
+	logging   bool
+	committer object.Signature
+	message   string
+}
+
+type update struct {
+	name     string
+	old, new string
+	// target is set instead of new to make the ref symbolic.
+	target string
+	// logOnly updates lock the ref and write its reflog but leave the
+	// ref alone, as HEAD when the branch it points at moves.
+	logOnly bool
+	lock    *atomicfile.File
+	// message, if set, replaces the transaction's reflog message.
+	message string
+
+	// logOld and logNew are the objects the ref resolved to before and
+	// after the update, for its reflog.
+	logOld, logNew string
+}
+
+// Transaction starts an empty transaction on s.
+func (s *Store) Transaction() *Transaction {
+	return &Transaction{store: s}
+}
+
+// Update queues pointing the ref name at new, or deleting it if new is
+// the zero ID. Unless old is empty the ref must still be at old when the
+// transaction commits, or not exist if old is the zero ID.
+func (tx *Transaction) Update(name, old, new string) {
+	tx.updates = append(tx.updates, update{name: name, old: old, new: new})
+}
+
+// UpdateMessage is Update with a reflog message of its own, which
+// replaces the message given to SetReflog for this ref.
+func (tx *Transaction) UpdateMessage(name, old, new, message string) {
+	tx.updates = append(tx.updates, update{name: name, old: old, new: new, message: message})
+}
+
+// SetSymbolic queues making the ref name a symbolic ref to target.
+func (tx *Transaction) SetSymbolic(name, target string) {
+	tx.updates = append(tx.updates, update{name: name, target: target})
+}
+
+// SetReflog has the transaction record its updates in the reflogs of
+// the refs it changes, as committer and with message. When the branch
+// HEAD points at is updated, HEAD's reflog gets the entry too.
+func (tx *Transaction) SetReflog(committer object.Signature, message string) {
+	tx.logging, tx.committer, tx.message = true, committer, message
+}
+
+// Delete queues deleting the ref name, loose or packed.
+func (tx *Transaction) Delete(name, old string) {
+	tx.Update(name, old, tx.store.format.ZeroID())
+}
+
+// Commit applies the queued updates. Every ref is locked and checked
+// against its expected old value before anything is written, so a
+// failure leaves all refs untouched. Reflog entries are written while
+// the refs are still locked.
+func (tx *Transaction) Commit() error {
+	s := tx.store
+	if tx.logging {
+		tx.addHeadLog()
+	}
+	sort.Slice(tx.updates, func(i, j int) bool { return tx.updates[i].name < tx.updates[j].name })
+	for i := 1; i < len(tx.updates); i++ {
+		if tx.updates[i].name == tx.updates[i-1].name {
+			return fmt.Errorf("multiple updates for ref '%s' not allowed", tx.updates[i].name)
+		}
+	}
+	defer func() {
+		for _, u := range tx.updates {
+			if u.lock != nil {
+				u.lock.Abort()
+			}
+		}
+	}()
+
+	deletes := make(map[string]bool)
+	for i := range tx.updates {
+		u := &tx.updates[i]
+		lock, err := s.lock(u.name)
+		if err != nil {
+			return err
+		}
+		u.lock = lock
+		if err := s.verify(u.name, u.old); err != nil {
+			return err
+		}
+		if tx.logging {
+			if u.logOld, err = s.resolvedOrZero(u.name); err != nil {
+				return err
+			}
+		}
+		switch {
+		case u.logOnly:
+		case u.target != "":
+			if _, err := lock.WriteString("ref: " + u.target + "\n"); err != nil {
+				return fmt.Errorf("error updating ref %s: %w", u.name, err)
+			}
+			if tx.logging {
+				if u.logNew, err = s.resolvedOrZero(u.target); err != nil {
+					return err
+				}
+			}
+		case object.IsZeroID(u.new):
+			deletes[u.name] = true
+		default:
+			if _, err := lock.WriteString(u.new + "\n"); err != nil {
+				return fmt.Errorf("error updating ref %s: %w", u.name, err)
+			}
+			u.logNew = u.new
+		}
+	}
+	// A symbolic ref whose target moves in the same transaction logs
+	// the target's new value, and HEAD's log-only entry mirrors the
+	// branch's. Both targets sort after HEAD, so this waits until all
+	// refs are locked.
+	for i := range tx.updates {
+		u := &tx.updates[i]
+		if u.target == "" {
+			continue
+		}
+		for _, t := range tx.updates {
+			if t.name == u.target && t.target == "" && !t.logOnly {
+				if u.logOnly {
+					u.logOld = t.logOld
+				}
+				u.logNew = t.logNew
+			}
+		}
+	}
+
+	// Deleted refs leave packed-refs first, so that a packed value can
+	// never show through once the loose file is gone.
+	if len(deletes) > 0 {
+		if err := s.removePacked(deletes); err != nil {
+			return err
+		}
+	}
+
+	for _, u := range tx.updates {
+		if deletes[u.name] {
+			err := os.Remove(s.path(u.name))
+			if err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("error deleting ref %s: %w", u.name, err)
+			}
+			if err := s.removeLog(u.name); err != nil {
+				return err
+			}
+			u.lock.Abort()
+			s.removeEmptyDirs(u.name)
+			continue
+		}
+		if tx.logging && s.shouldLog(u.name) {
+			message := tx.message
+			if u.message != "" {
+				message = u.message
+			}
+			if err := s.appendLog(u.name, u.logOld, u.logNew, tx.committer, message); err != nil {
+				return err
+			}
+		}
+		if u.logOnly {
+			u.lock.Abort()
+			continue
+		}
+		if err := u.lock.Commit(s.path(u.name), 0644); err != nil {
+			return fmt.Errorf("error updating ref %s: %w", u.name, err)
+		}
+	}
+	return nil
+}
+
+// addHeadLog queues a log-only update of HEAD if it points at a branch
+// the transaction moves and is not itself being updated.
+func (tx *Transaction) addHeadLog() {
+	head, err := tx.store.Read("HEAD")
+	if err != nil || !head.IsSymbolic() {
+		return
+	}
+	for _, u := range tx.updates {
+		if u.name == "HEAD" {
+			return
+		}
+	}
+	for _, u := range tx.updates {
+		if u.name == head.Target && u.target == "" && !object.IsZeroID(u.new) {
+			tx.updates = append(tx.updates, update{name: "HEAD", target: head.Target, logOnly: true, message: u.message})
+			return
+		}
+	}
+}
+
+// resolvedOrZero returns the object the ref name resolves to, or the
+// zero ID if it does not exist.
+func (s *Store) resolvedOrZero(name string) (string, error) {
+	_, hash, err := s.Resolve(name)
+	if errors.Is(err, ErrNotFound) {
+		return s.format.ZeroID(), nil
+	}
+	return hash, err
+}
+
+// verify checks that the ref name is at old, as described for Update.
+// The caller holds the ref's lock.
+func (s *Store) verify(name, old string) error {
+	if old == "" {
+		return nil
+	}
+	ref, err := s.Read(name)
+	switch {
+	case errors.Is(err, ErrNotFound):
+		if !object.IsZeroID(old) {
+			return fmt.Errorf("cannot lock ref '%s': unable to resolve reference '%s'", name, name)
+		}
+	case err != nil:
+		return err
+	case object.IsZeroID(old):
+		return fmt.Errorf("cannot lock ref '%s': reference already exists", name)
+	case ref.Hash != old:
+		current := ref.Hash
+		if ref.IsSymbolic() {
+			current = "ref: " + ref.Target
+		}
+		return fmt.Errorf("cannot lock ref '%s': is at %s but expected %s", name, current, old)
+	}
+	return nil
+}
+
+// removePacked drops names from packed-refs, if any of them is packed.
+func (s *Store) removePacked(names map[string]bool) error {
+	path := filepath.Join(s.GitDir, "packed-refs")
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil
+	}
+	lock, err := atomicfile.Lock(path, s.PackedRefsTimeout, s.Sync)
+	if err != nil {
+		return fmt.Errorf("error locking packed-refs: %w", err)
+	}
+	defer lock.Abort()
+
+	packed, err := s.readPacked()
+	if err != nil {
+		return err
+	}
+	if !packed.remove(names) {
+		return nil
+	}
+	return s.writePacked(lock, packed)
+}
@@ -0,0 +1,217 @@
+package refs
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/codecrafters-io/git-starter-go/object"
+)
+
+var (
+	hashA = strings.Repeat("a", 40)
+	hashB = strings.Repeat("b", 40)
+	hashC = strings.Repeat("c", 40)
+	zero  = object.SHA1.ZeroID()
+)
+
+// testStore returns a store with HEAD on main at hashA, feature packed
+// at hashB and v1 loose at hashC.
+func testStore(t *testing.T) *Store {
+	t.Helper()
+	s := New(t.TempDir(), object.SHA1)
+	s.LockTimeout, s.PackedRefsTimeout = 0, 0
+	if err := s.SetSymbolic("HEAD", "refs/heads/main"); err != nil {
+		t.Fatal(err)
+	}
+	tx := s.Transaction()
+	tx.Update("refs/heads/feature", zero, hashB)
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Pack(func(string) string { return "" }); err != nil {
+		t.Fatal(err)
+	}
+	tx = s.Transaction()
+	tx.Update("refs/heads/main", zero, hashA)
+	tx.Update("refs/tags/v1", zero, hashC)
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestTransaction(t *testing.T) {
+	tests := []struct {
+		name    string
+		setup   func(t *testing.T, s *Store)
+		queue   func(tx *Transaction)
+		wantErr string
+		// want maps ref names to the object they must resolve to
+		// afterwards, "" meaning the ref must not exist.
+		want map[string]string
+	}{
+		{
+			name:  "create",
+			queue: func(tx *Transaction) { tx.Update("refs/heads/new", zero, hashC) },
+			want:  map[string]string{"refs/heads/new": hashC, "refs/heads/main": hashA},
+		},
+		{
+			name:  "update without old value",
+			queue: func(tx *Transaction) { tx.Update("refs/heads/main", "", hashB) },
+			want:  map[string]string{"refs/heads/main": hashB, "HEAD": hashB},
+		},
+		{
+			name: "update several",
+			queue: func(tx *Transaction) {
+				tx.Update("refs/heads/main", hashA, hashB)
+				tx.Update("refs/heads/feature", hashB, hashC)
+				tx.Delete("refs/tags/v1", hashC)
+			},
+			want: map[string]string{"refs/heads/main": hashB, "refs/heads/feature": hashC, "refs/tags/v1": ""},
+		},
+		{
+			name:  "delete packed",
+			queue: func(tx *Transaction) { tx.Delete("refs/heads/feature", hashB) },
+			want:  map[string]string{"refs/heads/feature": "", "refs/heads/main": hashA},
+		},
+		{
+			name:  "symbolic",
+			queue: func(tx *Transaction) { tx.SetSymbolic("HEAD", "refs/heads/feature") },
+			want:  map[string]string{"HEAD": hashB},
+		},
+		{
+			name: "stale old value rolls back",
+			queue: func(tx *Transaction) {
+				tx.Update("refs/heads/new", zero, hashC)
+				tx.Update("refs/heads/main", hashB, hashC)
+			},
+			wantErr: "is at " + hashA + " but expected " + hashB,
+			want:    map[string]string{"refs/heads/new": "", "refs/heads/main": hashA},
+		},
+		{
+			name: "create existing rolls back",
+			queue: func(tx *Transaction) {
+				tx.Delete("refs/heads/feature", hashB)
+				tx.Update("refs/tags/v1", zero, hashA)
+			},
+			wantErr: "reference already exists",
+			want:    map[string]string{"refs/heads/feature": hashB, "refs/tags/v1": hashC},
+		},
+		{
+			name:    "missing ref",
+			queue:   func(tx *Transaction) { tx.Delete("refs/heads/gone", hashA) },
+			wantErr: "unable to resolve reference",
+			want:    map[string]string{"refs/heads/gone": ""},
+		},
+		{
+			name: "duplicate updates",
+			queue: func(tx *Transaction) {
+				tx.Update("refs/heads/main", hashA, hashB)
+				tx.Update("refs/heads/main", hashA, hashC)
+			},
+			wantErr: "multiple updates",
+			want:    map[string]string{"refs/heads/main": hashA},
+		},
+		{
+			name: "locked ref rolls back",
+			setup: func(t *testing.T, s *Store) {
+				if err := os.WriteFile(s.path("refs/tags/v1.lock"), nil, 0644); err != nil {
+					t.Fatal(err)
+				}
+			},
+			queue: func(tx *Transaction) {
+				tx.Update("refs/heads/main", hashA, hashB)
+				tx.Update("refs/tags/v1", hashC, hashA)
+			},
+			wantErr: "v1.lock",
+			want:    map[string]string{"refs/heads/main": hashA, "refs/tags/v1": hashC},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := testStore(t)
+			if tt.setup != nil {
+				tt.setup(t, s)
+			}
+			tx := s.Transaction()
+			tt.queue(tx)
+			err := tx.Commit()
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Fatalf("Commit: %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Fatalf("Commit error = %v, want %q", err, tt.wantErr)
+			}
+
+			for name, want := range tt.want {
+				_, got, err := s.Resolve(name)
+				if want == "" {
+					if err == nil {
+						t.Errorf("%s still exists at %s", name, got)
+					}
+					continue
+				}
+				if err != nil || got != want {
+					t.Errorf("%s = %s, %v; want %s", name, got, err, want)
+				}
+			}
+
+			// No lock of the transaction may be left behind.
+			filepath.Walk(s.GitDir, func(path string, info os.FileInfo, err error) error {
+				if strings.HasSuffix(path, ".lock") && !strings.HasSuffix(path, "v1.lock") {
+					t.Errorf("lock left behind: %s", path)
+				}
+				return nil
+			})
+		})
+	}
+}
+
+func TestTransactionReflog(t *testing.T) {
+	s := testStore(t)
+	s.LogAllRefUpdates = true
+	committer := object.Signature{Name: "A U Thor", Email: "author@example.com", When: time.Unix(1700000000, 0).UTC()}
+
+	tx := s.Transaction()
+	tx.SetReflog(committer, "commit: second\nbody")
+	tx.Update("refs/heads/main", hashA, hashB)
+	tx.Update("refs/tags/v1", hashC, hashA)
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := hashA + " " + hashB + " A U Thor <author@example.com> 1700000000 +0000\tcommit: second body\n"
+	for _, name := range []string{"refs/heads/main", "HEAD"} {
+		data, err := os.ReadFile(s.logPath(name))
+		if err != nil || string(data) != want {
+			t.Errorf("reflog of %s = %q, %v; want %q", name, data, err, want)
+		}
+	}
+	if _, err := os.Stat(s.logPath("refs/tags/v1")); !os.IsNotExist(err) {
+		t.Errorf("tag update was logged: %v", err)
+	}
+
+	tx = s.Transaction()
+	tx.SetReflog(committer, "fetch")
+	tx.UpdateMessage("refs/heads/feature", hashB, hashC, "fetch: fast-forward")
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	want = hashB + " " + hashC + " A U Thor <author@example.com> 1700000000 +0000\tfetch: fast-forward\n"
+	if data, err := os.ReadFile(s.logPath("refs/heads/feature")); err != nil || string(data) != want {
+		t.Errorf("reflog of refs/heads/feature = %q, %v; want %q", data, err, want)
+	}
+
+	tx = s.Transaction()
+	tx.SetReflog(committer, "branch: deleted")
+	tx.Delete("refs/heads/main", hashB)
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(s.logPath("refs/heads/main")); !os.IsNotExist(err) {
+		t.Errorf("reflog of a deleted ref survived: %v", err)
+	}
+}
@@ -0,0 +1,49 @@
+package revlist
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/codecrafters-io/git-starter-go/pack"
+	"github.com/codecrafters-io/git-starter-go/storage"
+)
+
+// WritePack writes objects from store to w as a pack stream, using
+// OFS_DELTA compression as configured by opts. It returns the written
+// objects in pack order and the pack checksum.
+func WritePack(w io.Writer, store storage.ObjectStore, objects []Entry, opts pack.BuildOptions) ([]*pack.ObjectInfo, []byte, error) {
+	build := make([]pack.BuildObject, len(objects))
+	for i, obj := range objects {
+		build[i] = pack.BuildObject{ID: obj.Hash, NameHash: pack.NameHash(obj.Path)}
+	}
+	return pack.Build(w, store.Format(), build, storeSource{store}, opts)
+}
+
+// storeSource reads the objects packed by WritePack from an object store.
+type storeSource struct {
+	store storage.ObjectStore
+}
+
+func (s storeSource) Stat(id string) (pack.ObjectType, int64, error) {
+	t, size, err := s.store.Stat(id)
+	if err != nil {
+		return 0, 0, fmt.Errorf("%w: %s", err, id)
+	}
+	return pack.ObjectType(t), size, nil
+}
+
+func (s storeSource) Load(id string) (pack.ObjectType, []byte, error) {
+	t, content, err := s.store.Get(id)
+	if err != nil {
+		return 0, nil, fmt.Errorf("%w: %s", err, id)
+	}
+	return pack.ObjectType(t), content, nil
+}
+
+func (s storeSource) Open(id string) (pack.ObjectType, int64, io.ReadCloser, error) {
+	t, size, r, err := s.store.Open(id)
+	if err != nil {
+		return 0, 0, nil, fmt.Errorf("%w: %s", err, id)
+	}
+	return pack.ObjectType(t), size, r, nil
+}
@@ -0,0 +1,377 @@
+// Package revlist walks commit history and selects the objects to
+// transfer between repositories.
+package revlist
+
+import (
+	"container/heap"
+	"errors"
+	"fmt"
+
+	"github.com/codecrafters-io/git-starter-go/object"
+	"github.com/codecrafters-io/git-starter-go/storage"
+)
+
+// Entry is an object selected for packing. Path is the tree path it
+// was first reached by, used to group similar objects.
+type Entry struct {
+	Hash string
+	Type object.Type
+	Path string
+}
+
+// objectWalker collects the objects reachable from a set of tips,
+// skipping everything already marked as seen.
+type objectWalker struct {
+	store   storage.ObjectStore
+	seen    map[string]bool
+	objects []Entry
+
+	// pendingTrees are trees and blobs pointed at directly by tags.
+	pendingTrees []string
+}
+
+// Objects returns the objects reachable from include but not from
+// exclude: commits first, then annotated tags, trees and blobs. Exclude
+// tips missing from the store are ignored. The parents of commits in
+// shallow, the boundary of a shallow repository, are not followed.
+func Objects(store storage.ObjectStore, include, exclude []string, shallow map[string]bool) ([]Entry, error) {
+	ow := &objectWalker{store: store, seen: make(map[string]bool)}
+
+	excludeCommits, err := ow.peelTips(exclude, false)
+	if err != nil {
+		return nil, err
+	}
+	uninteresting := make(map[string]bool)
+	queue := append([]string(nil), excludeCommits...)
+	for _, hash := range queue {
+		uninteresting[hash] = true
+	}
+	for len(queue) > 0 {
+		hash := queue[0]
+		queue = queue[1:]
+		commit, err := readCommit(store, hash)
+		if errors.Is(err, storage.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, parent := range commit.Parents {
+			if !uninteresting[parent] {
+				uninteresting[parent] = true
+				queue = append(queue, parent)
+			}
+		}
+	}
+
+	includeCommits, err := ow.peelTips(include, true)
+	if err != nil {
+		return nil, err
+	}
+	tags := ow.objects
+	ow.objects = nil
+
+	var commits []*object.Commit
+	var boundary []string
+	queue = nil
+	for _, hash := range includeCommits {
+		if !uninteresting[hash] && !ow.seen[hash] {
+			ow.seen[hash] = true
+			queue = append(queue, hash)
+		}
+	}
+	for len(queue) > 0 {
+		hash := queue[0]
+		queue = queue[1:]
+		commit, err := readCommit(store, hash)
+		if err != nil {
+			return nil, err
+		}
+		ow.objects = append(ow.objects, Entry{Hash: hash, Type: object.TypeCommit})
+		commits = append(commits, commit)
+		if shallow[hash] {
+			continue
+		}
+		for _, parent := range commit.Parents {
+			if uninteresting[parent] {
+				boundary = append(boundary, parent)
+			} else if !ow.seen[parent] {
+				ow.seen[parent] = true
+				queue = append(queue, parent)
+			}
+		}
+	}
+	ow.objects = append(ow.objects, tags...)
+
+	// Trees of the excluded tips and of the boundary commits are assumed
+	// to be present on the other side.
+	marked := len(ow.objects)
+	for _, hash := range append(excludeCommits, boundary...) {
+		commit, err := readCommit(store, hash)
+		if errors.Is(err, storage.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := ow.walkTree(commit.Tree, ""); err != nil {
+			return nil, err
+		}
+	}
+	ow.objects = ow.objects[:marked]
+
+	for _, commit := range commits {
+		if err := ow.walkTree(commit.Tree, ""); err != nil {
+			return nil, err
+		}
+	}
+	for _, tip := range ow.pendingTrees {
+		if err := ow.walkTree(tip, ""); err != nil {
+			return nil, err
+		}
+	}
+	return ow.objects, nil
+}
+
+// peelTips resolves annotated tags among tips down to commits. Tags met
+// on the way are recorded if record is set; tags of trees and blobs are
+// queued for walking. Missing tips are an error only when recording.
+func (ow *objectWalker) peelTips(tips []string, record bool) ([]string, error) {
+	var commits []string
+	for _, hash := range tips {
+		for {
+			objType, content, err := ow.store.Get(hash)
+			if errors.Is(err, storage.ErrNotFound) && !record {
+				break
+			}
+			if err != nil {
+				return nil, fmt.Errorf("%w: %s", err, hash)
+			}
+			if objType != object.TypeTag {
+				switch objType {
+				case object.TypeCommit:
+					commits = append(commits, hash)
+				case object.TypeTree, object.TypeBlob:
+					if record {
+						ow.pendingTrees = append(ow.pendingTrees, hash)
+					}
+				}
+				break
+			}
+
+			if record && !ow.seen[hash] {
+				ow.seen[hash] = true
+				ow.objects = append(ow.objects, Entry{Hash: hash, Type: object.TypeTag})
+			}
+			tag, err := object.ParseTag(content)
+			if err != nil {
+				return nil, fmt.Errorf("error parsing tag %s: %w", hash, err)
+			}
+			hash = tag.Object
+		}
+	}
+	return commits, nil
+}
+
+// walkTree adds the tree hash and everything below it that has not been
+// seen yet. hash may also name a blob.
+func (ow *objectWalker) walkTree(hash, path string) error {
+	if ow.seen[hash] {
+		return nil
+	}
+	ow.seen[hash] = true
+
+	objType, content, err := ow.store.Get(hash)
+	if err != nil {
+		return fmt.Errorf("%w: %s", err, hash)
+	}
+	ow.objects = append(ow.objects, Entry{Hash: hash, Type: objType, Path: path})
+	if objType != object.TypeTree {
+		return nil
+	}
+
+	tree, err := object.ParseTree(content, ow.store.Format())
+	if err != nil {
+		return fmt.Errorf("error parsing tree %s: %w", hash, err)
+	}
+	for _, entry := range tree.Entries {
+		entryPath := entry.Name
+		if path != "" {
+			entryPath = path + "/" + entry.Name
+		}
+		switch {
+		case entry.Mode == object.ModeGitlink:
+			continue
+		case entry.Mode.IsDir():
+			if err := ow.walkTree(entry.Hash, entryPath); err != nil {
+				return err
+			}
+		case !ow.seen[entry.Hash]:
+			ow.seen[entry.Hash] = true
+			ow.objects = append(ow.objects, Entry{Hash: entry.Hash, Type: object.TypeBlob, Path: entryPath})
+		}
+	}
+	return nil
+}
+
+// readCommit reads and parses the commit hash.
+func readCommit(store storage.ObjectStore, hash string) (*object.Commit, error) {
+	objType, content, err := store.Get(hash)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", err, hash)
+	}
+	if objType != object.TypeCommit {
+		return nil, fmt.Errorf("object %s is a %s, not a commit", hash, objType)
+	}
+	commit, err := object.ParseCommit(content)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing commit %s: %w", hash, err)
+	}
+	return commit, nil
+}
+
+// IsAncestor reports whether ancestor is reachable from commit. Missing
+// parents, as found at a shallow boundary, end the walk.
+func IsAncestor(store storage.ObjectStore, ancestor, commit string) (bool, error) {
+	seen := map[string]bool{commit: true}
+	queue := []string{commit}
+	for len(queue) > 0 {
+		hash := queue[0]
+		queue = queue[1:]
+		if hash == ancestor {
+			return true, nil
+		}
+
+		c, err := readCommit(store, hash)
+		if errors.Is(err, storage.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+		for _, parent := range c.Parents {
+			if !seen[parent] {
+				seen[parent] = true
+				queue = append(queue, parent)
+			}
+		}
+	}
+	return false, nil
+}
+
+// AheadBehind counts the commits reachable from a but not from b, and
+// those reachable from b but not from a. Like git it walks both
+// histories newest first and stops once every commit left to visit is
+// reachable from both, so history below the merge base is not read.
+func AheadBehind(store storage.ObjectStore, a, b string) (int, int, error) {
+	const (
+		fromA = 1 << iota
+		fromB
+		fromBoth = fromA | fromB
+	)
+	flags := make(map[string]int)
+	commits := make(map[string]*object.Commit)
+	var queue commitQueue
+	order := 0
+	// paint adds f to the flags of hash and queues it to pass them on to
+	// its parents, unless it has them already.
+	paint := func(hash string, f int) error {
+		if flags[hash]&f == f {
+			return nil
+		}
+		flags[hash] |= f
+		c, ok := commits[hash]
+		if !ok {
+			var err error
+			c, err = readCommit(store, hash)
+			if errors.Is(err, storage.ErrNotFound) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			commits[hash] = c
+		}
+		heap.Push(&queue, queuedCommit{hash: hash, commit: c, order: order})
+		order++
+		return nil
+	}
+	if err := paint(a, fromA); err != nil {
+		return 0, 0, err
+	}
+	if err := paint(b, fromB); err != nil {
+		return 0, 0, err
+	}
+
+	for queueHasUnshared(queue, flags, fromBoth) {
+		next := heap.Pop(&queue).(queuedCommit)
+		for _, parent := range next.commit.Parents {
+			if err := paint(parent, flags[next.hash]); err != nil {
+				return 0, 0, err
+			}
+		}
+	}
+	// With equal or skewed dates a commit can be passed on before it is
+	// known to be shared. The commits left only hand their flags down to
+	// history already visited, which puts that right without reading
+	// anything below the merge base.
+	for queue.Len() > 0 {
+		next := heap.Pop(&queue).(queuedCommit)
+		for _, parent := range next.commit.Parents {
+			if flags[parent] == 0 {
+				continue
+			}
+			if err := paint(parent, flags[next.hash]); err != nil {
+				return 0, 0, err
+			}
+		}
+	}
+
+	ahead, behind := 0, 0
+	for _, f := range flags {
+		switch f {
+		case fromA:
+			ahead++
+		case fromB:
+			behind++
+		}
+	}
+	return ahead, behind, nil
+}
+
+// queueHasUnshared reports whether any queued commit lacks one of the
+// both flags.
+func queueHasUnshared(queue commitQueue, flags map[string]int, both int) bool {
+	for _, q := range queue {
+		if flags[q.hash] != both {
+			return true
+		}
+	}
+	return false
+}
+
+// reachableCommits returns the commits reachable from tip, stopping at
+// missing parents like IsAncestor.
+func reachableCommits(store storage.ObjectStore, tip string) (map[string]bool, error) {
+	seen := map[string]bool{tip: true}
+	queue := []string{tip}
+	for len(queue) > 0 {
+		hash := queue[0]
+		queue = queue[1:]
+
+		c, err := readCommit(store, hash)
+		if errors.Is(err, storage.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, parent := range c.Parents {
+			if !seen[parent] {
+				seen[parent] = true
+				queue = append(queue, parent)
+			}
+		}
+	}
+	return seen, nil
+}
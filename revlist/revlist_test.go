@@ -0,0 +1,224 @@
+package revlist
+
+import (
+	"bytes"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/codecrafters-io/git-starter-go/object"
+	"github.com/codecrafters-io/git-starter-go/pack"
+	"github.com/codecrafters-io/git-starter-go/storage"
+)
+
+// history stores commits, each with a tree holding one file, and
+// returns their IDs by name.
+type history struct {
+	t     *testing.T
+	store *storage.MemoryStore
+	ids   map[string]string
+	// dated gives each commit a later date than the one before;
+	// otherwise they all share one.
+	dated bool
+}
+
+func newHistory(t *testing.T) *history {
+	return &history{t: t, store: storage.NewMemoryStore(object.SHA1), ids: make(map[string]string)}
+}
+
+func (h *history) put(obj object.Object) string {
+	h.t.Helper()
+	id, err := storage.PutObject(h.store, obj)
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	return id
+}
+
+// commit stores the commit name with the given parents. Its tree holds
+// dir/name, plus a file shared by every commit.
+func (h *history) commit(name string, parents ...string) {
+	h.t.Helper()
+	shared := h.put(&object.Blob{Data: []byte("shared\n")})
+	blob := h.put(&object.Blob{Data: []byte(name + "\n")})
+	dir := h.put(&object.Tree{Entries: []object.TreeEntry{{Mode: 0100644, Name: name, Hash: blob}}})
+	tree := h.put(&object.Tree{Entries: []object.TreeEntry{
+		{Mode: 040000, Name: "dir", Hash: dir},
+		{Mode: 0100644, Name: "shared", Hash: shared},
+	}})
+	when := time.Unix(1700000000, 0).UTC()
+	if h.dated {
+		when = when.Add(time.Duration(len(h.ids)) * time.Second)
+	}
+	sig := object.Signature{Name: "A U Thor", Email: "author@example.com", When: when}
+	c := &object.Commit{Tree: tree, Author: sig, Committer: sig, Message: name + "\n"}
+	for _, p := range parents {
+		c.Parents = append(c.Parents, h.ids[p])
+	}
+	h.ids[name] = h.put(c)
+}
+
+func (h *history) hashes(names ...string) []string {
+	var ids []string
+	for _, name := range names {
+		ids = append(ids, h.ids[name])
+	}
+	return ids
+}
+
+// testHistory is
+//
+//	a - b - c - m
+//	     \     /
+//	      d - e
+func testHistory(t *testing.T) *history {
+	h := newHistory(t)
+	h.commit("a")
+	h.commit("b", "a")
+	h.commit("c", "b")
+	h.commit("d", "b")
+	h.commit("e", "d")
+	h.commit("m", "c", "e")
+	return h
+}
+
+func TestObjects(t *testing.T) {
+	tests := []struct {
+		name             string
+		include, exclude []string
+		// commits is the number of commits; each brings a commit, two
+		// trees and a blob, and the shared blob comes once.
+		commits int
+	}{
+		{"everything", []string{"m"}, nil, 6},
+		{"one commit", []string{"a"}, nil, 1},
+		{"range", []string{"m"}, []string{"c"}, 3},
+		{"side branch", []string{"e"}, []string{"c"}, 2},
+		{"excluded tip", []string{"c"}, []string{"m"}, 0},
+		{"several tips", []string{"c", "e"}, []string{"a"}, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := testHistory(t)
+			objects, err := Objects(h.store, h.hashes(tt.include...), h.hashes(tt.exclude...), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := tt.commits * 4
+			if tt.commits > 0 && len(tt.exclude) == 0 {
+				want++
+			}
+			if len(objects) != want {
+				t.Fatalf("%d objects, want %d", len(objects), want)
+			}
+			seen := make(map[string]bool)
+			commitsDone := false
+			for _, e := range objects {
+				if seen[e.Hash] {
+					t.Errorf("%s listed twice", e.Hash)
+				}
+				seen[e.Hash] = true
+				if e.Type != object.TypeCommit {
+					commitsDone = true
+				} else if commitsDone {
+					t.Errorf("commit %s listed after other objects", e.Hash)
+				}
+			}
+		})
+	}
+}
+
+func TestAncestry(t *testing.T) {
+	tests := []struct {
+		a, b          string
+		isAncestor    bool
+		ahead, behind int
+	}{
+		{"a", "m", true, 0, 5},
+		{"m", "a", false, 5, 0},
+		{"c", "e", false, 1, 2},
+		{"d", "m", true, 0, 3},
+		{"m", "m", true, 0, 0},
+	}
+	h := testHistory(t)
+	for _, tt := range tests {
+		ok, err := IsAncestor(h.store, h.ids[tt.a], h.ids[tt.b])
+		if err != nil || ok != tt.isAncestor {
+			t.Errorf("IsAncestor(%s, %s) = %v, %v; want %v", tt.a, tt.b, ok, err, tt.isAncestor)
+		}
+		ahead, behind, err := AheadBehind(h.store, h.ids[tt.a], h.ids[tt.b])
+		if err != nil || ahead != tt.ahead || behind != tt.behind {
+			t.Errorf("AheadBehind(%s, %s) = %d, %d, %v; want %d, %d", tt.a, tt.b, ahead, behind, err, tt.ahead, tt.behind)
+		}
+	}
+}
+
+// readLog records the objects read from a store.
+type readLog struct {
+	storage.ObjectStore
+	read map[string]bool
+}
+
+func (r *readLog) Get(id string) (object.Type, []byte, error) {
+	r.read[id] = true
+	return r.ObjectStore.Get(id)
+}
+
+func TestAheadBehindStopsAtMergeBase(t *testing.T) {
+	h := newHistory(t)
+	h.dated = true
+	h.commit("r0")
+	prev := "r0"
+	for _, name := range []string{"r1", "r2", "r3", "base"} {
+		h.commit(name, prev)
+		prev = name
+	}
+	h.commit("x", "base")
+	h.commit("y", "base")
+	h.commit("y2", "y")
+
+	store := &readLog{ObjectStore: h.store, read: make(map[string]bool)}
+	ahead, behind, err := AheadBehind(store, h.ids["x"], h.ids["y2"])
+	if err != nil || ahead != 1 || behind != 2 {
+		t.Fatalf("AheadBehind(x, y2) = %d, %d, %v; want 1, 2", ahead, behind, err)
+	}
+	for _, name := range []string{"r0", "r1", "r2", "r3"} {
+		if store.read[h.ids[name]] {
+			t.Errorf("read %s, below the merge base", name)
+		}
+	}
+}
+
+func TestWritePack(t *testing.T) {
+	h := testHistory(t)
+	objects, err := Objects(h.store, h.hashes("m"), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	written, _, err := WritePack(&buf, h.store, objects, pack.DefaultBuildOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	indexed, _, err := pack.IndexPack(bytes.NewReader(buf.Bytes()), int64(buf.Len()), object.SHA1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want, got []string
+	for _, e := range objects {
+		want = append(want, e.Hash)
+	}
+	for _, info := range indexed {
+		got = append(got, info.ID)
+	}
+	sort.Strings(want)
+	if len(written) != len(objects) || len(got) != len(want) {
+		t.Fatalf("pack holds %d objects, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("pack object %d is %s, want %s", i, got[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package revlist
+
+import (
+	"container/heap"
+	"errors"
+	"io"
+
+	"github.com/codecrafters-io/git-starter-go/object"
+	"github.com/codecrafters-io/git-starter-go/storage"
+)
+
+// Walker yields the commits reachable from a set of tips, newest
+// committer date first, as git rev-list does by default. Each commit is
+// returned once.
+type Walker struct {
+	// FirstParent follows only the first parent of merges.
+	FirstParent bool
+	// ParentFilter, if set, chooses which of a commit's parents the walk
+	// goes on to, as history simplification does. It sees the parents
+	// left after FirstParent.
+	ParentFilter func(hash string, c *object.Commit, parents []string) ([]string, error)
+
+	store storage.ObjectStore
+	queue commitQueue
+	seen  map[string]bool
+	order int
+}
+
+func NewWalker(store storage.ObjectStore) *Walker {
+	return &Walker{store: store, seen: make(map[string]bool)}
+}
+
+// Push adds the commit hash as a starting point.
+func (w *Walker) Push(hash string) error {
+	if w.seen[hash] {
+		return nil
+	}
+	c, err := readCommit(w.store, hash)
+	if err != nil {
+		return err
+	}
+	w.seen[hash] = true
+	w.enqueue(hash, c)
+	return nil
+}
+
+// Hide excludes the commits reachable from hash from the walk, as ^hash
+// does for git rev-list. It must be called before Push.
+func (w *Walker) Hide(hash string) error {
+	hidden, err := reachableCommits(w.store, hash)
+	if err != nil {
+		return err
+	}
+	for h := range hidden {
+		w.seen[h] = true
+	}
+	return nil
+}
+
+func (w *Walker) enqueue(hash string, c *object.Commit) {
+	heap.Push(&w.queue, queuedCommit{hash: hash, commit: c, order: w.order})
+	w.order++
+}
+
+// Next returns the next commit, or io.EOF once the walk is done.
+// Parents missing from the store, as at a shallow boundary, end their
+// line of history.
+func (w *Walker) Next() (string, *object.Commit, error) {
+	if w.queue.Len() == 0 {
+		return "", nil, io.EOF
+	}
+	next := heap.Pop(&w.queue).(queuedCommit)
+	parents := next.commit.Parents
+	if w.FirstParent && len(parents) > 1 {
+		parents = parents[:1]
+	}
+	if w.ParentFilter != nil {
+		var err error
+		if parents, err = w.ParentFilter(next.hash, next.commit, parents); err != nil {
+			return "", nil, err
+		}
+	}
+	for _, parent := range parents {
+		if w.seen[parent] {
+			continue
+		}
+		w.seen[parent] = true
+		c, err := readCommit(w.store, parent)
+		if errors.Is(err, storage.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return "", nil, err
+		}
+		w.enqueue(parent, c)
+	}
+	return next.hash, next.commit, nil
+}
+
+type queuedCommit struct {
+	hash   string
+	commit *object.Commit
+	// order breaks ties between equal dates in favour of the commit
+	// queued first.
+	order int
+}
+
+// commitQueue is a max-heap of commits by committer date.
+type commitQueue []queuedCommit
+
+func (q commitQueue) Len() int { return len(q) }
+
+func (q commitQueue) Less(i, j int) bool {
+	ti, tj := q[i].commit.Committer.When, q[j].commit.Committer.When
+	if !ti.Equal(tj) {
+		return ti.After(tj)
+	}
+	return q[i].order < q[j].order
+}
+
+func (q commitQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *commitQueue) Push(x any) { *q = append(*q, x.(queuedCommit)) }
+
+func (q *commitQueue) Pop() any {
+	old := *q
+	item := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return item
+}
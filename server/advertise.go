@@ -0,0 +1,34 @@
+package server
+
+import (
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/object"
+	"github.com/codecrafters-io/git-starter-go/pktline"
+	"github.com/codecrafters-io/git-starter-go/transport"
+)
+
+const agent = "agent=mygit/1.0"
+
+// writeAdvertisement writes a protocol v0 ref advertisement: the refs
+// with capabilities after the first one, peeled tags and a flush. The
+// object format f is added to the capabilities.
+func writeAdvertisement(w *pktline.Writer, f *object.Format, refs []transport.Ref, caps []string) error {
+	capList := strings.Join(append(caps, "object-format="+f.Name), " ")
+	if len(refs) == 0 {
+		w.Writef("%s capabilities^{}\x00%s\n", f.ZeroID(), capList)
+		return w.Flush()
+	}
+
+	for i, ref := range refs {
+		if i == 0 {
+			w.Writef("%s %s\x00%s\n", ref.Hash, ref.Name, capList)
+		} else {
+			w.Writef("%s %s\n", ref.Hash, ref.Name)
+		}
+		if ref.Peeled != "" {
+			w.Writef("%s %s^{}\n", ref.Peeled, ref.Name)
+		}
+	}
+	return w.Flush()
+}
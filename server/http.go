@@ -0,0 +1,102 @@
+package server
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/pktline"
+	"github.com/codecrafters-io/git-starter-go/transport"
+)
+
+// Handler serves the repositories below Root over smart HTTP, like git
+// http-backend. A request for /team/app.git/info/refs is answered from
+// Root/team/app.git.
+type Handler struct {
+	Root string
+	// ReceivePack enables pushing, which is off by default as with
+	// git's http.receivepack.
+	ReceivePack bool
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	urlPath := path.Clean("/" + req.URL.Path)
+
+	var repoPath, service string
+	advertise := false
+	switch {
+	case strings.HasSuffix(urlPath, "/info/refs") && (req.Method == http.MethodGet || req.Method == http.MethodHead):
+		repoPath = strings.TrimSuffix(urlPath, "/info/refs")
+		service = req.URL.Query().Get("service")
+		advertise = true
+	case strings.HasSuffix(urlPath, "/"+transport.UploadPackService) && req.Method == http.MethodPost:
+		repoPath = strings.TrimSuffix(urlPath, "/"+transport.UploadPackService)
+		service = transport.UploadPackService
+	case strings.HasSuffix(urlPath, "/"+transport.ReceivePackService) && req.Method == http.MethodPost:
+		repoPath = strings.TrimSuffix(urlPath, "/"+transport.ReceivePackService)
+		service = transport.ReceivePackService
+	default:
+		http.NotFound(w, req)
+		return
+	}
+
+	switch service {
+	case transport.UploadPackService:
+	case transport.ReceivePackService:
+		if !h.ReceivePack {
+			http.Error(w, "receive-pack not enabled", http.StatusForbidden)
+			return
+		}
+	default:
+		// Dumb HTTP is not supported.
+		http.Error(w, "service not supported", http.StatusForbidden)
+		return
+	}
+
+	repo, err := Open(filepath.Join(h.Root, filepath.FromSlash(repoPath)))
+	if errors.Is(err, ErrNotRepository) {
+		http.NotFound(w, req)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer repo.Close()
+
+	body := io.Reader(req.Body)
+	if req.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(req.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer gz.Close()
+		body = gz
+	}
+
+	w.Header().Set("Cache-Control", "no-cache, max-age=0, must-revalidate")
+	opts := Options{StatelessRPC: true, AdvertiseRefs: advertise}
+	if advertise {
+		w.Header().Set("Content-Type", "application/x-"+service+"-advertisement")
+		pw := pktline.NewWriter(w)
+		pw.Writef("# service=%s\n", service)
+		pw.Flush()
+	} else {
+		w.Header().Set("Content-Type", "application/x-"+service+"-result")
+	}
+
+	if service == transport.UploadPackService {
+		err = UploadPack(repo, body, w, opts)
+	} else {
+		err = ReceivePack(repo, body, w, opts)
+	}
+	if err != nil {
+		log.Printf("%s %s: %s", service, repoPath, err)
+	}
+}
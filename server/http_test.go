@@ -0,0 +1,269 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/codecrafters-io/git-starter-go/object"
+	"github.com/codecrafters-io/git-starter-go/pack"
+	"github.com/codecrafters-io/git-starter-go/refs"
+	"github.com/codecrafters-io/git-starter-go/revlist"
+	"github.com/codecrafters-io/git-starter-go/storage"
+	"github.com/codecrafters-io/git-starter-go/transport"
+)
+
+// testRepo is a bare repository on disk.
+type testRepo struct {
+	objects *storage.DiskStore
+	refs    *refs.Store
+}
+
+func newTestRepo(t *testing.T, gitDir string) *testRepo {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Join(gitDir, "objects"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(gitDir, "HEAD"), []byte("ref: refs/heads/main\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	objects, err := storage.Open(filepath.Join(gitDir, "objects"), object.SHA1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { objects.Close() })
+	return &testRepo{objects: objects, refs: refs.New(gitDir, object.SHA1)}
+}
+
+// commit stores a commit of a tree holding file with content on top of
+// parent, if any.
+func (r *testRepo) commit(t *testing.T, parent, content string) string {
+	t.Helper()
+	blob, err := storage.PutObject(r.objects, &object.Blob{Data: []byte(content)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree, err := storage.PutObject(r.objects, &object.Tree{Entries: []object.TreeEntry{{Mode: 0100644, Name: "file", Hash: blob}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig := object.Signature{Name: "A U Thor", Email: "author@example.com", When: time.Unix(1700000000, 0).UTC()}
+	c := &object.Commit{Tree: tree, Author: sig, Committer: sig, Message: content + "\n"}
+	if parent != "" {
+		c.Parents = []string{parent}
+	}
+	id, err := storage.PutObject(r.objects, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func (r *testRepo) setRef(t *testing.T, name, hash string) {
+	t.Helper()
+	tx := r.refs.Transaction()
+	tx.Update(name, "", hash)
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (r *testRepo) ref(name string) string {
+	_, hash, err := r.refs.Resolve(name)
+	if err != nil {
+		return ""
+	}
+	return hash
+}
+
+// packFor returns a pack of the objects reachable from include but not
+// from exclude.
+func (r *testRepo) packFor(t *testing.T, include, exclude []string) []byte {
+	t.Helper()
+	objects, err := revlist.Objects(r.objects, include, exclude, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if _, _, err := revlist.WritePack(&buf, r.objects, objects, pack.DefaultBuildOptions); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// fetch downloads the objects of wants that local lacks into local.
+func fetch(t *testing.T, client *transport.Client, local *testRepo, wants, haves []string) {
+	t.Helper()
+	adv, err := client.Discover(transport.UploadPackService)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := client.FetchPack(adv, transport.FetchRequest{Wants: wants, Haves: haves})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer result.Pack.Close()
+	if _, err := local.objects.Packs.WritePack(result.Pack); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func push(t *testing.T, client *transport.Client, req transport.PushRequest) *transport.PushResult {
+	t.Helper()
+	adv, err := client.Discover(transport.ReceivePackService)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := client.Push(adv, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.UnpackError != "" {
+		t.Fatalf("unpack failed: %s", result.UnpackError)
+	}
+	return result
+}
+
+func TestHTTPRoundTrip(t *testing.T) {
+	for _, version := range []int{0, 2} {
+		t.Run(fmt.Sprintf("protocol v%d", version), func(t *testing.T) {
+			root := t.TempDir()
+			remote := newTestRepo(t, filepath.Join(root, "repo.git"))
+			c1 := remote.commit(t, "", "one")
+			c2 := remote.commit(t, c1, "two")
+			remote.setRef(t, "refs/heads/main", c2)
+
+			srv := httptest.NewServer(&Handler{Root: root, ReceivePack: true})
+			defer srv.Close()
+			client := transport.NewClient(srv.URL + "/repo.git")
+			client.ProtocolVersion = version
+
+			// Clone.
+			adv, err := client.Discover(transport.UploadPackService)
+			if err != nil {
+				t.Fatal(err)
+			}
+			remoteRefs, err := client.ListRefs(adv, "refs/heads/")
+			if err != nil {
+				t.Fatal(err)
+			}
+			main, ok := transport.FindRef(remoteRefs, "refs/heads/main")
+			if !ok || main.Hash != c2 {
+				t.Fatalf("advertised main = %+v, want %s", main, c2)
+			}
+			local := newTestRepo(t, filepath.Join(t.TempDir(), "local.git"))
+			fetch(t, client, local, []string{c2}, nil)
+			if objects, err := revlist.Objects(local.objects, []string{c2}, nil, nil); err != nil || len(objects) != 6 {
+				t.Fatalf("clone has %d objects of main, %v; want 6", len(objects), err)
+			}
+
+			// Fetch a new commit.
+			c3 := remote.commit(t, c2, "three")
+			remote.setRef(t, "refs/heads/main", c3)
+			fetch(t, client, local, []string{c3}, []string{c2})
+			if !local.objects.Has(c3) {
+				t.Fatal("fetch did not bring the new commit")
+			}
+
+			// Push a commit on top.
+			c4 := local.commit(t, c3, "four")
+			result := push(t, client, transport.PushRequest{
+				Commands: []transport.RefCommand{{Name: "refs/heads/main", Old: c3, New: c4}},
+				Pack:     bytes.NewReader(local.packFor(t, []string{c4}, []string{c3})),
+			})
+			if len(result.Refs) != 1 || result.Refs[0].Error != "" {
+				t.Fatalf("push result %+v", result.Refs)
+			}
+			if got := remote.ref("refs/heads/main"); got != c4 {
+				t.Fatalf("remote main = %s after push, want %s", got, c4)
+			}
+
+			// Delete a branch.
+			remote.setRef(t, "refs/heads/old", c1)
+			result = push(t, client, transport.PushRequest{
+				Commands: []transport.RefCommand{{Name: "refs/heads/old", Old: c1, New: object.SHA1.ZeroID()}},
+			})
+			if len(result.Refs) != 1 || result.Refs[0].Error != "" || remote.ref("refs/heads/old") != "" {
+				t.Fatalf("delete push result %+v, remote ref %q", result.Refs, remote.ref("refs/heads/old"))
+			}
+		})
+	}
+}
+
+func TestHTTPPushStatuses(t *testing.T) {
+	zero := object.SHA1.ZeroID()
+	tests := []struct {
+		name   string
+		atomic bool
+		// stale makes the update of main expect an old value it no
+		// longer has.
+		stale bool
+		// badName, if set, replaces the name of main.
+		badName     string
+		wantStatus  []string
+		wantFeature bool
+	}{
+		{"ok", false, false, "", []string{"", ""}, true},
+		{"atomic ok", true, false, "", []string{"", ""}, true},
+		{"stale", false, true, "", []string{"", "*"}, true},
+		{"atomic stale", true, true, "", []string{"atomic transaction failed", "atomic transaction failed"}, false},
+		{"funny refname", false, false, "refs/heads/bad..name", []string{"", "funny refname"}, true},
+		{"lock suffix", false, false, "refs/heads/main.lock", []string{"", "funny refname"}, true},
+		{"reflog syntax", false, false, "refs/heads/main@{1}", []string{"", "funny refname"}, true},
+		{"atomic funny refname", true, false, "refs/heads/bad..name", []string{"atomic push failure", "funny refname"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			remote := newTestRepo(t, filepath.Join(root, "repo.git"))
+			c1 := remote.commit(t, "", "one")
+			c2 := remote.commit(t, c1, "two")
+			remote.setRef(t, "refs/heads/main", c2)
+
+			srv := httptest.NewServer(&Handler{Root: root, ReceivePack: true})
+			defer srv.Close()
+			client := transport.NewClient(srv.URL + "/repo.git")
+
+			local := newTestRepo(t, filepath.Join(t.TempDir(), "local.git"))
+			fetch(t, client, local, []string{c2}, nil)
+			c3 := local.commit(t, c2, "three")
+
+			mainCmd := transport.RefCommand{Name: "refs/heads/main", Old: c2, New: c3}
+			if tt.stale {
+				mainCmd.Old = c1
+			}
+			if tt.badName != "" {
+				mainCmd.Name = tt.badName
+			}
+			result := push(t, client, transport.PushRequest{
+				Commands: []transport.RefCommand{{Name: "refs/heads/feature", Old: zero, New: c3}, mainCmd},
+				Pack:     bytes.NewReader(local.packFor(t, []string{c3}, []string{c2})),
+				Atomic:   tt.atomic,
+			})
+
+			if len(result.Refs) != len(tt.wantStatus) {
+				t.Fatalf("push result %+v", result.Refs)
+			}
+			for i, want := range tt.wantStatus {
+				got := result.Refs[i].Error
+				if (want == "*" && got == "") || (want != "*" && got != want) {
+					t.Errorf("status of %s = %q, want %q", result.Refs[i].Name, got, want)
+				}
+			}
+			if got := remote.ref("refs/heads/feature") != ""; got != tt.wantFeature {
+				t.Errorf("feature created = %v, want %v", got, tt.wantFeature)
+			}
+			wantMain := c2
+			if tt.wantStatus[1] == "" {
+				wantMain = c3
+			}
+			if got := remote.ref("refs/heads/main"); got != wantMain {
+				t.Errorf("remote main = %s, want %s", got, wantMain)
+			}
+		})
+	}
+}
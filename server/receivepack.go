@@ -0,0 +1,172 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/object"
+	"github.com/codecrafters-io/git-starter-go/pktline"
+	"github.com/codecrafters-io/git-starter-go/refs"
+	"github.com/codecrafters-io/git-starter-go/transport"
+)
+
+// ReceivePack serves a push to repo: it advertises the refs, stores the
+// pack sent by the client and applies the ref update commands,
+// reporting the outcome of each.
+func ReceivePack(repo *Repository, r io.Reader, w io.Writer, opts Options) error {
+	pw := pktline.NewWriter(w)
+	if opts.AdvertiseRefs || !opts.StatelessRPC {
+		refs, err := repo.Refs()
+		if err != nil {
+			return err
+		}
+		// HEAD is not pushed to, so only the refs are advertised.
+		if len(refs) > 0 && refs[0].Name == "HEAD" {
+			refs = refs[1:]
+		}
+		caps := []string{"report-status", "delete-refs", "side-band-64k", "quiet", "atomic", "no-thin", "ofs-delta", agent}
+		if err := writeAdvertisement(pw, repo.Objects.Format(), refs, caps); err != nil {
+			return err
+		}
+		if opts.AdvertiseRefs {
+			return nil
+		}
+	}
+
+	br := bufio.NewReader(r)
+	pr := pktline.NewReader(br)
+	var commands []transport.RefCommand
+	caps := make(map[string]bool)
+	for {
+		line, err := pr.ReadLine()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("error reading commands: %w", err)
+		}
+		line, capList, _ := strings.Cut(line, "\x00")
+		if len(commands) == 0 {
+			for _, c := range strings.Fields(capList) {
+				caps[c] = true
+			}
+		}
+		// The ref name is the rest of the line, so that a name with a
+		// space in it is rejected as funny rather than misparsed.
+		fields := strings.SplitN(line, " ", 3)
+		if len(fields) != 3 || !repo.Objects.Format().ValidID(fields[0]) || !repo.Objects.Format().ValidID(fields[1]) {
+			return fmt.Errorf("protocol error: expected old/new/ref, got '%s'", line)
+		}
+		commands = append(commands, transport.RefCommand{Old: fields[0], New: fields[1], Name: fields[2]})
+	}
+	if len(commands) == 0 {
+		return nil
+	}
+
+	unpackErr := ""
+	for _, cmd := range commands {
+		if !object.IsZeroID(cmd.New) {
+			if _, err := repo.Objects.Packs.WritePack(br); err != nil {
+				unpackErr = err.Error()
+			}
+			break
+		}
+	}
+
+	statuses := make([]string, len(commands))
+	if unpackErr != "" {
+		for i := range commands {
+			statuses[i] = "unpacker error"
+		}
+	} else {
+		statuses = applyCommands(repo, commands, caps["atomic"])
+	}
+
+	if !caps["report-status"] {
+		return nil
+	}
+	var report bytes.Buffer
+	rw := pktline.NewWriter(&report)
+	if unpackErr != "" {
+		rw.Writef("unpack %s\n", unpackErr)
+	} else {
+		rw.WriteString("unpack ok\n")
+	}
+	for i, cmd := range commands {
+		if statuses[i] == "" {
+			rw.Writef("ok %s\n", cmd.Name)
+		} else {
+			rw.Writef("ng %s %s\n", cmd.Name, statuses[i])
+		}
+	}
+	rw.Flush()
+
+	if !caps["side-band-64k"] {
+		_, err := w.Write(report.Bytes())
+		return err
+	}
+	if _, err := pktline.NewSidebandWriter(pw, 1, pktline.MaxPayload-1).Write(report.Bytes()); err != nil {
+		return err
+	}
+	return pw.Flush()
+}
+
+// applyCommands checks and applies the ref updates, returning the error
+// for each command or "" on success. With atomic set either all
+// commands are applied or none.
+func applyCommands(repo *Repository, commands []transport.RefCommand, atomic bool) []string {
+	statuses := make([]string, len(commands))
+	failed := false
+	for i, cmd := range commands {
+		statuses[i] = checkCommand(repo, cmd)
+		if statuses[i] != "" {
+			failed = true
+		}
+	}
+	if atomic && failed {
+		for i := range statuses {
+			if statuses[i] == "" {
+				statuses[i] = "atomic push failure"
+			}
+		}
+		return statuses
+	}
+	if atomic {
+		if err := repo.UpdateRefs(commands); err != nil {
+			for i := range statuses {
+				statuses[i] = "atomic transaction failed"
+			}
+		}
+		return statuses
+	}
+
+	for i, cmd := range commands {
+		if statuses[i] != "" {
+			continue
+		}
+		if err := repo.UpdateRef(cmd.Name, cmd.Old, cmd.New); err != nil {
+			statuses[i] = err.Error()
+		}
+	}
+	return statuses
+}
+
+// checkCommand validates a ref update before anything is changed.
+func checkCommand(repo *Repository, cmd transport.RefCommand) string {
+	if !strings.HasPrefix(cmd.Name, "refs/") || !refs.ValidName(cmd.Name) {
+		return "funny refname"
+	}
+	if !object.IsZeroID(cmd.New) && !repo.Objects.Has(cmd.New) {
+		return "missing necessary objects"
+	}
+	if !repo.Bare && cmd.Name == repo.HeadTarget() {
+		if object.IsZeroID(cmd.New) {
+			return "deletion of the current branch prohibited"
+		}
+		return "branch is currently checked out"
+	}
+	return ""
+}
@@ -0,0 +1,177 @@
+// Package server implements the server side of git's smart protocols:
+// upload-pack for fetches, receive-pack for pushes and an HTTP handler
+// in the style of git http-backend.
+package server
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/object"
+	"github.com/codecrafters-io/git-starter-go/refs"
+	"github.com/codecrafters-io/git-starter-go/storage"
+	"github.com/codecrafters-io/git-starter-go/transport"
+
+	"gopkg.in/ini.v1"
+)
+
+// ErrNotRepository is returned by Open for paths that hold no repository.
+var ErrNotRepository = errors.New("not a git repository")
+
+// Repository is a repository being served.
+type Repository struct {
+	GitDir  string
+	Bare    bool
+	Objects *storage.DiskStore
+
+	refs *refs.Store
+}
+
+// Open opens the bare repository at path, or the repository whose
+// working tree is at path.
+func Open(path string) (*Repository, error) {
+	repo := &Repository{GitDir: path, Bare: true}
+	if !isGitDir(path) {
+		repo = &Repository{GitDir: filepath.Join(path, ".git")}
+		if !isGitDir(repo.GitDir) {
+			return nil, fmt.Errorf("%w: %s", ErrNotRepository, path)
+		}
+	}
+
+	format, err := readObjectFormat(repo.GitDir)
+	if err != nil {
+		return nil, err
+	}
+	objects, err := storage.Open(filepath.Join(repo.GitDir, "objects"), format)
+	if err != nil {
+		return nil, err
+	}
+	repo.Objects = objects
+	repo.refs = refs.New(repo.GitDir, format)
+	return repo, nil
+}
+
+// readObjectFormat returns the object format set by
+// extensions.objectFormat in the repository config.
+func readObjectFormat(gitDir string) (*object.Format, error) {
+	configPath := filepath.Join(gitDir, "config")
+	if _, err := os.Stat(configPath); os.IsNotExist(err) {
+		return object.SHA1, nil
+	}
+	cfg, err := ini.LoadSources(ini.LoadOptions{Insensitive: true, AllowShadows: true}, configPath)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", configPath, err)
+	}
+	name := cfg.Section("extensions").Key("objectformat").String()
+	if name == "" {
+		return object.SHA1, nil
+	}
+	return object.FormatByName(name)
+}
+
+func isGitDir(path string) bool {
+	if info, err := os.Stat(filepath.Join(path, "objects")); err != nil || !info.IsDir() {
+		return false
+	}
+	_, err := os.Stat(filepath.Join(path, "HEAD"))
+	return err == nil
+}
+
+func (r *Repository) Close() error {
+	return r.Objects.Close()
+}
+
+// Refs returns HEAD, if it resolves, followed by all refs sorted by
+// name. Annotated tags carry their peeled object.
+func (r *Repository) Refs() ([]transport.Ref, error) {
+	values, err := r.refs.List("refs/")
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var refList []transport.Ref
+	target, hash, err := r.refs.Resolve("HEAD")
+	switch {
+	case err == nil && target == "HEAD":
+		refList = append(refList, transport.Ref{Name: "HEAD", Hash: hash})
+	case err == nil:
+		refList = append(refList, transport.Ref{Name: "HEAD", Hash: hash, Target: target})
+	case !errors.Is(err, refs.ErrNotFound):
+		return nil, err
+	}
+
+	for _, name := range names {
+		ref := transport.Ref{Name: name, Hash: values[name]}
+		if strings.HasPrefix(name, "refs/tags/") {
+			ref.Peeled = r.peel(ref.Hash)
+		}
+		refList = append(refList, ref)
+	}
+	return refList, nil
+}
+
+// HeadTarget returns the branch HEAD points to, or "" if it is detached.
+func (r *Repository) HeadTarget() string {
+	target, err := r.refs.Head()
+	if err != nil {
+		return ""
+	}
+	return target
+}
+
+// Shallow returns the shallow boundary commits of the repository.
+func (r *Repository) Shallow() map[string]bool {
+	shallow := make(map[string]bool)
+	data, err := os.ReadFile(filepath.Join(r.GitDir, "shallow"))
+	if err != nil {
+		return shallow
+	}
+	for _, hash := range strings.Fields(string(data)) {
+		shallow[hash] = true
+	}
+	return shallow
+}
+
+// peel returns the object an annotated tag ultimately points to, or ""
+// for anything else.
+func (r *Repository) peel(hash string) string {
+	peeled := ""
+	for i := 0; i < 10; i++ {
+		objType, content, err := r.Objects.Get(hash)
+		if err != nil || objType != object.TypeTag {
+			break
+		}
+		tag, err := object.ParseTag(content)
+		if err != nil {
+			break
+		}
+		hash, peeled = tag.Object, tag.Object
+	}
+	return peeled
+}
+
+// UpdateRef moves the ref name from old to new while holding its lock.
+// old and new are the zero ID for a missing ref.
+func (r *Repository) UpdateRef(name, old, new string) error {
+	return r.UpdateRefs([]transport.RefCommand{{Name: name, Old: old, New: new}})
+}
+
+// UpdateRefs applies the commands as a single transaction: either every
+// ref is moved or, if any of them is not at its old value, none is.
+func (r *Repository) UpdateRefs(commands []transport.RefCommand) error {
+	tx := r.refs.Transaction()
+	for _, cmd := range commands {
+		tx.Update(cmd.Name, cmd.Old, cmd.New)
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,208 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/object"
+	"github.com/codecrafters-io/git-starter-go/pack"
+	"github.com/codecrafters-io/git-starter-go/pktline"
+	"github.com/codecrafters-io/git-starter-go/revlist"
+	"github.com/codecrafters-io/git-starter-go/transport"
+)
+
+// Options control how a service talks to the client.
+type Options struct {
+	// StatelessRPC handles a single request of the smart HTTP protocol
+	// instead of a whole conversation.
+	StatelessRPC bool
+	// AdvertiseRefs only writes the ref advertisement.
+	AdvertiseRefs bool
+}
+
+// UploadPack serves a fetch from repo: it advertises the refs, takes
+// part in the have/want negotiation and sends a pack of the objects the
+// client is missing.
+func UploadPack(repo *Repository, r io.Reader, w io.Writer, opts Options) error {
+	pw := pktline.NewWriter(w)
+	refs, err := repo.Refs()
+	if err != nil {
+		return err
+	}
+
+	if opts.AdvertiseRefs || !opts.StatelessRPC {
+		caps := []string{"multi_ack_detailed", "side-band-64k", "side-band", "ofs-delta", "no-progress", "include-tag"}
+		if target := repo.HeadTarget(); target != "" {
+			caps = append(caps, "symref=HEAD:"+target)
+		}
+		caps = append(caps, agent)
+		if err := writeAdvertisement(pw, repo.Objects.Format(), refs, caps); err != nil {
+			return err
+		}
+		if opts.AdvertiseRefs {
+			return nil
+		}
+	}
+
+	advertised := make(map[string]bool)
+	for _, ref := range refs {
+		advertised[ref.Hash] = true
+		if ref.Peeled != "" {
+			advertised[ref.Peeled] = true
+		}
+	}
+
+	pr := pktline.NewReader(r)
+	var wants []string
+	caps := make(map[string]bool)
+	for {
+		line, err := pr.ReadLine()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("error reading wants: %w", err)
+		}
+		rest, ok := strings.CutPrefix(line, "want ")
+		if !ok {
+			return writeError(pw, fmt.Sprintf("upload-pack: protocol error, expected to get want, not '%s'", line))
+		}
+		hash, capList, _ := strings.Cut(rest, " ")
+		if len(wants) == 0 {
+			for _, c := range strings.Fields(capList) {
+				caps[c] = true
+			}
+		}
+		if !advertised[hash] {
+			return writeError(pw, "upload-pack: not our ref "+hash)
+		}
+		wants = append(wants, hash)
+	}
+	if len(wants) == 0 {
+		// The client is already up to date.
+		return nil
+	}
+
+	common, done, err := negotiate(repo, pr, pw, caps, opts.StatelessRPC)
+	if err != nil || !done {
+		return err
+	}
+
+	objects, err := revlist.Objects(repo.Objects, wants, common, repo.Shallow())
+	if err != nil {
+		return err
+	}
+	if caps["include-tag"] {
+		objects = includeTags(refs, objects)
+	}
+	return sendPack(repo, pw, w, objects, caps)
+}
+
+// negotiate reads have lines until the client is done, acknowledging
+// the ones we have. It returns the common objects and whether "done"
+// was received; a stateless request may end before that.
+func negotiate(repo *Repository, pr *pktline.Reader, pw *pktline.Writer, caps map[string]bool, stateless bool) ([]string, bool, error) {
+	multiAck := caps["multi_ack_detailed"]
+	var common []string
+	isCommon := make(map[string]bool)
+	for {
+		t, payload, err := pr.ReadPacket()
+		if err == io.EOF {
+			return common, false, nil
+		}
+		if err != nil {
+			return nil, false, fmt.Errorf("error reading haves: %w", err)
+		}
+
+		if t == pktline.Flush {
+			if err := pw.WriteString("NAK\n"); err != nil {
+				return nil, false, err
+			}
+			if stateless {
+				return common, false, nil
+			}
+			continue
+		}
+
+		line := strings.TrimSuffix(string(payload), "\n")
+		if line == "done" {
+			break
+		}
+		hash, ok := strings.CutPrefix(line, "have ")
+		if !ok {
+			return nil, false, writeError(pw, fmt.Sprintf("upload-pack: protocol error, expected to get have, not '%s'", line))
+		}
+		if isCommon[hash] || !repo.Objects.Has(hash) {
+			continue
+		}
+		isCommon[hash] = true
+		common = append(common, hash)
+		if multiAck {
+			pw.Writef("ACK %s common\n", hash)
+		} else if len(common) == 1 {
+			pw.Writef("ACK %s\n", hash)
+		}
+	}
+
+	switch {
+	case len(common) == 0:
+		return common, true, pw.WriteString("NAK\n")
+	case multiAck:
+		return common, true, pw.Writef("ACK %s\n", common[len(common)-1])
+	}
+	return common, true, nil
+}
+
+// includeTags adds the annotated tags pointing at objects being sent.
+func includeTags(refs []transport.Ref, objects []revlist.Entry) []revlist.Entry {
+	sending := make(map[string]bool, len(objects))
+	for _, obj := range objects {
+		sending[obj.Hash] = true
+	}
+	for _, ref := range refs {
+		if ref.Peeled != "" && sending[ref.Peeled] && !sending[ref.Hash] {
+			sending[ref.Hash] = true
+			objects = append(objects, revlist.Entry{Hash: ref.Hash, Type: object.TypeTag})
+		}
+	}
+	return objects
+}
+
+// sendPack writes the pack, multiplexed on band 1 if the client asked
+// for side-band.
+func sendPack(repo *Repository, pw *pktline.Writer, w io.Writer, objects []revlist.Entry, caps map[string]bool) error {
+	var progress io.Writer
+	switch {
+	case caps["side-band-64k"]:
+		w = pktline.NewSidebandWriter(pw, 1, pktline.MaxPayload-1)
+		progress = pktline.NewSidebandWriter(pw, 2, pktline.MaxPayload-1)
+	case caps["side-band"]:
+		w = pktline.NewSidebandWriter(pw, 1, 995)
+		progress = pktline.NewSidebandWriter(pw, 2, 995)
+	}
+	if progress != nil && !caps["no-progress"] {
+		fmt.Fprintf(progress, "Enumerating objects: %d, done.\n", len(objects))
+	}
+
+	buildOpts := pack.DefaultBuildOptions
+	if !caps["ofs-delta"] {
+		buildOpts.Window = 0
+	}
+	if _, _, err := revlist.WritePack(w, repo.Objects, objects, buildOpts); err != nil {
+		if progress != nil {
+			pktline.NewSidebandWriter(pw, 3, 995).Write([]byte(err.Error()))
+		}
+		return err
+	}
+	if progress != nil {
+		return pw.Flush()
+	}
+	return nil
+}
+
+// writeError reports a fatal error to the client and returns it.
+func writeError(pw *pktline.Writer, msg string) error {
+	pw.Writef("ERR %s\n", msg)
+	return fmt.Errorf("%s", msg)
+}
@@ -0,0 +1,295 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/atomicfile"
+	"github.com/codecrafters-io/git-starter-go/object"
+)
+
+// LooseStore keeps every object in its own zlib-compressed file under
+// <dir>/xx/yyyy.
+type LooseStore struct {
+	Dir string
+	// Sync makes Put flush new objects to disk before returning.
+	Sync   bool
+	format *object.Format
+}
+
+func NewLooseStore(dir string, f *object.Format) *LooseStore {
+	return &LooseStore{Dir: dir, format: f}
+}
+
+func (s *LooseStore) Format() *object.Format {
+	return s.format
+}
+
+// Path returns the file an object is stored in.
+func (s *LooseStore) Path(id string) string {
+	return filepath.Join(s.Dir, id[:2], id[2:])
+}
+
+func (s *LooseStore) Has(id string) bool {
+	if !s.format.ValidID(id) {
+		return false
+	}
+	_, err := os.Stat(s.Path(id))
+	return err == nil
+}
+
+func (s *LooseStore) Get(id string) (object.Type, []byte, error) {
+	if !s.format.ValidID(id) {
+		return 0, nil, fmt.Errorf("invalid object id %q", id)
+	}
+
+	f, err := os.Open(s.Path(id))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil, ErrNotFound
+		}
+		return 0, nil, err
+	}
+	defer f.Close()
+
+	zr, err := zlib.NewReader(f)
+	if err != nil {
+		return 0, nil, fmt.Errorf("error reading object %s: %w", id, err)
+	}
+	defer zr.Close()
+
+	data, err := io.ReadAll(zr)
+	if err != nil {
+		return 0, nil, fmt.Errorf("error decompressing object %s: %w", id, err)
+	}
+	return parseLoose(id, data)
+}
+
+func parseLoose(id string, data []byte) (object.Type, []byte, error) {
+	nullIndex := bytes.IndexByte(data, 0)
+	if nullIndex == -1 {
+		return 0, nil, fmt.Errorf("invalid object %s: missing header", id)
+	}
+	typeName, sizeStr, ok := strings.Cut(string(data[:nullIndex]), " ")
+	if !ok {
+		return 0, nil, fmt.Errorf("invalid object %s: malformed header", id)
+	}
+	t, err := object.ParseType(typeName)
+	if err != nil {
+		return 0, nil, fmt.Errorf("invalid object %s: %w", id, err)
+	}
+	content := data[nullIndex+1:]
+	if size, err := strconv.Atoi(sizeStr); err != nil || size != len(content) {
+		return 0, nil, fmt.Errorf("invalid object %s: size mismatch", id)
+	}
+	return t, content, nil
+}
+
+// Stat returns the type and size of an object from its header,
+// without inflating the content.
+func (s *LooseStore) Stat(id string) (object.Type, int64, error) {
+	t, size, r, err := s.Open(id)
+	if err != nil {
+		return 0, 0, err
+	}
+	r.Close()
+	return t, size, nil
+}
+
+// Open returns the type and size of an object and a reader that
+// inflates its content as it is read.
+func (s *LooseStore) Open(id string) (object.Type, int64, io.ReadCloser, error) {
+	if !s.format.ValidID(id) {
+		return 0, 0, nil, fmt.Errorf("invalid object id %q", id)
+	}
+
+	f, err := os.Open(s.Path(id))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, 0, nil, ErrNotFound
+		}
+		return 0, 0, nil, err
+	}
+	zr, err := zlib.NewReader(f)
+	if err != nil {
+		f.Close()
+		return 0, 0, nil, fmt.Errorf("error reading object %s: %w", id, err)
+	}
+	br := bufio.NewReader(zr)
+	r := &looseReader{Reader: br, zr: zr, f: f}
+
+	header, err := br.ReadString(0)
+	if err != nil {
+		r.Close()
+		return 0, 0, nil, fmt.Errorf("invalid object %s: missing header", id)
+	}
+	typeName, sizeStr, ok := strings.Cut(strings.TrimSuffix(header, "\x00"), " ")
+	if !ok {
+		r.Close()
+		return 0, 0, nil, fmt.Errorf("invalid object %s: malformed header", id)
+	}
+	t, err := object.ParseType(typeName)
+	if err != nil {
+		r.Close()
+		return 0, 0, nil, fmt.Errorf("invalid object %s: %w", id, err)
+	}
+	size, err := strconv.ParseInt(sizeStr, 10, 64)
+	if err != nil || size < 0 {
+		r.Close()
+		return 0, 0, nil, fmt.Errorf("invalid object %s: malformed header", id)
+	}
+	return t, size, r, nil
+}
+
+// looseReader reads the content of a loose object, closing the inflater
+// and the file along with it.
+type looseReader struct {
+	io.Reader
+	zr io.ReadCloser
+	f  *os.File
+}
+
+func (r *looseReader) Close() error {
+	r.zr.Close()
+	return r.f.Close()
+}
+
+func (s *LooseStore) Put(t object.Type, content []byte) (string, error) {
+	id, err := s.format.Hash(t, content)
+	if err != nil {
+		return "", err
+	}
+	objectPath := s.Path(id)
+	if _, err := os.Stat(objectPath); err == nil {
+		return id, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(objectPath), 0755); err != nil {
+		return "", fmt.Errorf("error creating directory: %w", err)
+	}
+
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	zw.Write(object.Header(t, len(content)))
+	zw.Write(content)
+	if err := zw.Close(); err != nil {
+		return "", fmt.Errorf("error compressing object: %w", err)
+	}
+
+	// Objects are immutable, so they are written read-only and only
+	// become visible once complete.
+	if err := atomicfile.WriteFile(objectPath, buf.Bytes(), 0444, s.Sync); err != nil {
+		return "", fmt.Errorf("error writing object %s: %w", id, err)
+	}
+	return id, nil
+}
+
+// PutStream stores size bytes read from r as an object of type t. The
+// content is hashed and compressed in one pass into a temporary file, so
+// it is never held in memory.
+func (s *LooseStore) PutStream(t object.Type, size int64, r io.Reader) (string, error) {
+	if err := os.MkdirAll(s.Dir, 0755); err != nil {
+		return "", fmt.Errorf("error creating directory: %w", err)
+	}
+	tmp, err := atomicfile.CreateTemp(s.Dir, "tmp_obj_", s.Sync)
+	if err != nil {
+		return "", fmt.Errorf("error creating temporary object: %w", err)
+	}
+	defer tmp.Abort()
+
+	h := s.format.New()
+	bw := bufio.NewWriter(tmp)
+	zw := zlib.NewWriter(bw)
+	header := object.Header(t, int(size))
+	h.Write(header)
+	zw.Write(header)
+	n, err := io.Copy(io.MultiWriter(h, zw), r)
+	if err != nil {
+		return "", err
+	}
+	if n != size {
+		return "", fmt.Errorf("object size changed while reading: expected %d bytes, read %d", size, n)
+	}
+	if err := zw.Close(); err != nil {
+		return "", fmt.Errorf("error compressing object: %w", err)
+	}
+	if err := bw.Flush(); err != nil {
+		return "", fmt.Errorf("error writing object: %w", err)
+	}
+
+	sum, err := s.format.Sum(h)
+	if err != nil {
+		return "", err
+	}
+	id := hex.EncodeToString(sum)
+	objectPath := s.Path(id)
+	if _, err := os.Stat(objectPath); err == nil {
+		return id, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(objectPath), 0755); err != nil {
+		return "", fmt.Errorf("error creating directory: %w", err)
+	}
+	if err := tmp.Commit(objectPath, 0444); err != nil {
+		return "", fmt.Errorf("error writing object %s: %w", id, err)
+	}
+	return id, nil
+}
+
+func (s *LooseStore) Iterate(fn func(id string) error) error {
+	dirs, err := os.ReadDir(s.Dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	for _, dir := range dirs {
+		if !dir.IsDir() || len(dir.Name()) != 2 {
+			continue
+		}
+		files, err := os.ReadDir(filepath.Join(s.Dir, dir.Name()))
+		if err != nil {
+			return err
+		}
+		for _, file := range files {
+			id := dir.Name() + file.Name()
+			if !s.format.ValidID(id) {
+				continue
+			}
+			if err := fn(id); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// FindPrefix returns the IDs of loose objects starting with prefix.
+func (s *LooseStore) FindPrefix(prefix string) ([]string, error) {
+	if len(prefix) < 2 {
+		return nil, fmt.Errorf("prefix %q too short", prefix)
+	}
+	files, err := os.ReadDir(filepath.Join(s.Dir, prefix[:2]))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error reading object directory: %w", err)
+	}
+
+	var ids []string
+	for _, file := range files {
+		if id := prefix[:2] + file.Name(); strings.HasPrefix(id, prefix) && s.format.ValidID(id) {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
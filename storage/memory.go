@@ -0,0 +1,100 @@
+package storage
+
+import (
+	"bytes"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/codecrafters-io/git-starter-go/object"
+)
+
+type memoryObject struct {
+	t       object.Type
+	content []byte
+}
+
+// MemoryStore is an ObjectStore that never touches disk.
+type MemoryStore struct {
+	mu      sync.RWMutex
+	format  *object.Format
+	objects map[string]memoryObject
+}
+
+func NewMemoryStore(f *object.Format) *MemoryStore {
+	return &MemoryStore{format: f, objects: make(map[string]memoryObject)}
+}
+
+func (s *MemoryStore) Format() *object.Format {
+	return s.format
+}
+
+func (s *MemoryStore) Has(id string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.objects[id]
+	return ok
+}
+
+func (s *MemoryStore) Get(id string) (object.Type, []byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	obj, ok := s.objects[id]
+	if !ok {
+		return 0, nil, ErrNotFound
+	}
+	return obj.t, append([]byte(nil), obj.content...), nil
+}
+
+func (s *MemoryStore) Stat(id string) (object.Type, int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	obj, ok := s.objects[id]
+	if !ok {
+		return 0, 0, ErrNotFound
+	}
+	return obj.t, int64(len(obj.content)), nil
+}
+
+// Open returns a reader over the stored content, which is never
+// modified once stored.
+func (s *MemoryStore) Open(id string) (object.Type, int64, io.ReadCloser, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	obj, ok := s.objects[id]
+	if !ok {
+		return 0, 0, nil, ErrNotFound
+	}
+	return obj.t, int64(len(obj.content)), io.NopCloser(bytes.NewReader(obj.content)), nil
+}
+
+func (s *MemoryStore) Put(t object.Type, content []byte) (string, error) {
+	id, err := s.format.Hash(t, content)
+	if err != nil {
+		return "", err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.objects[id]; !ok {
+		s.objects[id] = memoryObject{t: t, content: append([]byte(nil), content...)}
+	}
+	return id, nil
+}
+
+// Iterate visits objects in ID order.
+func (s *MemoryStore) Iterate(fn func(id string) error) error {
+	s.mu.RLock()
+	ids := make([]string, 0, len(s.objects))
+	for id := range s.objects {
+		ids = append(ids, id)
+	}
+	s.mu.RUnlock()
+
+	sort.Strings(ids)
+	for _, id := range ids {
+		if err := fn(id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,276 @@
+package storage
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/codecrafters-io/git-starter-go/atomicfile"
+	"github.com/codecrafters-io/git-starter-go/object"
+	"github.com/codecrafters-io/git-starter-go/pack"
+)
+
+// PackStore serves objects from the packs in a directory. It is
+// read-only.
+type PackStore struct {
+	Dir   string
+	Packs []*pack.Packfile
+	// Sync makes WritePack flush new packs and indexes to disk.
+	Sync   bool
+	format *object.Format
+
+	// external resolves REF_DELTA bases that live outside the packs.
+	external ObjectStore
+}
+
+// OpenPackStore opens every pack in dir, whose objects are named in
+// format f. Delta bases missing from the packs are looked up in
+// external, which may be nil.
+func OpenPackStore(dir string, f *object.Format, external ObjectStore) (*PackStore, error) {
+	s := &PackStore{Dir: dir, format: f, external: external}
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Reload closes the open packs and rescans the directory.
+func (s *PackStore) Reload() error {
+	s.Close()
+	s.Packs = nil
+
+	paths, err := filepath.Glob(filepath.Join(s.Dir, "*.pack"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		if _, err := os.Stat(path[:len(path)-len(".pack")] + ".idx"); os.IsNotExist(err) {
+			continue
+		}
+		p, err := pack.Open(path, s.format)
+		if err != nil {
+			s.Close()
+			return fmt.Errorf("error opening pack %s: %w", path, err)
+		}
+		if s.external != nil {
+			p.ResolveExternal = func(id string) (pack.ObjectType, []byte, error) {
+				t, content, err := s.external.Get(id)
+				return pack.ObjectType(t), content, err
+			}
+		}
+		s.Packs = append(s.Packs, p)
+	}
+	return nil
+}
+
+func (s *PackStore) Format() *object.Format {
+	return s.format
+}
+
+func (s *PackStore) Has(id string) bool {
+	for _, p := range s.Packs {
+		if p.Has(id) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *PackStore) Get(id string) (object.Type, []byte, error) {
+	for _, p := range s.Packs {
+		if !p.Has(id) {
+			continue
+		}
+		t, content, err := p.Get(id)
+		if err != nil {
+			return 0, nil, err
+		}
+		return object.Type(t), content, nil
+	}
+	return 0, nil, ErrNotFound
+}
+
+func (s *PackStore) Stat(id string) (object.Type, int64, error) {
+	for _, p := range s.Packs {
+		if !p.Has(id) {
+			continue
+		}
+		t, size, err := p.Stat(id)
+		if err != nil {
+			return 0, 0, err
+		}
+		return object.Type(t), size, nil
+	}
+	return 0, 0, ErrNotFound
+}
+
+func (s *PackStore) Open(id string) (object.Type, int64, io.ReadCloser, error) {
+	for _, p := range s.Packs {
+		if !p.Has(id) {
+			continue
+		}
+		t, size, r, err := p.Open(id)
+		if err != nil {
+			return 0, 0, nil, err
+		}
+		return object.Type(t), size, r, nil
+	}
+	return 0, 0, nil, ErrNotFound
+}
+
+func (s *PackStore) Put(t object.Type, content []byte) (string, error) {
+	return "", ErrReadOnly
+}
+
+func (s *PackStore) Iterate(fn func(id string) error) error {
+	for _, p := range s.Packs {
+		for i := 0; i < p.Index.Count(); i++ {
+			if err := fn(p.Index.HashAt(i)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// FindPrefix returns the IDs of packed objects starting with prefix.
+func (s *PackStore) FindPrefix(prefix string) []string {
+	var ids []string
+	for _, p := range s.Packs {
+		ids = append(ids, p.Index.FindPrefix(prefix)...)
+	}
+	return ids
+}
+
+// WritePack stores the pack read from r, writes its index and makes its
+// objects available. Delta bases missing from the pack are read from the
+// store's external objects and appended to it, so thin packs are
+// accepted. It returns
+// the hex pack checksum that names the new files.
+func (s *PackStore) WritePack(r io.Reader) (string, error) {
+	if err := os.MkdirAll(s.Dir, 0755); err != nil {
+		return "", err
+	}
+
+	tmp, err := atomicfile.CreateTemp(s.Dir, "tmp_pack_", s.Sync)
+	if err != nil {
+		return "", fmt.Errorf("error creating temporary pack: %w", err)
+	}
+	defer tmp.Abort()
+
+	size, err := io.Copy(tmp, r)
+	if err != nil {
+		return "", fmt.Errorf("error receiving pack: %w", err)
+	}
+
+	var external func(id string) (pack.ObjectType, []byte, error)
+	if s.external != nil {
+		external = func(id string) (pack.ObjectType, []byte, error) {
+			t, content, err := s.external.Get(id)
+			return pack.ObjectType(t), content, err
+		}
+	}
+	objects, checksum, err := pack.IndexPack(tmp, size, s.format, external)
+	if err != nil {
+		return "", fmt.Errorf("error indexing pack: %w", err)
+	}
+	// Like index-pack --fix-thin, store the bases of a thin pack along
+	// with it so that the pack does not depend on other objects.
+	if missing := pack.MissingBases(objects); len(missing) > 0 {
+		added, sum, err := pack.AppendObjects(tmp, size, s.format, missing, external)
+		if err != nil {
+			return "", fmt.Errorf("error completing thin pack: %w", err)
+		}
+		objects, checksum = append(objects, added...), sum
+		sort.Slice(objects, func(i, j int) bool { return objects[i].ID < objects[j].ID })
+	}
+
+	tmpIdx, err := atomicfile.CreateTemp(s.Dir, "tmp_idx_", s.Sync)
+	if err != nil {
+		return "", fmt.Errorf("error creating temporary index: %w", err)
+	}
+	defer tmpIdx.Abort()
+
+	if err := pack.WriteIndex(tmpIdx, s.format, objects, checksum); err != nil {
+		return "", fmt.Errorf("error writing pack index: %w", err)
+	}
+
+	name := hex.EncodeToString(checksum)
+	base := filepath.Join(s.Dir, "pack-"+name)
+	if err := tmp.Commit(base+".pack", 0444); err != nil {
+		return "", err
+	}
+	if err := tmpIdx.Commit(base+".idx", 0444); err != nil {
+		return "", err
+	}
+
+	return name, s.Reload()
+}
+
+// PutStream stores size bytes read from r as an object of type t in a
+// pack of its own, without holding the content in memory or trying to
+// deltify it. It is meant for objects too big to be worth storing loose.
+func (s *PackStore) PutStream(t object.Type, size int64, r io.Reader) (string, error) {
+	if err := os.MkdirAll(s.Dir, 0755); err != nil {
+		return "", err
+	}
+	tmp, err := atomicfile.CreateTemp(s.Dir, "tmp_pack_", s.Sync)
+	if err != nil {
+		return "", fmt.Errorf("error creating temporary pack: %w", err)
+	}
+	defer tmp.Abort()
+
+	bw := bufio.NewWriter(tmp)
+	pw, err := pack.NewWriter(bw, s.format, 1)
+	if err != nil {
+		return "", err
+	}
+	info, err := pw.WriteObjectFrom(pack.ObjectType(t), size, r)
+	if err != nil {
+		return "", err
+	}
+	if s.Has(info.ID) {
+		return info.ID, nil
+	}
+	checksum, err := pw.Close()
+	if err != nil {
+		return "", err
+	}
+	if err := bw.Flush(); err != nil {
+		return "", fmt.Errorf("error writing pack: %w", err)
+	}
+
+	tmpIdx, err := atomicfile.CreateTemp(s.Dir, "tmp_idx_", s.Sync)
+	if err != nil {
+		return "", fmt.Errorf("error creating temporary index: %w", err)
+	}
+	defer tmpIdx.Abort()
+	if err := pack.WriteIndex(tmpIdx, s.format, pw.Objects(), checksum); err != nil {
+		return "", fmt.Errorf("error writing pack index: %w", err)
+	}
+
+	base := filepath.Join(s.Dir, "pack-"+hex.EncodeToString(checksum))
+	if err := tmp.Commit(base+".pack", 0444); err != nil {
+		return "", err
+	}
+	if err := tmpIdx.Commit(base+".idx", 0444); err != nil {
+		return "", err
+	}
+	return info.ID, s.Reload()
+}
+
+func (s *PackStore) Close() error {
+	var firstErr error
+	for _, p := range s.Packs {
+		if err := p.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,164 @@
+// Package storage provides git object databases behind a common
+// ObjectStore interface.
+package storage
+
+import (
+	"errors"
+	"io"
+	"path/filepath"
+	"sort"
+
+	"github.com/codecrafters-io/git-starter-go/object"
+	"github.com/codecrafters-io/git-starter-go/pack"
+)
+
+var (
+	// ErrNotFound is returned by Get for objects the store does not hold.
+	ErrNotFound = errors.New("object not found")
+	// ErrReadOnly is returned by Put on stores that cannot be written.
+	ErrReadOnly = errors.New("object store is read-only")
+)
+
+// ObjectStore is a content-addressed object database.
+type ObjectStore interface {
+	// Has reports whether the object is present.
+	Has(id string) bool
+	// Get returns the type and content of an object.
+	Get(id string) (object.Type, []byte, error)
+	// Stat returns the type and size of an object without reading its
+	// content.
+	Stat(id string) (object.Type, int64, error)
+	// Open returns the type and size of an object and a reader over its
+	// content, which the caller must close.
+	Open(id string) (object.Type, int64, io.ReadCloser, error)
+	// Put stores content as an object of type t and returns its ID.
+	Put(t object.Type, content []byte) (string, error)
+	// Iterate calls fn for every object ID in the store. Returning an
+	// error from fn stops the iteration with that error.
+	Iterate(fn func(id string) error) error
+	// Format is the hash algorithm naming the objects.
+	Format() *object.Format
+}
+
+// PutObject encodes obj and stores it.
+func PutObject(s ObjectStore, obj object.Object) (string, error) {
+	return s.Put(obj.Type(), obj.Encode())
+}
+
+// DiskStore is the object database of a repository: loose objects with
+// packs as a fallback. New objects are written loose.
+type DiskStore struct {
+	Loose *LooseStore
+	Packs *PackStore
+	// BigFileThreshold is the size above which PutStream writes objects
+	// straight to a pack instead of loose; 0 means no limit.
+	BigFileThreshold int64
+}
+
+// Open opens the object database rooted at objectsDir (usually
+// .git/objects) of a repository using object format f.
+func Open(objectsDir string, f *object.Format) (*DiskStore, error) {
+	s := &DiskStore{Loose: NewLooseStore(objectsDir, f), BigFileThreshold: pack.DefaultBigFileThreshold}
+	packs, err := OpenPackStore(filepath.Join(objectsDir, "pack"), f, s)
+	if err != nil {
+		return nil, err
+	}
+	s.Packs = packs
+	return s, nil
+}
+
+func (s *DiskStore) Format() *object.Format {
+	return s.Loose.Format()
+}
+
+func (s *DiskStore) Has(id string) bool {
+	return s.Loose.Has(id) || s.Packs.Has(id)
+}
+
+func (s *DiskStore) Get(id string) (object.Type, []byte, error) {
+	t, content, err := s.Loose.Get(id)
+	if err != ErrNotFound {
+		return t, content, err
+	}
+	return s.Packs.Get(id)
+}
+
+func (s *DiskStore) Stat(id string) (object.Type, int64, error) {
+	t, size, err := s.Loose.Stat(id)
+	if err != ErrNotFound {
+		return t, size, err
+	}
+	return s.Packs.Stat(id)
+}
+
+func (s *DiskStore) Open(id string) (object.Type, int64, io.ReadCloser, error) {
+	t, size, r, err := s.Loose.Open(id)
+	if err != ErrNotFound {
+		return t, size, r, err
+	}
+	return s.Packs.Open(id)
+}
+
+func (s *DiskStore) Put(t object.Type, content []byte) (string, error) {
+	id, err := s.Format().Hash(t, content)
+	if err != nil {
+		return "", err
+	}
+	if s.Packs.Has(id) {
+		return id, nil
+	}
+	return s.Loose.Put(t, content)
+}
+
+// PutStream stores size bytes read from r as an object of type t,
+// without holding them in memory. Objects larger than BigFileThreshold
+// go to a pack of their own.
+func (s *DiskStore) PutStream(t object.Type, size int64, r io.Reader) (string, error) {
+	if s.BigFileThreshold > 0 && size > s.BigFileThreshold {
+		return s.Packs.PutStream(t, size, r)
+	}
+	return s.Loose.PutStream(t, size, r)
+}
+
+// Iterate visits every object once, even if it is both loose and packed.
+func (s *DiskStore) Iterate(fn func(id string) error) error {
+	seen := make(map[string]bool)
+	visit := func(id string) error {
+		if seen[id] {
+			return nil
+		}
+		seen[id] = true
+		return fn(id)
+	}
+	if err := s.Loose.Iterate(visit); err != nil {
+		return err
+	}
+	return s.Packs.Iterate(visit)
+}
+
+// FindPrefix returns the sorted IDs of all objects starting with prefix.
+func (s *DiskStore) FindPrefix(prefix string) ([]string, error) {
+	loose, err := s.Loose.FindPrefix(prefix)
+	if err != nil {
+		return nil, err
+	}
+	matches := make(map[string]bool)
+	for _, id := range loose {
+		matches[id] = true
+	}
+	for _, id := range s.Packs.FindPrefix(prefix) {
+		matches[id] = true
+	}
+
+	ids := make([]string, 0, len(matches))
+	for id := range matches {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// Close releases the open pack files.
+func (s *DiskStore) Close() error {
+	return s.Packs.Close()
+}
@@ -0,0 +1,312 @@
+package storage
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/codecrafters-io/git-starter-go/object"
+	"github.com/codecrafters-io/git-starter-go/pack"
+)
+
+var testContents = []struct {
+	t       object.Type
+	content []byte
+}{
+	{object.TypeBlob, nil},
+	{object.TypeBlob, []byte("hello\n")},
+	{object.TypeBlob, bytes.Repeat([]byte("a line of a larger file\n"), 5000)},
+	{object.TypeCommit, []byte("tree 4b825dc642cb6eb9a060e54bf8d69288fbee4904\n\nmessage\n")},
+}
+
+// checkStore verifies that every test object reads back from s through
+// Get, Stat and Open.
+func checkStore(t *testing.T, s ObjectStore, ids []string) {
+	t.Helper()
+	for i, obj := range testContents {
+		id := ids[i]
+		if !s.Has(id) {
+			t.Fatalf("Has(%s) = false", id)
+		}
+		typ, content, err := s.Get(id)
+		if err != nil || typ != obj.t || !bytes.Equal(content, obj.content) {
+			t.Errorf("Get(%s) = %s, %d bytes, %v", id, typ, len(content), err)
+		}
+		typ, size, err := s.Stat(id)
+		if err != nil || typ != obj.t || size != int64(len(obj.content)) {
+			t.Errorf("Stat(%s) = %s, %d, %v; want %s, %d", id, typ, size, err, obj.t, len(obj.content))
+		}
+		typ, size, r, err := s.Open(id)
+		if err != nil {
+			t.Fatalf("Open(%s): %v", id, err)
+		}
+		content, err = io.ReadAll(r)
+		r.Close()
+		if err != nil || typ != obj.t || size != int64(len(content)) || !bytes.Equal(content, obj.content) {
+			t.Errorf("Open(%s) = %s, %d, %d bytes, %v", id, typ, size, len(content), err)
+		}
+	}
+
+	missing := strings.Repeat("0", 40)
+	if s.Has(missing) {
+		t.Error("Has(missing) = true")
+	}
+	if _, _, err := s.Get(missing); err != ErrNotFound {
+		t.Errorf("Get(missing) = %v, want ErrNotFound", err)
+	}
+	if _, _, err := s.Stat(missing); err != ErrNotFound {
+		t.Errorf("Stat(missing) = %v, want ErrNotFound", err)
+	}
+	if _, _, _, err := s.Open(missing); err != ErrNotFound {
+		t.Errorf("Open(missing) = %v, want ErrNotFound", err)
+	}
+}
+
+func TestStores(t *testing.T) {
+	tests := []struct {
+		name string
+		// open returns an empty store. put, if set, stores an object
+		// instead of Put.
+		open func(t *testing.T) ObjectStore
+		put  func(t *testing.T, s ObjectStore, typ object.Type, content []byte) string
+	}{
+		{
+			name: "memory",
+			open: func(t *testing.T) ObjectStore { return NewMemoryStore(object.SHA1) },
+		},
+		{
+			name: "loose",
+			open: func(t *testing.T) ObjectStore { return NewLooseStore(t.TempDir(), object.SHA1) },
+		},
+		{
+			name: "loose streamed",
+			open: func(t *testing.T) ObjectStore { return NewLooseStore(t.TempDir(), object.SHA1) },
+			put: func(t *testing.T, s ObjectStore, typ object.Type, content []byte) string {
+				id, err := s.(*LooseStore).PutStream(typ, int64(len(content)), bytes.NewReader(content))
+				if err != nil {
+					t.Fatal(err)
+				}
+				return id
+			},
+		},
+		{
+			name: "disk with big files packed",
+			open: func(t *testing.T) ObjectStore {
+				s, err := Open(t.TempDir(), object.SHA1)
+				if err != nil {
+					t.Fatal(err)
+				}
+				s.BigFileThreshold = 1000
+				t.Cleanup(func() { s.Close() })
+				return s
+			},
+			put: func(t *testing.T, s ObjectStore, typ object.Type, content []byte) string {
+				id, err := s.(*DiskStore).PutStream(typ, int64(len(content)), bytes.NewReader(content))
+				if err != nil {
+					t.Fatal(err)
+				}
+				return id
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := tt.open(t)
+			var ids []string
+			for _, obj := range testContents {
+				var id string
+				if tt.put != nil {
+					id = tt.put(t, s, obj.t, obj.content)
+				} else {
+					var err error
+					if id, err = s.Put(obj.t, obj.content); err != nil {
+						t.Fatal(err)
+					}
+				}
+				want, _ := object.SHA1.Hash(obj.t, obj.content)
+				if id != want {
+					t.Fatalf("stored as %s, want %s", id, want)
+				}
+				ids = append(ids, id)
+			}
+			checkStore(t, s, ids)
+		})
+	}
+}
+
+// collidingHash is SHA-1 that reports everything it hashes as part of
+// a collision attack.
+type collidingHash struct{ hash.Hash }
+
+func (h collidingHash) CollisionResistantSum(b []byte) ([]byte, bool) { return h.Sum(b), true }
+
+var colliding = object.NewFormat("sha1", sha1.Size, func() hash.Hash { return collidingHash{sha1.New()} })
+
+func TestCollisionRefused(t *testing.T) {
+	content := bytes.Repeat([]byte("colliding content\n"), 100)
+	tests := []struct {
+		name string
+		put  func(dir string) (string, error)
+	}{
+		{"loose", func(dir string) (string, error) {
+			return NewLooseStore(dir, colliding).Put(object.TypeBlob, content)
+		}},
+		{"loose streamed", func(dir string) (string, error) {
+			return NewLooseStore(dir, colliding).PutStream(object.TypeBlob, int64(len(content)), bytes.NewReader(content))
+		}},
+		{"big file packed", func(dir string) (string, error) {
+			s, err := Open(dir, colliding)
+			if err != nil {
+				return "", err
+			}
+			defer s.Close()
+			s.BigFileThreshold = 100
+			return s.PutStream(object.TypeBlob, int64(len(content)), bytes.NewReader(content))
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if id, err := tt.put(dir); !errors.Is(err, object.ErrCollision) {
+				t.Fatalf("stored as %s, %v; want ErrCollision", id, err)
+			}
+			filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+				if err == nil && !d.IsDir() {
+					t.Errorf("%s left behind", path)
+				}
+				return err
+			})
+		})
+	}
+}
+
+func TestPackStore(t *testing.T) {
+	dir := t.TempDir()
+	mem := NewMemoryStore(object.SHA1)
+	var ids []string
+	var build []pack.BuildObject
+	for _, obj := range testContents {
+		id, err := mem.Put(obj.t, obj.content)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+		build = append(build, pack.BuildObject{ID: id})
+	}
+	// Deltify the larger blob against a similar one.
+	similar, _ := mem.Put(object.TypeBlob, append(bytes.Repeat([]byte("a line of a larger file\n"), 5000), '!'))
+	build = append(build, pack.BuildObject{ID: similar})
+
+	var buf bytes.Buffer
+	if _, _, err := pack.Build(&buf, object.SHA1, build, memorySource{mem}, pack.DefaultBuildOptions); err != nil {
+		t.Fatal(err)
+	}
+	s, err := OpenPackStore(dir, object.SHA1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if _, err := s.WritePack(&buf); err != nil {
+		t.Fatal(err)
+	}
+	checkStore(t, s, ids)
+	if _, err := s.Put(object.TypeBlob, nil); err != ErrReadOnly {
+		t.Errorf("Put = %v, want ErrReadOnly", err)
+	}
+}
+
+// memorySource adapts a MemoryStore to pack.Build.
+type memorySource struct {
+	s *MemoryStore
+}
+
+func (m memorySource) Stat(id string) (pack.ObjectType, int64, error) {
+	t, size, err := m.s.Stat(id)
+	return pack.ObjectType(t), size, err
+}
+
+func (m memorySource) Load(id string) (pack.ObjectType, []byte, error) {
+	t, content, err := m.s.Get(id)
+	return pack.ObjectType(t), content, err
+}
+
+func (m memorySource) Open(id string) (pack.ObjectType, int64, io.ReadCloser, error) {
+	t, size, r, err := m.s.Open(id)
+	return pack.ObjectType(t), size, r, err
+}
+
+// thinPack returns a pack holding target as a REF_DELTA against base,
+// without base itself.
+func thinPack(t *testing.T, baseID string, base, target []byte) []byte {
+	t.Helper()
+	delta := pack.CreateDelta(base, target)
+	var buf bytes.Buffer
+	buf.WriteString("PACK")
+	binary.Write(&buf, binary.BigEndian, uint32(2))
+	binary.Write(&buf, binary.BigEndian, uint32(1))
+
+	size := len(delta)
+	c := byte(pack.ObjRefDelta)<<4 | byte(size&0x0f)
+	for size >>= 4; size > 0; size >>= 7 {
+		buf.WriteByte(c | 0x80)
+		c = byte(size & 0x7f)
+	}
+	buf.WriteByte(c)
+	hash, _ := hex.DecodeString(baseID)
+	buf.Write(hash)
+	zw := zlib.NewWriter(&buf)
+	zw.Write(delta)
+	zw.Close()
+
+	h := object.SHA1.New()
+	h.Write(buf.Bytes())
+	return h.Sum(buf.Bytes())
+}
+
+func TestWritePackCompletesThinPack(t *testing.T) {
+	objectsDir := t.TempDir()
+	s, err := Open(objectsDir, object.SHA1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	base := bytes.Repeat([]byte("shared content\n"), 200)
+	target := append(append([]byte(nil), base...), "one more line\n"...)
+	baseID, err := s.Put(object.TypeBlob, base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	targetID, _ := object.SHA1.Hash(object.TypeBlob, target)
+
+	name, err := s.Packs.WritePack(bytes.NewReader(thinPack(t, baseID, base, target)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The stored pack must stand on its own, without the loose base.
+	p, err := pack.Open(filepath.Join(objectsDir, "pack", "pack-"+name+".pack"), object.SHA1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	if p.Index.Count() != 2 || !p.Has(baseID) {
+		t.Fatalf("pack holds %d objects, base included: %v", p.Index.Count(), p.Has(baseID))
+	}
+	typ, content, err := p.Get(targetID)
+	if err != nil || typ != pack.ObjBlob || !bytes.Equal(content, target) {
+		t.Fatalf("Get(target) = %s, %d bytes, %v", typ, len(content), err)
+	}
+	if _, err := pack.Verify(filepath.Join(objectsDir, "pack", "pack-"+name+".pack"), object.SHA1); err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+}
@@ -0,0 +1,221 @@
+package transport
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/object"
+	"github.com/codecrafters-io/git-starter-go/pktline"
+)
+
+// Ref is a reference advertised by a remote.
+type Ref struct {
+	Name string
+	Hash string
+	// Peeled is the object an annotated tag points to, if advertised.
+	Peeled string
+	// Target is set for symbolic refs, such as HEAD -> refs/heads/main.
+	Target string
+}
+
+// FindRef returns the ref with the given name.
+func FindRef(refs []Ref, name string) (Ref, bool) {
+	for _, ref := range refs {
+		if ref.Name == name {
+			return ref, true
+		}
+	}
+	return Ref{}, false
+}
+
+// DefaultBranch returns the branch HEAD points to on the remote. Servers
+// report it as a symref; for older servers we can only guess from a
+// branch with the same hash as HEAD.
+func DefaultBranch(refs []Ref) string {
+	head, ok := FindRef(refs, "HEAD")
+	if !ok {
+		return ""
+	}
+	if head.Target != "" {
+		return head.Target
+	}
+
+	var candidates []string
+	for _, ref := range refs {
+		if strings.HasPrefix(ref.Name, "refs/heads/") && ref.Hash == head.Hash {
+			candidates = append(candidates, ref.Name)
+		}
+	}
+	sort.Strings(candidates)
+	for _, preferred := range []string{"refs/heads/main", "refs/heads/master"} {
+		for _, c := range candidates {
+			if c == preferred {
+				return c
+			}
+		}
+	}
+	if len(candidates) > 0 {
+		return candidates[0]
+	}
+	return ""
+}
+
+// Capabilities is the set of capabilities a server advertised, in the
+// order they were sent.
+type Capabilities []string
+
+// Has reports whether the capability name is present, with or without a
+// value.
+func (c Capabilities) Has(name string) bool {
+	for _, capability := range c {
+		if capability == name || strings.HasPrefix(capability, name+"=") {
+			return true
+		}
+	}
+	return false
+}
+
+// Values returns the values of every "name=value" capability.
+func (c Capabilities) Values(name string) []string {
+	var values []string
+	for _, capability := range c {
+		if value, ok := strings.CutPrefix(capability, name+"="); ok {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// Features returns the space-separated features of a protocol v2
+// command capability, e.g. "fetch=shallow filter".
+func (c Capabilities) Features(command string) []string {
+	var features []string
+	for _, value := range c.Values(command) {
+		features = append(features, strings.Fields(value)...)
+	}
+	return features
+}
+
+// HasFeature reports whether a protocol v2 command supports feature.
+func (c Capabilities) HasFeature(command, feature string) bool {
+	for _, f := range c.Features(command) {
+		if f == feature {
+			return true
+		}
+	}
+	return false
+}
+
+// Advertisement is a server's initial response. For protocol v0 it
+// lists every ref; for protocol v2 it only lists capabilities and refs
+// must be requested with ls-refs.
+type Advertisement struct {
+	Version      int
+	Refs         []Ref
+	Capabilities Capabilities
+	// Shallow lists the commits at which a shallow remote's history is
+	// cut, advertised after the refs in protocol v0.
+	Shallow []string
+}
+
+// ObjectFormat returns the hash algorithm of the remote repository,
+// SHA-1 unless the server advertised another.
+func (adv *Advertisement) ObjectFormat() (*object.Format, error) {
+	formats := adv.Capabilities.Values("object-format")
+	if len(formats) == 0 {
+		return object.SHA1, nil
+	}
+	return object.FormatByName(formats[0])
+}
+
+// objectFormatCapability echoes the object format the server
+// advertised, which a v0 client must do for formats other than SHA-1.
+func (adv *Advertisement) objectFormatCapability() []string {
+	if formats := adv.Capabilities.Values("object-format"); len(formats) > 0 && formats[0] != object.SHA1.Name {
+		return []string{"object-format=" + formats[0]}
+	}
+	return nil
+}
+
+// readAdvertisement parses a v0/v1 ref advertisement, or a v2
+// capability advertisement, up to its flush.
+func readAdvertisement(r *pktline.Reader) (*Advertisement, error) {
+	adv := &Advertisement{}
+	first := true
+	for {
+		line, err := r.ReadLine()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading ref advertisement: %w", err)
+		}
+		if strings.HasPrefix(line, "ERR ") {
+			return nil, fmt.Errorf("%w: %s", pktline.ErrRemote, line[4:])
+		}
+
+		if adv.Version == 2 {
+			adv.Capabilities = append(adv.Capabilities, line)
+			continue
+		}
+
+		if first {
+			first = false
+			switch line {
+			case "version 2":
+				adv.Version = 2
+				continue
+			case "version 1":
+				first = true
+				continue
+			}
+			refPart, caps, _ := strings.Cut(line, "\x00")
+			adv.Capabilities = strings.Fields(caps)
+			line = refPart
+		}
+
+		if hash, ok := strings.CutPrefix(line, "shallow "); ok {
+			if !object.ValidHash(hash) {
+				return nil, fmt.Errorf("malformed shallow line %q", line)
+			}
+			adv.Shallow = append(adv.Shallow, hash)
+			continue
+		}
+
+		hash, name, ok := strings.Cut(line, " ")
+		if !ok || !object.ValidHash(hash) {
+			return nil, fmt.Errorf("malformed ref advertisement line %q", line)
+		}
+		if name == "capabilities^{}" {
+			// Empty repository: only capabilities are advertised.
+			continue
+		}
+		if base, ok := strings.CutSuffix(name, "^{}"); ok {
+			for i := range adv.Refs {
+				if adv.Refs[i].Name == base {
+					adv.Refs[i].Peeled = hash
+				}
+			}
+			continue
+		}
+		adv.Refs = append(adv.Refs, Ref{Name: name, Hash: hash})
+	}
+	if adv.Version == 2 {
+		return adv, nil
+	}
+
+	for _, symref := range adv.Capabilities.Values("symref") {
+		name, target, ok := strings.Cut(symref, ":")
+		if !ok {
+			continue
+		}
+		for i := range adv.Refs {
+			if adv.Refs[i].Name == name {
+				adv.Refs[i].Target = target
+			}
+		}
+	}
+	return adv, nil
+}
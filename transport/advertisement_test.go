@@ -0,0 +1,193 @@
+package transport
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/codecrafters-io/git-starter-go/pktline"
+)
+
+var (
+	hashA = strings.Repeat("a", 40)
+	hashB = strings.Repeat("b", 40)
+	hashC = strings.Repeat("c", 40)
+)
+
+// packets encodes lines as pkt-lines ending with a flush.
+func packets(lines ...string) *pktline.Reader {
+	var buf bytes.Buffer
+	w := pktline.NewWriter(&buf)
+	for _, line := range lines {
+		w.WriteString(line + "\n")
+	}
+	w.Flush()
+	return pktline.NewReader(&buf)
+}
+
+func TestReadAdvertisement(t *testing.T) {
+	tests := []struct {
+		name    string
+		lines   []string
+		want    *Advertisement
+		wantErr bool
+		is      error
+	}{
+		{
+			name: "v0",
+			lines: []string{
+				hashA + " HEAD\x00multi_ack side-band-64k symref=HEAD:refs/heads/main agent=git/2.43",
+				hashA + " refs/heads/main",
+				hashB + " refs/tags/v1",
+				hashC + " refs/tags/v1^{}",
+			},
+			want: &Advertisement{
+				Refs: []Ref{
+					{Name: "HEAD", Hash: hashA, Target: "refs/heads/main"},
+					{Name: "refs/heads/main", Hash: hashA},
+					{Name: "refs/tags/v1", Hash: hashB, Peeled: hashC},
+				},
+				Capabilities: Capabilities{"multi_ack", "side-band-64k", "symref=HEAD:refs/heads/main", "agent=git/2.43"},
+			},
+		},
+		{
+			name: "shallow",
+			lines: []string{
+				hashA + " refs/heads/main\x00shallow",
+				"shallow " + hashB,
+				"shallow " + hashC,
+			},
+			want: &Advertisement{
+				Refs:         []Ref{{Name: "refs/heads/main", Hash: hashA}},
+				Capabilities: Capabilities{"shallow"},
+				Shallow:      []string{hashB, hashC},
+			},
+		},
+		{
+			name:    "malformed shallow",
+			lines:   []string{hashA + " refs/heads/main\x00shallow", "shallow xyz"},
+			wantErr: true,
+		},
+		{
+			name:  "version 1 line",
+			lines: []string{"version 1", hashA + " refs/heads/main\x00report-status"},
+			want:  &Advertisement{Refs: []Ref{{Name: "refs/heads/main", Hash: hashA}}, Capabilities: Capabilities{"report-status"}},
+		},
+		{
+			name:  "empty repository",
+			lines: []string{strings.Repeat("0", 40) + " capabilities^{}\x00report-status delete-refs"},
+			want:  &Advertisement{Capabilities: Capabilities{"report-status", "delete-refs"}},
+		},
+		{
+			name:  "v2",
+			lines: []string{"version 2", "agent=git/2.43", "ls-refs=unborn", "fetch=shallow filter", "object-format=sha1"},
+			want:  &Advertisement{Version: 2, Capabilities: Capabilities{"agent=git/2.43", "ls-refs=unborn", "fetch=shallow filter", "object-format=sha1"}},
+		},
+		{
+			name:    "remote error",
+			lines:   []string{"ERR repository not found"},
+			wantErr: true,
+			is:      pktline.ErrRemote,
+		},
+		{
+			name:    "malformed",
+			lines:   []string{"not a ref line"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			adv, err := readAdvertisement(packets(tt.lines...))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, want error %v", err, tt.wantErr)
+			}
+			if tt.is != nil && !errors.Is(err, tt.is) {
+				t.Fatalf("error = %v, want %v", err, tt.is)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(adv, tt.want) {
+				t.Fatalf("advertisement = %+v, want %+v", adv, tt.want)
+			}
+		})
+	}
+}
+
+func TestCapabilities(t *testing.T) {
+	caps := Capabilities{"side-band-64k", "symref=HEAD:refs/heads/main", "fetch=shallow filter", "fetch=wait-for-done"}
+	tests := []struct {
+		name string
+		got  any
+		want any
+	}{
+		{"has plain", caps.Has("side-band-64k"), true},
+		{"has prefix only", caps.Has("side-band"), false},
+		{"has with value", caps.Has("symref"), true},
+		{"values", caps.Values("symref"), []string{"HEAD:refs/heads/main"}},
+		{"no values", caps.Values("agent"), []string(nil)},
+		{"features", caps.Features("fetch"), []string{"shallow", "filter", "wait-for-done"}},
+		{"has feature", caps.HasFeature("fetch", "filter"), true},
+		{"missing feature", caps.HasFeature("fetch", "sideband-all"), false},
+	}
+	for _, tt := range tests {
+		if !reflect.DeepEqual(tt.got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestDefaultBranch(t *testing.T) {
+	tests := []struct {
+		name string
+		refs []Ref
+		want string
+	}{
+		{"symref", []Ref{{Name: "HEAD", Hash: hashA, Target: "refs/heads/trunk"}, {Name: "refs/heads/main", Hash: hashA}}, "refs/heads/trunk"},
+		{"prefers main", []Ref{{Name: "HEAD", Hash: hashA}, {Name: "refs/heads/aaa", Hash: hashA}, {Name: "refs/heads/main", Hash: hashA}}, "refs/heads/main"},
+		{"first match", []Ref{{Name: "HEAD", Hash: hashA}, {Name: "refs/heads/zz", Hash: hashA}, {Name: "refs/heads/dev", Hash: hashA}}, "refs/heads/dev"},
+		{"no match", []Ref{{Name: "HEAD", Hash: hashA}, {Name: "refs/heads/main", Hash: hashB}}, ""},
+		{"no HEAD", []Ref{{Name: "refs/heads/main", Hash: hashA}}, ""},
+	}
+	for _, tt := range tests {
+		if got := DefaultBranch(tt.refs); got != tt.want {
+			t.Errorf("%s: DefaultBranch = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestReadReportStatus(t *testing.T) {
+	tests := []struct {
+		name    string
+		lines   []string
+		want    *PushResult
+		wantErr bool
+	}{
+		{
+			name:  "ok",
+			lines: []string{"unpack ok", "ok refs/heads/main", "ng refs/heads/dev non-fast-forward", "ng refs/heads/x"},
+			want: &PushResult{Refs: []RefStatus{
+				{Name: "refs/heads/main"},
+				{Name: "refs/heads/dev", Error: "non-fast-forward"},
+				{Name: "refs/heads/x", Error: "failed"},
+			}},
+		},
+		{
+			name:  "unpack failed",
+			lines: []string{"unpack index-pack failed", "ng refs/heads/main unpacker error"},
+			want:  &PushResult{UnpackError: "index-pack failed", Refs: []RefStatus{{Name: "refs/heads/main", Error: "unpacker error"}}},
+		},
+		{name: "no unpack line", lines: []string{"ok refs/heads/main"}, wantErr: true},
+		{name: "unknown status", lines: []string{"unpack ok", "maybe refs/heads/main"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := readReportStatus(packets(tt.lines...))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(result, tt.want) {
+				t.Fatalf("result = %+v, want %+v", result, tt.want)
+			}
+		})
+	}
+}
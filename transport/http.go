@@ -0,0 +1,273 @@
+// Package transport implements the client side of git's smart HTTP
+// protocol.
+package transport
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/pktline"
+)
+
+const (
+	UploadPackService  = "git-upload-pack"
+	ReceivePackService = "git-receive-pack"
+
+	userAgent = "mygit/1.0"
+
+	// postBuffer is the largest request body sent in one piece.
+	postBuffer = 1 << 20
+)
+
+// Client talks to a repository served over smart HTTP.
+type Client struct {
+	URL  string
+	HTTP *http.Client
+	// Progress receives the remote's side-band progress messages. It
+	// may be nil to request a quiet transfer.
+	Progress io.Writer
+	// ProtocolVersion is the upload-pack protocol version to ask for.
+	// Servers that do not support version 2 answer with version 0.
+	ProtocolVersion int
+}
+
+// NewClient returns a client for the repository at url.
+func NewClient(url string) *Client {
+	return &Client{URL: strings.TrimSuffix(url, "/"), HTTP: http.DefaultClient, ProtocolVersion: 2}
+}
+
+// Discover fetches the ref advertisement for service.
+func (c *Client) Discover(service string) (*Advertisement, error) {
+	req, err := http.NewRequest("GET", c.URL+"/info/refs?service="+service, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	if service == UploadPackService && c.ProtocolVersion == 2 {
+		req.Header.Set("Git-Protocol", "version=2")
+	}
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected HTTP status %s from %s", resp.Status, req.URL.Redacted())
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "application/x-"+service+"-advertisement" {
+		return nil, fmt.Errorf("%s does not support the smart HTTP protocol", c.URL)
+	}
+
+	br := bufio.NewReader(resp.Body)
+	r := pktline.NewReader(br)
+
+	// Version 2 servers may omit the service announcement.
+	if peek, err := br.Peek(14); err == nil && string(peek[4:]) == "# service=" {
+		line, err := r.ReadLine()
+		if err != nil {
+			return nil, fmt.Errorf("error reading service announcement: %w", err)
+		}
+		if line != "# service="+service {
+			return nil, fmt.Errorf("unexpected service announcement %q", line)
+		}
+		if t, _, err := r.ReadPacket(); err != nil || t != pktline.Flush {
+			return nil, fmt.Errorf("missing flush after service announcement")
+		}
+	}
+
+	return readAdvertisement(r)
+}
+
+// post sends body to the service endpoint and returns the response body.
+// Requests belonging to a protocol v2 session carry the Git-Protocol
+// header.
+func (c *Client) post(service string, body io.Reader, v2 bool) (io.ReadCloser, error) {
+	// Like git, send small requests with a Content-Length and only
+	// stream larger ones chunked, which some servers reject.
+	buf, err := io.ReadAll(io.LimitReader(body, postBuffer+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(buf) <= postBuffer {
+		body = bytes.NewReader(buf)
+	} else {
+		body = io.MultiReader(bytes.NewReader(buf), body)
+	}
+
+	req, err := http.NewRequest("POST", c.URL+"/"+service, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Content-Type", "application/x-"+service+"-request")
+	req.Header.Set("Accept", "application/x-"+service+"-result")
+	if v2 {
+		req.Header.Set("Git-Protocol", "version=2")
+	}
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected HTTP status %s from %s", resp.Status, req.URL.Redacted())
+	}
+	return resp.Body, nil
+}
+
+// FetchRequest describes the objects to download.
+type FetchRequest struct {
+	// Wants are the tips the client wants.
+	Wants []string
+	// Haves are commits the client already has.
+	Haves []string
+
+	// Shallows are the client's current shallow boundary commits.
+	Shallows []string
+	// Depth, if positive, limits the history to that many commits.
+	Depth int
+	// Filter is a partial clone filter spec such as "blob:none".
+	Filter string
+}
+
+// FetchResult is the outcome of a fetch.
+type FetchResult struct {
+	// Pack is the received pack stream. The caller must close it.
+	Pack io.ReadCloser
+	// Shallow and Unshallow report changes to the shallow boundary.
+	Shallow   []string
+	Unshallow []string
+}
+
+// ListRefs returns the remote refs starting with any of prefixes, or all
+// refs if no prefix is given. Protocol v2 servers filter the refs
+// themselves; for v0 the advertisement is filtered locally.
+func (c *Client) ListRefs(adv *Advertisement, prefixes ...string) ([]Ref, error) {
+	if adv.Version == 2 {
+		return c.lsRefs(adv, prefixes)
+	}
+
+	if len(prefixes) == 0 {
+		return adv.Refs, nil
+	}
+	var refs []Ref
+	for _, ref := range adv.Refs {
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(ref.Name, prefix) {
+				refs = append(refs, ref)
+				break
+			}
+		}
+	}
+	return refs, nil
+}
+
+// FetchPack negotiates with upload-pack and returns the pack stream.
+// Only objects reachable from Wants and not from Haves are sent.
+func (c *Client) FetchPack(adv *Advertisement, req FetchRequest) (*FetchResult, error) {
+	if len(req.Wants) == 0 {
+		return nil, fmt.Errorf("nothing to fetch")
+	}
+	if adv.Version == 2 {
+		return c.fetchV2(adv, req)
+	}
+	if req.Depth > 0 || req.Filter != "" || len(req.Shallows) > 0 {
+		return nil, fmt.Errorf("shallow and partial fetches require protocol version 2")
+	}
+
+	var caps []string
+	sideband := ""
+	for _, name := range []string{"side-band-64k", "side-band"} {
+		if adv.Capabilities.Has(name) {
+			sideband = name
+			break
+		}
+	}
+	if sideband != "" {
+		caps = append(caps, sideband)
+	}
+	if adv.Capabilities.Has("ofs-delta") {
+		caps = append(caps, "ofs-delta")
+	}
+	if c.Progress == nil && adv.Capabilities.Has("no-progress") {
+		caps = append(caps, "no-progress")
+	}
+	if adv.Capabilities.Has("agent") {
+		caps = append(caps, "agent="+userAgent)
+	}
+	caps = append(caps, adv.objectFormatCapability()...)
+
+	var body bytes.Buffer
+	w := pktline.NewWriter(&body)
+	for i, want := range req.Wants {
+		if i == 0 {
+			w.Writef("want %s %s\n", want, strings.Join(caps, " "))
+		} else {
+			w.Writef("want %s\n", want)
+		}
+	}
+	w.Flush()
+	for _, have := range req.Haves {
+		w.Writef("have %s\n", have)
+	}
+	w.WriteString("done\n")
+
+	respBody, err := c.post(UploadPackService, &body, false)
+	if err != nil {
+		return nil, err
+	}
+
+	pack, err := readPackResponse(respBody, sideband != "", c.Progress)
+	if err != nil {
+		respBody.Close()
+		return nil, err
+	}
+	return &FetchResult{Pack: readCloser{pack, respBody}}, nil
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// readPackResponse skips the ACK/NAK lines of an upload-pack response
+// and returns a reader for the pack data that follows.
+func readPackResponse(body io.Reader, sideband bool, progress io.Writer) (io.Reader, error) {
+	br := bufio.NewReader(body)
+	r := pktline.NewReader(br)
+	for {
+		if peek, err := br.Peek(4); err == nil && string(peek) == "PACK" && !sideband {
+			return br, nil
+		}
+
+		t, payload, err := r.ReadPacket()
+		if err != nil {
+			return nil, fmt.Errorf("error reading upload-pack response: %w", err)
+		}
+		if t != pktline.Data {
+			continue
+		}
+		line := string(payload)
+		switch {
+		case strings.HasPrefix(line, "ACK ") || strings.HasPrefix(line, "NAK"):
+			continue
+		case strings.HasPrefix(line, "ERR "):
+			return nil, fmt.Errorf("%w: %s", pktline.ErrRemote, strings.TrimSpace(line[4:]))
+		case !sideband:
+			return nil, fmt.Errorf("unexpected upload-pack response %q", line)
+		}
+
+		demux := pktline.NewSidebandReader(r, progress)
+		if err := demux.Unread(payload); err != nil {
+			return nil, err
+		}
+		return demux, nil
+	}
+}
@@ -0,0 +1,168 @@
+package transport
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/object"
+	"github.com/codecrafters-io/git-starter-go/pktline"
+)
+
+// RefCommand asks the remote to move the ref Name from Old to New.
+// Old is the zero ID to create the ref and New is the zero ID to
+// delete it.
+type RefCommand struct {
+	Name string
+	Old  string
+	New  string
+}
+
+// PushRequest describes a push to receive-pack.
+type PushRequest struct {
+	Commands []RefCommand
+	// Pack holds the objects the remote is missing. It is only
+	// optional if every command is a deletion.
+	Pack io.Reader
+	// Atomic asks the remote to apply all commands or none.
+	Atomic bool
+}
+
+// RefStatus is the remote's verdict on one command. Error is empty if
+// the ref was updated.
+type RefStatus struct {
+	Name  string
+	Error string
+}
+
+// PushResult is the status report of a push.
+type PushResult struct {
+	// UnpackError is set if the remote failed to store the pack.
+	UnpackError string
+	Refs        []RefStatus
+}
+
+// Push sends the ref update commands and pack to receive-pack. adv must
+// be the receive-pack advertisement.
+func (c *Client) Push(adv *Advertisement, req PushRequest) (*PushResult, error) {
+	if len(req.Commands) == 0 {
+		return nil, fmt.Errorf("nothing to push")
+	}
+
+	caps := []string{}
+	reportStatus := adv.Capabilities.Has("report-status")
+	if reportStatus {
+		caps = append(caps, "report-status")
+	}
+	sideband := adv.Capabilities.Has("side-band-64k")
+	if sideband {
+		caps = append(caps, "side-band-64k")
+	}
+	if c.Progress == nil && adv.Capabilities.Has("quiet") {
+		caps = append(caps, "quiet")
+	}
+	if req.Atomic {
+		if !adv.Capabilities.Has("atomic") {
+			return nil, fmt.Errorf("the receiving end does not support --atomic push")
+		}
+		caps = append(caps, "atomic")
+	}
+	deletes, deletesOnly := false, true
+	for _, cmd := range req.Commands {
+		if object.IsZeroID(cmd.New) {
+			deletes = true
+		} else {
+			deletesOnly = false
+		}
+	}
+	if deletes {
+		if !adv.Capabilities.Has("delete-refs") {
+			return nil, fmt.Errorf("the receiving end does not support deleting refs")
+		}
+		caps = append(caps, "delete-refs")
+	}
+	if !deletesOnly && req.Pack == nil {
+		return nil, fmt.Errorf("push without a pack can only delete refs")
+	}
+	if adv.Capabilities.Has("agent") {
+		caps = append(caps, "agent="+userAgent)
+	}
+	caps = append(caps, adv.objectFormatCapability()...)
+
+	var commands bytes.Buffer
+	w := pktline.NewWriter(&commands)
+	for i, cmd := range req.Commands {
+		if i == 0 {
+			w.Writef("%s %s %s\x00%s\n", cmd.Old, cmd.New, cmd.Name, strings.Join(caps, " "))
+		} else {
+			w.Writef("%s %s %s\n", cmd.Old, cmd.New, cmd.Name)
+		}
+	}
+	w.Flush()
+
+	var body io.Reader = &commands
+	if !deletesOnly {
+		body = io.MultiReader(&commands, req.Pack)
+	}
+	respBody, err := c.post(ReceivePackService, body, false)
+	if err != nil {
+		return nil, err
+	}
+	defer respBody.Close()
+
+	if !reportStatus {
+		io.Copy(io.Discard, respBody)
+		result := &PushResult{}
+		for _, cmd := range req.Commands {
+			result.Refs = append(result.Refs, RefStatus{Name: cmd.Name})
+		}
+		return result, nil
+	}
+
+	r := pktline.NewReader(respBody)
+	if sideband {
+		r = pktline.NewReader(pktline.NewSidebandReader(r, c.Progress))
+	}
+	return readReportStatus(r)
+}
+
+// readReportStatus parses a report-status response.
+func readReportStatus(r *pktline.Reader) (*PushResult, error) {
+	line, err := r.ReadLine()
+	if err != nil {
+		return nil, fmt.Errorf("error reading push status: %w", err)
+	}
+	unpack, ok := strings.CutPrefix(line, "unpack ")
+	if !ok {
+		return nil, fmt.Errorf("unexpected push status %q", line)
+	}
+
+	result := &PushResult{}
+	if unpack != "ok" {
+		result.UnpackError = unpack
+	}
+	for {
+		line, err := r.ReadLine()
+		if err == io.EOF {
+			return result, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading push status: %w", err)
+		}
+
+		status, rest, _ := strings.Cut(line, " ")
+		switch status {
+		case "ok":
+			result.Refs = append(result.Refs, RefStatus{Name: rest})
+		case "ng":
+			name, reason, _ := strings.Cut(rest, " ")
+			if reason == "" {
+				reason = "failed"
+			}
+			result.Refs = append(result.Refs, RefStatus{Name: name, Error: reason})
+		default:
+			return nil, fmt.Errorf("unexpected push status %q", line)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package transport
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/object"
+	"github.com/codecrafters-io/git-starter-go/pktline"
+)
+
+// commandRequest starts a protocol v2 command request: the command,
+// its capabilities and the delimiter before the arguments.
+func commandRequest(adv *Advertisement, command string) (*bytes.Buffer, *pktline.Writer) {
+	var body bytes.Buffer
+	w := pktline.NewWriter(&body)
+	w.Writef("command=%s\n", command)
+	if adv.Capabilities.Has("agent") {
+		w.Writef("agent=%s\n", userAgent)
+	}
+	if formats := adv.Capabilities.Values("object-format"); len(formats) > 0 {
+		w.Writef("object-format=%s\n", formats[0])
+	}
+	w.Delim()
+	return &body, w
+}
+
+// lsRefs runs the protocol v2 ls-refs command.
+func (c *Client) lsRefs(adv *Advertisement, prefixes []string) ([]Ref, error) {
+	if !adv.Capabilities.Has("ls-refs") {
+		return nil, fmt.Errorf("server does not support ls-refs")
+	}
+
+	body, w := commandRequest(adv, "ls-refs")
+	w.WriteString("peel\n")
+	w.WriteString("symrefs\n")
+	if adv.Capabilities.HasFeature("ls-refs", "unborn") {
+		w.WriteString("unborn\n")
+	}
+	for _, prefix := range prefixes {
+		w.Writef("ref-prefix %s\n", prefix)
+	}
+	w.Flush()
+
+	respBody, err := c.post(UploadPackService, body, true)
+	if err != nil {
+		return nil, err
+	}
+	defer respBody.Close()
+
+	var refs []Ref
+	r := pktline.NewReader(respBody)
+	for {
+		line, err := r.ReadLine()
+		if err == io.EOF {
+			return refs, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading ls-refs response: %w", err)
+		}
+		if strings.HasPrefix(line, "ERR ") {
+			return nil, fmt.Errorf("%w: %s", pktline.ErrRemote, line[4:])
+		}
+		ref, err := parseLsRefsLine(line)
+		if err != nil {
+			return nil, err
+		}
+		refs = append(refs, ref)
+	}
+}
+
+// parseLsRefsLine parses "<oid> <name> [symref-target:<t>] [peeled:<oid>]".
+// Unborn refs are reported with "unborn" in place of the oid.
+func parseLsRefsLine(line string) (Ref, error) {
+	fields := strings.Split(line, " ")
+	if len(fields) < 2 || (fields[0] != "unborn" && !object.ValidHash(fields[0])) {
+		return Ref{}, fmt.Errorf("malformed ls-refs line %q", line)
+	}
+
+	ref := Ref{Name: fields[1]}
+	if fields[0] != "unborn" {
+		ref.Hash = fields[0]
+	}
+	for _, attr := range fields[2:] {
+		if target, ok := strings.CutPrefix(attr, "symref-target:"); ok {
+			ref.Target = target
+		} else if peeled, ok := strings.CutPrefix(attr, "peeled:"); ok {
+			ref.Peeled = peeled
+		}
+	}
+	return ref, nil
+}
+
+// fetchV2 runs the protocol v2 fetch command, sending all haves at once
+// followed by "done" so the server replies with the pack directly.
+func (c *Client) fetchV2(adv *Advertisement, req FetchRequest) (*FetchResult, error) {
+	if !adv.Capabilities.Has("fetch") {
+		return nil, fmt.Errorf("server does not support fetch")
+	}
+	if req.Depth > 0 && !adv.Capabilities.HasFeature("fetch", "shallow") {
+		return nil, fmt.Errorf("server does not support shallow fetches")
+	}
+	if req.Filter != "" && !adv.Capabilities.HasFeature("fetch", "filter") {
+		return nil, fmt.Errorf("server does not support filters")
+	}
+
+	body, w := commandRequest(adv, "fetch")
+	w.WriteString("ofs-delta\n")
+	if c.Progress == nil {
+		w.WriteString("no-progress\n")
+	}
+	for _, shallow := range req.Shallows {
+		w.Writef("shallow %s\n", shallow)
+	}
+	if req.Depth > 0 {
+		w.Writef("deepen %d\n", req.Depth)
+	}
+	if req.Filter != "" {
+		w.Writef("filter %s\n", req.Filter)
+	}
+	for _, want := range req.Wants {
+		w.Writef("want %s\n", want)
+	}
+	for _, have := range req.Haves {
+		w.Writef("have %s\n", have)
+	}
+	w.WriteString("done\n")
+	w.Flush()
+
+	respBody, err := c.post(UploadPackService, body, true)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := c.readFetchResponse(respBody)
+	if err != nil {
+		respBody.Close()
+		return nil, err
+	}
+	return result, nil
+}
+
+// readFetchResponse reads the sections of a v2 fetch response up to the
+// packfile section, whose side-band stream becomes the result's Pack.
+func (c *Client) readFetchResponse(body io.ReadCloser) (*FetchResult, error) {
+	result := &FetchResult{}
+	r := pktline.NewReader(body)
+	section := ""
+	for {
+		t, payload, err := r.ReadPacket()
+		if err != nil {
+			return nil, fmt.Errorf("error reading fetch response: %w", err)
+		}
+		switch t {
+		case pktline.Delim:
+			section = ""
+			continue
+		case pktline.Flush, pktline.ResponseEnd:
+			return nil, fmt.Errorf("fetch response ended without a packfile")
+		}
+
+		line := strings.TrimSuffix(string(payload), "\n")
+		if strings.HasPrefix(line, "ERR ") {
+			return nil, fmt.Errorf("%w: %s", pktline.ErrRemote, line[4:])
+		}
+		if section == "" {
+			section = line
+			if section == "packfile" {
+				pack := pktline.NewSidebandReader(r, c.Progress)
+				result.Pack = readCloser{pack, body}
+				return result, nil
+			}
+			continue
+		}
+
+		if section == "shallow-info" {
+			kind, hash, _ := strings.Cut(line, " ")
+			switch kind {
+			case "shallow":
+				result.Shallow = append(result.Shallow, hash)
+			case "unshallow":
+				result.Unshallow = append(result.Unshallow, hash)
+			}
+		}
+	}
+}